@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"os"
+	"synapmentor/internal/auth"
+)
+
+const keygenUsage = "usage: server keygen [rsa|ed25519] <path>"
+
+// runKeygenCommand implements `server keygen`, writing a new JWT signing key
+// for JWT_PRIVATE_KEY_FILE
+func runKeygenCommand(args []string) {
+	algorithm := auth.AlgorithmEd25519
+	if len(args) == 2 {
+		algorithm, args = args[0], args[1:]
+	}
+	if len(args) != 1 {
+		log.Fatal(keygenUsage)
+	}
+
+	pemData, kid, err := auth.GenerateKey(algorithm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// O_EXCL so an existing key is never overwritten by accident
+	f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Fatal("Failed to create key file:", err)
+	}
+	if _, err := f.Write(pemData); err != nil {
+		f.Close()
+		log.Fatal("Failed to write key file:", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal("Failed to write key file:", err)
+	}
+
+	log.Printf("Wrote %s key %s to %s", algorithm, kid, args[0])
+}
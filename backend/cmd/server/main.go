@@ -1,10 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"synapmentor/internal/auth"
 	"synapmentor/internal/database"
 	"synapmentor/internal/handlers"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/mail"
 	"synapmentor/internal/middleware"
+	"synapmentor/internal/models"
+	"synapmentor/internal/oauth"
+	"synapmentor/internal/payouts"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/reminders"
+	"synapmentor/internal/repository"
+	"synapmentor/internal/sms"
+	"time"
+	_ "time/tzdata" // IANA zones for user time zones, even without system tzdata
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,11 +31,63 @@ func main() {
 		log.Println("No .env file found, using default values")
 	}
 
+	// Schema management subcommand: server migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+
+	// Key management subcommand: server keygen [rsa|ed25519] <path>
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		runKeygenCommand(os.Args[2:])
+		return
+	}
+
+	// Tokens cannot be issued or checked without a signing key
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal("Failed to load JWT keys: ", err)
+	}
+
 	// Initialize database
 	if err := database.InitDatabase(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure mail: ", err)
+	}
+	texts, err := sms.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure SMS: ", err)
+	}
+
+	// Wire repositories into the HTTP handlers
+	repos := repository.New(database.DB, ledger.PolicyFromEnv())
+	twoFactor := auth.TwoFactorPolicyFromEnv()
+	providers, err := oauth.ProvidersFromEnv(handlers.OAuthRedirectURL)
+	if err != nil {
+		log.Fatal("Failed to configure OAuth providers: ", err)
+	}
+	h := handlers.New(repos, mailer, texts, twoFactor, providers, policy.FromEnv())
+
+	// Remind attendees of upcoming events in the background
+	go (&reminders.Worker{
+		Events:        repos.Events,
+		Users:         repos.Users,
+		Notifications: repos.Notifications,
+		Mailer:        mailer,
+		Lead:          reminders.LeadFromEnv(),
+		Interval:      time.Minute,
+	}).Run(context.Background())
+
+	// Pay organizers for ticketed events once they are over
+	go (&payouts.Worker{
+		Events:        repos.Events,
+		Notifications: repos.Notifications,
+		Interval:      5 * time.Minute,
+	}).Run(context.Background())
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -29,7 +95,7 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:5175", "http://localhost:5176", "http://localhost:5177", "http://localhost:5178", "http://localhost:5179", "http://localhost:5180", "http://localhost:3000", "http://localhost:4173", "http://localhost:8080", "http://localhost"}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"}
 	config.AllowCredentials = true
 	r.Use(cors.New(config))
 
@@ -42,76 +108,178 @@ func main() {
 		})
 	})
 
+	// Public keys for services verifying our access tokens
+	r.GET("/.well-known/jwks.json", h.GetJWKS)
+
 	// API routes
 	api := r.Group("/api/v1")
 
 	// Public routes (no authentication required)
 	public := api.Group("/")
 	{
-		public.POST("/register", handlers.Register)
-		public.POST("/login", handlers.Login)
-		public.POST("/refresh-token", handlers.RefreshToken)
-		public.GET("/leaderboard", handlers.GetLeaderboard)
+		public.POST("/register", h.Register)
+		public.POST("/login", h.Login)
+		public.POST("/login/2fa", h.LoginTwoFactor)
+		public.POST("/refresh-token", h.RefreshToken)
+		public.POST("/logout", h.Logout)
+		public.POST("/verify-email", h.VerifyEmail)
+		public.POST("/forgot-password", h.ForgotPassword)
+		public.POST("/reset-password", h.ResetPassword)
+		public.GET("/oauth/providers", h.GetOAuthProviders)
+		public.POST("/oauth/:provider/authorize", h.AuthorizeOAuth)
+		public.POST("/oauth/:provider/callback", h.OAuthCallback)
+		public.GET("/leaderboard", h.GetLeaderboard)
+		public.GET("/ical/:token", h.GetCalendarFeed)
 	}
 
 	// Protected routes (authentication required)
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(repos.Logins, repos.APIKeys))
 	{
 		// User profile routes
-		protected.GET("/profile", handlers.GetProfile)
-		protected.PUT("/profile", handlers.UpdateProfile)
+		protected.GET("/profile", h.GetProfile)
+		protected.PUT("/profile", h.UpdateProfile)
+		protected.POST("/verify-email/resend", h.ResendVerificationEmail)
+		protected.PUT("/password", h.ChangePassword)
+		protected.POST("/phone/send-code", h.SendPhoneCode)
+		protected.POST("/phone/verify", h.VerifyPhone)
+		protected.GET("/verification", h.GetVerification)
+		protected.POST("/verification/documents", h.SubmitIDDocument)
+		protected.GET("/roles", h.GetMyRoles)
+		protected.POST("/roles", h.AddRole)
+
+		// Personal API keys
+		protected.GET("/api-keys", h.GetAPIKeys)
+		protected.POST("/api-keys", h.CreateAPIKey)
+		protected.DELETE("/api-keys/:id", h.RevokeAPIKey)
+
+		// Signed-in devices
+		protected.GET("/login-sessions", h.GetLoginSessions)
+		protected.DELETE("/login-sessions", h.RevokeOtherLoginSessions)
+		protected.DELETE("/login-sessions/:id", h.RevokeLoginSession)
+
+		// Two-factor authentication
+		protected.GET("/2fa", h.GetTwoFactorStatus)
+		protected.POST("/2fa/setup", h.SetupTwoFactor)
+		protected.POST("/2fa/enable", h.EnableTwoFactor)
+		protected.POST("/2fa/disable", h.DisableTwoFactor)
+		protected.POST("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+		protected.GET("/identities", h.GetIdentities)
+		protected.POST("/identities/:provider/link", h.LinkIdentity)
+		protected.POST("/identities/:provider/callback", h.LinkIdentityCallback)
+		protected.DELETE("/identities/:id", h.UnlinkIdentity)
 
 		// Dashboard routes
-		protected.GET("/dashboard/stats", handlers.GetDashboardStats)
-		protected.GET("/dashboard/recent-sessions", handlers.GetRecentSessions)
-		protected.GET("/dashboard/upcoming-sessions", handlers.GetUpcomingSessions)
-		protected.GET("/dashboard/analytics", handlers.GetAnalytics)
+		protected.GET("/dashboard/stats", h.GetDashboardStats)
+		protected.GET("/dashboard/recent-sessions", h.GetRecentSessions)
+		protected.GET("/dashboard/upcoming-sessions", h.GetUpcomingSessions)
+		protected.GET("/dashboard/analytics", h.GetAnalytics)
 
 		// Session routes
-		protected.GET("/sessions", handlers.GetSessions)
-		protected.POST("/sessions", handlers.CreateSession)
-		protected.GET("/sessions/:id", handlers.GetSession)
-		protected.PUT("/sessions/:id", handlers.UpdateSession)
-		protected.DELETE("/sessions/:id", handlers.DeleteSession)
+		protected.GET("/sessions", h.GetSessions)
+		protected.POST("/sessions", h.CreateSession)
+		protected.GET("/sessions/:id", h.GetSession)
+		protected.PUT("/sessions/:id", h.UpdateSession)
+		protected.DELETE("/sessions/:id", h.DeleteSession)
+		protected.POST("/sessions/:id/pay", h.PaySession)
+		protected.POST("/sessions/:id/confirm", h.ConfirmSession)
+		protected.POST("/sessions/:id/start", h.StartSession)
+		protected.POST("/sessions/:id/complete", h.CompleteSession)
+		protected.POST("/sessions/:id/cancel", h.CancelSession)
+		protected.POST("/sessions/:id/no-show", h.ReportNoShow)
+		protected.POST("/sessions/:id/rate", h.RateSession)
+		protected.GET("/sessions/:id/history", h.GetSessionHistory)
+		protected.GET("/sessions/:id/ics", h.GetSessionICS)
+		protected.GET("/series/:id", h.GetSeries)
+		protected.PUT("/series/:id", h.UpdateSeries)
+		protected.POST("/series/:id/cancel", h.CancelSeries)
+
+		// Calendar feed routes
+		protected.POST("/calendar/feed", h.CreateCalendarFeed)
+		protected.DELETE("/calendar/feed", h.DeleteCalendarFeed)
+
+		// Availability routes
+		protected.GET("/availability", h.GetAvailability)
+		protected.PUT("/availability/rules", h.ReplaceAvailabilityRules)
+		protected.POST("/availability/exceptions", h.AddAvailabilityException)
+		protected.DELETE("/availability/exceptions/:id", h.DeleteAvailabilityException)
+		protected.GET("/solvers/:id/slots", h.GetSolverSlots)
 
 		// Content routes
-		protected.GET("/content", handlers.GetContent)
-		protected.POST("/content", handlers.CreateContent)
-		protected.GET("/content/:id", handlers.GetContentByID)
-		protected.PUT("/content/:id", handlers.UpdateContent)
-		protected.DELETE("/content/:id", handlers.DeleteContent)
+		protected.GET("/content", h.GetContent)
+		protected.POST("/content", h.CreateContent)
+		protected.GET("/content/:id", h.GetContentByID)
+		protected.PUT("/content/:id", h.UpdateContent)
+		protected.DELETE("/content/:id", h.DeleteContent)
 
 		// Wallet routes
-		protected.GET("/wallet", handlers.GetWallet)
-		protected.GET("/wallet/transactions", handlers.GetTransactions)
-		protected.POST("/wallet/transfer", handlers.TransferFunds)
+		protected.GET("/wallet", h.GetWallet)
+		protected.GET("/wallet/transactions", h.GetTransactions)
+		protected.POST("/wallet/transfer", h.TransferFunds)
 
 		// Notification routes
-		protected.GET("/notifications", handlers.GetNotifications)
-		protected.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
-		protected.DELETE("/notifications/:id", handlers.DeleteNotification)
+		protected.GET("/notifications", h.GetNotifications)
+		protected.PUT("/notifications/:id/read", h.MarkNotificationRead)
+		protected.DELETE("/notifications/:id", h.DeleteNotification)
 
 		// Community routes
-		protected.GET("/community/discussions", handlers.GetDiscussions)
-		protected.POST("/community/discussions", handlers.CreateDiscussion)
-		protected.GET("/community/events", handlers.GetEvents)
-		protected.POST("/community/events", handlers.CreateEvent)
+		protected.GET("/community/communities", h.GetCommunities)
+		protected.POST("/community/communities", h.CreateCommunity)
+		protected.GET("/community/communities/:id", h.GetCommunity)
+		protected.PUT("/community/communities/:id", h.UpdateCommunity)
+		protected.DELETE("/community/communities/:id", h.DeleteCommunity)
+		protected.POST("/community/communities/:id/join", h.JoinCommunity)
+		protected.POST("/community/communities/:id/leave", h.LeaveCommunity)
+		protected.GET("/community/communities/:id/members", h.GetCommunityMembers)
+		protected.PUT("/community/communities/:id/members/:user_id", h.SetCommunityMemberRole)
+		protected.GET("/community/communities/:id/discussions", h.GetDiscussions)
+		protected.POST("/community/communities/:id/discussions", h.CreateDiscussion)
+		protected.GET("/community/discussions", h.GetDiscussions)
+		protected.POST("/community/discussions", h.CreateDiscussion)
+		protected.GET("/community/discussions/:id", h.GetDiscussion)
+		protected.PUT("/community/discussions/:id", h.UpdateDiscussion)
+		protected.DELETE("/community/discussions/:id", h.DeleteDiscussion)
+		protected.GET("/community/discussions/:id/replies", h.GetReplies)
+		protected.POST("/community/discussions/:id/replies", h.CreateReply)
+		protected.PUT("/community/replies/:id", h.UpdateReply)
+		protected.DELETE("/community/replies/:id", h.DeleteReply)
+		protected.GET("/community/events", h.GetEvents)
+		protected.POST("/community/events", h.CreateEvent)
+		protected.GET("/community/events/:id", h.GetEvent)
+		protected.PUT("/community/events/:id", h.UpdateEvent)
+		protected.DELETE("/community/events/:id", h.DeleteEvent)
+		protected.POST("/community/events/:id/rsvp", h.RSVPEvent)
+		protected.DELETE("/community/events/:id/rsvp", h.CancelEventRSVP)
+		protected.GET("/community/events/:id/attendees", h.GetEventAttendees)
 
 		// Settings routes
-		protected.GET("/settings", handlers.GetSettings)
-		protected.PUT("/settings", handlers.UpdateSettings)
+		protected.GET("/settings", h.GetSettings)
+		protected.PUT("/settings", h.UpdateSettings)
 	}
 
-	// Admin routes (admin role required)
+	// Admin routes (staff roles; each route needs its own permission)
 	admin := api.Group("/admin")
-	admin.Use(middleware.AuthMiddleware())
-	admin.Use(middleware.RequireRole("admin"))
+	admin.Use(middleware.AuthMiddleware(repos.Logins, repos.APIKeys))
+	if twoFactor.Admin {
+		admin.Use(middleware.RequireTwoFactor())
+	}
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(repos.Roles, permission)
+	}
 	{
-		admin.GET("/users", handlers.GetAllUsers)
-		admin.PUT("/users/:id/status", handlers.UpdateUserStatus)
-		admin.GET("/sessions/all", handlers.GetAllSessions)
-		admin.GET("/analytics/platform", handlers.GetPlatformAnalytics)
+		admin.GET("/users", can(models.PermUsersRead), h.GetAllUsers)
+		admin.PUT("/users/:id/status", can(models.PermUsersSuspend), h.UpdateUserStatus)
+		admin.POST("/users/:id/unlock", can(models.PermUsersUnlock), h.UnlockUser)
+		admin.POST("/users/:id/roles", can(models.PermRolesManage), h.GrantRole)
+		admin.DELETE("/users/:id/roles/:role", can(models.PermRolesManage), h.RevokeRole)
+		admin.GET("/roles", can(models.PermRolesManage), h.GetRoles)
+		admin.GET("/login-attempts", can(models.PermLoginAttemptsRead), h.GetLoginAttempts)
+		admin.GET("/verification/documents", can(models.PermIdentityReview), h.GetIDDocuments)
+		admin.GET("/verification/documents/:id/file", can(models.PermIdentityReview), h.GetIDDocumentFile)
+		admin.POST("/verification/documents/:id/review", can(models.PermIdentityReview), h.ReviewIDDocument)
+		admin.GET("/sessions/all", can(models.PermSessionsReadAny), h.GetAllSessions)
+		admin.GET("/analytics/platform", can(models.PermAnalyticsRead), h.GetPlatformAnalytics)
+		admin.GET("/ledger/reconcile", can(models.PermLedgerReconcile), h.ReconcileLedger)
 	}
 
 	log.Println("Server starting on :8081")
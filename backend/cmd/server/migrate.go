@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"synapmentor/internal/database"
+	"text/tabwriter"
+)
+
+const migrateUsage = "usage: server migrate up | down [steps] | status"
+
+// runMigrateCommand implements `server migrate up|down|status`
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	if err := database.Connect(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp()
+		if err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatal(migrateUsage)
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(steps)
+		if err != nil {
+			log.Fatal("Rollback failed:", err)
+		}
+		log.Printf("Reverted %d migration(s)", reverted)
+
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			log.Fatal("Failed to read migration status:", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range states {
+			status, appliedAt := "pending", "-"
+			if s.Applied {
+				status = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				status += " (modified)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EmailTokenTTL is how long an email verification link stays valid
+const EmailTokenTTL = 24 * time.Hour
+
+// emailClaims identify the user and the address being verified, so a link
+// stops working once the account's email changes
+type emailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateEmailToken signs an expiring token proving control of email
+func GenerateEmailToken(userID int, email string) (string, error) {
+	now := time.Now()
+	return sign(&emailClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			ExpiresAt: jwt.NewNumericDate(now.Add(EmailTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "synapmentor",
+			Audience:  jwt.ClaimStrings{audienceEmailVerification},
+		},
+	})
+}
+
+// ValidateEmailToken returns the user and address an email token was issued for
+func ValidateEmailToken(token string) (userID int, email string, err error) {
+	claims := &emailClaims{}
+	if err := parse(token, claims, audienceEmailVerification); err != nil {
+		return 0, "", err
+	}
+	userID, err = strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, claims.Email, nil
+}
@@ -2,80 +2,105 @@ package auth
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
+// AccessTokenTTL is how long an access token is accepted; clients renew it
+// with a refresh token
+const AccessTokenTTL = 15 * time.Minute
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-super-secret-jwt-key-change-this-in-production"
-	}
-	jwtSecret = []byte(secret)
-}
+// RefreshTokenTTL is how long a refresh token may be exchanged, so a login
+// lapses after this long without activity
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Token audiences keep a token signed for one purpose from being accepted
+// for another
+const (
+	audienceAccess             = "synapmentor-api"
+	audienceEmailVerification  = "synapmentor-email-verification"
+	audienceTwoFactorChallenge = "synapmentor-2fa-challenge"
+)
 
 // Claims represents the JWT claims
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    int      `json:"user_id"`
+	SessionID int      `json:"sid"` // login session the token was issued to
+	Email     string   `json:"email"`
+	Role      string   `json:"role"`          // primary role
+	Roles     []string `json:"roles"`         // every role held
+	TwoFactor bool     `json:"mfa,omitempty"` // the login passed a second factor
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token for a user
-func GenerateToken(userID int, email, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// GenerateToken generates a new JWT token for a user's login session;
+// twoFactor records whether that login passed a second factor
+func GenerateToken(userID, sessionID int, email, role string, roles []string, twoFactor bool) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 	
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		SessionID: sessionID,
+		Email:     email,
+		Role:      role,
+		Roles:     roles,
+		TwoFactor: twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "synapmentor",
+			Audience:  jwt.ClaimStrings{audienceAccess},
 		},
 	}
 	
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", err
+	return sign(claims)
+}
+
+// sign signs claims with the current key, naming it in the kid header
+func sign(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", ErrNoSigningKey
 	}
-	
-	return tokenString, nil
+	token := jwt.NewWithClaims(keys.current.method, claims)
+	token.Header["kid"] = keys.current.id
+	return token.SignedString(keys.current.private)
 }
 
 // ValidateToken validates a JWT token and returns the claims
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	
-	if err != nil {
+	if err := parse(tokenString, claims, audienceAccess); err != nil {
 		return nil, err
 	}
-	
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-	
 	return claims, nil
 }
 
-// RefreshToken generates a new token with extended expiration
-func RefreshToken(tokenString string) (string, error) {
-	claims, err := ValidateToken(tokenString)
+// parse verifies a token signed by sign and meant for audience into claims
+func parse(tokenString string, claims jwt.Claims, audience string) error {
+	if keys == nil {
+		return ErrNoSigningKey
+	}
+
+	// The kid picks the key; tokens signed with a key that has been rotated
+	// out, or with any other algorithm than that key's, are rejected
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := keys.lookup(kid)
+		if key == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer("synapmentor"), jwt.WithAudience(audience))
 	if err != nil {
-		return "", err
+		return err
 	}
-	
-	// Generate new token with same claims but extended expiration
-	return GenerateToken(claims.UserID, claims.Email, claims.Role)
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
 }
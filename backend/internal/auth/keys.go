@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key algorithms accepted by GenerateKey
+const (
+	AlgorithmRSA     = "rsa"
+	AlgorithmEd25519 = "ed25519"
+)
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 3072
+
+// ErrNoSigningKey is returned when no signing key has been configured
+var ErrNoSigningKey = errors.New("no JWT signing key configured: set JWT_PRIVATE_KEY_FILE (generate one with `server keygen`)")
+
+// signingKey is one key pair tokens are signed or verified with
+type signingKey struct {
+	id      string // the kid header of tokens it signs
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for keys that only verify
+	public  crypto.PublicKey
+}
+
+// keySet holds the key new tokens are signed with and the previous keys
+// whose tokens are still accepted while a rotation completes
+type keySet struct {
+	current      *signingKey
+	previous     []*signingKey
+	previousEnds time.Time // zero while previous keys have no end of window
+}
+
+// active returns the keys tokens are verified with right now, current first
+func (s *keySet) active() []*signingKey {
+	if !s.previousEnds.IsZero() && time.Now().After(s.previousEnds) {
+		return []*signingKey{s.current}
+	}
+	return append([]*signingKey{s.current}, s.previous...)
+}
+
+// lookup returns the active key with the given kid
+func (s *keySet) lookup(kid string) *signingKey {
+	for _, k := range s.active() {
+		if k.id == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+var keys *keySet
+
+// LoadKeys reads the signing key from JWT_PRIVATE_KEY_FILE and any keys being
+// rotated out from JWT_PREVIOUS_KEY_FILES (comma separated; public or private
+// PEM files). Previous keys are honoured until JWT_PREVIOUS_KEYS_UNTIL (an
+// RFC 3339 time) when it is set. The server must not start when it fails.
+func LoadKeys() error {
+	path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if path == "" {
+		return ErrNoSigningKey
+	}
+
+	current, err := readKeyFile(path)
+	if err != nil {
+		return err
+	}
+	if current.private == nil {
+		return fmt.Errorf("%s: JWT_PRIVATE_KEY_FILE must contain a private key", path)
+	}
+
+	set := &keySet{current: current}
+	for _, path := range strings.Split(os.Getenv("JWT_PREVIOUS_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		previous, err := readKeyFile(path)
+		if err != nil {
+			return err
+		}
+		set.previous = append(set.previous, previous)
+	}
+
+	if until := os.Getenv("JWT_PREVIOUS_KEYS_UNTIL"); until != "" {
+		set.previousEnds, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fmt.Errorf("JWT_PREVIOUS_KEYS_UNTIL: %w", err)
+		}
+	}
+
+	keys = set
+	return nil
+}
+
+// readKeyFile parses a PEM encoded RSA or Ed25519 key, private or public
+func readKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: not a PEM file", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &signingKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+
+	key.id, err = keyID(key.public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// keyID derives a stable kid from the public key, so the same key always
+// has the same id on every server
+func keyID(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// GenerateKey creates a new private key for algorithm and returns it PEM
+// encoded together with its kid
+func GenerateKey(algorithm string) (pemData []byte, kid string, err error) {
+	var private crypto.Signer
+	switch algorithm {
+	case AlgorithmRSA:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEd25519:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, "", fmt.Errorf("unknown key algorithm %q (use rsa or ed25519)", algorithm)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, "", err
+	}
+	kid, err = keyID(private.Public())
+	if err != nil {
+		return nil, "", err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), kid, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns every key tokens are currently verified with, so that
+// other services can verify tokens across a rotation
+func PublicKeys() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if keys == nil {
+		return set
+	}
+
+	for _, k := range keys.active() {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
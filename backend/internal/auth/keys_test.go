@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey generates an Ed25519 key into dir and returns its path and kid
+func writeKey(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	key, kid, err := GenerateKey(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, kid
+}
+
+// loadKeys configures the key set from the environment, restoring the
+// previous one when the test ends
+func loadKeys(t *testing.T, current, previous, until string) {
+	t.Helper()
+	saved := keys
+	t.Cleanup(func() { keys = saved })
+	t.Setenv("JWT_PRIVATE_KEY_FILE", current)
+	t.Setenv("JWT_PREVIOUS_KEY_FILES", previous)
+	t.Setenv("JWT_PREVIOUS_KEYS_UNTIL", until)
+	if err := LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, oldKid := writeKey(t, dir, "old.pem")
+	newPath, newKid := writeKey(t, dir, "new.pem")
+
+	loadKeys(t, oldPath, "", "")
+	issued, err := GenerateToken(1, 2, "user@example.com", "seeker", []string{"seeker"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// During the rotation the old key's tokens are still accepted and both
+	// keys are published, the new one first
+	loadKeys(t, newPath, oldPath, time.Now().Add(time.Hour).Format(time.RFC3339))
+	if claims, err := ValidateToken(issued); err != nil || claims.UserID != 1 || claims.SessionID != 2 {
+		t.Fatalf("token from the previous key = %+v, %v", claims, err)
+	}
+	published := PublicKeys().Keys
+	if len(published) != 2 || published[0].Kid != newKid || published[1].Kid != oldKid {
+		t.Errorf("PublicKeys() = %+v, want %s then %s", published, newKid, oldKid)
+	}
+	fresh, err := GenerateToken(1, 2, "user@example.com", "seeker", []string{"seeker"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _, _ := jwt.NewParser().ParseUnverified(fresh, &Claims{}); token.Header["kid"] != newKid {
+		t.Errorf("new tokens are signed with %v, want %s", token.Header["kid"], newKid)
+	}
+
+	// Once the window ends the old key is dropped
+	loadKeys(t, newPath, oldPath, time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if _, err := ValidateToken(issued); err == nil {
+		t.Error("token from an expired previous key was accepted")
+	}
+	if published := PublicKeys().Keys; len(published) != 1 {
+		t.Errorf("PublicKeys() after the window = %+v, want the current key only", published)
+	}
+	if _, err := ValidateToken(fresh); err != nil {
+		t.Errorf("token from the current key: %v", err)
+	}
+}
+
+func TestValidateTokenRejectsOtherAlgorithms(t *testing.T) {
+	path, kid := writeKey(t, t.TempDir(), "key.pem")
+	loadKeys(t, path, "", "")
+
+	// A token MACed with a shared secret under the right kid must not pass
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           1,
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "synapmentor"},
+	})
+	token.Header["kid"] = kid
+	forged, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(forged); err == nil {
+		t.Error("HS256 token was accepted")
+	}
+}
+
+func TestLoadKeysNeedsPrivateKey(t *testing.T) {
+	saved := keys
+	t.Cleanup(func() { keys = saved })
+	t.Setenv("JWT_PRIVATE_KEY_FILE", "")
+	if err := LoadKeys(); err != ErrNoSigningKey {
+		t.Errorf("LoadKeys() without a key = %v, want ErrNoSigningKey", err)
+	}
+}
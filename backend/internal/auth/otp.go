@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// phoneCodeDigits is the length of a one-time code sent by text message
+const phoneCodeDigits = 6
+
+// NewPhoneCode returns a random numeric one-time code
+func NewPhoneCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < phoneCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", phoneCodeDigits, n), nil
+}
+
+// HashPhoneCode returns the stored form of a one-time code sent to a user;
+// mixing in the user keeps equal codes for different users apart
+func HashPhoneCode(userID int, code string) string {
+	return HashToken(strconv.Itoa(userID) + ":" + code)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TOTP parameters (RFC 6238); they are the defaults every authenticator app
+// understands, so the otpauth URI does not need to spell them out
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // steps either side of now that are still accepted
+	totpIssuer = "SynapMentor"
+)
+
+// RecoveryCodeCount is how many recovery codes a user is given at a time
+const RecoveryCodeCount = 10
+
+// ChallengeTokenTTL is how long a user has to enter their second factor
+// after giving the right password
+const ChallengeTokenTTL = 5 * time.Minute
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret, base32 encoded as
+// authenticator apps expect
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI that enrolls secret for account in an
+// authenticator app, usually shown as a QR code
+func TOTPURI(secret, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ValidateTOTP checks code against secret at time at, allowing for a little
+// clock drift, and returns the time step it matched. Callers store the step
+// and reject codes for steps already used, so a code works only once.
+func ValidateTOTP(secret, code string, at time.Time) (step int64, ok bool) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := at.Unix() / int64(totpPeriod.Seconds())
+	for s := now - totpSkew; s <= now+totpSkew; s++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) of key for counter
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// NewRecoveryCodes returns RecoveryCodeCount single-use codes shaped like
+// "k7qm-2xfp-wd3a" together with the hashes to store in their place
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789" // no look-alike characters
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		var code strings.Builder
+		for j, c := range b {
+			if j > 0 && j%4 == 0 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(alphabet[int(c)%len(alphabet)])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, HashRecoveryCode(code.String()))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the stored form of a recovery code, ignoring case,
+// spaces and dashes so it can be typed back however is convenient
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(code)
+}
+
+// challengeClaims identify a user who has given the right password but still
+// has to give their second factor
+type challengeClaims struct {
+	jwt.RegisteredClaims
+}
+
+// GenerateChallengeToken signs a short-lived token that lets userID finish
+// signing in with a second factor
+func GenerateChallengeToken(userID int) (string, error) {
+	now := time.Now()
+	return sign(&challengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "synapmentor",
+			Audience:  jwt.ClaimStrings{audienceTwoFactorChallenge},
+		},
+	})
+}
+
+// ValidateChallengeToken returns the user a challenge token was issued to
+func ValidateChallengeToken(token string) (int, error) {
+	claims := &challengeClaims{}
+	if err := parse(token, claims, audienceTwoFactorChallenge); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// TwoFactorPolicy says where a second factor is mandatory
+type TwoFactorPolicy struct {
+	Admin       bool // admin routes need a login that passed a second factor
+	Withdrawals bool // wallet withdrawals need a fresh authenticator code
+}
+
+// TwoFactorPolicyFromEnv reads REQUIRE_2FA_ADMIN and REQUIRE_2FA_WITHDRAWALS;
+// both are off unless set to true
+func TwoFactorPolicyFromEnv() TwoFactorPolicy {
+	enabled := func(key string) bool {
+		v, _ := strconv.ParseBool(os.Getenv(key))
+		return v
+	}
+	return TwoFactorPolicy{
+		Admin:       enabled("REQUIRE_2FA_ADMIN"),
+		Withdrawals: enabled("REQUIRE_2FA_WITHDRAWALS"),
+	}
+}
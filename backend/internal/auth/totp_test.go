@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfcSecret, tt.code, at)
+		if !ok {
+			t.Errorf("ValidateTOTP(%s at %d) rejected the RFC code", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / 30; step != want {
+			t.Errorf("ValidateTOTP(%s at %d) matched step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+
+	// Secrets are accepted in lower case too, as some apps show them
+	if _, ok := ValidateTOTP(strings.ToLower(rfcSecret), "287082", time.Unix(59, 0)); !ok {
+		t.Error("lower-case secret rejected")
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	key, err := secretEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / 30
+
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, totpCode(key, current+tt.offset), now)
+		if ok != tt.ok {
+			t.Errorf("code for step %+d accepted = %v, want %v", tt.offset, ok, tt.ok)
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("code for step %+d matched step %d", tt.offset, step-current)
+		}
+	}
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now); ok {
+			t.Errorf("malformed code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", now); ok {
+		t.Error("code accepted for an undecodable secret")
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 14 || strings.Count(code, "-") != 2 {
+			t.Errorf("code %q is not shaped xxxx-xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash %d does not match its code", i)
+		}
+		// However the user types it back, it hashes the same
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("%q does not hash like %q", typed, code)
+		}
+	}
+}
+
+func TestChallengeTokenIsNotAnAccessToken(t *testing.T) {
+	path, _ := writeKey(t, t.TempDir(), "key.pem")
+	loadKeys(t, path, "", "")
+
+	challenge, err := GenerateChallengeToken(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := ValidateChallengeToken(challenge); err != nil || userID != 4 {
+		t.Fatalf("ValidateChallengeToken() = %d, %v, want 4", userID, err)
+	}
+	if _, err := ValidateToken(challenge); err == nil {
+		t.Error("challenge token accepted as an access token")
+	}
+
+	access, err := GenerateToken(4, 1, "user@example.com", "seeker", []string{"seeker"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateChallengeToken(access); err == nil {
+		t.Error("access token accepted as a challenge token")
+	}
+}
@@ -0,0 +1,182 @@
+// Package availability turns a solver's weekly availability rules and dated
+// exceptions into concrete open time slots
+package availability
+
+import (
+	"sort"
+	"time"
+)
+
+// SlotStep is the spacing between candidate slot start times
+const SlotStep = 30 * time.Minute
+
+// Rule is a recurring weekly window, in minutes since midnight in the
+// solver's own time zone
+type Rule struct {
+	ID          int          `json:"id"`
+	Weekday     time.Weekday `json:"weekday" binding:"min=0,max=6"`
+	StartMinute int          `json:"start_minute" binding:"min=0,max=1440"`
+	EndMinute   int          `json:"end_minute" binding:"min=0,max=1440,gtfield=StartMinute"`
+}
+
+// Exception overrides the weekly rules for a dated period: it either blocks
+// time the rules would offer or opens extra time outside them
+type Exception struct {
+	ID        int       `json:"id"`
+	StartsAt  time.Time `json:"starts_at" binding:"required"`
+	EndsAt    time.Time `json:"ends_at" binding:"required,gtfield=StartsAt"`
+	Available bool      `json:"available"`
+	Reason    string    `json:"reason"`
+}
+
+// Interval is a half-open span of time [Start, End)
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Overlaps reports whether two intervals share any time
+func (i Interval) Overlaps(o Interval) bool {
+	return i.Start.Before(o.End) && o.Start.Before(i.End)
+}
+
+// contains reports whether o lies entirely within i
+func (i Interval) contains(o Interval) bool {
+	return !o.Start.Before(i.Start) && !o.End.After(i.End)
+}
+
+// Windows returns the merged open windows between from and to: the weekly
+// rules laid out on the calendar of loc, plus available exceptions, minus
+// unavailable exceptions. The windows are returned in UTC.
+func Windows(rules []Rule, exceptions []Exception, from, to time.Time, loc *time.Location) []Interval {
+	from, to = from.UTC(), to.UTC()
+
+	var open []Interval
+	local := from.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, r := range rules {
+			if r.Weekday != day.Weekday() {
+				continue
+			}
+			// Wall-clock times, so a window keeps its local hours across DST changes
+			open = append(open, Interval{
+				Start: atMinute(day, r.StartMinute).UTC(),
+				End:   atMinute(day, r.EndMinute).UTC(),
+			})
+		}
+	}
+	for _, e := range exceptions {
+		if e.Available {
+			open = append(open, Interval{Start: e.StartsAt.UTC(), End: e.EndsAt.UTC()})
+		}
+	}
+	open = merge(open)
+
+	for _, e := range exceptions {
+		if !e.Available {
+			open = subtract(open, Interval{Start: e.StartsAt.UTC(), End: e.EndsAt.UTC()})
+		}
+	}
+	return clip(open, Interval{Start: from, End: to})
+}
+
+// atMinute returns the wall-clock time a number of minutes after midnight of day
+func atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, day.Location())
+}
+
+// Slots returns the start-to-end slots of the given duration that fit inside
+// the open windows without overlapping any busy interval
+func Slots(windows, busy []Interval, duration time.Duration) []Interval {
+	slots := []Interval{}
+	for _, w := range windows {
+		start := w.Start.Truncate(SlotStep)
+		if start.Before(w.Start) {
+			start = start.Add(SlotStep)
+		}
+		for ; !start.Add(duration).After(w.End); start = start.Add(SlotStep) {
+			slot := Interval{Start: start, End: start.Add(duration)}
+			if !overlapsAny(slot, busy) {
+				slots = append(slots, slot)
+			}
+		}
+	}
+	return slots
+}
+
+// Covers reports whether an interval lies entirely within one open window
+func Covers(windows []Interval, i Interval) bool {
+	for _, w := range windows {
+		if w.contains(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapsAny(i Interval, others []Interval) bool {
+	for _, o := range others {
+		if i.Overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge sorts intervals and joins those that overlap or touch
+func merge(in []Interval) []Interval {
+	if len(in) == 0 {
+		return in
+	}
+	sort.Slice(in, func(a, b int) bool { return in[a].Start.Before(in[b].Start) })
+
+	out := []Interval{in[0]}
+	for _, i := range in[1:] {
+		last := &out[len(out)-1]
+		if !i.Start.After(last.End) {
+			if i.End.After(last.End) {
+				last.End = i.End
+			}
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// subtract removes a blocked interval from a set of windows
+func subtract(windows []Interval, blocked Interval) []Interval {
+	var out []Interval
+	for _, w := range windows {
+		if !w.Overlaps(blocked) {
+			out = append(out, w)
+			continue
+		}
+		if w.Start.Before(blocked.Start) {
+			out = append(out, Interval{Start: w.Start, End: blocked.Start})
+		}
+		if blocked.End.Before(w.End) {
+			out = append(out, Interval{Start: blocked.End, End: w.End})
+		}
+	}
+	return out
+}
+
+// clip trims windows to a bounding interval
+func clip(windows []Interval, bounds Interval) []Interval {
+	var out []Interval
+	for _, w := range windows {
+		if !w.Overlaps(bounds) {
+			continue
+		}
+		if w.Start.Before(bounds.Start) {
+			w.Start = bounds.Start
+		}
+		if w.End.After(bounds.End) {
+			w.End = bounds.End
+		}
+		out = append(out, w)
+	}
+	return out
+}
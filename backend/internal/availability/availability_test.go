@@ -0,0 +1,126 @@
+package availability
+
+import (
+	"testing"
+	"time"
+)
+
+// monday is a Monday at midnight UTC
+var monday = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func at(day, hour, minute int) time.Time {
+	return monday.AddDate(0, 0, day).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func TestWindows(t *testing.T) {
+	rules := []Rule{
+		{Weekday: time.Monday, StartMinute: 9 * 60, EndMinute: 12 * 60},
+		{Weekday: time.Monday, StartMinute: 12 * 60, EndMinute: 13 * 60}, // touches the first
+		{Weekday: time.Tuesday, StartMinute: 9 * 60, EndMinute: 17 * 60},
+	}
+
+	tests := []struct {
+		name       string
+		exceptions []Exception
+		from, to   time.Time
+		want       []Interval
+	}{
+		{"rules only", nil, at(0, 0, 0), at(2, 0, 0), []Interval{
+			{at(0, 9, 0), at(0, 13, 0)},
+			{at(1, 9, 0), at(1, 17, 0)},
+		}},
+		{"clipped to the period", nil, at(0, 10, 0), at(1, 10, 0), []Interval{
+			{at(0, 10, 0), at(0, 13, 0)},
+			{at(1, 9, 0), at(1, 10, 0)},
+		}},
+		{"blocked lunch", []Exception{{StartsAt: at(1, 12, 0), EndsAt: at(1, 13, 0)}}, at(1, 0, 0), at(2, 0, 0), []Interval{
+			{at(1, 9, 0), at(1, 12, 0)},
+			{at(1, 13, 0), at(1, 17, 0)},
+		}},
+		{"extra evening", []Exception{{StartsAt: at(0, 18, 0), EndsAt: at(0, 20, 0), Available: true}}, at(0, 0, 0), at(1, 0, 0), []Interval{
+			{at(0, 9, 0), at(0, 13, 0)},
+			{at(0, 18, 0), at(0, 20, 0)},
+		}},
+		{"day off", []Exception{{StartsAt: at(1, 0, 0), EndsAt: at(2, 0, 0)}}, at(1, 0, 0), at(2, 0, 0), nil},
+	}
+	for _, tt := range tests {
+		got := Windows(rules, tt.exceptions, tt.from, tt.to, time.UTC)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Windows() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+				t.Errorf("%s: Windows() = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// Rules are wall-clock hours in the solver's zone, so a window keeps its local
+// hours when daylight saving time starts
+func TestWindowsInSolverTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	rules := []Rule{
+		{Weekday: time.Friday, StartMinute: 9 * 60, EndMinute: 17 * 60},
+		{Weekday: time.Monday, StartMinute: 9 * 60, EndMinute: 17 * 60},
+	}
+
+	// Daylight saving time starts on Sunday 8 March 2026 in New York
+	got := Windows(rules, nil, at(4, 0, 0), at(8, 0, 0), loc)
+	want := []Interval{
+		{at(4, 14, 0), at(4, 22, 0)}, // EST, UTC-5
+		{at(7, 13, 0), at(7, 21, 0)}, // EDT, UTC-4
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Windows() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) {
+			t.Errorf("window %d = %v, want %v", i, got[i], want[i])
+		}
+		if got[i].Start.Location() != time.UTC {
+			t.Errorf("window %d is in %v, want UTC", i, got[i].Start.Location())
+		}
+	}
+}
+
+func TestSlots(t *testing.T) {
+	windows := []Interval{{at(0, 9, 15), at(0, 12, 0)}}
+	busy := []Interval{{at(0, 10, 30), at(0, 11, 0)}}
+
+	got := Slots(windows, busy, time.Hour)
+	want := []time.Time{at(0, 9, 30), at(0, 11, 0)}
+	if len(got) != len(want) {
+		t.Fatalf("Slots() = %v, want starts %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i]) || got[i].End.Sub(got[i].Start) != time.Hour {
+			t.Errorf("slot %d = %v, want an hour from %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	windows := []Interval{{at(0, 9, 0), at(0, 12, 0)}, {at(0, 13, 0), at(0, 17, 0)}}
+
+	tests := []struct {
+		slot Interval
+		want bool
+	}{
+		{Interval{at(0, 9, 0), at(0, 10, 0)}, true},
+		{Interval{at(0, 11, 0), at(0, 12, 0)}, true},
+		{Interval{at(0, 11, 30), at(0, 12, 30)}, false}, // runs past the window
+		{Interval{at(0, 11, 30), at(0, 13, 30)}, false}, // spans the gap
+		{Interval{at(0, 8, 30), at(0, 9, 30)}, false},
+	}
+	for _, tt := range tests {
+		if got := Covers(windows, tt.slot); got != tt.want {
+			t.Errorf("Covers(%v) = %v, want %v", tt.slot, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Conn wraps *sql.DB and rewrites queries for the active dialect, so callers
+// can keep writing `?` placeholders regardless of the backend
+type Conn struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Exec executes a query without returning rows
+func (c *Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.Dialect.Rebind(query), args...)
+}
+
+// Query executes a query that returns rows
+func (c *Conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.Dialect.Rebind(query), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (c *Conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.Dialect.Rebind(query), args...)
+}
+
+// Begin starts a transaction that rebinds queries like Conn does
+func (c *Conn) Begin() (*Tx, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: c.Dialect}, nil
+}
+
+// InsertID runs an INSERT and returns the generated id column
+func (c *Conn) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(c.Dialect, c.Exec, c.QueryRow, query, args...)
+}
+
+// Tx wraps *sql.Tx with the same placeholder rewriting as Conn
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+// Exec executes a query without returning rows
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.Dialect.Rebind(query), args...)
+}
+
+// Query executes a query that returns rows
+func (t *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(t.Dialect.Rebind(query), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (t *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(t.Dialect.Rebind(query), args...)
+}
+
+// InsertID runs an INSERT and returns the generated id column
+func (t *Tx) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(t.Dialect, t.Exec, t.QueryRow, query, args...)
+}
+
+// insertID uses LastInsertId where the driver supports it and falls back to
+// INSERT ... RETURNING id otherwise
+func insertID(d Dialect,
+	exec func(string, ...interface{}) (sql.Result, error),
+	queryRow func(string, ...interface{}) *sql.Row,
+	query string, args ...interface{}) (int64, error) {
+	if d.SupportsLastInsertID() {
+		result, err := exec(query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	}
+
+	var id int64
+	err := queryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
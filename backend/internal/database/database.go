@@ -5,38 +5,30 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// DB is the shared connection used by the rest of the application
+var DB *Conn
 
-// InitDatabase initializes the SQLite database connection
+// InitDatabase initializes the database connection, applies pending
+// migrations and seeds demo data
 func InitDatabase() error {
-	var err error
-	
-	// Create database directory if it doesn't exist
-	if err := os.MkdirAll("./data", 0755); err != nil {
-		return fmt.Errorf("failed to create data directory: %v", err)
-	}
-	
-	// Open database connection
-	DB, err = sql.Open("sqlite3", "./data/synapmentor.db")
-	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
-	}
-	
-	// Test the connection
-	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+	if err := Connect(); err != nil {
+		return err
 	}
 	
-	log.Println("Database connection established successfully")
-	
 	// Run migrations
-	if err := runMigrations(); err != nil {
+	applied, err := MigrateUp()
+	if err != nil {
 		return fmt.Errorf("failed to run migrations: %v", err)
 	}
+	log.Printf("Migrations up to date (%d applied this run)", applied)
 	
 	// Seed demo data
 	if err := seedDemoData(); err != nil {
@@ -46,196 +38,74 @@ func InitDatabase() error {
 	return nil
 }
 
-// runMigrations creates all necessary tables
-func runMigrations() error {
-	migrations := []string{
-		createUsersTable,
-		createUserProfilesTable,
-		createSessionsTable,
-		createContentTable,
-		createWalletsTable,
-		createTransactionsTable,
-		createNotificationsTable,
-		createCommunitiesTable,
-		createDiscussionsTable,
-		createEventsTable,
+// Connect opens the database connection without touching the schema.
+// DATABASE_URL selects the backend: postgres:// or postgresql:// URLs use
+// PostgreSQL, anything else (or DB_PATH) is treated as a SQLite file path.
+func Connect() error {
+	dialect, dsn := resolveDSN()
+
+	if dialect.Name() == "sqlite" {
+		// Create database directory if it doesn't exist
+		if err := os.MkdirAll(filepath.Dir(sqlitePath(dsn)), 0755); err != nil {
+			return fmt.Errorf("failed to create data directory: %v", err)
+		}
 	}
 	
-	for _, migration := range migrations {
-		if _, err := DB.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %v", err)
-		}
+	// Open database connection
+	sqlDB, err := sql.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	DB = &Conn{DB: sqlDB, Dialect: dialect}
+	
+	// Test the connection
+	if err = DB.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %v", err)
 	}
 	
-	log.Println("All migrations completed successfully")
+	log.Printf("Database connection established successfully (%s)", dialect.Name())
 	return nil
 }
 
-const createUsersTable = `
-CREATE TABLE IF NOT EXISTS users (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    email TEXT UNIQUE NOT NULL,
-    password TEXT NOT NULL,
-    first_name TEXT,
-    last_name TEXT,
-    country TEXT,
-    city TEXT,
-    gender TEXT,
-    date_of_birth DATE,
-    profile_pic TEXT,
-    bio TEXT,
-    phone TEXT,
-    is_email_verified BOOLEAN DEFAULT FALSE,
-    is_phone_verified BOOLEAN DEFAULT FALSE,
-    verification_level TEXT DEFAULT 'light',
-    is_active BOOLEAN DEFAULT TRUE,
-    role TEXT DEFAULT 'seeker',
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);`
-
-const createUserProfilesTable = `
-CREATE TABLE IF NOT EXISTS user_profiles (
-    user_id INTEGER PRIMARY KEY,
-    languages TEXT DEFAULT '[]',
-    skills TEXT DEFAULT '[]',
-    experience TEXT DEFAULT '[]',
-    achievements TEXT DEFAULT '[]',
-    projects TEXT DEFAULT '[]',
-    bank_account TEXT,
-    profile_complete INTEGER DEFAULT 0,
-    followers INTEGER DEFAULT 0,
-    following INTEGER DEFAULT 0,
-    interests TEXT DEFAULT '[]',
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);`
-
-const createSessionsTable = `
-CREATE TABLE IF NOT EXISTS sessions (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    solver_id INTEGER NOT NULL,
-    seeker_id INTEGER NOT NULL,
-    title TEXT NOT NULL,
-    description TEXT,
-    category TEXT,
-    sub_category TEXT,
-    duration INTEGER DEFAULT 60,
-    price REAL DEFAULT 0.0,
-    status TEXT DEFAULT 'scheduled',
-    scheduled_at DATETIME NOT NULL,
-    started_at DATETIME,
-    ended_at DATETIME,
-    recording_url TEXT,
-    rating INTEGER DEFAULT 0,
-    review TEXT,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (solver_id) REFERENCES users(id),
-    FOREIGN KEY (seeker_id) REFERENCES users(id)
-);`
-
-const createContentTable = `
-CREATE TABLE IF NOT EXISTS content (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id INTEGER NOT NULL,
-    title TEXT NOT NULL,
-    description TEXT,
-    type TEXT NOT NULL,
-    url TEXT,
-    category TEXT,
-    sub_category TEXT,
-    tags TEXT DEFAULT '[]',
-    views INTEGER DEFAULT 0,
-    likes INTEGER DEFAULT 0,
-    status TEXT DEFAULT 'draft',
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);`
-
-const createWalletsTable = `
-CREATE TABLE IF NOT EXISTS wallets (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id INTEGER UNIQUE NOT NULL,
-    balance REAL DEFAULT 0.0,
-    currency TEXT DEFAULT 'USD',
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);`
-
-const createTransactionsTable = `
-CREATE TABLE IF NOT EXISTS transactions (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    wallet_id INTEGER NOT NULL,
-    session_id INTEGER,
-    type TEXT NOT NULL,
-    amount REAL NOT NULL,
-    description TEXT,
-    status TEXT DEFAULT 'pending',
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (wallet_id) REFERENCES wallets(id),
-    FOREIGN KEY (session_id) REFERENCES sessions(id)
-);`
-
-const createNotificationsTable = `
-CREATE TABLE IF NOT EXISTS notifications (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id INTEGER NOT NULL,
-    title TEXT NOT NULL,
-    message TEXT NOT NULL,
-    type TEXT DEFAULT 'in_app',
-    is_read BOOLEAN DEFAULT FALSE,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);`
+// resolveDSN picks the dialect and driver DSN from the environment
+func resolveDSN() (Dialect, string) {
+	dsn := os.Getenv("DATABASE_URL")
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return postgresDialect{}, dsn
+	}
 
-const createCommunitiesTable = `
-CREATE TABLE IF NOT EXISTS communities (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL,
-    description TEXT,
-    category TEXT,
-    member_count INTEGER DEFAULT 0,
-    is_active BOOLEAN DEFAULT TRUE,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);`
+	dsn = strings.TrimPrefix(dsn, "sqlite://")
+	if dsn == "" {
+		dsn = os.Getenv("DB_PATH")
+	}
+	if dsn == "" {
+		dsn = "./data/synapmentor.db"
+	}
+	return sqliteDialect{}, withSQLiteOptions(dsn)
+}
 
-const createDiscussionsTable = `
-CREATE TABLE IF NOT EXISTS discussions (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    community_id INTEGER,
-    user_id INTEGER NOT NULL,
-    title TEXT NOT NULL,
-    content TEXT NOT NULL,
-    likes INTEGER DEFAULT 0,
-    replies INTEGER DEFAULT 0,
-    is_anonymous BOOLEAN DEFAULT FALSE,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (community_id) REFERENCES communities(id),
-    FOREIGN KEY (user_id) REFERENCES users(id)
-);`
+// withSQLiteOptions makes every transaction take the write lock when it
+// begins and makes writers wait for each other instead of failing with
+// SQLITE_BUSY, so read-check-write sequences inside a transaction are atomic
+func withSQLiteOptions(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	if !strings.Contains(dsn, "_txlock=") {
+		dsn += sep + "_txlock=immediate"
+		sep = "&"
+	}
+	if !strings.Contains(dsn, "_busy_timeout=") {
+		dsn += sep + "_busy_timeout=5000"
+	}
+	return dsn
+}
 
-const createEventsTable = `
-CREATE TABLE IF NOT EXISTS events (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    title TEXT NOT NULL,
-    description TEXT,
-    event_date DATETIME NOT NULL,
-    duration INTEGER DEFAULT 60,
-    max_attendees INTEGER,
-    current_attendees INTEGER DEFAULT 0,
-    category TEXT,
-    is_active BOOLEAN DEFAULT TRUE,
-    created_by INTEGER NOT NULL,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (created_by) REFERENCES users(id)
-);`
+// sqlitePath strips connection options from a SQLite DSN
+func sqlitePath(dsn string) string {
+	return strings.TrimPrefix(strings.SplitN(dsn, "?", 2)[0], "file:")
+}
 
 // seedDemoData inserts demo data for testing
 func seedDemoData() error {
@@ -268,6 +138,9 @@ func seedDemoData() error {
 			return fmt.Errorf("failed to insert demo user: %v", err)
 		}
 	}
+	if _, err := DB.Exec(backfillUserRoles); err != nil {
+		return fmt.Errorf("failed to grant demo user roles: %v", err)
+	}
 
 	// Insert user profiles
 	demoProfiles := []string{
@@ -300,17 +173,27 @@ func seedDemoData() error {
 		}
 	}
 
+	// Record the demo balances in the ledger
+	if _, err := DB.Exec(backfillOpeningBalances); err != nil {
+		return fmt.Errorf("failed to record demo wallet balances: %v", err)
+	}
+
 	// Insert demo sessions
-	demoSessions := []string{
-		`INSERT INTO sessions (solver_id, seeker_id, title, description, category, duration, price, status, scheduled_at)
-		 VALUES (1, 2, 'JavaScript Fundamentals', 'Learn the basics of JavaScript programming', 'Programming', 60, 25.00, 'completed', datetime('now', '+1 day'))`,
+	demoSessions := []struct {
+		query       string
+		scheduledAt time.Time
+	}{
+		{`INSERT INTO sessions (solver_id, seeker_id, title, description, category, duration, price, status, scheduled_at)
+		 VALUES (1, 2, 'JavaScript Fundamentals', 'Learn the basics of JavaScript programming', 'Programming', 60, 25.00, 'completed', ?)`,
+			time.Now().UTC().AddDate(0, 0, 1)},
 
-		`INSERT INTO sessions (solver_id, seeker_id, title, description, category, duration, price, status, scheduled_at)
-		 VALUES (1, 2, 'React Components Deep Dive', 'Advanced React component patterns', 'Programming', 90, 40.00, 'scheduled', datetime('now', '+2 days'))`,
+		{`INSERT INTO sessions (solver_id, seeker_id, title, description, category, duration, price, status, scheduled_at)
+		 VALUES (1, 2, 'React Components Deep Dive', 'Advanced React component patterns', 'Programming', 90, 40.00, 'confirmed', ?)`,
+			time.Now().UTC().AddDate(0, 0, 2)},
 	}
 
-	for _, query := range demoSessions {
-		if _, err := DB.Exec(query); err != nil {
+	for _, session := range demoSessions {
+		if _, err := DB.Exec(session.query, session.scheduledAt); err != nil {
 			return fmt.Errorf("failed to insert demo session: %v", err)
 		}
 	}
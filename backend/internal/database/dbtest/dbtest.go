@@ -0,0 +1,82 @@
+// Package dbtest opens throwaway databases for tests
+package dbtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"synapmentor/internal/database"
+	"testing"
+)
+
+// Open points database.DB at an empty database with every migration applied
+// and returns it. That is a SQLite file in a temporary directory or, when
+// TEST_DATABASE_URL names a PostgreSQL server, a schema of the test's own
+// there, dropped again when the test ends.
+func Open(t testing.TB) *database.Conn {
+	t.Helper()
+
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		t.Setenv("DATABASE_URL", postgresSchema(t, dsn))
+	} else {
+		t.Setenv("DATABASE_URL", "")
+		t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	}
+
+	if err := database.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db := database.DB
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := database.MigrateUp(); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return db
+}
+
+// Postgres reports whether tests run against PostgreSQL
+func Postgres() bool {
+	return os.Getenv("TEST_DATABASE_URL") != ""
+}
+
+// postgresSchema creates a schema for one test on the server dsn names and
+// returns a DSN that uses it, so that packages testing in parallel do not
+// see each other's tables
+func postgresSchema(t testing.TB, dsn string) string {
+	t.Helper()
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL: %v", err)
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open %s: %v", u.Redacted(), err)
+	}
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
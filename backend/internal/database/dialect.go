@@ -0,0 +1,86 @@
+package database
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the SQL differences between the supported database engines.
+// Queries throughout the code base are written in SQLite flavour with `?`
+// placeholders; the dialect adapts them for the active driver.
+type Dialect interface {
+	// Name returns the dialect name, e.g. "sqlite" or "postgres"
+	Name() string
+	// DriverName returns the database/sql driver to open
+	DriverName() string
+	// Rebind rewrites `?` placeholders into the driver's bind syntax
+	Rebind(query string) string
+	// TranslateDDL adapts schema statements written for SQLite
+	TranslateDDL(ddl string) string
+	// SupportsLastInsertID reports whether sql.Result.LastInsertId works
+	SupportsLastInsertID() bool
+	// ForUpdate returns the clause that row-locks a SELECT inside a
+	// transaction, or "" where the transaction itself already holds the lock
+	ForUpdate() string
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string                   { return "sqlite" }
+func (sqliteDialect) DriverName() string             { return "sqlite3" }
+func (sqliteDialect) Rebind(query string) string     { return query }
+func (sqliteDialect) TranslateDDL(ddl string) string { return ddl }
+func (sqliteDialect) SupportsLastInsertID() bool     { return true }
+
+// SQLite transactions are opened with BEGIN IMMEDIATE (see Connect), which
+// takes the write lock up front, so no per-row locking is needed
+func (sqliteDialect) ForUpdate() string { return "" }
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string               { return "postgres" }
+func (postgresDialect) DriverName() string         { return "postgres" }
+func (postgresDialect) SupportsLastInsertID() bool { return false }
+func (postgresDialect) ForUpdate() string          { return " FOR UPDATE" }
+
+// Rebind numbers placeholders as $1, $2, ... skipping quoted literals
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inQuote = !inQuote
+			b.WriteByte(ch)
+		case ch == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
+
+var postgresDDLReplacements = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\bINTEGER PRIMARY KEY AUTOINCREMENT\b`), "SERIAL PRIMARY KEY"},
+	{regexp.MustCompile(`(?i)\bDATETIME\b`), "TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\bREAL\b`), "DOUBLE PRECISION"},
+}
+
+func (postgresDialect) TranslateDDL(ddl string) string {
+	for _, r := range postgresDDLReplacements {
+		ddl = r.pattern.ReplaceAllString(ddl, r.replacement)
+	}
+	return ddl
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no placeholders", "SELECT 1", "SELECT 1"},
+		{"numbers in order", "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"skips literals", "SELECT '?' FROM t WHERE a = ? AND b = 'x?y'", "SELECT '?' FROM t WHERE a = $1 AND b = 'x?y'"},
+		{"escaped quotes", "SELECT 'it''s ?' WHERE a = ?", "SELECT 'it''s ?' WHERE a = $1"},
+		{"appended clause", "SELECT id FROM t WHERE id = ?" + postgresDialect{}.ForUpdate(), "SELECT id FROM t WHERE id = $1 FOR UPDATE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (postgresDialect{}).Rebind(tt.query); got != tt.want {
+				t.Errorf("Rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteRebindLeavesQueries(t *testing.T) {
+	query := "SELECT * FROM t WHERE a = ? AND b = '?'"
+	if got := (sqliteDialect{}).Rebind(query); got != query {
+		t.Errorf("Rebind(%q) = %q", query, got)
+	}
+}
+
+func TestPostgresTranslateDDL(t *testing.T) {
+	ddl := `CREATE TABLE t (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    amount REAL NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    realm TEXT
+);`
+	got := (postgresDialect{}).TranslateDDL(ddl)
+
+	for _, want := range []string{"id SERIAL PRIMARY KEY", "amount DOUBLE PRECISION NOT NULL", "created_at TIMESTAMP DEFAULT", "realm TEXT"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("TranslateDDL() = %q, missing %q", got, want)
+		}
+	}
+	for _, unwanted := range []string{"AUTOINCREMENT", "DATETIME", " REAL "} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("TranslateDDL() = %q, still contains %q", got, unwanted)
+		}
+	}
+	if (sqliteDialect{}).TranslateDDL(ddl) != ddl {
+		t.Error("SQLite TranslateDDL changed the statement")
+	}
+}
+
+func TestForUpdate(t *testing.T) {
+	if got := (sqliteDialect{}).ForUpdate(); got != "" {
+		t.Errorf("sqlite ForUpdate() = %q, want none", got)
+	}
+	if got := (postgresDialect{}).ForUpdate(); got != " FOR UPDATE" {
+		t.Errorf("postgres ForUpdate() = %q", got)
+	}
+}
+
+func TestResolveDSN(t *testing.T) {
+	tests := []struct {
+		name        string
+		databaseURL string
+		dbPath      string
+		wantDialect string
+		wantDSN     string
+	}{
+		{"postgres url", "postgres://u:p@db/app", "", "postgres", "postgres://u:p@db/app"},
+		{"postgresql url", "postgresql://db/app?sslmode=disable", "", "postgres", "postgresql://db/app?sslmode=disable"},
+		{"sqlite url", "sqlite:///tmp/app.db", "", "sqlite", "/tmp/app.db?_txlock=immediate&_busy_timeout=5000"},
+		{"db path", "", "/tmp/other.db", "sqlite", "/tmp/other.db?_txlock=immediate&_busy_timeout=5000"},
+		{"default", "", "", "sqlite", "./data/synapmentor.db?_txlock=immediate&_busy_timeout=5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", tt.databaseURL)
+			t.Setenv("DB_PATH", tt.dbPath)
+
+			dialect, dsn := resolveDSN()
+			if dialect.Name() != tt.wantDialect || dsn != tt.wantDSN {
+				t.Errorf("resolveDSN() = %s %q, want %s %q", dialect.Name(), dsn, tt.wantDialect, tt.wantDSN)
+			}
+		})
+	}
+}
+
+func TestWithSQLiteOptions(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"app.db", "app.db?_txlock=immediate&_busy_timeout=5000"},
+		{"file:app.db?cache=shared", "file:app.db?cache=shared&_txlock=immediate&_busy_timeout=5000"},
+		{"app.db?_txlock=deferred", "app.db?_txlock=deferred&_busy_timeout=5000"},
+		{"app.db?_busy_timeout=100", "app.db?_busy_timeout=100&_txlock=immediate"},
+	}
+	for _, tt := range tests {
+		if got := withSQLiteOptions(tt.dsn); got != tt.want {
+			t.Errorf("withSQLiteOptions(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
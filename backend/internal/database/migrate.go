@@ -0,0 +1,241 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is a single numbered, reversible schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Dialect, when set, limits the migration to that dialect; elsewhere it
+	// is recorded as applied without running
+	Dialect string
+}
+
+// runsOn reports whether the migration's SQL is meant for dialect d
+func (m Migration) runsOn(d Dialect) bool {
+	return m.Dialect == "" || m.Dialect == d.Name()
+}
+
+// Checksum returns a digest of the migration body so that edits to an
+// already-applied migration can be detected. It is computed over the source
+// SQL, before any dialect translation, so it is the same on every backend.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up + "\n-- down --\n" + m.Down))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationState describes a known migration and whether it has been applied
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool // applied checksum differs from the current source
+}
+
+// ErrChecksumMismatch is returned when an applied migration was edited afterwards
+var ErrChecksumMismatch = errors.New("applied migration has been modified")
+
+const createSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);`
+
+type appliedMigration struct {
+	version   int
+	checksum  string
+	appliedAt time.Time
+}
+
+// MigrateUp applies every pending migration in order and returns how many ran
+func MigrateUp() (int, error) {
+	applied, err := loadAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyAppliedMigrations(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return count, err
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, up to steps of them
+func MigrateDown(steps int) (int, error) {
+	applied, err := loadAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyAppliedMigrations(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := revertMigration(m); err != nil {
+			return count, err
+		}
+		log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus reports every known migration and whether it is applied
+func MigrationStatus() ([]MigrationState, error) {
+	applied, err := loadAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			appliedAt := a.appliedAt
+			state.Applied = true
+			state.AppliedAt = &appliedAt
+			state.Modified = a.checksum != m.Checksum()
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// loadAppliedMigrations reads schema_migrations, creating it when missing
+func loadAppliedMigrations() (map[int]appliedMigration, error) {
+	if err := validateMigrations(); err != nil {
+		return nil, err
+	}
+
+	if _, err := DB.Exec(DB.Dialect.TranslateDDL(createSchemaMigrationsTable)); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	rows, err := DB.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		applied[a.version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+// validateMigrations guards against programming mistakes in the registry
+func validateMigrations() error {
+	for i, m := range migrations {
+		if m.Version <= 0 || m.Name == "" {
+			return fmt.Errorf("migration at index %d needs a positive version and a name", i)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d is out of order", m.Version)
+		}
+	}
+	return nil
+}
+
+// verifyAppliedMigrations ensures the database matches the migrations compiled
+// into this binary before anything is changed
+func verifyAppliedMigrations(applied map[int]appliedMigration) error {
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	for version, a := range applied {
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("database has migration %d which this build does not know about", version)
+		}
+		if a.checksum != m.Checksum() {
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(m Migration) error {
+	return withMigrationTx(m, func(tx *Tx) error {
+		if m.runsOn(tx.Dialect) {
+			if _, err := tx.Exec(tx.Dialect.TranslateDDL(m.Up)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO schema_migrations (version, name, checksum, applied_at)
+			VALUES (?, ?, ?, ?)`,
+			m.Version, m.Name, m.Checksum(), time.Now().UTC())
+		return err
+	})
+}
+
+func revertMigration(m Migration) error {
+	return withMigrationTx(m, func(tx *Tx) error {
+		if m.runsOn(tx.Dialect) {
+			if _, err := tx.Exec(tx.Dialect.TranslateDDL(m.Down)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		return err
+	})
+}
+
+// withMigrationTx runs fn in a transaction so a failing migration leaves no
+// partial schema change or bookkeeping row behind
+func withMigrationTx(m Migration, fn func(tx *Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package database_test
+
+import (
+	"errors"
+	"strings"
+	"synapmentor/internal/database"
+	"synapmentor/internal/database/dbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	db := dbtest.Open(t)
+
+	states, err := database.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if !s.Applied || s.Modified {
+			t.Errorf("migration %04d_%s: applied %v, modified %v", s.Version, s.Name, s.Applied, s.Modified)
+		}
+	}
+
+	if n, err := database.MigrateUp(); err != nil || n != 0 {
+		t.Fatalf("MigrateUp() on an up to date schema = %d, %v", n, err)
+	}
+
+	reverted, err := database.MigrateDown(len(states))
+	if err != nil {
+		t.Fatalf("MigrateDown() = %v after %d", err, reverted)
+	}
+	if reverted != len(states) {
+		t.Errorf("MigrateDown() reverted %d, want %d", reverted, len(states))
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err == nil {
+		t.Error("users table survived reverting every migration")
+	}
+
+	applied, err := database.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp() after reverting = %v", err)
+	}
+	if applied != len(states) {
+		t.Errorf("MigrateUp() applied %d, want %d", applied, len(states))
+	}
+}
+
+func TestMigrateDownSteps(t *testing.T) {
+	dbtest.Open(t)
+
+	if n, err := database.MigrateDown(2); err != nil || n != 2 {
+		t.Fatalf("MigrateDown(2) = %d, %v", n, err)
+	}
+
+	states, err := database.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range states {
+		if want := i < len(states)-2; s.Applied != want {
+			t.Errorf("migration %04d_%s applied = %v, want %v", s.Version, s.Name, s.Applied, want)
+		}
+	}
+
+	if n, err := database.MigrateUp(); err != nil || n != 2 {
+		t.Fatalf("MigrateUp() = %d, %v", n, err)
+	}
+}
+
+func TestMigrateRefusesEditedMigration(t *testing.T) {
+	db := dbtest.Open(t)
+
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = ? WHERE version = ?", "edited", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.MigrateUp(); !errors.Is(err, database.ErrChecksumMismatch) {
+		t.Errorf("MigrateUp() = %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := database.MigrateDown(1); !errors.Is(err, database.ErrChecksumMismatch) {
+		t.Errorf("MigrateDown() = %v, want ErrChecksumMismatch", err)
+	}
+
+	states, err := database.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !states[0].Modified {
+		t.Error("MigrationStatus() does not report the edited migration")
+	}
+}
+
+// scratchTable creates a table for a test, translated for the dialect
+func scratchTable(t *testing.T, db *database.Conn) {
+	t.Helper()
+	ddl := db.Dialect.TranslateDDL(`
+CREATE TABLE scratch (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    amount REAL NOT NULL,
+    created_at DATETIME NOT NULL
+)`)
+	if _, err := db.Exec(ddl); err != nil {
+		t.Fatalf("create scratch table: %v", err)
+	}
+}
+
+func TestInsertIDAndRebind(t *testing.T) {
+	db := dbtest.Open(t)
+	scratchTable(t, db)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for want := int64(1); want <= 3; want++ {
+		id, err := db.InsertID("INSERT INTO scratch (amount, created_at) VALUES (?, ?)", float64(want)/2, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("InsertID() = %d, want %d", id, want)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	id, err := tx.InsertID("INSERT INTO scratch (amount, created_at) VALUES (?, ?)", 2.5, now)
+	if err != nil || id != 4 {
+		t.Fatalf("Tx.InsertID() = %d, %v", id, err)
+	}
+
+	var amount float64
+	var createdAt time.Time
+	err = tx.QueryRow("SELECT amount, created_at FROM scratch WHERE id = ? AND amount > ?", id, 1).
+		Scan(&amount, &createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount != 2.5 || !createdAt.Equal(now) {
+		t.Errorf("read back %v at %v, want 2.5 at %v", amount, createdAt, now)
+	}
+}
+
+// Every balance change in the repositories reads a row and writes it back in
+// one transaction; with the row locked (or, on SQLite, the database) none of
+// the concurrent increments may be lost
+func TestForUpdateSerializesReadModifyWrite(t *testing.T) {
+	db := dbtest.Open(t)
+	scratchTable(t, db)
+	if _, err := db.Exec("INSERT INTO scratch (amount, created_at) VALUES (?, ?)", 0, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- increment(db)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var amount float64
+	if err := db.QueryRow("SELECT amount FROM scratch WHERE id = ?", 1).Scan(&amount); err != nil {
+		t.Fatal(err)
+	}
+	if amount != workers {
+		t.Errorf("amount = %v after %d increments", amount, workers)
+	}
+}
+
+func increment(db *database.Conn) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var amount float64
+	if err := tx.QueryRow("SELECT amount FROM scratch WHERE id = ?"+tx.Dialect.ForUpdate(), 1).Scan(&amount); err != nil {
+		return err
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := tx.Exec("UPDATE scratch SET amount = ? WHERE id = ?", amount+1, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestNormalizeScheduleTimes(t *testing.T) {
+	if dbtest.Postgres() {
+		t.Skip("PostgreSQL TIMESTAMP columns never kept offsets")
+	}
+	db := dbtest.Open(t)
+	if n, err := database.MigrateDown(1); err != nil || n != 1 {
+		t.Fatalf("MigrateDown(1) = %d, %v", n, err)
+	}
+
+	// Written the way the driver stores times that were not converted to UTC
+	if _, err := db.Exec(`INSERT INTO users (email, password) VALUES ('solver@example.com', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	stored := []string{
+		"2024-05-01 14:00:00+02:00",
+		"2024-05-01 12:30:00+00:00",
+		"2024-04-30 22:15:00.5-05:30",
+	}
+	for _, at := range stored {
+		if _, err := db.Exec(`INSERT INTO sessions (solver_id, seeker_id, title, scheduled_at) VALUES (1, 1, 'Algebra', ?)`, at); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO events (title, event_date, created_by) VALUES ('Workshop', ?, 1)`, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := database.MigrateUp(); err != nil || n != 1 {
+		t.Fatalf("MigrateUp() = %d, %v", n, err)
+	}
+
+	want := []string{
+		"2024-05-01 03:45:00.5+00:00",
+		"2024-05-01 12:00:00+00:00",
+		"2024-05-01 12:30:00+00:00",
+	}
+	for _, column := range []string{"sessions.scheduled_at", "events.event_date"} {
+		table, field, _ := strings.Cut(column, ".")
+		rows, err := db.Query("SELECT CAST(" + field + " AS TEXT) FROM " + table + " ORDER BY " + field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for rows.Next() {
+			var at string
+			if err := rows.Scan(&at); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, at)
+		}
+		rows.Close()
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Errorf("%s = %v, want %v", column, got, want)
+		}
+	}
+}
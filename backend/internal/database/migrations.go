@@ -0,0 +1,882 @@
+package database
+
+// migrations is the ordered list of schema changes. Append new entries with
+// the next version number; never edit or reorder a migration that has already
+// shipped, because applied checksums are verified on every run.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline_schema",
+		Up: createUsersTable + createUserProfilesTable + createSessionsTable +
+			createContentTable + createWalletsTable + createTransactionsTable +
+			createNotificationsTable + createCommunitiesTable +
+			createDiscussionsTable + createEventsTable,
+		Down: `
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS discussions;
+DROP TABLE IF EXISTS communities;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS wallets;
+DROP TABLE IF EXISTS content;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS user_profiles;
+DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version: 2,
+		Name:    "double_entry_ledger",
+		Up:      createLedgerTables + backfillOpeningBalances,
+		Down: `
+ALTER TABLE transactions DROP COLUMN journal_entry_id;
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS ledger_accounts;`,
+	},
+	{
+		Version: 3,
+		Name:    "session_payment_status",
+		Up: `
+ALTER TABLE sessions ADD COLUMN payment_status TEXT DEFAULT 'none';
+CREATE INDEX idx_transactions_session ON transactions(session_id);`,
+		Down: `
+DROP INDEX IF EXISTS idx_transactions_session;
+ALTER TABLE sessions DROP COLUMN payment_status;`,
+	},
+	{
+		Version: 4,
+		Name:    "session_lifecycle",
+		Up: createSessionTransitionsTable + `
+UPDATE sessions SET status = 'requested' WHERE status = 'scheduled' OR status IS NULL;`,
+		Down: `
+UPDATE sessions SET status = 'scheduled' WHERE status IN ('requested', 'confirmed');
+UPDATE sessions SET status = 'cancelled' WHERE status = 'no_show';
+DROP TABLE IF EXISTS session_transitions;`,
+	},
+	{
+		Version: 5,
+		Name:    "solver_availability",
+		Up:      createAvailabilityTables,
+		Down: `
+DROP TABLE IF EXISTS availability_exceptions;
+DROP TABLE IF EXISTS availability_rules;
+DROP INDEX IF EXISTS idx_sessions_solver_schedule;`,
+	},
+	{
+		Version: 6,
+		Name:    "user_timezone_locale",
+		Up: `
+ALTER TABLE users ADD COLUMN timezone TEXT DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN locale TEXT DEFAULT 'en';`,
+		Down: `
+ALTER TABLE users DROP COLUMN locale;
+ALTER TABLE users DROP COLUMN timezone;`,
+	},
+	{
+		Version: 7,
+		Name:    "calendar_feeds",
+		Up: createCalendarTables + `
+ALTER TABLE sessions ADD COLUMN ical_sequence INTEGER DEFAULT 0;
+ALTER TABLE events ADD COLUMN ical_sequence INTEGER DEFAULT 0;`,
+		Down: `
+ALTER TABLE events DROP COLUMN ical_sequence;
+ALTER TABLE sessions DROP COLUMN ical_sequence;
+DROP TABLE IF EXISTS event_attendees;
+DROP TABLE IF EXISTS calendar_feeds;`,
+	},
+	{
+		Version: 8,
+		Name:    "session_series",
+		Up: createSessionSeriesTable + `
+ALTER TABLE sessions ADD COLUMN series_id INTEGER;
+CREATE INDEX idx_sessions_series ON sessions(series_id);`,
+		Down: `
+DROP INDEX IF EXISTS idx_sessions_series;
+ALTER TABLE sessions DROP COLUMN series_id;
+DROP TABLE IF EXISTS session_series;`,
+	},
+	{
+		Version: 9,
+		Name:    "refresh_tokens",
+		Up:      createRefreshTokensTable,
+		Down: `
+DROP TABLE IF EXISTS refresh_tokens;`,
+	},
+	{
+		Version: 10,
+		Name:    "login_sessions",
+		Up:      createLoginSessionsTable,
+		Down: `
+DROP TABLE IF EXISTS login_sessions;`,
+	},
+	{
+		Version: 11,
+		Name:    "email_verification",
+		Up: `
+ALTER TABLE users ADD COLUMN email_verification_sent_at DATETIME;`,
+		Down: `
+ALTER TABLE users DROP COLUMN email_verification_sent_at;`,
+	},
+	{
+		Version: 12,
+		Name:    "password_reset_tokens",
+		Up:      createPasswordResetTokensTable,
+		Down: `
+DROP TABLE IF EXISTS password_reset_tokens;`,
+	},
+	{
+		Version: 13,
+		Name:    "two_factor",
+		Up: createTwoFactorTables + `
+ALTER TABLE login_sessions ADD COLUMN two_factor BOOLEAN DEFAULT FALSE;`,
+		Down: `
+ALTER TABLE login_sessions DROP COLUMN two_factor;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;`,
+	},
+	{
+		Version: 14,
+		Name:    "login_attempts",
+		Up: createLoginAttemptsTable + `
+ALTER TABLE users ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until DATETIME;`,
+		Down: `
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN failed_login_count;
+DROP TABLE IF EXISTS login_attempts;`,
+	},
+	{
+		Version: 15,
+		Name:    "user_identities",
+		Up:      createUserIdentitiesTables,
+		Down: `
+DROP TABLE IF EXISTS oauth_states;
+DROP TABLE IF EXISTS user_identities;`,
+	},
+	{
+		Version: 16,
+		Name:    "roles_permissions",
+		Up:      createRoleTables + seedRoles + backfillUserRoles,
+		Down: `
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;`,
+	},
+	{
+		Version: 17,
+		Name:    "api_keys",
+		Up:      createAPIKeysTable,
+		Down: `
+DROP TABLE IF EXISTS api_keys;`,
+	},
+	{
+		Version: 18,
+		Name:    "phone_verifications",
+		Up:      createPhoneVerificationsTable,
+		Down: `
+DROP TABLE IF EXISTS phone_verifications;`,
+	},
+	{
+		Version: 19,
+		Name:    "identity_documents",
+		Up: createIdentityDocumentsTable + `
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'identity:review'),
+    ('support', 'identity:review');` + recomputeVerificationLevels,
+		Down: `
+DELETE FROM role_permissions WHERE permission = 'identity:review';
+DROP TABLE IF EXISTS identity_documents;`,
+	},
+	{
+		Version: 20,
+		Name:    "community",
+		Up:      createCommunityTables + recountCommunities,
+		Down: `
+DROP TABLE IF EXISTS discussion_replies;
+DROP TABLE IF EXISTS community_members;
+DROP INDEX IF EXISTS idx_discussions_community;
+ALTER TABLE communities DROP COLUMN created_by;`,
+	},
+	{
+		Version: 21,
+		Name:    "event_rsvps",
+		Up: `
+ALTER TABLE event_attendees ADD COLUMN reminded_at DATETIME;
+CREATE INDEX idx_event_attendees_event ON event_attendees(event_id, status, id);` + recountEventAttendees,
+		Down: `
+DROP INDEX IF EXISTS idx_event_attendees_event;
+ALTER TABLE event_attendees DROP COLUMN reminded_at;`,
+	},
+	{
+		Version: 22,
+		Name:    "event_tickets",
+		Up:      createEventTicketsTable,
+		Down: `
+DROP TABLE IF EXISTS event_tickets;
+DROP INDEX IF EXISTS idx_transactions_event;
+ALTER TABLE transactions DROP COLUMN event_id;
+ALTER TABLE journal_entries DROP COLUMN event_id;
+ALTER TABLE events DROP COLUMN paid_out_at;
+ALTER TABLE events DROP COLUMN price;`,
+	},
+	{
+		Version: 23,
+		Name:    "utc_schedule_times",
+		Up:      normalizeScheduleTimes,
+		Down: `
+-- Nothing to undo: the UTC values read back as the same instants`,
+		Dialect: "sqlite",
+	},
+}
+
+const createUsersTable = `
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    first_name TEXT,
+    last_name TEXT,
+    country TEXT,
+    city TEXT,
+    gender TEXT,
+    date_of_birth DATE,
+    profile_pic TEXT,
+    bio TEXT,
+    phone TEXT,
+    is_email_verified BOOLEAN DEFAULT FALSE,
+    is_phone_verified BOOLEAN DEFAULT FALSE,
+    verification_level TEXT DEFAULT 'light',
+    is_active BOOLEAN DEFAULT TRUE,
+    role TEXT DEFAULT 'seeker',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+const createUserProfilesTable = `
+CREATE TABLE IF NOT EXISTS user_profiles (
+    user_id INTEGER PRIMARY KEY,
+    languages TEXT DEFAULT '[]',
+    skills TEXT DEFAULT '[]',
+    experience TEXT DEFAULT '[]',
+    achievements TEXT DEFAULT '[]',
+    projects TEXT DEFAULT '[]',
+    bank_account TEXT,
+    profile_complete INTEGER DEFAULT 0,
+    followers INTEGER DEFAULT 0,
+    following INTEGER DEFAULT 0,
+    interests TEXT DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+const createSessionsTable = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    solver_id INTEGER NOT NULL,
+    seeker_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    category TEXT,
+    sub_category TEXT,
+    duration INTEGER DEFAULT 60,
+    price REAL DEFAULT 0.0,
+    status TEXT DEFAULT 'scheduled',
+    scheduled_at DATETIME NOT NULL,
+    started_at DATETIME,
+    ended_at DATETIME,
+    recording_url TEXT,
+    rating INTEGER DEFAULT 0,
+    review TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (solver_id) REFERENCES users(id),
+    FOREIGN KEY (seeker_id) REFERENCES users(id)
+);`
+
+const createContentTable = `
+CREATE TABLE IF NOT EXISTS content (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    type TEXT NOT NULL,
+    url TEXT,
+    category TEXT,
+    sub_category TEXT,
+    tags TEXT DEFAULT '[]',
+    views INTEGER DEFAULT 0,
+    likes INTEGER DEFAULT 0,
+    status TEXT DEFAULT 'draft',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+const createWalletsTable = `
+CREATE TABLE IF NOT EXISTS wallets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER UNIQUE NOT NULL,
+    balance REAL DEFAULT 0.0,
+    currency TEXT DEFAULT 'USD',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+const createTransactionsTable = `
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    wallet_id INTEGER NOT NULL,
+    session_id INTEGER,
+    type TEXT NOT NULL,
+    amount REAL NOT NULL,
+    description TEXT,
+    status TEXT DEFAULT 'pending',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (wallet_id) REFERENCES wallets(id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id)
+);`
+
+const createNotificationsTable = `
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    message TEXT NOT NULL,
+    type TEXT DEFAULT 'in_app',
+    is_read BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+const createCommunitiesTable = `
+CREATE TABLE IF NOT EXISTS communities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    category TEXT,
+    member_count INTEGER DEFAULT 0,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+const createDiscussionsTable = `
+CREATE TABLE IF NOT EXISTS discussions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    community_id INTEGER,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    likes INTEGER DEFAULT 0,
+    replies INTEGER DEFAULT 0,
+    is_anonymous BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (community_id) REFERENCES communities(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);`
+
+const createEventsTable = `
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    event_date DATETIME NOT NULL,
+    duration INTEGER DEFAULT 60,
+    max_attendees INTEGER,
+    current_attendees INTEGER DEFAULT 0,
+    category TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);`
+
+// Ledger amounts are stored as integer minor units (cents) so that the
+// postings of an entry sum to exactly zero.
+const createLedgerTables = `
+CREATE TABLE ledger_accounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT UNIQUE NOT NULL,
+    kind TEXT NOT NULL,
+    wallet_id INTEGER UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (wallet_id) REFERENCES wallets(id)
+);
+
+CREATE TABLE journal_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    description TEXT,
+    reference TEXT,
+    session_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+CREATE TABLE postings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entry_id INTEGER NOT NULL,
+    account_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id),
+    FOREIGN KEY (account_id) REFERENCES ledger_accounts(id)
+);
+
+CREATE INDEX idx_postings_account ON postings(account_id);
+CREATE INDEX idx_postings_entry ON postings(entry_id);
+
+ALTER TABLE transactions ADD COLUMN journal_entry_id INTEGER REFERENCES journal_entries(id);`
+
+// backfillOpeningBalances moves wallet balances that were not written through
+// the ledger into it: one opening entry per wallet, balanced against the
+// opening_balance account. It is idempotent so seeding can reuse it.
+const backfillOpeningBalances = `
+INSERT INTO ledger_accounts (code, kind)
+SELECT 'system:opening_balance', 'system'
+WHERE NOT EXISTS (SELECT 1 FROM ledger_accounts WHERE code = 'system:opening_balance');
+
+INSERT INTO ledger_accounts (code, kind, wallet_id)
+SELECT 'wallet:' || w.id, 'wallet', w.id FROM wallets w
+WHERE NOT EXISTS (SELECT 1 FROM ledger_accounts la WHERE la.wallet_id = w.id);
+
+INSERT INTO journal_entries (kind, description, reference)
+SELECT 'opening_balance', 'Opening balance', 'wallet:' || w.id
+FROM wallets w
+WHERE w.balance <> 0
+AND NOT EXISTS (
+    SELECT 1 FROM journal_entries je
+    WHERE je.kind = 'opening_balance' AND je.reference = 'wallet:' || w.id
+);
+
+INSERT INTO postings (entry_id, account_id, amount)
+SELECT je.id, la.id, CAST(ROUND(w.balance * 100) AS INTEGER)
+FROM journal_entries je
+JOIN ledger_accounts la ON la.code = je.reference
+JOIN wallets w ON w.id = la.wallet_id
+WHERE je.kind = 'opening_balance'
+AND NOT EXISTS (SELECT 1 FROM postings p WHERE p.entry_id = je.id);
+
+INSERT INTO postings (entry_id, account_id, amount)
+SELECT p.entry_id, ob.id, -p.amount
+FROM postings p
+JOIN journal_entries je ON je.id = p.entry_id
+JOIN ledger_accounts ob ON ob.code = 'system:opening_balance'
+WHERE je.kind = 'opening_balance'
+AND p.account_id <> ob.id
+AND NOT EXISTS (SELECT 1 FROM postings p2 WHERE p2.entry_id = p.entry_id AND p2.account_id = ob.id);`
+
+const createSessionTransitionsTable = `
+CREATE TABLE IF NOT EXISTS session_transitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_session_transitions_session ON session_transitions(session_id);`
+
+const createAvailabilityTables = `
+CREATE TABLE IF NOT EXISTS availability_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    solver_id INTEGER NOT NULL,
+    weekday INTEGER NOT NULL,
+    start_minute INTEGER NOT NULL,
+    end_minute INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (solver_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_availability_rules_solver ON availability_rules(solver_id);
+
+CREATE TABLE IF NOT EXISTS availability_exceptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    solver_id INTEGER NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    available BOOLEAN NOT NULL DEFAULT FALSE,
+    reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (solver_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_availability_exceptions_solver ON availability_exceptions(solver_id, starts_at);
+
+CREATE INDEX idx_sessions_solver_schedule ON sessions(solver_id, scheduled_at);`
+
+// Feed tokens are stored as SHA-256 hashes; the token itself is only shown to
+// the user when the feed is created
+const createCalendarTables = `
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id INTEGER PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS event_attendees (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT DEFAULT 'going',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_event_attendees_user ON event_attendees(user_id);`
+
+
+// A series records the recurrence a set of sessions was booked from; each
+// occurrence is an ordinary session pointing back at it
+const createSessionSeriesTable = `
+CREATE TABLE IF NOT EXISTS session_series (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    solver_id INTEGER NOT NULL,
+    seeker_id INTEGER NOT NULL,
+    frequency TEXT NOT NULL,
+    occurrences INTEGER,
+    until_date DATETIME,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    created_by INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (solver_id) REFERENCES users(id),
+    FOREIGN KEY (seeker_id) REFERENCES users(id),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);`
+
+// Refresh tokens are stored as SHA-256 hashes. Every login starts a family
+// that each rotation extends; presenting a used token revokes the family.
+const createRefreshTokensTable = `
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id);`
+
+// A login session is one signed-in device. Access tokens carry its id and
+// stop working once it is revoked; its refresh token family shares its fate.
+const createLoginSessionsTable = `
+CREATE TABLE IF NOT EXISTS login_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    family_id TEXT NOT NULL UNIQUE,
+    device TEXT,
+    user_agent TEXT,
+    ip_address TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_login_sessions_user ON login_sessions(user_id);`
+
+// Reset tokens are stored as SHA-256 hashes and work once
+const createPasswordResetTokensTable = `
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);`
+
+// A user's TOTP secret is pending until its first code is confirmed.
+// last_step is the newest time step a code was accepted for, so each code
+// works once; recovery codes are stored as SHA-256 hashes.
+const createTwoFactorTables = `
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled_at DATETIME,
+    last_step INTEGER NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_id);`
+
+// Every sign-in attempt is audited, including those for unknown addresses;
+// the per-IP throttle counts recent failures from this table.
+const createLoginAttemptsTable = `
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    email TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    result TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created_at);`
+
+// An identity maps a provider's subject to one of our users; a user has at
+// most one identity per provider. oauth_states holds the PKCE verifier and
+// nonce of each sign-in in flight, keyed by the hash of its state parameter.
+const createUserIdentitiesTables = `
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS oauth_states (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    state_hash TEXT NOT NULL UNIQUE,
+    provider TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    user_id INTEGER,
+    role TEXT,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+// Roles group permissions; a user holds any number of roles. users.role stays
+// as the primary role, the side of the marketplace a user who holds both
+// acts on by default. Staff roles can reach the admin API.
+const createRoleTables = `
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    staff BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission),
+    FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL,
+    granted_by INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (role) REFERENCES roles(name),
+    FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_user_roles_role ON user_roles(role);`
+
+const seedRoles = `
+INSERT INTO roles (name, description, staff) VALUES
+    ('seeker', 'Books sessions with solvers', FALSE),
+    ('solver', 'Offers sessions and keeps an availability calendar', FALSE),
+    ('admin', 'Full administrative access', TRUE),
+    ('moderator', 'Reviews content and suspends abusive accounts', TRUE),
+    ('support', 'Helps users with their accounts and sessions', TRUE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:suspend'),
+    ('admin', 'users:unlock'),
+    ('admin', 'login_attempts:read'),
+    ('admin', 'sessions:read:any'),
+    ('admin', 'content:moderate'),
+    ('admin', 'analytics:read'),
+    ('admin', 'ledger:reconcile'),
+    ('admin', 'roles:manage'),
+    ('moderator', 'users:read'),
+    ('moderator', 'users:suspend'),
+    ('moderator', 'sessions:read:any'),
+    ('moderator', 'content:moderate'),
+    ('support', 'users:read'),
+    ('support', 'users:unlock'),
+    ('support', 'login_attempts:read'),
+    ('support', 'sessions:read:any');`
+
+// backfillUserRoles grants every user their primary role. It is idempotent
+// so seeding can reuse it.
+const backfillUserRoles = `
+INSERT INTO user_roles (user_id, role)
+SELECT u.id, u.role FROM users u
+WHERE u.role IN (SELECT name FROM roles)
+  AND NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.role = u.role);`
+
+// API keys are stored as the hash of the whole key; prefix is the part shown
+// in listings so users can tell their keys apart. scopes is space separated.
+const createAPIKeysTable = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+    last_used_ip TEXT,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_api_keys_user ON api_keys(user_id);`
+
+// A user has at most one phone number being verified. sends_in_window counts
+// the codes sent since window_started_at, to cap them per hour.
+const createPhoneVerificationsTable = `
+CREATE TABLE IF NOT EXISTS phone_verifications (
+    user_id INTEGER PRIMARY KEY,
+    phone TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    sent_at DATETIME NOT NULL,
+    window_started_at DATETIME NOT NULL,
+    sends_in_window INTEGER NOT NULL DEFAULT 1,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);`
+
+// Identity documents are uploaded by users and approved or rejected by
+// staff; the file itself lives on disk under file_key
+const createIdentityDocumentsTable = `
+CREATE TABLE IF NOT EXISTS identity_documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    document_type TEXT NOT NULL,
+    file_key TEXT NOT NULL,
+    file_name TEXT,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    rejection_reason TEXT,
+    reviewed_by INTEGER,
+    reviewed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_identity_documents_user ON identity_documents(user_id);
+CREATE INDEX idx_identity_documents_status ON identity_documents(status, created_at);`
+
+// Levels were stored but never enforced or derived from anything, so they
+// are recomputed from verified email and phone; no ID document has been
+// approved yet, so nobody starts at full
+const recomputeVerificationLevels = `
+UPDATE users SET verification_level =
+    CASE WHEN COALESCE(is_email_verified, FALSE) AND COALESCE(is_phone_verified, FALSE)
+         THEN 'standard' ELSE 'light' END;`
+
+// Communities are joined through community_members, whose role is owner,
+// moderator or member. Replies to discussions nest through parent_id; a
+// deleted reply keeps its row, without content, so the thread stays whole.
+const createCommunityTables = `
+ALTER TABLE communities ADD COLUMN created_by INTEGER;
+CREATE TABLE IF NOT EXISTS community_members (
+    community_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (community_id, user_id),
+    FOREIGN KEY (community_id) REFERENCES communities(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_community_members_user ON community_members(user_id);
+CREATE INDEX idx_discussions_community ON discussions(community_id, id);
+CREATE TABLE IF NOT EXISTS discussion_replies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    discussion_id INTEGER NOT NULL,
+    parent_id INTEGER,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    is_anonymous BOOLEAN DEFAULT FALSE,
+    depth INTEGER NOT NULL DEFAULT 0,
+    deleted_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (discussion_id) REFERENCES discussions(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES discussion_replies(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_discussion_replies_discussion ON discussion_replies(discussion_id, id);`
+
+// The counters were never maintained, so they are recomputed from the rows
+// they count
+const recountCommunities = `
+UPDATE communities SET member_count =
+    (SELECT COUNT(*) FROM community_members m WHERE m.community_id = communities.id);
+UPDATE discussions SET replies =
+    (SELECT COUNT(*) FROM discussion_replies r
+     WHERE r.discussion_id = discussions.id AND r.deleted_at IS NULL);`
+
+// current_attendees counts RSVPs with status going; waitlisted ones wait for
+// a spot in the order they were made
+const recountEventAttendees = `
+UPDATE events SET current_attendees =
+    (SELECT COUNT(*) FROM event_attendees a WHERE a.event_id = events.id AND a.status = 'going');`
+
+// A ticket is the payment for one RSVP to a paid event. Its price stays in
+// escrow until the attendee cancels, the event is cancelled, or the event
+// ends and the organizer is paid out, which sets paid_out_at.
+const createEventTicketsTable = `
+ALTER TABLE events ADD COLUMN price REAL DEFAULT 0.0;
+ALTER TABLE events ADD COLUMN paid_out_at DATETIME;
+ALTER TABLE journal_entries ADD COLUMN event_id INTEGER;
+ALTER TABLE transactions ADD COLUMN event_id INTEGER;
+CREATE INDEX idx_transactions_event ON transactions(event_id);
+CREATE TABLE IF NOT EXISTS event_tickets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    price REAL NOT NULL,
+    payment_status TEXT NOT NULL DEFAULT 'held',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (event_id) REFERENCES events(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_event_tickets_event ON event_tickets(event_id, payment_status);
+CREATE INDEX idx_event_tickets_user ON event_tickets(user_id, event_id);`
+
+// Before times were stored in UTC, sessions and events kept the offset they
+// were booked with, e.g. "2024-05-01 14:00:00+02:00". SQLite compares those
+// as text, so they sort and range-match out of step with the UTC values
+// written since. normalizeScheduleTimes rewrites them to UTC in the driver's
+// format. PostgreSQL needs nothing: its TIMESTAMP columns dropped the offset
+// on write, so there is nothing left to correct there.
+const normalizeScheduleTimes = `
+UPDATE sessions
+SET scheduled_at = rtrim(rtrim(strftime('%Y-%m-%d %H:%M:%f', scheduled_at), '0'), '.') || '+00:00'
+WHERE substr(scheduled_at, -6, 1) IN ('+', '-') AND substr(scheduled_at, -3, 1) = ':'
+  AND substr(scheduled_at, -6) <> '+00:00';
+
+UPDATE events
+SET event_date = rtrim(rtrim(strftime('%Y-%m-%d %H:%M:%f', event_date), '0'), '.') || '+00:00'
+WHERE substr(event_date, -6, 1) IN ('+', '-') AND substr(event_date, -3, 1) = ':'
+  AND substr(event_date, -6) <> '+00:00';`
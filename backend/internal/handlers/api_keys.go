@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxAPIKeys caps the keys a user can have active at once
+	maxAPIKeys = 20
+	// defaultAPIKeyDays is how long a key lasts when no expiry is asked for
+	defaultAPIKeyDays = 90
+)
+
+// CreateAPIKeyRequest names a new API key and what it may do
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// CreateAPIKeyResponse carries a new key; the key itself is never shown again
+type CreateAPIKeyResponse struct {
+	Key string `json:"key"`
+	models.APIKey
+}
+
+// GetAPIKeys lists the current user's API keys
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API keys"})
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey mints an API key for the current user
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes, ok := apiKeyScopes(req.Scopes)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope; valid scopes are " + strings.Join(models.APIKeyScopes, ", ")})
+		return
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyDays
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	apiKey := models.APIKey{
+		UserID:    currentUserID(c),
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().UTC().AddDate(0, 0, days),
+	}
+	_, err = h.apiKeys.Create(&apiKey, hash, maxAPIKeys)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have too many active API keys; revoke one first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: apiKey})
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	err := h.apiKeys.Revoke(currentUserID(c), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// apiKeyScopes checks requested scopes against the known ones, dropping duplicates
+func apiKeyScopes(requested []string) ([]string, bool) {
+	known := map[string]bool{}
+	for _, s := range models.APIKeyScopes {
+		known[s] = true
+	}
+
+	var scopes []string
+	seen := map[string]bool{}
+	for _, s := range requested {
+		if !known[s] {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, true
+}
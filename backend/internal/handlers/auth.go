@@ -1,13 +1,12 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"log"
 	"net/http"
-	"strings"
 	"synapmentor/internal/auth"
-	"synapmentor/internal/database"
 	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +21,8 @@ type RegisterRequest struct {
 	LastName        string `json:"last_name" binding:"required"`
 	Role            string `json:"role" binding:"required,oneof=solver seeker"`
 	AcceptTerms     bool   `json:"accept_terms" binding:"required"`
+	Timezone        string `json:"timezone"`
+	Locale          string `json:"locale"`
 }
 
 // LoginRequest represents the login request payload
@@ -30,14 +31,22 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// AuthResponse represents the authentication response
+// RefreshRequest carries a refresh token to exchange or revoke
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// AuthResponse represents the authentication response; token is a short-lived
+// access token and refresh_token a single-use token to renew it with
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresIn    int          `json:"expires_in"` // seconds until token expires
+	User         *models.User `json:"user,omitempty"`
 }
 
 // Register handles user registration
-func Register(c *gin.Context) {
+func (h *Handler) Register(c *gin.Context) {
 	log.Printf("Registration request received from %s", c.ClientIP())
 
 	var req RegisterRequest
@@ -56,16 +65,28 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if req.Timezone != "" && !validTimezone(req.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+	if req.Locale != "" && !validLocale(req.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale"})
+		return
+	}
+
 	// Validate password strength
 	if !auth.ValidatePasswordStrength(req.Password) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters with uppercase, lowercase, and number"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": passwordRules})
 		return
 	}
 
 	// Check if user already exists
-	var existingID int
-	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", req.Email).Scan(&existingID)
-	if err != sql.ErrNoRows {
+	exists, err := h.users.EmailExists(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
 		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
 		return
 	}
@@ -77,82 +98,67 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Insert user
-	result, err := database.DB.Exec(`
-		INSERT INTO users (email, password, first_name, last_name, role, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		req.Email, hashedPassword, req.FirstName, req.LastName, req.Role, time.Now(), time.Now())
+	// Insert user together with profile and wallet
+	userID, err := h.users.Create(&models.User{
+		Email:     req.Email,
+		Password:  hashedPassword,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      req.Role,
+		Timezone:  req.Timezone,
+		Locale:    req.Locale,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	userID, _ := result.LastInsertId()
-
-	// Create user profile
-	_, err = database.DB.Exec(`
-		INSERT INTO user_profiles (user_id, created_at, updated_at)
-		VALUES (?, ?, ?)`,
-		userID, time.Now(), time.Now())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user profile"})
-		return
-	}
-
-	// Create wallet
-	_, err = database.DB.Exec(`
-		INSERT INTO wallets (user_id, created_at, updated_at)
-		VALUES (?, ?, ?)`,
-		userID, time.Now(), time.Now())
+	// Get created user
+	user, err := h.users.GetByID(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wallet"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(int(userID), req.Email, req.Role)
+	response, err := h.issueTokens(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Get created user
-	user := models.User{}
-	err = database.DB.QueryRow(`
-		SELECT id, email, first_name, last_name, role, is_email_verified, is_active, created_at
-		FROM users WHERE id = ?`, userID).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Role,
-		&user.IsEmailVerified, &user.IsActive, &user.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
+	// The account works without a verified email, but cannot book sessions
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
 	}
 
 	log.Printf("User registration successful for email: %s", req.Email)
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
-// Login handles user authentication
-func Login(c *gin.Context) {
+// Login handles user authentication. Failed attempts are audited and slow
+// down further attempts for the account and for the client's IP address.
+func (h *Handler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	until, err := h.ipBlockedUntil(c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !until.IsZero() {
+		h.recordLogin(c, req.Email, nil, models.LoginIPBlocked)
+		tooManyLoginAttempts(c, until, "Too many failed sign-in attempts from this address; please try again later")
+		return
+	}
+
 	// Get user from database
-	var user models.User
-	var hashedPassword string
-	err := database.DB.QueryRow(`
-		SELECT id, email, password, first_name, last_name, role, is_email_verified, is_active, created_at
-		FROM users WHERE email = ?`, req.Email).Scan(
-		&user.ID, &user.Email, &hashedPassword, &user.FirstName, &user.LastName,
-		&user.Role, &user.IsEmailVerified, &user.IsActive, &user.CreatedAt)
-
-	if err == sql.ErrNoRows {
+	user, err := h.users.GetByEmail(req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.recordLogin(c, req.Email, nil, models.LoginInvalidCredentials)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
@@ -161,58 +167,105 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// The password is not even checked while the account is locked
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		h.recordLogin(c, req.Email, user, models.LoginAccountLocked)
+		tooManyLoginAttempts(c, *user.LockedUntil, "Too many failed sign-in attempts; please try again later")
+		return
+	}
+
 	// Check if user is active
 	if !user.IsActive {
+		h.recordLogin(c, req.Email, user, models.LoginDeactivated)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
 		return
 	}
 
 	// Verify password
-	if !auth.CheckPasswordHash(req.Password, hashedPassword) {
+	if !auth.CheckPasswordHash(req.Password, user.Password) {
+		h.recordLogin(c, req.Email, user, models.LoginInvalidCredentials)
+		if err := h.recordLoginFailure(user); err != nil {
+			log.Printf("Failed to record login failure for user %d: %v", user.ID, err)
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email, user.Role)
+	if err := h.users.ClearLoginFailures(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Accounts with two-factor authentication get their tokens from
+	// LoginTwoFactor once they give a code
+	if user.TwoFactorEnabled {
+		challenge, err := auth.GenerateChallengeToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		h.recordLogin(c, req.Email, user, models.LoginTwoFactorPending)
+		c.JSON(http.StatusOK, TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(auth.ChallengeTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	response, err := h.issueTokens(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	h.recordLogin(c, req.Email, user, models.LoginSucceeded)
+	c.JSON(http.StatusOK, response)
 }
 
-// GetProfile returns the current user's profile
-func GetProfile(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var user models.User
-	err := database.DB.QueryRow(`
-		SELECT id, email,
-		       COALESCE(first_name, '') as first_name,
-		       COALESCE(last_name, '') as last_name,
-		       COALESCE(country, '') as country,
-		       COALESCE(city, '') as city,
-		       COALESCE(gender, '') as gender,
-		       date_of_birth,
-		       COALESCE(profile_pic, '') as profile_pic,
-		       COALESCE(bio, '') as bio,
-		       COALESCE(phone, '') as phone,
-		       COALESCE(is_email_verified, 0) as is_email_verified,
-		       COALESCE(is_phone_verified, 0) as is_phone_verified,
-		       COALESCE(verification_level, 'light') as verification_level,
-		       COALESCE(is_active, 1) as is_active,
-		       role, created_at, updated_at
-		FROM users WHERE id = ?`, userID).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.Country,
-		&user.City, &user.Gender, &user.DateOfBirth, &user.ProfilePic, &user.Bio,
-		&user.Phone, &user.IsEmailVerified, &user.IsPhoneVerified,
-		&user.VerificationLevel, &user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+// issueTokens records a new login session for user on the requesting device
+// and returns its access token and the first token of its refresh family;
+// twoFactor records whether the login passed a second factor
+func (h *Handler) issueTokens(c *gin.Context, user *models.User, twoFactor bool) (*AuthResponse, error) {
+	familyID, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	userAgent := c.Request.UserAgent()
+	sessionID, err := h.logins.Create(&models.LoginSession{
+		UserID:    user.ID,
+		Device:    deviceName(userAgent),
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+		TwoFactor: twoFactor,
+	}, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := auth.GenerateToken(user.ID, sessionID, user.Email, user.Role, user.Roles, twoFactor)
+	if err != nil {
+		return nil, err
+	}
+	refresh, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.tokens.IssueRefresh(user.ID, familyID, hash, time.Now().Add(auth.RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
 
+// GetProfile returns the current user's profile
+func (h *Handler) GetProfile(c *gin.Context) {
+	user, err := h.users.GetByID(currentUserID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile"})
 		return
@@ -222,24 +275,28 @@ func GetProfile(c *gin.Context) {
 }
 
 // UpdateProfile updates the current user's profile
-func UpdateProfile(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
+func (h *Handler) UpdateProfile(c *gin.Context) {
 	var req models.User
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update user profile
-	_, err := database.DB.Exec(`
-		UPDATE users SET first_name = ?, last_name = ?, country = ?, city = ?,
-		               gender = ?, date_of_birth = ?, bio = ?, phone = ?, updated_at = ?
-		WHERE id = ?`,
-		req.FirstName, req.LastName, req.Country, req.City, req.Gender,
-		req.DateOfBirth, req.Bio, req.Phone, time.Now(), userID)
+	if req.Timezone != "" && !validTimezone(req.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+	if req.Locale != "" && !validLocale(req.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale"})
+		return
+	}
+	// Keep a verified number verified when it is sent back formatted differently
+	if phone, ok := normalizePhone(req.Phone); ok {
+		req.Phone = phone
+	}
 
-	if err != nil {
+	// Update user profile
+	if err := h.users.UpdateProfile(currentUserID(c), &req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
@@ -247,25 +304,80 @@ func UpdateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
-// RefreshToken generates a new token
-func RefreshToken(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+// RefreshToken exchanges a refresh token for a new access token and its
+// successor refresh token; each refresh token works only once
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	tokenParts := strings.Split(authHeader, " ")
-	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+	next, nextHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	newToken, err := auth.RefreshToken(tokenParts[1])
+	userID, familyID, err := h.tokens.RotateRefresh(auth.HashToken(req.RefreshToken), nextHash,
+		time.Now().Add(auth.RefreshTokenTTL))
+	if errors.Is(err, repository.ErrTokenReused) {
+		log.Printf("Refresh token reuse detected from %s; token family revoked", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; please sign in again"})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	user, err := h.users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	session, err := h.logins.ForFamily(familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	token, err := auth.GenerateToken(user.ID, session.ID, user.Email, user.Role, user.Roles, session.TwoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: next,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+// GetJWKS publishes the public keys access tokens are signed with
+func (h *Handler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.PublicKeys())
+}
+
+// Logout revokes the refresh token and every token rotated from the same
+// login; access tokens already issued lapse on their own shortly after
+func (h *Handler) Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.tokens.RevokeRefreshFamily(auth.HashToken(req.RefreshToken))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginFixture serves the sign-in routes over users who all have the
+// password "password1": 1 can sign in, 2 is deactivated, 3 is locked for an
+// hour and 4 has two-factor authentication with the recovery code
+// "recovery-code"
+type loginFixture struct {
+	users    *fakeUsers
+	logins   *fakeLogins
+	attempts *fakeLoginAttempts
+	router   *gin.Engine
+}
+
+func newLoginFixture(t *testing.T) *loginFixture {
+	t.Helper()
+	hash, err := auth.HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedUntil := time.Now().Add(time.Hour)
+	user := func(id int, email string) *models.User {
+		return &models.User{ID: id, Email: email, Password: hash, Role: "seeker", IsActive: true}
+	}
+	active, deactivated, locked, twoFactor := user(1, "active@example.com"), user(2, "gone@example.com"),
+		user(3, "locked@example.com"), user(4, "mfa@example.com")
+	deactivated.IsActive = false
+	locked.LockedUntil = &lockedUntil
+	twoFactor.TwoFactorEnabled = true
+
+	f := &loginFixture{
+		users:    newFakeUsers(active, deactivated, locked, twoFactor),
+		logins:   &fakeLogins{},
+		attempts: &fakeLoginAttempts{},
+	}
+	h := &Handler{
+		users:         f.users,
+		tokens:        &fakeTokens{},
+		logins:        f.logins,
+		twoFactor:     newFakeTwoFactor(4, "recovery-code"),
+		loginAttempts: f.attempts,
+	}
+	f.router = gin.New()
+	f.router.POST("/auth/login", h.Login)
+	f.router.POST("/auth/login/2fa", h.LoginTwoFactor)
+	f.router.POST("/auth/refresh", h.RefreshToken)
+	return f
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+		wantResult string // the audited result, if any
+	}{
+		{"signs in", `{"email":"active@example.com","password":"password1"}`, http.StatusOK, "", models.LoginSucceeded},
+		{"wrong password", `{"email":"active@example.com","password":"nope"}`, http.StatusUnauthorized, "Invalid email or password", models.LoginInvalidCredentials},
+		{"unknown email", `{"email":"nobody@example.com","password":"password1"}`, http.StatusUnauthorized, "Invalid email or password", models.LoginInvalidCredentials},
+		{"deactivated", `{"email":"gone@example.com","password":"password1"}`, http.StatusUnauthorized, "Account is deactivated", models.LoginDeactivated},
+		{"locked", `{"email":"locked@example.com","password":"password1"}`, http.StatusTooManyRequests, "Too many failed sign-in attempts; please try again later", models.LoginAccountLocked},
+		{"two-factor", `{"email":"mfa@example.com","password":"password1"}`, http.StatusOK, "", models.LoginTwoFactorPending},
+		{"missing password", `{"email":"active@example.com"}`, http.StatusBadRequest, "", ""},
+		{"not JSON", `email=active@example.com`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLoginFixture(t)
+			w := serve(f.router, http.MethodPost, "/auth/login", tt.body)
+			expectStatus(t, w, tt.wantStatus)
+			body := decode(t, w)
+
+			if tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+			results := f.attempts.results()
+			if tt.wantResult == "" && len(results) != 0 {
+				t.Errorf("audited %v for a malformed request", results)
+			}
+			if tt.wantResult != "" && (len(results) != 1 || results[0] != tt.wantResult) {
+				t.Errorf("audited %v, want [%s]", results, tt.wantResult)
+			}
+			if tt.wantResult != models.LoginSucceeded {
+				if body["token"] != nil || len(f.logins.created) != 0 {
+					t.Errorf("issued a token or login session: %v", body)
+				}
+				return
+			}
+			token, _ := body["token"].(string)
+			claims, err := auth.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("issued token does not validate: %v", err)
+			}
+			if claims.UserID != 1 || claims.SessionID != 1 || claims.Email != "active@example.com" || claims.TwoFactor {
+				t.Errorf("claims = %+v, want user 1 without a second factor", claims)
+			}
+			if user, _ := body["user"].(map[string]interface{}); user["password"] != nil {
+				t.Error("response leaks the password hash")
+			}
+			if refresh, _ := body["refresh_token"].(string); refresh == "" {
+				t.Error("no refresh token issued")
+			}
+		})
+	}
+}
+
+func TestLoginLocksAfterRepeatedFailures(t *testing.T) {
+	f := newLoginFixture(t)
+
+	wrong := `{"email":"active@example.com","password":"nope"}`
+	for i := 0; i <= loginFreeFailures; i++ {
+		expectStatus(t, serve(f.router, http.MethodPost, "/auth/login", wrong), http.StatusUnauthorized)
+	}
+	if f.users.byID[1].LockedUntil == nil {
+		t.Fatalf("account not locked after %d failures", loginFreeFailures+1)
+	}
+
+	// The right password no longer helps until the lock runs out
+	w := serve(f.router, http.MethodPost, "/auth/login", `{"email":"active@example.com","password":"password1"}`)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("locked response has no Retry-After header")
+	}
+}
+
+func TestLoginClearsFailuresOnSuccess(t *testing.T) {
+	f := newLoginFixture(t)
+
+	wrong := `{"email":"active@example.com","password":"nope"}`
+	for i := 0; i < loginFreeFailures; i++ {
+		expectStatus(t, serve(f.router, http.MethodPost, "/auth/login", wrong), http.StatusUnauthorized)
+	}
+	expectStatus(t, serve(f.router, http.MethodPost, "/auth/login", `{"email":"active@example.com","password":"password1"}`), http.StatusOK)
+	if f.users.failures[1] != 0 {
+		t.Errorf("failures = %d after signing in, want 0", f.users.failures[1])
+	}
+}
+
+func TestLoginBlocksNoisyAddress(t *testing.T) {
+	f := newLoginFixture(t)
+
+	// httptest requests come from 192.0.2.1
+	for i := 0; i <= loginIPFreeFailures; i++ {
+		f.attempts.Record(&models.LoginAttempt{
+			Email: "someone@example.com", IPAddress: "192.0.2.1", Result: models.LoginInvalidCredentials,
+		})
+	}
+
+	w := serve(f.router, http.MethodPost, "/auth/login", `{"email":"active@example.com","password":"password1"}`)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	results := f.attempts.results()
+	if last := results[len(results)-1]; last != models.LoginIPBlocked {
+		t.Errorf("audited %s, want %s", last, models.LoginIPBlocked)
+	}
+	if f.users.failures[1] != 0 {
+		t.Error("a blocked address counted a failure against the account")
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{loginFreeFailures, 0},
+		{loginFreeFailures + 1, loginBackoffBase},
+		{loginFreeFailures + 2, 2 * loginBackoffBase},
+		{loginFreeFailures + 3, 4 * loginBackoffBase},
+		{loginFreeFailures + 50, loginBackoffMax},
+	}
+	for _, tt := range tests {
+		if got := loginBackoff(tt.failures, loginFreeFailures); got != tt.want {
+			t.Errorf("loginBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	router := newLoginFixture(t).router
+	w := serve(router, http.MethodPost, "/auth/login", `{"email":"active@example.com","password":"password1"}`)
+	expectStatus(t, w, http.StatusOK)
+	first, _ := decode(t, w)["refresh_token"].(string)
+
+	w = serve(router, http.MethodPost, "/auth/refresh", `{"refresh_token":"`+first+`"}`)
+	expectStatus(t, w, http.StatusOK)
+	body := decode(t, w)
+	second, _ := body["refresh_token"].(string)
+	if second == "" || second == first {
+		t.Errorf("refresh returned %q after %q, want a new refresh token", second, first)
+	}
+	token, _ := body["token"].(string)
+	if claims, err := auth.ValidateToken(token); err != nil || claims.UserID != 1 || claims.SessionID != 1 {
+		t.Errorf("refreshed access token = %+v, %v", claims, err)
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"reused", `{"refresh_token":"` + first + `"}`, "Refresh token has already been used; please sign in again"},
+		{"unknown", `{"refresh_token":"forged"}`, "Invalid refresh token"},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodPost, "/auth/refresh", tt.body)
+		expectStatus(t, w, http.StatusUnauthorized)
+		if body := decode(t, w); body["error"] != tt.wantError {
+			t.Errorf("%s: error = %v, want %q", tt.name, body["error"], tt.wantError)
+		}
+	}
+	expectStatus(t, serve(router, http.MethodPost, "/auth/refresh", `{}`), http.StatusBadRequest)
+}
+
+func TestLoginTwoFactorChallenge(t *testing.T) {
+	f := newLoginFixture(t)
+	router := f.router
+
+	w := serve(router, http.MethodPost, "/auth/login", `{"email":"mfa@example.com","password":"password1"}`)
+	expectStatus(t, w, http.StatusOK)
+	body := decode(t, w)
+	if body["two_factor_required"] != true || body["token"] != nil {
+		t.Fatalf("response %v does not ask for a second factor", body)
+	}
+	challenge, _ := body["challenge_token"].(string)
+	if userID, err := auth.ValidateChallengeToken(challenge); err != nil || userID != 4 {
+		t.Fatalf("challenge token names user %d, %v; want 4", userID, err)
+	}
+
+	login := func(code string) *httptest.ResponseRecorder {
+		return serve(router, http.MethodPost, "/auth/login/2fa",
+			`{"challenge_token":"`+challenge+`","code":"`+code+`"}`)
+	}
+	expectStatus(t, login("000000"), http.StatusUnauthorized)
+
+	// Recovery codes are typed back however is convenient, and work once
+	w = login("RECOVERY CODE")
+	expectStatus(t, w, http.StatusOK)
+	token, _ := decode(t, w)["token"].(string)
+	if claims, err := auth.ValidateToken(token); err != nil || claims.UserID != 4 || !claims.TwoFactor {
+		t.Errorf("claims = %+v, %v, want user 4 with a second factor", claims, err)
+	}
+	expectStatus(t, login("recovery-code"), http.StatusUnauthorized)
+
+	want := []string{models.LoginTwoFactorPending, models.LoginInvalidCode, models.LoginSucceeded, models.LoginInvalidCode}
+	if got := f.attempts.results(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("audited %v, want %v", got, want)
+	}
+
+	// The challenge is no access token
+	w = serve(router, http.MethodPost, "/auth/login/2fa", `{"challenge_token":"`+token+`","code":"recovery-code"}`)
+	expectStatus(t, w, http.StatusUnauthorized)
+}
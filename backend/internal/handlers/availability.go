@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"synapmentor/internal/availability"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSlotDays bounds the number of days a single slots request may cover
+const maxSlotDays = 31
+
+// AvailabilityRulesRequest replaces a solver's weekly availability
+type AvailabilityRulesRequest struct {
+	Rules []availability.Rule `json:"rules" binding:"dive"`
+}
+
+// GetAvailability returns the current solver's weekly rules and upcoming exceptions
+func (h *Handler) GetAvailability(c *gin.Context) {
+	if !requireSolver(c) {
+		return
+	}
+	userID := currentUserID(c)
+
+	rules, err := h.availability.Rules(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get availability"})
+		return
+	}
+
+	now := time.Now().UTC()
+	exceptions, err := h.availability.Exceptions(userID, now, now.AddDate(1, 0, 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules":      rules,
+		"exceptions": exceptions,
+	})
+}
+
+// ReplaceAvailabilityRules sets the current solver's weekly availability
+func (h *Handler) ReplaceAvailabilityRules(c *gin.Context) {
+	if !requireSolver(c) {
+		return
+	}
+
+	var req AvailabilityRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.availability.ReplaceRules(currentUserID(c), req.Rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Availability updated successfully"})
+}
+
+// AddAvailabilityException blocks or opens a dated period for the current solver
+func (h *Handler) AddAvailabilityException(c *gin.Context) {
+	if !requireSolver(c) {
+		return
+	}
+
+	var req availability.Exception
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := h.availability.AddException(currentUserID(c), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add exception"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Exception added successfully",
+		"id":      id,
+	})
+}
+
+// DeleteAvailabilityException removes one of the current solver's exceptions
+func (h *Handler) DeleteAvailabilityException(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exception not found"})
+		return
+	}
+
+	err := h.availability.DeleteException(currentUserID(c), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exception not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exception"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exception deleted successfully"})
+}
+
+// GetSolverSlots returns a solver's open slots between the from and to dates
+// (YYYY-MM-DD in the caller's time zone, to inclusive) for sessions of the
+// given duration in minutes
+func (h *Handler) GetSolverSlots(c *gin.Context) {
+	solverID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Solver not found"})
+		return
+	}
+
+	// Dates are days on the caller's calendar
+	loc := h.userLocation(c)
+	from, err := time.ParseInLocation("2006-01-02", c.Query("from"), loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD)"})
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", c.DefaultQuery("to", c.Query("from")), loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD)"})
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) || to.After(from.AddDate(0, 0, maxSlotDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range must cover 1 to 31 days"})
+		return
+	}
+
+	duration := queryInt(c, "duration", 60)
+	if duration < 15 || duration > 480 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be between 15 and 480 minutes"})
+		return
+	}
+
+	// Slots in the past cannot be booked
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusOK, []availability.Interval{})
+		return
+	}
+
+	solver, err := h.users.GetByID(solverID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !solver.HasRole(models.RoleSolver)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Solver not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get solver"})
+		return
+	}
+
+	slots, err := h.availability.Slots(solverID, from, to, time.Duration(duration)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get slots"})
+		return
+	}
+	for i := range slots {
+		slots[i].Start, slots[i].End = slots[i].Start.In(loc), slots[i].End.In(loc)
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+// requireSolver rejects users who are not solvers
+func requireSolver(c *gin.Context) bool {
+	if !hasRole(c, models.RoleSolver) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only solvers have an availability calendar"})
+		return false
+	}
+	return true
+}
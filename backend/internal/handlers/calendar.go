@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/ical"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uidDomain qualifies calendar UIDs so they are globally unique
+const uidDomain = "synapmentor.com"
+
+// feedHistory is how far back a calendar feed reaches
+const feedHistory = 90 * 24 * time.Hour
+
+// CreateCalendarFeed issues a new secret feed URL for the current user,
+// invalidating any previous one
+func (h *Handler) CreateCalendarFeed(c *gin.Context) {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed"})
+		return
+	}
+
+	if err := h.calendar.SetFeedToken(currentUserID(c), hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Calendar feed created; keep this URL private",
+		"url":     publicURL(c, "/api/v1/ical/"+token+".ics"),
+	})
+}
+
+// DeleteCalendarFeed revokes the current user's feed URL
+func (h *Handler) DeleteCalendarFeed(c *gin.Context) {
+	err := h.calendar.DeleteFeed(currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No calendar feed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed deleted"})
+}
+
+// GetCalendarFeed serves the iCal feed behind a secret token; calendar
+// clients cannot send credentials, so the token is the authentication
+func (h *Handler) GetCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	userID, err := h.calendar.FeedOwner(auth.HashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+
+	since := time.Now().Add(-feedHistory)
+	sessions, err := h.calendar.Sessions(userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+	events, err := h.calendar.Events(userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+
+	cal := ical.Calendar{Name: "SynapMentor", Method: ical.MethodPublish}
+	for _, s := range sessions {
+		cal.Events = append(cal.Events, sessionEntry(&s))
+	}
+	for _, e := range events {
+		cal.Events = append(cal.Events, eventEntry(&e))
+	}
+
+	writeCalendar(c, &cal, "")
+}
+
+// GetSessionICS returns an invitation for one session, or a cancellation
+// once it has been called off
+func (h *Handler) GetSessionICS(c *gin.Context) {
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	userID := currentUserID(c)
+	if userID != session.SolverID && userID != session.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to view this session"})
+		return
+	}
+
+	entry, err := h.calendar.Session(session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		return
+	}
+
+	event := sessionEntry(entry)
+	method := ical.MethodRequest
+	if event.Status == ical.StatusCancelled {
+		method = ical.MethodCancel
+	}
+
+	writeCalendar(c, &ical.Calendar{Method: method, Events: []ical.Event{event}},
+		fmt.Sprintf("session-%d.ics", session.ID))
+}
+
+// sessionEntry maps a session onto a calendar event
+func sessionEntry(s *repository.CalendarSession) ical.Event {
+	status := ical.StatusConfirmed
+	switch s.Status {
+	case models.SessionRequested:
+		status = ical.StatusTentative
+	case models.SessionCancelled, models.SessionNoShow:
+		status = ical.StatusCancelled
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("session-%d@%s", s.ID, uidDomain),
+		Sequence:    s.Sequence,
+		Start:       s.ScheduledAt,
+		End:         s.ScheduledAt.Add(time.Duration(s.Duration) * time.Minute),
+		Summary:     s.Title,
+		Description: s.Description,
+		Status:      status,
+		Organizer:   &ical.Attendee{Name: s.SolverName, Email: s.SolverEmail},
+		Attendees:   []ical.Attendee{{Name: s.SeekerName, Email: s.SeekerEmail}},
+		Updated:     s.UpdatedAt,
+	}
+}
+
+// eventEntry maps a community event onto a calendar event
+func eventEntry(e *repository.CalendarEvent) ical.Event {
+	status := ical.StatusConfirmed
+	if !e.IsActive {
+		status = ical.StatusCancelled
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", e.ID, uidDomain),
+		Sequence:    e.Sequence,
+		Start:       e.EventDate,
+		End:         e.EventDate.Add(time.Duration(e.Duration) * time.Minute),
+		Summary:     e.Title,
+		Description: e.Description,
+		Status:      status,
+		Organizer:   &ical.Attendee{Name: e.OrganizerName, Email: e.OrganizerEmail},
+		Updated:     e.UpdatedAt,
+	}
+}
+
+// writeCalendar sends an iCalendar document, as a download when filename is set
+func writeCalendar(c *gin.Context, cal *ical.Calendar, filename string) {
+	var buf bytes.Buffer
+	if err := cal.Write(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render calendar"})
+		return
+	}
+
+	contentType := "text/calendar; charset=utf-8"
+	if cal.Method != "" {
+		contentType += "; method=" + cal.Method
+	}
+	if filename != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// publicURL builds an absolute URL for path, using PUBLIC_BASE_URL when set
+// and the request's own host otherwise
+func publicURL(c *gin.Context, path string) string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/") + path
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + path
+}
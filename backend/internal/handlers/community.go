@@ -0,0 +1,825 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPageSize caps the limit parameter of cursor-paginated listings
+const maxPageSize = 100
+
+// maxReplyDepth is how deeply replies may nest below a discussion
+const maxReplyDepth = 8
+
+// anonymousName stands in for the author of an anonymous post
+const anonymousName = "Anonymous"
+
+// CommunityRequest creates or updates a community
+type CommunityRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=2000"`
+	Category    string `json:"category" binding:"max=50"`
+}
+
+// MemberRoleRequest changes a member's role in a community
+type MemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=moderator member"`
+}
+
+// DiscussionRequest starts a discussion; CommunityID is taken from the path
+// when the route has one
+type DiscussionRequest struct {
+	CommunityID int    `json:"community_id"`
+	Title       string `json:"title" binding:"required,max=200"`
+	Content     string `json:"content" binding:"required,max=20000"`
+	IsAnonymous bool   `json:"is_anonymous"`
+}
+
+// UpdateDiscussionRequest edits a discussion
+type UpdateDiscussionRequest struct {
+	Title   string `json:"title" binding:"required,max=200"`
+	Content string `json:"content" binding:"required,max=20000"`
+}
+
+// ReplyRequest answers a discussion, or another reply when ParentID is set
+type ReplyRequest struct {
+	Content     string `json:"content" binding:"required,max=10000"`
+	ParentID    *int   `json:"parent_id"`
+	IsAnonymous bool   `json:"is_anonymous"`
+}
+
+// UpdateReplyRequest edits a reply
+type UpdateReplyRequest struct {
+	Content string `json:"content" binding:"required,max=10000"`
+}
+
+// encodeCursor turns the id of the last item on a page into the opaque
+// cursor that fetches the next one
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// queryCursor decodes the cursor query parameter, 0 when absent. It writes
+// the error response itself when the cursor is malformed.
+func queryCursor(c *gin.Context) (int, bool) {
+	cursor := c.Query("cursor")
+	if cursor == "" {
+		return 0, true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	id, convErr := strconv.Atoi(string(b))
+	if err != nil || convErr != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return 0, false
+	}
+	return id, true
+}
+
+// pageLimit reads the limit query parameter of a cursor-paginated listing
+func pageLimit(c *gin.Context) int {
+	limit := queryInt(c, "limit", 20)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit
+}
+
+// cursorPage writes one page of a listing; listings fetch one item more than
+// limit so that more tells whether another page follows lastID
+func cursorPage(c *gin.Context, items interface{}, more bool, lastID int) {
+	response := gin.H{"items": items, "next_cursor": nil}
+	if more {
+		response["next_cursor"] = encodeCursor(lastID)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// hideDiscussionAuthor hides who wrote an anonymous discussion from everyone
+// but its author and the community's moderators
+func hideDiscussionAuthor(d *models.Discussion, viewerID int, moderator bool) {
+	if d.IsAnonymous && d.UserID != viewerID && !moderator {
+		d.UserID, d.AuthorName = 0, anonymousName
+	}
+}
+
+// hideReplyAuthor hides who wrote an anonymous or deleted reply from
+// everyone but its author and the community's moderators
+func hideReplyAuthor(r *models.DiscussionReply, viewerID int, moderator bool) {
+	if r.UserID == viewerID || moderator {
+		return
+	}
+	switch {
+	case r.IsDeleted:
+		r.UserID, r.AuthorName = 0, ""
+	case r.IsAnonymous:
+		r.UserID, r.AuthorName = 0, anonymousName
+	}
+}
+
+// moderatesCommunity reports whether the current user moderates a community,
+// as its owner, one of its moderators or through the content:moderate
+// permission
+func (h *Handler) moderatesCommunity(c *gin.Context, communityID int) (bool, error) {
+	role, err := h.communities.MemberRole(communityID, currentUserID(c))
+	if err != nil {
+		return false, err
+	}
+	if role == models.CommunityRoleOwner || role == models.CommunityRoleModerator {
+		return true, nil
+	}
+	return h.can(c, models.PermContentModerate)
+}
+
+// loadCommunity fetches the active community named by the path parameter
+// key, writing the error response itself when it cannot
+func (h *Handler) loadCommunity(c *gin.Context, key string) (*models.Community, bool) {
+	id, ok := paramID(c, key)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return nil, false
+	}
+	community, err := h.communities.Get(id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get community"})
+		return nil, false
+	}
+	return community, true
+}
+
+// loadOwnedCommunity fetches the community named by :id and checks that the
+// current user owns it or holds content:moderate, writing the error response
+// itself when not
+func (h *Handler) loadOwnedCommunity(c *gin.Context) (*models.Community, bool) {
+	community, ok := h.loadCommunity(c, "id")
+	if !ok {
+		return nil, false
+	}
+	if community.Role == models.CommunityRoleOwner {
+		return community, true
+	}
+	allowed, err := h.can(c, models.PermContentModerate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can manage this community"})
+		return nil, false
+	}
+	return community, true
+}
+
+// GetCommunities lists active communities, optionally only those the
+// current user belongs to
+func (h *Handler) GetCommunities(c *gin.Context) {
+	after, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit := pageLimit(c)
+
+	filter := repository.CommunityFilter{
+		ViewerID: currentUserID(c),
+		Category: c.Query("category"),
+		Query:    strings.ToLower(strings.TrimSpace(c.Query("q"))),
+		After:    after,
+		Limit:    limit + 1,
+	}
+	if c.Query("mine") == "true" {
+		filter.MemberID = currentUserID(c)
+	}
+
+	communities, err := h.communities.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get communities"})
+		return
+	}
+	if communities == nil {
+		communities = []models.Community{}
+	}
+
+	more := len(communities) > limit
+	if more {
+		communities = communities[:limit]
+	}
+	lastID := 0
+	if len(communities) > 0 {
+		lastID = communities[len(communities)-1].ID
+	}
+	cursorPage(c, communities, more, lastID)
+}
+
+// CreateCommunity starts a community owned by the current user
+func (h *Handler) CreateCommunity(c *gin.Context) {
+	var req CommunityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := h.communities.Create(currentUserID(c), &models.Community{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Category:    req.Category,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create community"})
+		return
+	}
+
+	community, err := h.communities.Get(id, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get community"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, community)
+}
+
+// GetCommunity returns a community with the current user's role in it
+func (h *Handler) GetCommunity(c *gin.Context) {
+	community, ok := h.loadCommunity(c, "id")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, community)
+}
+
+// UpdateCommunity changes a community's name, description and category
+func (h *Handler) UpdateCommunity(c *gin.Context) {
+	var req CommunityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	community, ok := h.loadOwnedCommunity(c)
+	if !ok {
+		return
+	}
+
+	community.Name = strings.TrimSpace(req.Name)
+	community.Description = req.Description
+	community.Category = req.Category
+	if err := h.communities.Update(community.ID, community); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update community"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Community updated successfully"})
+}
+
+// DeleteCommunity deactivates a community, hiding it and its discussions
+func (h *Handler) DeleteCommunity(c *gin.Context) {
+	community, ok := h.loadOwnedCommunity(c)
+	if !ok {
+		return
+	}
+
+	if err := h.communities.Delete(community.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete community"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Community deleted successfully"})
+}
+
+// JoinCommunity makes the current user a member of a community
+func (h *Handler) JoinCommunity(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return
+	}
+
+	err := h.communities.Join(id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already a member of this community"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join community"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Joined community"})
+}
+
+// LeaveCommunity ends the current user's membership of a community
+func (h *Handler) LeaveCommunity(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return
+	}
+
+	err := h.communities.Leave(id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this community"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The owner cannot leave the community"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave community"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left community"})
+}
+
+// GetCommunityMembers lists the members of a community
+func (h *Handler) GetCommunityMembers(c *gin.Context) {
+	community, ok := h.loadCommunity(c, "id")
+	if !ok {
+		return
+	}
+	after, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit := pageLimit(c)
+
+	members, err := h.communities.Members(community.ID, after, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get members"})
+		return
+	}
+	if members == nil {
+		members = []models.CommunityMember{}
+	}
+
+	more := len(members) > limit
+	if more {
+		members = members[:limit]
+	}
+	lastID := 0
+	if len(members) > 0 {
+		lastID = members[len(members)-1].UserID
+	}
+	cursorPage(c, members, more, lastID)
+}
+
+// SetCommunityMemberRole makes a member a moderator of a community or takes
+// that away again
+func (h *Handler) SetCommunityMemberRole(c *gin.Context) {
+	var req MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	community, ok := h.loadOwnedCommunity(c)
+	if !ok {
+		return
+	}
+	userID, ok := paramID(c, "user_id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	err := h.communities.SetMemberRole(community.ID, userID, req.Role)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The owner's role cannot be changed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated"})
+}
+
+// GetDiscussions lists discussions, newest first, in the community named by
+// the path or the community_id parameter, or across all communities
+func (h *Handler) GetDiscussions(c *gin.Context) {
+	before, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit := pageLimit(c)
+
+	filter := repository.DiscussionFilter{Before: before, Limit: limit + 1}
+	if c.Param("id") != "" {
+		community, ok := h.loadCommunity(c, "id")
+		if !ok {
+			return
+		}
+		filter.CommunityID = community.ID
+	} else {
+		filter.CommunityID = queryInt(c, "community_id", 0)
+	}
+
+	discussions, err := h.discussions.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get discussions"})
+		return
+	}
+	if discussions == nil {
+		discussions = []models.Discussion{}
+	}
+
+	more := len(discussions) > limit
+	if more {
+		discussions = discussions[:limit]
+	}
+
+	// Listings may span communities, each with its own moderators
+	moderates := map[int]bool{}
+	for i := range discussions {
+		d := &discussions[i]
+		moderator, seen := moderates[d.CommunityID]
+		if !seen && d.IsAnonymous {
+			if moderator, err = h.moderatesCommunity(c, d.CommunityID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				return
+			}
+			moderates[d.CommunityID] = moderator
+		}
+		hideDiscussionAuthor(d, currentUserID(c), moderator)
+	}
+
+	lastID := 0
+	if len(discussions) > 0 {
+		lastID = discussions[len(discussions)-1].ID
+	}
+	cursorPage(c, discussions, more, lastID)
+}
+
+// CreateDiscussion starts a discussion in a community the current user
+// belongs to, optionally without showing who they are
+func (h *Handler) CreateDiscussion(c *gin.Context) {
+	var req DiscussionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var community *models.Community
+	if c.Param("id") != "" {
+		var ok bool
+		if community, ok = h.loadCommunity(c, "id"); !ok {
+			return
+		}
+	} else {
+		if req.CommunityID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "community_id is required"})
+			return
+		}
+		var err error
+		community, err = h.communities.Get(req.CommunityID, currentUserID(c))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get community"})
+			return
+		}
+	}
+	if community.Role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Join the community to post in it"})
+		return
+	}
+
+	discussion := models.Discussion{
+		CommunityID: community.ID,
+		UserID:      currentUserID(c),
+		Title:       strings.TrimSpace(req.Title),
+		Content:     req.Content,
+		IsAnonymous: req.IsAnonymous,
+	}
+	id, err := h.discussions.Create(&discussion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create discussion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Discussion created successfully",
+		"discussion_id": id,
+	})
+}
+
+// loadDiscussion fetches the discussion named by :id, writing the error
+// response itself when it cannot
+func (h *Handler) loadDiscussion(c *gin.Context) (*models.Discussion, bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Discussion not found"})
+		return nil, false
+	}
+	discussion, err := h.discussions.Get(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Discussion not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get discussion"})
+		return nil, false
+	}
+	return discussion, true
+}
+
+// GetDiscussion returns a discussion
+func (h *Handler) GetDiscussion(c *gin.Context) {
+	discussion, ok := h.loadDiscussion(c)
+	if !ok {
+		return
+	}
+	moderator, err := h.moderatesCommunity(c, discussion.CommunityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
+	hideDiscussionAuthor(discussion, currentUserID(c), moderator)
+	c.JSON(http.StatusOK, discussion)
+}
+
+// UpdateDiscussion lets the author edit a discussion
+func (h *Handler) UpdateDiscussion(c *gin.Context) {
+	var req UpdateDiscussionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discussion, ok := h.loadDiscussion(c)
+	if !ok {
+		return
+	}
+	if discussion.UserID != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this discussion"})
+		return
+	}
+
+	if err := h.discussions.Update(discussion.ID, strings.TrimSpace(req.Title), req.Content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update discussion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Discussion updated successfully"})
+}
+
+// DeleteDiscussion removes a discussion and its replies; the author and the
+// community's moderators may do this
+func (h *Handler) DeleteDiscussion(c *gin.Context) {
+	discussion, ok := h.loadDiscussion(c)
+	if !ok {
+		return
+	}
+	if discussion.UserID != currentUserID(c) {
+		moderator, err := h.moderatesCommunity(c, discussion.CommunityID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !moderator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to delete this discussion"})
+			return
+		}
+	}
+
+	if err := h.discussions.Delete(discussion.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete discussion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Discussion deleted successfully"})
+}
+
+// GetReplies lists the replies to a discussion, oldest first; each names its
+// parent_id so clients can build the thread
+func (h *Handler) GetReplies(c *gin.Context) {
+	discussion, ok := h.loadDiscussion(c)
+	if !ok {
+		return
+	}
+	after, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit := pageLimit(c)
+
+	replies, err := h.discussions.Replies(discussion.ID, after, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get replies"})
+		return
+	}
+	if replies == nil {
+		replies = []models.DiscussionReply{}
+	}
+	moderator, err := h.moderatesCommunity(c, discussion.CommunityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+
+	more := len(replies) > limit
+	if more {
+		replies = replies[:limit]
+	}
+	for i := range replies {
+		hideReplyAuthor(&replies[i], currentUserID(c), moderator)
+	}
+
+	lastID := 0
+	if len(replies) > 0 {
+		lastID = replies[len(replies)-1].ID
+	}
+	cursorPage(c, replies, more, lastID)
+}
+
+// CreateReply answers a discussion, or one of its replies when parent_id is
+// given, and notifies whoever is being answered
+func (h *Handler) CreateReply(c *gin.Context) {
+	var req ReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discussion, ok := h.loadDiscussion(c)
+	if !ok {
+		return
+	}
+	userID := currentUserID(c)
+
+	role, err := h.communities.MemberRole(discussion.CommunityID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Join the community to post in it"})
+		return
+	}
+
+	notify := discussion.UserID
+	if req.ParentID != nil {
+		parent, err := h.discussions.GetReply(*req.ParentID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && parent.DiscussionID != discussion.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent_id is not a reply in this discussion"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reply"})
+			return
+		}
+		if parent.IsDeleted {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot reply to a deleted reply"})
+			return
+		}
+		if parent.Depth+1 >= maxReplyDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Replies cannot be nested more than " + strconv.Itoa(maxReplyDepth) + " levels deep"})
+			return
+		}
+		notify = parent.UserID
+	}
+
+	reply := models.DiscussionReply{
+		DiscussionID: discussion.ID,
+		ParentID:     req.ParentID,
+		UserID:       userID,
+		Content:      req.Content,
+		IsAnonymous:  req.IsAnonymous,
+	}
+	id, err := h.discussions.CreateReply(&reply)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply"})
+		return
+	}
+	created, err := h.discussions.GetReply(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reply"})
+		return
+	}
+
+	if notify != userID {
+		h.notifications.Create(notify, "New Reply", "Someone replied in the discussion: "+discussion.Title, "in_app")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Reply created successfully",
+		"reply":   created,
+	})
+}
+
+// loadReply fetches the reply named by :id, writing the error response
+// itself when it cannot
+func (h *Handler) loadReply(c *gin.Context) (*models.DiscussionReply, bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return nil, false
+	}
+	reply, err := h.discussions.GetReply(id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && reply.IsDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reply"})
+		return nil, false
+	}
+	return reply, true
+}
+
+// UpdateReply lets the author edit a reply
+func (h *Handler) UpdateReply(c *gin.Context) {
+	var req UpdateReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reply, ok := h.loadReply(c)
+	if !ok {
+		return
+	}
+	if reply.UserID != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this reply"})
+		return
+	}
+
+	err := h.discussions.UpdateReply(reply.ID, req.Content)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reply updated successfully"})
+}
+
+// DeleteReply blanks a reply, keeping its place in the thread; the author and
+// the community's moderators may do this
+func (h *Handler) DeleteReply(c *gin.Context) {
+	reply, ok := h.loadReply(c)
+	if !ok {
+		return
+	}
+	if reply.UserID != currentUserID(c) {
+		discussion, err := h.discussions.Get(reply.DiscussionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get discussion"})
+			return
+		}
+		moderator, err := h.moderatesCommunity(c, discussion.CommunityID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !moderator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to delete this reply"})
+			return
+		}
+	}
+
+	err := h.discussions.DeleteReply(reply.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reply not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reply deleted successfully"})
+}
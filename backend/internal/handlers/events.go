@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventRequest creates or updates an event; leaving MaxAttendees out means
+// anyone may come and leaving Price out that the event is free
+type EventRequest struct {
+	Title        string    `json:"title" binding:"required,max=200"`
+	Description  string    `json:"description" binding:"max=5000"`
+	EventDate    time.Time `json:"event_date" binding:"required"`
+	Duration     int       `json:"duration" binding:"omitempty,min=15,max=1440"` // minutes, 60 by default
+	MaxAttendees *int      `json:"max_attendees" binding:"omitempty,min=1"`
+	Category     string    `json:"category" binding:"max=50"`
+	Price        float64   `json:"price" binding:"min=0"` // per ticket
+}
+
+// bindEvent reads an EventRequest into an event, writing the error response
+// itself when the request is invalid
+func bindEvent(c *gin.Context) (*models.Event, bool) {
+	var req EventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !req.EventDate.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event date must be in the future"})
+		return nil, false
+	}
+	if req.Duration == 0 {
+		req.Duration = 60
+	}
+
+	return &models.Event{
+		Title:        strings.TrimSpace(req.Title),
+		Description:  req.Description,
+		EventDate:    req.EventDate,
+		Duration:     req.Duration,
+		MaxAttendees: req.MaxAttendees,
+		Category:     req.Category,
+		Price:        req.Price,
+	}, true
+}
+
+// canSellTickets checks that the current user may charge for tickets to an
+// event and has a wallet to be paid into, writing the error response itself
+// when not
+func (h *Handler) canSellTickets(c *gin.Context) bool {
+	if !h.requireLevel(c, policy.SellTickets, 0) {
+		return false
+	}
+	_, err := h.wallets.GetByUserID(currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You need a wallet to sell tickets"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get wallet"})
+		return false
+	}
+	return true
+}
+
+// loadEvent fetches the event named by :id, writing the error response
+// itself when it cannot
+func (h *Handler) loadEvent(c *gin.Context) (*models.Event, bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return nil, false
+	}
+	event, err := h.events.Get(id, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get event"})
+		return nil, false
+	}
+	return event, true
+}
+
+// loadOrganizedEvent fetches the active event named by :id and checks that
+// the current user organises it, writing the error response itself when not
+func (h *Handler) loadOrganizedEvent(c *gin.Context) (*models.Event, bool) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return nil, false
+	}
+	if event.CreatedBy != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the organizer can manage this event"})
+		return nil, false
+	}
+	if !event.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has been cancelled"})
+		return nil, false
+	}
+	return event, true
+}
+
+// notifyPromoted tells users taken off an event's waitlist that they have a spot
+func (h *Handler) notifyPromoted(promoted []int, event *models.Event) {
+	for _, userID := range promoted {
+		h.notifications.Create(userID, "Spot Available",
+			"A spot opened up and you are now going to "+event.Title, "in_app")
+	}
+}
+
+// GetEvents lists upcoming events, soonest first, optionally only those the
+// current user organises
+func (h *Handler) GetEvents(c *gin.Context) {
+	filter := repository.EventFilter{
+		ViewerID: currentUserID(c),
+		Category: c.Query("category"),
+		From:     time.Now(),
+		Limit:    queryInt(c, "limit", 20),
+		Offset:   queryInt(c, "offset", 0),
+	}
+	if c.Query("mine") == "true" {
+		filter.OrganizerID = currentUserID(c)
+	}
+
+	events, err := h.events.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get events"})
+		return
+	}
+	if events == nil {
+		events = []models.Event{}
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// CreateEvent schedules an event organised by the current user, who must be
+// a solver
+func (h *Handler) CreateEvent(c *gin.Context) {
+	if !hasRole(c, models.RoleSolver) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only solvers can organise events"})
+		return
+	}
+
+	event, ok := bindEvent(c)
+	if !ok {
+		return
+	}
+	if event.Price > 0 && !h.canSellTickets(c) {
+		return
+	}
+	event.CreatedBy = currentUserID(c)
+
+	id, err := h.events.Create(event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		return
+	}
+
+	created, err := h.events.Get(id, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get event"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetEvent returns an event with the current user's RSVP to it
+func (h *Handler) GetEvent(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// UpdateEvent changes an event's details. Raising the capacity promotes
+// people from the waitlist; it cannot drop below the attendees already going.
+// A new price only applies to tickets bought from then on.
+func (h *Handler) UpdateEvent(c *gin.Context) {
+	update, ok := bindEvent(c)
+	if !ok {
+		return
+	}
+
+	event, ok := h.loadOrganizedEvent(c)
+	if !ok {
+		return
+	}
+	if update.Price > 0 && !h.canSellTickets(c) {
+		return
+	}
+
+	promoted, err := h.events.Update(event.ID, update)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Capacity cannot be below the number of attendees already going"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+		return
+	}
+	h.notifyPromoted(promoted, update)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event updated successfully"})
+}
+
+// DeleteEvent cancels an event, refunding every ticket, and tells everyone
+// who responded to it
+func (h *Handler) DeleteEvent(c *gin.Context) {
+	event, ok := h.loadOrganizedEvent(c)
+	if !ok {
+		return
+	}
+
+	attendees, err := h.events.Cancel(event.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel event"})
+		return
+	}
+	for _, userID := range attendees {
+		h.notifications.Create(userID, "Event Cancelled", event.Title+" has been cancelled", "in_app")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event cancelled successfully"})
+}
+
+// RSVPEvent signs the current user up for an event, or puts them on the
+// waitlist when it is full. A ticket to a paid event is bought from the
+// wallet either way, and refunded should the waitlist never move.
+func (h *Handler) RSVPEvent(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	if !event.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has been cancelled"})
+		return
+	}
+	if event.CreatedBy == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are organising this event"})
+		return
+	}
+	if !event.EventDate.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has already started"})
+		return
+	}
+
+	status, err := h.events.RSVP(event.ID, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has been cancelled"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already responded to this event"})
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to RSVP"})
+		return
+	}
+
+	message := "You are going to " + event.Title
+	if status == models.RSVPWaitlisted {
+		message = "The event is full, you have been added to the waitlist"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "status": status, "paid": event.Price})
+}
+
+// CancelEventRSVP withdraws the current user's RSVP, handing their spot to
+// the first person on the waitlist and refunding their ticket
+func (h *Handler) CancelEventRSVP(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	if event.IsActive && !event.EventDate.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has already started"})
+		return
+	}
+
+	refunded, promoted, err := h.events.CancelRSVP(event.ID, currentUserID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You have not responded to this event"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel RSVP"})
+		return
+	}
+	h.notifyPromoted(promoted, event)
+
+	message := "RSVP cancelled"
+	if refunded > 0 {
+		message = fmt.Sprintf("RSVP cancelled, %.2f refunded to your wallet", refunded)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "refunded": refunded})
+}
+
+// GetEventAttendees lists who is going to an event and who is waitlisted,
+// for its organizer
+func (h *Handler) GetEventAttendees(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	if event.CreatedBy != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the organizer can see the attendee list"})
+		return
+	}
+
+	attendees, err := h.events.Attendees(event.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attendees"})
+		return
+	}
+	if attendees == nil {
+		attendees = []models.EventAttendee{}
+	}
+
+	c.JSON(http.StatusOK, attendees)
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"synapmentor/internal/auth"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+)
+
+// The fakes below keep their state in memory and implement only the methods
+// the tests reach; the embedded interface panics on anything else, which
+// makes an unexpected repository call fail loudly
+
+type fakeUsers struct {
+	repository.UserRepo
+	byID map[int]*models.User
+	// claimed holds users a verification email has gone out to
+	claimed  map[int]bool
+	failures map[int]int
+}
+
+func newFakeUsers(users ...*models.User) *fakeUsers {
+	f := &fakeUsers{byID: map[int]*models.User{}, failures: map[int]int{}}
+	for _, u := range users {
+		f.byID[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) GetByID(id int) (*models.User, error) {
+	u, ok := f.byID[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (f *fakeUsers) GetByEmail(email string) (*models.User, error) {
+	for _, u := range f.byID {
+		if u.Email == email {
+			return f.GetByID(u.ID)
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeUsers) MarkEmailVerified(id int, email string) error {
+	u, ok := f.byID[id]
+	if !ok || u.Email != email {
+		return repository.ErrNotFound
+	}
+	u.IsEmailVerified = true
+	return nil
+}
+
+func (f *fakeUsers) ClaimVerificationEmail(id int, interval time.Duration) error {
+	if f.claimed == nil {
+		f.claimed = map[int]bool{}
+	}
+	if f.claimed[id] {
+		return repository.ErrRateLimited
+	}
+	f.claimed[id] = true
+	return nil
+}
+
+func (f *fakeUsers) ChangePassword(id int, passwordHash string, keepSession int) error {
+	f.byID[id].Password = passwordHash
+	return nil
+}
+
+func (f *fakeUsers) RecordLoginFailure(id int) (int, error) {
+	f.failures[id]++
+	return f.failures[id], nil
+}
+
+func (f *fakeUsers) LockLogin(id int, until time.Time) error {
+	f.byID[id].LockedUntil = &until
+	return nil
+}
+
+func (f *fakeUsers) ClearLoginFailures(id int) error {
+	u, ok := f.byID[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	f.failures[id] = 0
+	u.LockedUntil = nil
+	return nil
+}
+
+func (f *fakeUsers) SetActive(id int, active bool) error {
+	u, ok := f.byID[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	u.IsActive = active
+	return nil
+}
+
+type fakeRoles struct {
+	repository.RoleRepo
+	permissions map[int][]string
+	staff       map[int]bool
+}
+
+func (f *fakeRoles) Permissions(userID int) ([]string, error) {
+	return f.permissions[userID], nil
+}
+
+func (f *fakeRoles) IsStaff(userID int) (bool, error) {
+	return f.staff[userID], nil
+}
+
+type fakeLoginAttempts struct {
+	repository.LoginAttemptRepo
+	attempts []models.LoginAttempt
+}
+
+func (f *fakeLoginAttempts) Record(attempt *models.LoginAttempt) error {
+	a := *attempt
+	a.CreatedAt = time.Now()
+	f.attempts = append(f.attempts, a)
+	return nil
+}
+
+func (f *fakeLoginAttempts) FailuresFromIP(ip string, since time.Time) (int, *time.Time, error) {
+	var failures int
+	var latest *time.Time
+	for i, a := range f.attempts {
+		if a.IPAddress != ip || a.Result != models.LoginInvalidCredentials || a.CreatedAt.Before(since) {
+			continue
+		}
+		failures++
+		latest = &f.attempts[i].CreatedAt
+	}
+	return failures, latest, nil
+}
+
+// results lists the results of the recorded attempts in order
+func (f *fakeLoginAttempts) results() []string {
+	var results []string
+	for _, a := range f.attempts {
+		results = append(results, a.Result)
+	}
+	return results
+}
+
+type fakeMailer struct {
+	sent []mail.Message
+}
+
+func (f *fakeMailer) Send(msg mail.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+type fakeNotifications struct {
+	repository.NotificationRepo
+	sent []models.Notification
+}
+
+func (f *fakeNotifications) Create(userID int, title, message, notificationType string) error {
+	f.sent = append(f.sent, models.Notification{UserID: userID, Title: title, Message: message, Type: notificationType})
+	return nil
+}
+
+type fakeTokens struct {
+	repository.TokenRepo
+	refresh map[string]int    // token hash to user
+	family  map[string]string // token hash to family
+	used    map[string]bool
+	// resets maps password reset token hashes to their user
+	resets map[string]int
+}
+
+func (f *fakeTokens) IssueRefresh(userID int, familyID, tokenHash string, expiresAt time.Time) error {
+	if f.refresh == nil {
+		f.refresh, f.family, f.used = map[string]int{}, map[string]string{}, map[string]bool{}
+	}
+	f.refresh[tokenHash], f.family[tokenHash] = userID, familyID
+	return nil
+}
+
+func (f *fakeTokens) RotateRefresh(tokenHash, nextHash string, expiresAt time.Time) (int, string, error) {
+	userID, ok := f.refresh[tokenHash]
+	if !ok {
+		return 0, "", repository.ErrNotFound
+	}
+	if f.used[tokenHash] {
+		return 0, "", repository.ErrTokenReused
+	}
+	family := f.family[tokenHash]
+	f.used[tokenHash] = true
+	f.refresh[nextHash], f.family[nextHash] = userID, family
+	return userID, family, nil
+}
+
+func (f *fakeTokens) IssuePasswordReset(userID int, tokenHash string, expiresAt time.Time, interval time.Duration) error {
+	if f.resets == nil {
+		f.resets = map[string]int{}
+	}
+	f.resets[tokenHash] = userID
+	return nil
+}
+
+func (f *fakeTokens) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	userID, ok := f.resets[tokenHash]
+	if !ok {
+		return 0, repository.ErrNotFound
+	}
+	delete(f.resets, tokenHash)
+	return userID, nil
+}
+
+type fakeTwoFactor struct {
+	repository.TwoFactorRepo
+	userID   int
+	recovery map[string]bool // unused recovery code hashes
+	failures int
+	pending  string // secret from StartEnrollment
+}
+
+// newFakeTwoFactor enables two-factor authentication for userID with the
+// given recovery codes and a secret nobody has a code for
+func newFakeTwoFactor(userID int, recoveryCodes ...string) *fakeTwoFactor {
+	f := &fakeTwoFactor{userID: userID, recovery: map[string]bool{}}
+	for _, code := range recoveryCodes {
+		f.recovery[auth.HashRecoveryCode(code)] = true
+	}
+	return f
+}
+
+func (f *fakeTwoFactor) Secret(userID int) (*repository.TOTPSecret, error) {
+	if userID != f.userID {
+		return nil, repository.ErrNotFound
+	}
+	return &repository.TOTPSecret{Secret: "JBSWY3DPEHPK3PXP", Enabled: true, FailedAttempts: f.failures}, nil
+}
+
+func (f *fakeTwoFactor) StartEnrollment(userID int, secret string) error {
+	f.pending = secret
+	return nil
+}
+
+func (f *fakeTwoFactor) UseRecoveryCode(userID int, codeHash string) error {
+	if userID != f.userID || !f.recovery[codeHash] {
+		return repository.ErrTokenInvalid
+	}
+	delete(f.recovery, codeHash)
+	return nil
+}
+
+func (f *fakeTwoFactor) RecordFailure(userID int) error {
+	f.failures++
+	return nil
+}
+
+type fakeLogins struct {
+	repository.LoginSessionRepo
+	created []models.LoginSession
+	family  map[string]int
+}
+
+func (f *fakeLogins) Create(session *models.LoginSession, familyID string) (int, error) {
+	if f.family == nil {
+		f.family = map[string]int{}
+	}
+	f.created = append(f.created, *session)
+	f.family[familyID] = len(f.created)
+	return len(f.created), nil
+}
+
+func (f *fakeLogins) List(userID int) ([]models.LoginSession, error) {
+	var sessions []models.LoginSession
+	for i, session := range f.created {
+		if session.UserID == userID {
+			session.ID = i + 1
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeLogins) ForFamily(familyID string) (*models.LoginSession, error) {
+	id, ok := f.family[familyID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	session := f.created[id-1]
+	session.ID = id
+	return &session, nil
+}
+
+type fakeSessions struct {
+	repository.SessionRepo
+	byID    map[int]*models.Session
+	updates map[int]map[string]interface{}
+	deleted []int
+	// fail is returned from Update and the transitions when set
+	fail error
+}
+
+func newFakeSessions(sessions ...*models.Session) *fakeSessions {
+	f := &fakeSessions{byID: map[int]*models.Session{}, updates: map[int]map[string]interface{}{}}
+	for _, s := range sessions {
+		f.byID[s.ID] = s
+	}
+	return f
+}
+
+func (f *fakeSessions) Get(id int) (*models.Session, error) {
+	s, ok := f.byID[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (f *fakeSessions) Update(id, userID int, fields map[string]interface{}) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.updates[id] = fields
+	return nil
+}
+
+func (f *fakeSessions) transition(id int, from, to string) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	s := f.byID[id]
+	if s.Status != from {
+		return repository.ErrInvalidState
+	}
+	s.Status = to
+	return nil
+}
+
+func (f *fakeSessions) Confirm(id, userID int) error {
+	return f.transition(id, models.SessionRequested, models.SessionConfirmed)
+}
+
+func (f *fakeSessions) Start(id, userID int) error {
+	return f.transition(id, models.SessionConfirmed, models.SessionActive)
+}
+
+func (f *fakeSessions) Delete(id int) error {
+	delete(f.byID, id)
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+type fakeWallets struct {
+	repository.WalletRepo
+	byUser       map[int]*models.Wallet
+	transactions map[int][]models.Transaction // by wallet
+}
+
+func newFakeWallets(wallets ...*models.Wallet) *fakeWallets {
+	f := &fakeWallets{byUser: map[int]*models.Wallet{}, transactions: map[int][]models.Transaction{}}
+	for _, w := range wallets {
+		f.byUser[w.UserID] = w
+	}
+	return f
+}
+
+func (f *fakeWallets) GetByUserID(userID int) (*models.Wallet, error) {
+	w, ok := f.byUser[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *w
+	return &copied, nil
+}
+
+func (f *fakeWallets) ListTransactions(walletID, limit, offset int) ([]models.Transaction, error) {
+	all := f.transactions[walletID]
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	return all[offset:end], nil
+}
+
+func (f *fakeWallets) Transfer(userID int, transferType string, amount float64, description string) (float64, error) {
+	w, ok := f.byUser[userID]
+	if !ok {
+		return 0, repository.ErrNotFound
+	}
+	change := amount
+	if transferType == "withdraw" {
+		if w.Balance < amount {
+			return 0, ledger.ErrInsufficientFunds
+		}
+		change = -amount
+	}
+	w.Balance += change
+	f.transactions[w.ID] = append(f.transactions[w.ID], models.Transaction{
+		WalletID: w.ID, Type: transferType, Amount: amount, Description: description, Status: "completed",
+	})
+	return w.Balance, nil
+}
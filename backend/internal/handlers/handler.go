@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/oauth"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+	"synapmentor/internal/sms"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the HTTP API on top of the repositories and services it is
+// given, so tests can substitute fakes for any of them
+type Handler struct {
+	users         repository.UserRepo
+	sessions      repository.SessionRepo
+	content       repository.ContentRepo
+	wallets       repository.WalletRepo
+	notifications repository.NotificationRepo
+	ledger        repository.LedgerRepo
+	availability  repository.AvailabilityRepo
+	calendar      repository.CalendarRepo
+	tokens        repository.TokenRepo
+	logins        repository.LoginSessionRepo
+	twoFactor     repository.TwoFactorRepo
+	loginAttempts repository.LoginAttemptRepo
+	identities    repository.IdentityRepo
+	roles         repository.RoleRepo
+	apiKeys       repository.APIKeyRepo
+	phones        repository.PhoneRepo
+	idDocuments   repository.IDDocumentRepo
+	communities   repository.CommunityRepo
+	discussions   repository.DiscussionRepo
+	events        repository.EventRepo
+	mailer        mail.Sender
+	sms           sms.Sender
+	require2FA    auth.TwoFactorPolicy
+	providers     map[string]*oauth.Provider
+	verification  policy.Policy
+}
+
+// New creates a Handler backed by the given repositories that sends email
+// through mailer and text messages through texts, asks for a second factor
+// where require2FA says so, offers sign-in with the given identity providers
+// and gates actions on the verification levels verification requires
+func New(repos *repository.Repositories, mailer mail.Sender, texts sms.Sender, require2FA auth.TwoFactorPolicy,
+	providers map[string]*oauth.Provider, verification policy.Policy) *Handler {
+	return &Handler{
+		users:         repos.Users,
+		sessions:      repos.Sessions,
+		content:       repos.Content,
+		wallets:       repos.Wallets,
+		notifications: repos.Notifications,
+		ledger:        repos.Ledger,
+		availability:  repos.Availability,
+		calendar:      repos.Calendar,
+		tokens:        repos.Tokens,
+		logins:        repos.Logins,
+		twoFactor:     repos.TwoFactor,
+		loginAttempts: repos.LoginAttempts,
+		identities:    repos.Identities,
+		roles:         repos.Roles,
+		apiKeys:       repos.APIKeys,
+		phones:        repos.Phones,
+		idDocuments:   repos.IDDocuments,
+		communities:   repos.Communities,
+		discussions:   repos.Discussions,
+		events:        repos.Events,
+		mailer:        mailer,
+		sms:           texts,
+		require2FA:    require2FA,
+		providers:     providers,
+		verification:  verification,
+	}
+}
+
+// currentUserID returns the authenticated user's id set by AuthMiddleware
+func currentUserID(c *gin.Context) int {
+	return c.GetInt("user_id")
+}
+
+// currentLoginSessionID returns the login session of the request's access token
+func currentLoginSessionID(c *gin.Context) int {
+	return c.GetInt("login_session_id")
+}
+
+// currentUserRole returns the authenticated user's primary role set by AuthMiddleware
+func currentUserRole(c *gin.Context) string {
+	return c.GetString("user_role")
+}
+
+// hasRole reports whether the authenticated user's token carries role
+func hasRole(c *gin.Context, role string) bool {
+	for _, r := range c.GetStringSlice("user_roles") {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// queryInt reads a non-negative integer query parameter, falling back to def
+func queryInt(c *gin.Context, key string, def int) int {
+	n, err := strconv.Atoi(c.Query(key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// paramID parses a numeric path parameter
+func paramID(c *gin.Context, key string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(key))
+	return id, err == nil && id > 0
+}
+
+// userLocation returns the current user's time zone, or UTC if it cannot be loaded
+func (h *Handler) userLocation(c *gin.Context) *time.Location {
+	loc, err := h.users.Location(currentUserID(c))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// validTimezone reports whether name is an IANA time zone this binary knows
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// validLocale reports whether tag is shaped like a BCP 47 language tag
+func validLocale(tag string) bool {
+	return localePattern.MatchString(tag)
+}
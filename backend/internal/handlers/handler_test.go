@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"synapmentor/internal/auth"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := func() int {
+		defer os.RemoveAll(dir)
+		key, _, err := auth.GenerateKey(auth.AlgorithmEd25519)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path := filepath.Join(dir, "jwt.pem")
+		if err := os.WriteFile(path, key, 0o600); err != nil {
+			log.Fatal(err)
+		}
+		os.Setenv("JWT_PRIVATE_KEY_FILE", path)
+		if err := auth.LoadKeys(); err != nil {
+			log.Fatal(err)
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// signedIn stands in for AuthMiddleware, authenticating every request as
+// userID holding roles; a userID of 0 leaves requests anonymous
+func signedIn(userID int, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID == 0 {
+			return
+		}
+		c.Set("user_id", userID)
+		c.Set("login_session_id", 1)
+		c.Set("user_email", "user@example.com")
+		if len(roles) > 0 {
+			c.Set("user_role", roles[0])
+		}
+		c.Set("user_roles", roles)
+	}
+}
+
+// serve sends a request with a JSON body, if any, and cookies to router
+func serve(router http.Handler, method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decode parses a JSON response body into a map
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q is not a JSON object: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// expectStatus fails the test unless w has the wanted status code
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, want, w.Body.String())
+	}
+}
+
+func TestValidTimezone(t *testing.T) {
+	for name, want := range map[string]bool{
+		"UTC": true, "Europe/Berlin": true, "America/New_York": true,
+		"": false, "Local": false, "Mars/Olympus": false, "+02:00": false,
+	} {
+		if got := validTimezone(name); got != want {
+			t.Errorf("validTimezone(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestValidLocale(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"en": true, "de-DE": true, "zh-Hant-TW": true, "fil": true,
+		"": false, "e": false, "en_US": false, "en-": false, "english": false,
+	} {
+		if got := validLocale(tag); got != want {
+			t.Errorf("validLocale(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
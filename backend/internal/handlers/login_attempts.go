@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Failed sign-ins are free up to a point, per account and per IP address;
+// after that each further failure doubles the wait before the next attempt,
+// from loginBackoffBase up to loginBackoffMax
+const (
+	loginFreeFailures   = 3
+	loginIPFreeFailures = 20
+	loginIPWindow       = time.Hour
+	loginBackoffBase    = 30 * time.Second
+	loginBackoffMax     = time.Hour
+)
+
+// loginBackoff returns how long sign-ins wait after failures in a row when
+// the first free of them cost nothing
+func loginBackoff(failures, free int) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	wait := loginBackoffBase
+	for i := free + 1; i < failures && wait < loginBackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > loginBackoffMax {
+		wait = loginBackoffMax
+	}
+	return wait
+}
+
+// ipBlockedUntil returns when ip may try to sign in again, or the zero time
+// if it may now
+func (h *Handler) ipBlockedUntil(ip string) (time.Time, error) {
+	failures, latest, err := h.loginAttempts.FailuresFromIP(ip, time.Now().Add(-loginIPWindow))
+	if err != nil || latest == nil {
+		return time.Time{}, err
+	}
+	until := latest.Add(loginBackoff(failures, loginIPFreeFailures))
+	if !until.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// recordLoginFailure counts a wrong password against user and locks the
+// account once the failures call for a wait
+func (h *Handler) recordLoginFailure(user *models.User) error {
+	failures, err := h.users.RecordLoginFailure(user.ID)
+	if err != nil {
+		return err
+	}
+	if wait := loginBackoff(failures, loginFreeFailures); wait > 0 {
+		return h.users.LockLogin(user.ID, time.Now().Add(wait))
+	}
+	return nil
+}
+
+// recordLogin audits a sign-in attempt; user is nil when no account has the
+// email. Failing to audit does not fail the sign-in.
+func (h *Handler) recordLogin(c *gin.Context, email string, user *models.User, result string) {
+	attempt := &models.LoginAttempt{
+		Email:     email,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Result:    result,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := h.loginAttempts.Record(attempt); err != nil {
+		log.Printf("Failed to record login attempt for %s: %v", email, err)
+	}
+}
+
+// tooManyLoginAttempts rejects a sign-in that has to wait until until
+func tooManyLoginAttempts(c *gin.Context, until time.Time, message string) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// GetLoginAttempts lists audited sign-in attempts, newest first, filtered by
+// the user_id, email and ip query parameters; failed=true leaves out successes
+func (h *Handler) GetLoginAttempts(c *gin.Context) {
+	filter := repository.LoginAttemptFilter{
+		UserID:     queryInt(c, "user_id", 0),
+		Email:      c.Query("email"),
+		IPAddress:  c.Query("ip"),
+		FailedOnly: c.Query("failed") == "true",
+	}
+
+	attempts, err := h.loginAttempts.List(filter, queryInt(c, "limit", 50), queryInt(c, "offset", 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login attempts"})
+		return
+	}
+	if attempts == nil {
+		attempts = []models.LoginAttempt{}
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
+
+// UnlockUser lifts a lockout from repeated failed sign-ins
+func (h *Handler) UnlockUser(c *gin.Context) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err := h.users.ClearLoginFailures(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	log.Printf("Admin %d unlocked sign-in for user %d", currentUserID(c), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
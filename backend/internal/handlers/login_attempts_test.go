@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"synapmentor/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUnlockUser(t *testing.T) {
+	f := newLoginFixture(t)
+	h := &Handler{users: f.users}
+	router := gin.New()
+	router.Use(signedIn(9, "admin"))
+	router.POST("/admin/users/:id/unlock", h.UnlockUser)
+
+	expectStatus(t, serve(router, http.MethodPost, "/admin/users/3/unlock", ""), http.StatusOK)
+	if f.users.byID[3].LockedUntil != nil {
+		t.Error("user 3 is still locked")
+	}
+	expectStatus(t, serve(router, http.MethodPost, "/admin/users/99/unlock", ""), http.StatusNotFound)
+	expectStatus(t, serve(router, http.MethodPost, "/admin/users/abc/unlock", ""), http.StatusNotFound)
+
+	// The unlocked user can sign in again
+	w := serve(f.router, http.MethodPost, "/auth/login", `{"email":"locked@example.com","password":"password1"}`)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestIPBlockExpires(t *testing.T) {
+	f := newLoginFixture(t)
+	h := &Handler{loginAttempts: f.attempts}
+
+	for i := 0; i <= loginIPFreeFailures; i++ {
+		f.attempts.Record(&models.LoginAttempt{
+			Email: "someone@example.com", IPAddress: "192.0.2.1", Result: models.LoginInvalidCredentials,
+		})
+	}
+	until, err := h.ipBlockedUntil("192.0.2.1")
+	if err != nil || until.IsZero() {
+		t.Fatalf("ipBlockedUntil() = %v, %v, want a block", until, err)
+	}
+
+	// The block runs from the latest failure
+	for i := range f.attempts.attempts {
+		f.attempts.attempts[i].CreatedAt = time.Now().Add(-loginBackoffBase - time.Second)
+	}
+	if until, err := h.ipBlockedUntil("192.0.2.1"); err != nil || !until.IsZero() {
+		t.Errorf("ipBlockedUntil() once the wait is over = %v, %v", until, err)
+	}
+	if until, err := h.ipBlockedUntil("198.51.100.1"); err != nil || !until.IsZero() {
+		t.Errorf("ipBlockedUntil() for another address = %v, %v", until, err)
+	}
+}
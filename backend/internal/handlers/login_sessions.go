@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoginSessions lists the devices the current user is signed in on
+func (h *Handler) GetLoginSessions(c *gin.Context) {
+	sessions, err := h.logins.List(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login sessions"})
+		return
+	}
+
+	current := currentLoginSessionID(c)
+	if sessions == nil {
+		sessions = []models.LoginSession{}
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeLoginSession signs one of the current user's devices out
+func (h *Handler) RevokeLoginSession(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login session not found"})
+		return
+	}
+
+	err := h.logins.Revoke(currentUserID(c), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke login session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login session revoked"})
+}
+
+// RevokeOtherLoginSessions signs the current user out everywhere except the
+// device making the request
+func (h *Handler) RevokeOtherLoginSessions(c *gin.Context) {
+	n, err := h.logins.RevokeAll(currentUserID(c), currentLoginSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke login sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Signed out of other devices",
+		"revoked": n,
+	})
+}
+
+// deviceName gives a rough, human readable name for a user agent, such as
+// "Firefox on Linux"
+func deviceName(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp", "Android app"},
+	}
+	systems := []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
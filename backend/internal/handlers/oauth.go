@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"synapmentor/internal/oauth"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthStateTTL is how long a user has to finish signing in with a provider
+const oauthStateTTL = 10 * time.Minute
+
+// oauthBindingCookie holds a nonce tying a sign-in with a provider to the
+// browser that started it, so that a callback cannot be replayed in another
+// browser to sign it in to someone else's account or link someone else's
+// provider account to it
+const oauthBindingCookie = "oauth_binding"
+
+// oauthStateKey is what a started sign-in is stored under: the hash of its
+// state parameter together with the binding nonce of the browser
+func oauthStateKey(state, binding string) string {
+	return auth.HashToken(state + "." + binding)
+}
+
+// setOAuthBinding sets the binding cookie, or clears it when maxAge is negative
+func setOAuthBinding(c *gin.Context, binding string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthBindingCookie, binding, maxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+// OAuthAuthorizeRequest starts a sign-in with an identity provider; role
+// applies if the sign-in ends up creating an account
+type OAuthAuthorizeRequest struct {
+	Role string `json:"role" binding:"omitempty,oneof=solver seeker"`
+}
+
+// OAuthCallbackRequest carries what the provider sent back to the web app
+type OAuthCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// OAuthRedirectURL is the web app page a provider sends the user back to;
+// it is registered with the provider and posts to the sign-in callback, or
+// to the link callback when the user started a link from their profile
+func OAuthRedirectURL(provider string) string {
+	return appURL("/oauth/" + provider + "/callback")
+}
+
+// GetOAuthProviders lists the identity providers users can sign in with
+func (h *Handler) GetOAuthProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// AuthorizeOAuth starts signing in with a provider and returns the URL to
+// send the user to
+func (h *Handler) AuthorizeOAuth(c *gin.Context) {
+	var req OAuthAuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleSeeker
+	}
+	h.startOAuth(c, nil, role)
+}
+
+// LinkIdentity starts linking a provider account to the current user and
+// returns the URL to send the user to
+func (h *Handler) LinkIdentity(c *gin.Context) {
+	userID := currentUserID(c)
+	h.startOAuth(c, &userID, "")
+}
+
+// startOAuth records a sign-in with the provider in the path, binds it to the
+// browser and responds with its authorization URL; userID is set when linking
+func (h *Handler) startOAuth(c *gin.Context, userID *int, role string) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, err := oauth.NewState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	nonce, err := oauth.NewState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	verifier, err := oauth.NewVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	binding, err := oauth.NewState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, verifier, nonce)
+	if err != nil {
+		log.Printf("Failed to start sign-in with %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	if err := h.identities.SaveState(oauthStateKey(state, binding), &models.OAuthState{
+		Provider:  provider.Name,
+		Verifier:  verifier,
+		Nonce:     nonce,
+		UserID:    userID,
+		Role:      role,
+		ExpiresAt: time.Now().Add(oauthStateTTL),
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	setOAuthBinding(c, binding, int(oauthStateTTL.Seconds()))
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// consumeOAuthState takes the sign-in a provider callback finishes, which
+// must have been started in the same browser, and returns its provider and
+// the code to exchange, writing the error response itself when it cannot
+func (h *Handler) consumeOAuthState(c *gin.Context) (*oauth.Provider, *models.OAuthState, string, bool) {
+	var req OAuthCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, "", false
+	}
+
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return nil, nil, "", false
+	}
+
+	binding, err := c.Cookie(oauthBindingCookie)
+	if err != nil || binding == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in was not started in this browser; please try again"})
+		return nil, nil, "", false
+	}
+
+	state, err := h.identities.ConsumeState(oauthStateKey(req.State, binding), provider.Name)
+	if errors.Is(err, repository.ErrTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in attempt has expired; please try again"})
+		return nil, nil, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sign-in"})
+		return nil, nil, "", false
+	}
+	setOAuthBinding(c, "", -1)
+
+	return provider, state, req.Code, true
+}
+
+// exchangeOAuthCode redeems the code a provider sent back for the identity
+// it vouches for, writing the error response itself when it cannot
+func exchangeOAuthCode(c *gin.Context, provider *oauth.Provider, state *models.OAuthState, code string) (*oauth.Identity, bool) {
+	identity, err := provider.Exchange(c.Request.Context(), code, state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("Sign-in with %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Sign-in with " + provider.Name + " failed"})
+		return nil, false
+	}
+	return identity, true
+}
+
+// OAuthCallback finishes a sign-in with a provider: the user the provider
+// account is linked to is signed in, an existing account with the same
+// verified email is linked and signed in, or a new account is created. Links
+// started by LinkIdentity are finished by LinkIdentityCallback instead.
+func (h *Handler) OAuthCallback(c *gin.Context) {
+	provider, state, code, ok := h.consumeOAuthState(c)
+	if !ok {
+		return
+	}
+	if state.UserID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Linking an account has to be finished while signed in"})
+		return
+	}
+
+	identity, ok := exchangeOAuthCode(c, provider, state, code)
+	if !ok {
+		return
+	}
+
+	link := &models.UserIdentity{
+		Provider: provider.Name,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, ok := h.oauthUser(c, link, identity, state.Role)
+	if !ok {
+		return
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		h.recordLogin(c, user.Email, user, models.LoginAccountLocked)
+		tooManyLoginAttempts(c, *user.LockedUntil, "Too many failed sign-in attempts; please try again later")
+		return
+	}
+	if !user.IsActive {
+		h.recordLogin(c, user.Email, user, models.LoginDeactivated)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	// The provider stands in for the password; a second factor is still due
+	if user.TwoFactorEnabled {
+		challenge, err := auth.GenerateChallengeToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		h.recordLogin(c, user.Email, user, models.LoginTwoFactorPending)
+		c.JSON(http.StatusOK, TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(auth.ChallengeTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	response, err := h.issueTokens(c, user, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.recordLogin(c, user.Email, user, models.LoginSucceeded)
+	c.JSON(http.StatusOK, response)
+}
+
+// LinkIdentityCallback finishes linking a provider account to the current
+// user, who must be the one that started the link
+func (h *Handler) LinkIdentityCallback(c *gin.Context) {
+	provider, state, code, ok := h.consumeOAuthState(c)
+	if !ok {
+		return
+	}
+	if state.UserID == nil || *state.UserID != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link was not started from your account"})
+		return
+	}
+
+	identity, ok := exchangeOAuthCode(c, provider, state, code)
+	if !ok {
+		return
+	}
+
+	link := &models.UserIdentity{
+		UserID:   *state.UserID,
+		Provider: provider.Name,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	err := h.identities.Link(link)
+	if errors.Is(err, repository.ErrAlreadyLinked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "That " + link.Provider + " account is linked to another user"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A different " + link.Provider + " account is already linked; unlink it first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Linked " + link.Provider + " account"})
+}
+
+// oauthUser finds or creates the user a provider sign-in belongs to
+func (h *Handler) oauthUser(c *gin.Context, link *models.UserIdentity, identity *oauth.Identity, role string) (*models.User, bool) {
+	userID, err := h.identities.FindUser(link.Provider, link.Subject)
+	if err == nil {
+		return h.loadUser(c, userID)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sign-in"})
+		return nil, false
+	}
+
+	if identity.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your " + link.Provider + " account did not share an email address"})
+		return nil, false
+	}
+
+	existing, err := h.users.GetByEmail(identity.Email)
+	if err == nil {
+		// Only when both sides have verified the address can we tell it is
+		// the same person, rather than someone who registered it first
+		if !identity.EmailVerified || !existing.IsEmailVerified {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists; sign in with your password and link " + link.Provider + " from your profile"})
+			return nil, false
+		}
+		link.UserID = existing.ID
+		if err := h.identities.Link(link); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "A different " + link.Provider + " account is already linked to this email's account"})
+			return nil, false
+		}
+		return existing, true
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sign-in"})
+		return nil, false
+	}
+
+	firstName := identity.FirstName
+	if firstName == "" {
+		firstName = strings.Split(identity.Email, "@")[0]
+	}
+	userID, err = h.identities.CreateUser(&models.User{
+		Email:           identity.Email,
+		FirstName:       firstName,
+		LastName:        identity.LastName,
+		Role:            role,
+		IsEmailVerified: identity.EmailVerified,
+	}, link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return nil, false
+	}
+
+	user, ok := h.loadUser(c, userID)
+	if ok && !user.IsEmailVerified {
+		if err := h.sendVerificationEmail(user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		}
+	}
+	return user, ok
+}
+
+// loadUser fetches a user for a sign-in
+func (h *Handler) loadUser(c *gin.Context, userID int) (*models.User, bool) {
+	user, err := h.users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetIdentities lists the provider accounts linked to the current user
+func (h *Handler) GetIdentities(c *gin.Context) {
+	identities, err := h.identities.List(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get linked accounts"})
+		return
+	}
+	if identities == nil {
+		identities = []models.UserIdentity{}
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// UnlinkIdentity removes a linked provider account from the current user
+func (h *Handler) UnlinkIdentity(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found"})
+		return
+	}
+
+	err := h.identities.Unlink(currentUserID(c), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password before unlinking your only sign-in method"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/database/dbtest"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/models"
+	"synapmentor/internal/oauth"
+	"synapmentor/internal/oauth/oauthtest"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+	"synapmentor/internal/sms"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The provider sign-in runs through the real repositories on a test
+// database, against a stand-in OIDC issuer
+
+var bob = oauthtest.User{
+	Subject:       "bob-1",
+	Email:         "bob@example.com",
+	EmailVerified: true,
+	FirstName:     "Bob",
+	LastName:      "Builder",
+}
+
+type oauthFixture struct {
+	repos  *repository.Repositories
+	issuer *oauthtest.Issuer
+	h      *Handler
+}
+
+func newOAuthFixture(t *testing.T) *oauthFixture {
+	t.Helper()
+	f := &oauthFixture{
+		repos:  repository.New(dbtest.Open(t), ledger.Policy{}),
+		issuer: oauthtest.NewIssuer(t),
+	}
+	providers := map[string]*oauth.Provider{"test": f.issuer.Provider("test", OAuthRedirectURL("test"))}
+	f.h = New(f.repos, mail.LogSender{}, sms.LogSender{}, auth.TwoFactorPolicy{}, providers, policy.Default())
+	return f
+}
+
+// router serves the provider routes with userID signed in, or nobody for 0
+func (f *oauthFixture) router(userID int) *gin.Engine {
+	r := gin.New()
+	r.POST("/oauth/:provider/authorize", f.h.AuthorizeOAuth)
+	r.POST("/oauth/:provider/callback", f.h.OAuthCallback)
+
+	protected := r.Group("/", signedIn(userID, models.RoleSeeker))
+	protected.GET("/identities", f.h.GetIdentities)
+	protected.POST("/identities/:provider/link", f.h.LinkIdentity)
+	protected.POST("/identities/:provider/callback", f.h.LinkIdentityCallback)
+	protected.DELETE("/identities/:id", f.h.UnlinkIdentity)
+	return r
+}
+
+// start begins a sign-in or link at path and has user consent at the
+// issuer; it returns the callback body and the browser's binding cookie
+func (f *oauthFixture) start(t *testing.T, router http.Handler, path string, user oauthtest.User) (string, *http.Cookie) {
+	t.Helper()
+	w := serve(router, http.MethodPost, path, "{}")
+	expectStatus(t, w, http.StatusOK)
+	authURL, _ := decode(t, w)["authorization_url"].(string)
+
+	binding := responseCookie(w, oauthBindingCookie)
+	if binding == nil || binding.Value == "" || !binding.HttpOnly || binding.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("sign-in did not set an HttpOnly, SameSite=Lax binding cookie: %+v", binding)
+	}
+
+	code, state := f.issuer.Authorize(t, authURL, user)
+	return `{"code":"` + code + `","state":"` + state + `"}`, binding
+}
+
+// createUser registers a user with a password, and a verified email if verified
+func (f *oauthFixture) createUser(t *testing.T, email string, verified bool) int {
+	t.Helper()
+	hash, err := auth.HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := f.repos.Users.Create(&models.User{
+		Email: email, Password: hash, FirstName: "Test", LastName: "User", Role: models.RoleSeeker,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := f.repos.Users.MarkEmailVerified(id, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// signedInAs returns the user an auth response's access token is for
+func signedInAs(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	token, _ := decode(t, w)["token"].(string)
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("response %s carries no valid token: %v", w.Body.String(), err)
+	}
+	return claims.UserID
+}
+
+func TestOAuthSignInCreatesAndReusesAccount(t *testing.T) {
+	f := newOAuthFixture(t)
+	router := f.router(0)
+
+	body, binding := f.start(t, router, "/oauth/test/authorize", bob)
+	w := serve(router, http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+	userID := signedInAs(t, w)
+	if cleared := responseCookie(w, oauthBindingCookie); cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("binding cookie not cleared after the callback: %+v", cleared)
+	}
+
+	user, err := f.repos.Users.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != bob.Email || !user.IsEmailVerified || user.HasPassword || user.Role != models.RoleSeeker {
+		t.Errorf("created user = %+v", user)
+	}
+
+	// Signing in again finds the linked account rather than creating one
+	body, binding = f.start(t, router, "/oauth/test/authorize", bob)
+	w = serve(router, http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+	if again := signedInAs(t, w); again != userID {
+		t.Errorf("second sign-in was user %d, want %d", again, userID)
+	}
+}
+
+func TestOAuthSignInWithExistingEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		userVerified  bool
+		emailVerified bool
+		wantStatus    int
+	}{
+		{"both verified", true, true, http.StatusOK},
+		{"provider unverified", true, false, http.StatusConflict},
+		{"account unverified", false, true, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			router := f.router(0)
+			existing := f.createUser(t, bob.Email, tt.userVerified)
+
+			user := bob
+			user.EmailVerified = tt.emailVerified
+			body, binding := f.start(t, router, "/oauth/test/authorize", user)
+			w := serve(router, http.MethodPost, "/oauth/test/callback", body, binding)
+			expectStatus(t, w, tt.wantStatus)
+
+			if tt.wantStatus == http.StatusOK {
+				if got := signedInAs(t, w); got != existing {
+					t.Errorf("signed in as user %d, want %d", got, existing)
+				}
+				return
+			}
+			// Someone else's provider account must not be attached to it
+			identities, err := f.repos.Identities.List(existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(identities) != 0 {
+				t.Errorf("linked %+v to an account whose email was not proven", identities)
+			}
+		})
+	}
+}
+
+func TestOAuthSignInRefusesBlockedAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		block      func(repos *repository.Repositories, userID int) error
+		wantStatus int
+		wantResult string
+	}{
+		{
+			name: "locked",
+			block: func(repos *repository.Repositories, userID int) error {
+				return repos.Users.LockLogin(userID, time.Now().Add(time.Hour))
+			},
+			wantStatus: http.StatusTooManyRequests,
+			wantResult: models.LoginAccountLocked,
+		},
+		{
+			name: "deactivated",
+			block: func(repos *repository.Repositories, userID int) error {
+				return repos.Users.SetActive(userID, false)
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantResult: models.LoginDeactivated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOAuthFixture(t)
+			router := f.router(0)
+			userID := f.createUser(t, bob.Email, true)
+			if err := f.repos.Identities.Link(&models.UserIdentity{UserID: userID, Provider: "test", Subject: bob.Subject}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.block(f.repos, userID); err != nil {
+				t.Fatal(err)
+			}
+
+			body, binding := f.start(t, router, "/oauth/test/authorize", bob)
+			w := serve(router, http.MethodPost, "/oauth/test/callback", body, binding)
+			expectStatus(t, w, tt.wantStatus)
+			if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("locked response has no Retry-After header")
+			}
+
+			attempts, err := f.repos.LoginAttempts.List(repository.LoginAttemptFilter{UserID: userID}, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(attempts) != 1 || attempts[0].Result != tt.wantResult {
+				t.Errorf("audited %+v, want one %s attempt", attempts, tt.wantResult)
+			}
+		})
+	}
+}
+
+// A callback only counts in the browser that started the sign-in, so that
+// an attacker cannot get a victim's browser to finish the attacker's
+// sign-in, nor replay a victim's callback in their own
+func TestOAuthCallbackIsBoundToBrowser(t *testing.T) {
+	f := newOAuthFixture(t)
+	public := f.router(0)
+	victim := f.createUser(t, "victim@example.com", true)
+
+	body, binding := f.start(t, public, "/oauth/test/authorize", bob)
+	_, otherBrowser := f.start(t, public, "/oauth/test/authorize", bob)
+	linkBody, linkBinding := f.start(t, f.router(victim), "/identities/test/link", bob)
+
+	tests := []struct {
+		name      string
+		body      string
+		cookie    *http.Cookie
+		wantError string
+	}{
+		{"no cookie", body, nil, "Sign-in was not started in this browser; please try again"},
+		{"another browser's cookie", body, otherBrowser, "Sign-in attempt has expired; please try again"},
+		{"link finished signed out", linkBody, linkBinding, "Linking an account has to be finished while signed in"},
+		{"forged state", `{"code":"x","state":"forged"}`, binding, "Sign-in attempt has expired; please try again"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cookies []*http.Cookie
+			if tt.cookie != nil {
+				cookies = append(cookies, tt.cookie)
+			}
+			w := serve(public, http.MethodPost, "/oauth/test/callback", tt.body, cookies...)
+			expectStatus(t, w, http.StatusBadRequest)
+			if got := decode(t, w)["error"]; got != tt.wantError {
+				t.Errorf("error = %v, want %q", got, tt.wantError)
+			}
+		})
+	}
+
+	// The right browser still finishes its sign-in, exactly once
+	w := serve(public, http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+	w = serve(public, http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	identities, err := f.repos.Identities.List(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("the victim's account got linked: %+v", identities)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	f := newOAuthFixture(t)
+	owner := f.createUser(t, "owner@example.com", true)
+	intruder := f.createUser(t, "intruder@example.com", true)
+
+	// Another signed-in user cannot finish the link, even in the same browser
+	body, binding := f.start(t, f.router(owner), "/identities/test/link", bob)
+	w := serve(f.router(intruder), http.MethodPost, "/identities/test/callback", body, binding)
+	expectStatus(t, w, http.StatusForbidden)
+
+	body, binding = f.start(t, f.router(owner), "/identities/test/link", bob)
+	w = serve(f.router(owner), http.MethodPost, "/identities/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+
+	w = serve(f.router(owner), http.MethodGet, "/identities", "")
+	expectStatus(t, w, http.StatusOK)
+	identities, err := f.repos.Identities.List(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Subject != bob.Subject {
+		t.Fatalf("identities = %+v, want bob's", identities)
+	}
+
+	// The provider account now signs in to the owner
+	body, binding = f.start(t, f.router(0), "/oauth/test/authorize", bob)
+	w = serve(f.router(0), http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+	if got := signedInAs(t, w); got != owner {
+		t.Errorf("signed in as user %d, want %d", got, owner)
+	}
+
+	// and cannot be linked to anyone else
+	body, binding = f.start(t, f.router(intruder), "/identities/test/link", bob)
+	w = serve(f.router(intruder), http.MethodPost, "/identities/test/callback", body, binding)
+	expectStatus(t, w, http.StatusConflict)
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	f := newOAuthFixture(t)
+
+	// An account created by a provider sign-in has no password to fall back on
+	body, binding := f.start(t, f.router(0), "/oauth/test/authorize", bob)
+	w := serve(f.router(0), http.MethodPost, "/oauth/test/callback", body, binding)
+	expectStatus(t, w, http.StatusOK)
+	passwordless := signedInAs(t, w)
+
+	withPassword := f.createUser(t, "carol@example.com", true)
+	carol := oauthtest.User{Subject: "carol-1", Email: "carol@example.com", EmailVerified: true}
+	body, binding = f.start(t, f.router(withPassword), "/identities/test/link", carol)
+	expectStatus(t, serve(f.router(withPassword), http.MethodPost, "/identities/test/callback", body, binding), http.StatusOK)
+
+	identityOf := func(userID int) string {
+		identities, err := f.repos.Identities.List(userID)
+		if err != nil || len(identities) != 1 {
+			t.Fatalf("identities of user %d = %+v, %v", userID, identities, err)
+		}
+		return strconv.Itoa(identities[0].ID)
+	}
+	bobsIdentity, carolsIdentity := identityOf(passwordless), identityOf(withPassword)
+
+	tests := []struct {
+		name       string
+		userID     int
+		id         string
+		wantStatus int
+	}{
+		{"only sign-in method", passwordless, bobsIdentity, http.StatusConflict},
+		{"someone else's", withPassword, bobsIdentity, http.StatusNotFound},
+		{"unknown", withPassword, "999", http.StatusNotFound},
+		{"with a password", withPassword, carolsIdentity, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(f.router(tt.userID), http.MethodDelete, "/identities/"+tt.id, "")
+			expectStatus(t, w, tt.wantStatus)
+		})
+	}
+
+	if identityOf(passwordless) != bobsIdentity {
+		t.Error("the passwordless account lost its identity")
+	}
+	if identities, _ := f.repos.Identities.List(withPassword); len(identities) != 0 {
+		t.Errorf("identities left after unlinking = %+v", identities)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// passwordResetInterval is the least time between two reset emails to one user
+const passwordResetInterval = 2 * time.Minute
+
+// passwordRules describes what ValidatePasswordStrength requires
+const passwordRules = "Password must be at least 8 characters with uppercase, lowercase, and number"
+
+// ForgotPasswordRequest asks for a reset link for an account
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with a reset token
+type ResetPasswordRequest struct {
+	Token           string `json:"token" binding:"required"`
+	Password        string `json:"password" binding:"required,min=8"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
+
+// ChangePasswordRequest sets a new password for the signed-in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
+
+// ForgotPassword mails a reset link to the account's address. The response
+// is the same whether or not the account exists, so it cannot be used to
+// find out which addresses are registered.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.sendPasswordReset(req.Email); err != nil {
+		log.Printf("Failed to send password reset to %s: %v", req.Email, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that address, a reset link has been sent"})
+}
+
+// sendPasswordReset issues a reset token for the account with email and mails it
+func (h *Handler) sendPasswordReset(email string) error {
+	user, err := h.users.GetByEmail(email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive {
+		return nil
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = h.tokens.IssuePasswordReset(user.ID, hash, time.Now().Add(passwordResetTTL), passwordResetInterval)
+	if errors.Is(err, repository.ErrRateLimited) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/reset-password?token=" + url.QueryEscape(token))
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your SynapMentor password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your SynapMentor account. "+
+			"To choose a new password, open this link:\n\n%s\n\n"+
+			"The link works once and expires in %d minutes. If you did not ask for this, you can ignore this email.\n",
+			user.FirstName, link, int(passwordResetTTL.Minutes())),
+	})
+}
+
+// ResetPassword sets a new password with a token from a reset email and signs
+// the account out of every device
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Password != req.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
+		return
+	}
+	if !auth.ValidatePasswordStrength(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": passwordRules})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	_, err = h.tokens.ResetPassword(auth.HashToken(req.Token), hashedPassword)
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully; please sign in again"})
+}
+
+// ChangePassword replaces the current user's password after checking the
+// current one, and signs out every other device
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NewPassword != req.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
+		return
+	}
+	if !auth.ValidatePasswordStrength(req.NewPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": passwordRules})
+		return
+	}
+
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if !auth.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if auth.CheckPasswordHash(req.NewPassword, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current one"})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	if err := h.users.ChangePassword(user.ID, hashedPassword, currentLoginSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
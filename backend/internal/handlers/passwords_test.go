@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passwordFixture serves the password routes, signed in as user 1 whose
+// password is "password1"
+type passwordFixture struct {
+	users  *fakeUsers
+	tokens *fakeTokens
+	mailer *fakeMailer
+	router *gin.Engine
+}
+
+func newPasswordFixture(t *testing.T) *passwordFixture {
+	t.Helper()
+	hash, err := auth.HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &passwordFixture{
+		users: newFakeUsers(&models.User{
+			ID: 1, Email: "seeker@example.com", Password: hash, Role: "seeker", IsActive: true,
+		}),
+		tokens: &fakeTokens{},
+		mailer: &fakeMailer{},
+	}
+	h := &Handler{users: f.users, tokens: f.tokens, mailer: f.mailer}
+	f.router = gin.New()
+	f.router.POST("/auth/forgot-password", h.ForgotPassword)
+	f.router.POST("/auth/reset-password", h.ResetPassword)
+	f.router.PUT("/profile/password", signedIn(1, "seeker"), h.ChangePassword)
+	return f
+}
+
+func TestPasswordReset(t *testing.T) {
+	f := newPasswordFixture(t)
+
+	// An unknown address gets the same answer and no email
+	unknown := serve(f.router, http.MethodPost, "/auth/forgot-password", `{"email":"nobody@example.com"}`)
+	expectStatus(t, unknown, http.StatusOK)
+	known := serve(f.router, http.MethodPost, "/auth/forgot-password", `{"email":"seeker@example.com"}`)
+	expectStatus(t, known, http.StatusOK)
+	if unknown.Body.String() != known.Body.String() {
+		t.Errorf("responses differ: %s and %s", unknown.Body, known.Body)
+	}
+	if len(f.mailer.sent) != 1 || f.mailer.sent[0].To != "seeker@example.com" {
+		t.Fatalf("sent = %+v, want one email to the seeker", f.mailer.sent)
+	}
+
+	body := f.mailer.sent[0].Body
+	start := strings.Index(body, "token=")
+	if start < 0 {
+		t.Fatalf("email body has no reset link:\n%s", body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(body[start+len("token="):])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"mismatched", `{"token":"` + token + `","password":"Password2","confirm_password":"Password3"}`, http.StatusBadRequest},
+		{"weak", `{"token":"` + token + `","password":"password","confirm_password":"password"}`, http.StatusBadRequest},
+		{"unknown token", `{"token":"other","password":"Password2","confirm_password":"Password2"}`, http.StatusBadRequest},
+		{"valid", `{"token":"` + token + `","password":"Password2","confirm_password":"Password2"}`, http.StatusOK},
+		{"used token", `{"token":"` + token + `","password":"Password2","confirm_password":"Password2"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, serve(f.router, http.MethodPost, "/auth/reset-password", tt.body), tt.want)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		changed bool
+	}{
+		{"wrong current password", `{"current_password":"wrong","new_password":"Password2","confirm_password":"Password2"}`, http.StatusUnauthorized, false},
+		{"mismatched", `{"current_password":"password1","new_password":"Password2","confirm_password":"Password3"}`, http.StatusBadRequest, false},
+		{"weak", `{"current_password":"password1","new_password":"password2","confirm_password":"password2"}`, http.StatusBadRequest, false},
+		{"changed", `{"current_password":"password1","new_password":"Password2","confirm_password":"Password2"}`, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPasswordFixture(t)
+			expectStatus(t, serve(f.router, http.MethodPut, "/profile/password", tt.body), tt.want)
+			if got := auth.CheckPasswordHash("Password2", f.users.byID[1].Password); got != tt.changed {
+				t.Errorf("password changed = %v, want %v", got, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/repository"
+	"synapmentor/internal/sms"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// phoneCodeTTL is how long a code sent by text message can be used
+const phoneCodeTTL = 10 * time.Minute
+
+// phoneLimits throttles sending codes, which costs money per message, and
+// guessing them
+var phoneLimits = repository.PhoneLimits{
+	Interval:    time.Minute,
+	MaxPerHour:  5,
+	MaxAttempts: 5,
+}
+
+// e164 matches a phone number in international form, e.g. +14155550123
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// SendPhoneCodeRequest names the phone number to verify
+type SendPhoneCodeRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// VerifyPhoneRequest carries the code sent to the phone
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// normalizePhone strips the spaces, dashes, dots and parentheses people
+// type into phone numbers and checks what is left is in E.164 form
+func normalizePhone(phone string) (string, bool) {
+	phone = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(phone)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	return phone, e164.MatchString(phone)
+}
+
+// SendPhoneCode texts a one-time code to the phone number the current user
+// wants to verify
+func (h *Handler) SendPhoneCode(c *gin.Context) {
+	var req SendPhoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	phone, ok := normalizePhone(req.Phone)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter the phone number in international format, e.g. +14155550123"})
+		return
+	}
+
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user.IsPhoneVerified && user.Phone == phone {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already verified"})
+		return
+	}
+
+	code, err := auth.NewPhoneCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+	err = h.phones.Start(user.ID, phone, auth.HashPhoneCode(user.ID, code), time.Now().Add(phoneCodeTTL), phoneLimits)
+	if errors.Is(err, repository.ErrRateLimited) {
+		c.Header("Retry-After", strconv.Itoa(int(phoneLimits.Interval.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A code was sent recently; please wait before requesting another"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This phone number is verified on another account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	if err := h.sms.Send(sms.Message{
+		To:   phone,
+		Body: "Your SynapMentor verification code is " + code + ". It expires in " + strconv.Itoa(int(phoneCodeTTL.Minutes())) + " minutes.",
+	}); err != nil {
+		log.Printf("Failed to send verification code to user %d: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send code; check the number and try again shortly"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Verification code sent",
+		"expires_in": int(phoneCodeTTL.Seconds()),
+	})
+}
+
+// VerifyPhone checks the code sent to the current user's phone and marks the
+// number verified
+func (h *Handler) VerifyPhone(c *gin.Context) {
+	var req VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	phone, err := h.phones.Verify(userID, auth.HashPhoneCode(userID, normalizeCode(req.Code)), phoneLimits)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No code is pending or it has expired; request a new one"})
+		return
+	}
+	if errors.Is(err, repository.ErrTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect code"})
+		return
+	}
+	if errors.Is(err, repository.ErrRateLimited) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many incorrect codes; request a new one"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This phone number is verified on another account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+
+	user, err := h.users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Phone verified successfully",
+		"phone":              phone,
+		"verification_level": user.VerificationLevel,
+	})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"+14155550123", "+14155550123", true},
+		{"+1 (415) 555-0123", "+14155550123", true},
+		{"0049 30.1234.5678", "+493012345678", true},
+		{"4155550123", "4155550123", false},
+		{"+0155550123", "+0155550123", false},
+		{"+1415", "+1415", false},
+		{"+1415555012345678", "+1415555012345678", false},
+		{"+1415555O123", "+1415555O123", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizePhone(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizePhone(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"synapmentor/internal/middleware"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddRoleRequest adds a marketplace role to the current user
+type AddRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=solver seeker"`
+}
+
+// GrantRoleRequest gives a user any role
+type GrantRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// RolesResponse describes what the current user may do
+type RolesResponse struct {
+	Role        string   `json:"role"` // primary role
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// can reports whether the current user holds permission
+func (h *Handler) can(c *gin.Context, permission string) (bool, error) {
+	return middleware.HasPermission(c, h.roles, permission)
+}
+
+// actingAsSolver reports whether the request acts on the solver side of the
+// marketplace. Users who hold both roles pick a side with ?as=solver or
+// ?as=seeker; otherwise their primary role decides. It writes the error
+// response itself when the side asked for is not one the user holds.
+func actingAsSolver(c *gin.Context) (asSolver, ok bool) {
+	as := c.Query("as")
+	switch as {
+	case "":
+		return currentUserRole(c) == models.RoleSolver, true
+	case models.RoleSolver, models.RoleSeeker:
+		if !hasRole(c, as) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have the " + as + " role"})
+			return false, false
+		}
+		return as == models.RoleSolver, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as must be solver or seeker"})
+		return false, false
+	}
+}
+
+// canManageAccount checks that the current user may act on another user's
+// account: staff accounts are only open to those who manage roles, so a
+// moderator cannot suspend an admin. It writes the error response itself.
+func (h *Handler) canManageAccount(c *gin.Context, userID int) bool {
+	staff, err := h.roles.IsStaff(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !staff {
+		return true
+	}
+
+	allowed, err := h.can(c, models.PermRolesManage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can change staff accounts"})
+		return false
+	}
+	return true
+}
+
+// GetMyRoles returns the current user's roles and permissions
+func (h *Handler) GetMyRoles(c *gin.Context) {
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+	permissions, err := h.roles.Permissions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	c.JSON(http.StatusOK, RolesResponse{
+		Role:        user.Role,
+		Roles:       user.Roles,
+		Permissions: permissions,
+	})
+}
+
+// AddRole lets a solver also book sessions as a seeker, or a seeker also
+// offer them as a solver
+func (h *Handler) AddRole(c *gin.Context) {
+	var req AddRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.roles.Grant(currentUserID(c), req.Role, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add role"})
+		return
+	}
+
+	// The role reaches the access token on its next refresh
+	c.JSON(http.StatusOK, gin.H{"message": "Role added; refresh your token to use it"})
+}
+
+// GetRoles lists every role with the permissions it grants
+func (h *Handler) GetRoles(c *gin.Context) {
+	roles, err := h.roles.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GrantRole gives a user a role
+func (h *Handler) GrantRole(c *gin.Context) {
+	var req GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	grantedBy := currentUserID(c)
+	err := h.roles.Grant(userID, req.Role, &grantedBy)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User or role not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role granted"})
+}
+
+// RevokeRole takes a role from a user
+func (h *Handler) RevokeRole(c *gin.Context) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err := h.roles.Revoke(userID, c.Param("role"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User does not have this role"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot revoke a user's primary role or the last administrator's"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked"})
+}
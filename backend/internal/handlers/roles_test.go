@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"synapmentor/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestActingAsSolver(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      []string
+		query      string
+		wantStatus int
+		wantSolver bool
+	}{
+		{"primary solver", []string{"solver"}, "", http.StatusOK, true},
+		{"primary seeker", []string{"seeker", "solver"}, "", http.StatusOK, false},
+		{"picks the solver side", []string{"seeker", "solver"}, "?as=solver", http.StatusOK, true},
+		{"picks the seeker side", []string{"solver", "seeker"}, "?as=seeker", http.StatusOK, false},
+		{"side not held", []string{"seeker"}, "?as=solver", http.StatusForbidden, false},
+		{"unknown side", []string{"seeker"}, "?as=admin", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/side", signedIn(1, tt.roles...), func(c *gin.Context) {
+				if asSolver, ok := actingAsSolver(c); ok {
+					c.JSON(http.StatusOK, gin.H{"solver": asSolver})
+				}
+			})
+
+			w := serve(router, http.MethodGet, "/side"+tt.query, "")
+			expectStatus(t, w, tt.wantStatus)
+			if body := decode(t, w); tt.wantStatus == http.StatusOK && body["solver"] != tt.wantSolver {
+				t.Errorf("solver = %v, want %v", body["solver"], tt.wantSolver)
+			}
+		})
+	}
+}
+
+func TestOnlyRoleManagersChangeStaffAccounts(t *testing.T) {
+	const (
+		admin     = 8
+		moderator = 9
+		staff     = 5
+		member    = 6
+	)
+	tests := []struct {
+		name       string
+		actor      int
+		target     int
+		wantStatus int
+	}{
+		{"moderator suspends a member", moderator, member, http.StatusOK},
+		{"moderator suspends staff", moderator, staff, http.StatusForbidden},
+		{"admin suspends staff", admin, staff, http.StatusOK},
+		{"admin suspends themselves", admin, admin, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newFakeUsers(
+				&models.User{ID: staff, Role: models.RoleSupport, IsActive: true},
+				&models.User{ID: member, Role: models.RoleSeeker, IsActive: true},
+			)
+			roles := &fakeRoles{
+				permissions: map[int][]string{
+					admin:     {models.PermUsersSuspend, models.PermRolesManage},
+					moderator: {models.PermUsersSuspend},
+				},
+				staff: map[int]bool{admin: true, moderator: true, staff: true},
+			}
+			h := &Handler{users: users, roles: roles}
+			router := gin.New()
+			router.PUT("/admin/users/:id/status", signedIn(tt.actor, models.RoleAdmin), h.UpdateUserStatus)
+
+			w := serve(router, http.MethodPut, "/admin/users/"+strconv.Itoa(tt.target)+"/status", `{"is_active":false}`)
+			expectStatus(t, w, tt.wantStatus)
+			if u, ok := users.byID[tt.target]; ok && u.IsActive != (tt.wantStatus != http.StatusOK) {
+				t.Errorf("IsActive = %v after status %d", u.IsActive, w.Code)
+			}
+		})
+	}
+}
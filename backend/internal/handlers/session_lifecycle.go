@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransitionRequest carries an optional explanation for a status change
+type TransitionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RateSessionRequest represents the seeker's rating of a completed session
+type RateSessionRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Review string `json:"review"`
+}
+
+// ConfirmSession lets the solver accept a requested session, or the seeker
+// accept the new time of one the solver rescheduled; paid sessions need the
+// verification level the policy sets for them
+func (h *Handler) ConfirmSession(c *gin.Context) {
+	h.transitionSession(c, "confirmed",
+		func(s *models.Session, userID int, _ string) (*ledger.Settlement, error) {
+			if s.Price > 0 && userID == s.SolverID {
+				if err := h.checkLevel(userID, policy.AcceptPaidSession, s.Price); err != nil {
+					return nil, err
+				}
+			}
+			return nil, h.sessions.Confirm(s.ID, userID)
+		})
+}
+
+// StartSession marks a confirmed session as under way
+func (h *Handler) StartSession(c *gin.Context) {
+	h.transitionSession(c, "started",
+		func(s *models.Session, userID int, _ string) (*ledger.Settlement, error) {
+			return nil, h.sessions.Start(s.ID, userID)
+		})
+}
+
+// CompleteSession ends an active session and releases escrow to the solver
+func (h *Handler) CompleteSession(c *gin.Context) {
+	h.transitionSession(c, "completed",
+		func(s *models.Session, userID int, _ string) (*ledger.Settlement, error) {
+			return h.sessions.Complete(s.ID, userID)
+		})
+}
+
+// CancelSession calls off a session that has not started yet
+func (h *Handler) CancelSession(c *gin.Context) {
+	h.transitionSession(c, "cancelled",
+		func(s *models.Session, userID int, reason string) (*ledger.Settlement, error) {
+			return h.sessions.Cancel(s.ID, userID, reason)
+		})
+}
+
+// ReportNoShow records that the other participant did not attend
+func (h *Handler) ReportNoShow(c *gin.Context) {
+	h.transitionSession(c, "marked as no-show",
+		func(s *models.Session, userID int, reason string) (*ledger.Settlement, error) {
+			return h.sessions.NoShow(s.ID, userID, reason)
+		})
+}
+
+// transitionSession runs a lifecycle transition on the session named by :id
+// after checking that the current user may perform it, then notifies the
+// other participant
+func (h *Handler) transitionSession(c *gin.Context, verb string,
+	apply func(s *models.Session, userID int, reason string) (*ledger.Settlement, error)) {
+	userID := currentUserID(c)
+
+	var req TransitionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	if userID != session.SolverID && userID != session.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this session"})
+		return
+	}
+
+	settlement, err := apply(session, userID, req.Reason)
+	var required *verificationRequiredError
+	switch {
+	case errors.As(err, &required):
+		verificationRequired(c, required)
+		return
+	case errors.Is(err, repository.ErrInvalidState):
+		c.JSON(http.StatusConflict, gin.H{"error": "Session cannot be " + verb + " while " + session.Status})
+		return
+	case errors.Is(err, repository.ErrPaymentRequired):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "The seeker has not paid for this session yet"})
+		return
+	case errors.Is(err, repository.ErrNotConfirmer):
+		c.JSON(http.StatusForbidden, gin.H{"error": "The other participant has to confirm this session"})
+		return
+	case errors.Is(err, repository.ErrTooEarly):
+		c.JSON(http.StatusConflict, gin.H{"error": "Session has not reached its scheduled time"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		return
+	}
+
+	other := session.SeekerID
+	if userID == session.SeekerID {
+		other = session.SolverID
+	}
+	h.notifications.Create(other, "Session Update", "Session "+verb+": "+session.Title, "in_app")
+
+	response := gin.H{"message": "Session " + verb}
+	if settlement != nil {
+		response["settlement"] = settlementResponse(settlement)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RateSession stores the seeker's rating once a session is completed
+func (h *Handler) RateSession(c *gin.Context) {
+	var req RateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	if currentUserID(c) != session.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the seeker can rate this session"})
+		return
+	}
+
+	err := h.sessions.Rate(session.ID, req.Rating, req.Review)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only completed, unrated sessions can be rated"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rate session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session rated successfully"})
+}
+
+// GetSessionHistory returns the status changes of a session
+func (h *Handler) GetSessionHistory(c *gin.Context) {
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	userID := currentUserID(c)
+	if userID != session.SolverID && userID != session.SeekerID {
+		readAny, err := h.can(c, models.PermSessionsReadAny)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session history"})
+			return
+		}
+		if !readAny {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to view this session"})
+			return
+		}
+	}
+
+	history, err := h.sessions.History(session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// settlementResponse shapes an escrow settlement for the API
+func settlementResponse(s *ledger.Settlement) gin.H {
+	return gin.H{
+		"refund":       ledger.FromCents(s.Refund),
+		"payout":       ledger.FromCents(s.Payout),
+		"platform_fee": ledger.FromCents(s.Fee),
+	}
+}
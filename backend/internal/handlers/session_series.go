@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/recurrence"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecurrenceRequest turns a session booking into a weekly or biweekly series
+// bounded by a number of occurrences or an end date (YYYY-MM-DD in the
+// caller's time zone, inclusive)
+type RecurrenceRequest struct {
+	Frequency string `json:"frequency" binding:"required,oneof=weekly biweekly"`
+	Count     int    `json:"count" binding:"min=0,max=52"`
+	Until     string `json:"until"`
+}
+
+// UpdateSeriesRequest edits every upcoming occurrence of a series; time is a
+// new start time of day (HH:MM in the caller's time zone)
+type UpdateSeriesRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Time        string  `json:"time"`
+}
+
+// createSeries books every occurrence of a recurring session in one go
+func (h *Handler) createSeries(c *gin.Context, template models.Session, req *RecurrenceRequest) {
+	userID := currentUserID(c)
+	loc := h.userLocation(c)
+
+	rule := recurrence.Rule{Frequency: req.Frequency, Count: req.Count}
+	series := models.SessionSeries{Frequency: req.Frequency, Timezone: loc.String()}
+	if req.Count > 0 {
+		series.Occurrences = &req.Count
+	}
+	if req.Until != "" {
+		day, err := time.ParseInLocation("2006-01-02", req.Until, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be a date (YYYY-MM-DD)"})
+			return
+		}
+		// The end date is inclusive, so the series runs until the end of that day
+		until := day.AddDate(0, 0, 1).Add(-time.Second).UTC()
+		rule.Until, series.Until = &until, &until
+	}
+
+	starts, err := rule.Occurrences(template.ScheduledAt, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, err := h.sessions.CreateSeries(&series, template, starts, userID)
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance to pay for every occurrence"})
+		return
+	}
+	if bookingConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session series"})
+		return
+	}
+
+	message := "A new recurring session has been scheduled: " + template.Title
+	h.notifications.Create(template.SolverID, "New Session Series Scheduled", message, "in_app")
+	if template.SolverID != template.SeekerID {
+		h.notifications.Create(template.SeekerID, "New Session Series Scheduled", message, "in_app")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Session series created successfully",
+		"series_id":   series.ID,
+		"session_ids": ids,
+	})
+}
+
+// GetSeries returns a series with all of its occurrences
+func (h *Handler) GetSeries(c *gin.Context) {
+	series, ok := h.loadSeries(c)
+	if !ok {
+		return
+	}
+
+	details, err := h.sessions.SeriesSessions(series.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session series"})
+		return
+	}
+
+	sessions := []map[string]interface{}{}
+	for _, d := range details {
+		sessions = append(sessions, sessionResponse(d))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":   series,
+		"sessions": sessions,
+	})
+}
+
+// UpdateSeries edits every upcoming occurrence of a series; single
+// occurrences are edited through the session endpoints
+func (h *Handler) UpdateSeries(c *gin.Context) {
+	var req UpdateSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	series, ok := h.loadSeries(c)
+	if !ok {
+		return
+	}
+
+	edit := repository.SeriesEdit{Fields: map[string]interface{}{}}
+	if req.Title != nil {
+		if *req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+			return
+		}
+		edit.Fields["title"] = *req.Title
+	}
+	if req.Description != nil {
+		edit.Fields["description"] = *req.Description
+	}
+	if req.Time != "" {
+		clock, err := time.Parse("15:04", req.Time)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "time must be a time of day (HH:MM)"})
+			return
+		}
+		// Each occurrence keeps its date and moves to the new time on the
+		// caller's calendar
+		loc := h.userLocation(c)
+		edit.Reschedule = func(at time.Time) time.Time {
+			local := at.In(loc)
+			return time.Date(local.Year(), local.Month(), local.Day(),
+				clock.Hour(), clock.Minute(), 0, 0, loc)
+		}
+	}
+
+	if len(edit.Fields) == 0 && edit.Reschedule == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
+		return
+	}
+
+	ids, err := h.sessions.UpdateSeries(series.ID, currentUserID(c), edit)
+	if errors.Is(err, repository.ErrInPast) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled time must be in the future", "occurrence": occurrenceTime(err)})
+		return
+	}
+	if bookingConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session series"})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The series has no upcoming occurrences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Session series updated successfully",
+		"session_ids": ids,
+	})
+}
+
+// CancelSeries cancels every upcoming occurrence of a series, refunding each
+// one under the cancellation policy
+func (h *Handler) CancelSeries(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req TransitionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	series, ok := h.loadSeries(c)
+	if !ok {
+		return
+	}
+
+	cancelled, err := h.sessions.CancelSeries(series.ID, userID, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel session series"})
+		return
+	}
+	if len(cancelled) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The series has no upcoming occurrences"})
+		return
+	}
+
+	other := series.SeekerID
+	if userID == series.SeekerID {
+		other = series.SolverID
+	}
+	h.notifications.Create(other, "Session Update", "Recurring session cancelled", "in_app")
+
+	occurrences := []gin.H{}
+	for _, o := range cancelled {
+		occurrence := gin.H{"session_id": o.SessionID}
+		if o.Settlement != nil {
+			occurrence["settlement"] = settlementResponse(o.Settlement)
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Session series cancelled",
+		"occurrences": occurrences,
+	})
+}
+
+// loadSeries fetches the series named by the :id parameter if the current
+// user takes part in it, writing the error response itself when it cannot
+func (h *Handler) loadSeries(c *gin.Context) (*models.SessionSeries, bool) {
+	seriesID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session series not found"})
+		return nil, false
+	}
+
+	series, err := h.sessions.GetSeries(seriesID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session series not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	userID := currentUserID(c)
+	if userID != series.SolverID && userID != series.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to access this session series"})
+		return nil, false
+	}
+
+	return series, true
+}
+
+// occurrenceTime returns the occurrence an error is about, if any
+func occurrenceTime(err error) *time.Time {
+	var oe *repository.OccurrenceError
+	if errors.As(err, &oe) {
+		return &oe.At
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
-	"synapmentor/internal/database"
+	"strings"
+	"synapmentor/internal/ledger"
 	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,87 +19,52 @@ type CreateSessionRequest struct {
 	Category    string    `json:"category" binding:"required"`
 	SubCategory string    `json:"sub_category"`
 	Duration    int       `json:"duration" binding:"required,min=15,max=480"`
-	Price       float64   `json:"price" binding:"required,min=0"`
+	Price       float64   `json:"price" binding:"min=0"`
 	ScheduledAt time.Time `json:"scheduled_at" binding:"required"`
 	SeekerID    int       `json:"seeker_id"`
+	// Recurrence books a series starting at ScheduledAt instead of a single session
+	Recurrence *RecurrenceRequest `json:"recurrence"`
 }
 
 // GetSessions returns sessions for the current user
-func GetSessions(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	userRole, _ := c.Get("user_role")
-
-	status := c.Query("status")
-	limit := c.DefaultQuery("limit", "20")
-	offset := c.DefaultQuery("offset", "0")
-
-	var query string
-	var args []interface{}
-
-	baseQuery := `
-		SELECT s.id, s.solver_id, s.seeker_id, s.title, s.description, s.category,
-		       s.sub_category, s.duration, s.price, s.status, s.scheduled_at,
-		       s.started_at, s.ended_at, s.recording_url, s.rating, s.review,
-		       s.created_at, s.updated_at,
-		       solver.first_name || ' ' || solver.last_name as solver_name,
-		       seeker.first_name || ' ' || seeker.last_name as seeker_name
-		FROM sessions s
-		JOIN users solver ON s.solver_id = solver.id
-		JOIN users seeker ON s.seeker_id = seeker.id`
-
-	if userRole == "solver" {
-		query = baseQuery + " WHERE s.solver_id = ?"
-		args = append(args, userID)
-	} else {
-		query = baseQuery + " WHERE s.seeker_id = ?"
-		args = append(args, userID)
-	}
-
-	if status != "" {
-		query += " AND s.status = ?"
-		args = append(args, status)
+func (h *Handler) GetSessions(c *gin.Context) {
+	asSolver, ok := actingAsSolver(c)
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY s.scheduled_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
-
-	rows, err := database.DB.Query(query, args...)
+	details, err := h.sessions.List(repository.SessionFilter{
+		UserID:   currentUserID(c),
+		AsSolver: asSolver,
+		Status:   c.Query("status"),
+		Limit:    queryInt(c, "limit", 20),
+		Offset:   queryInt(c, "offset", 0),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
 		return
 	}
-	defer rows.Close()
 
 	var sessions []map[string]interface{}
-	for rows.Next() {
-		var session models.Session
-		var solverName, seekerName string
-		err := rows.Scan(&session.ID, &session.SolverID, &session.SeekerID,
-			&session.Title, &session.Description, &session.Category,
-			&session.SubCategory, &session.Duration, &session.Price,
-			&session.Status, &session.ScheduledAt, &session.StartedAt,
-			&session.EndedAt, &session.RecordingURL, &session.Rating,
-			&session.Review, &session.CreatedAt, &session.UpdatedAt,
-			&solverName, &seekerName)
-		if err != nil {
-			continue
-		}
-
-		sessionData := map[string]interface{}{
-			"session":     session,
-			"solver_name": solverName,
-			"seeker_name": seekerName,
-		}
-		sessions = append(sessions, sessionData)
+	for _, d := range details {
+		sessions = append(sessions, sessionResponse(d))
 	}
 
 	c.JSON(http.StatusOK, sessions)
 }
 
+// sessionResponse shapes a session with participant names for the API
+func sessionResponse(d repository.SessionDetail) map[string]interface{} {
+	return map[string]interface{}{
+		"session":     d.Session,
+		"solver_name": d.SolverName,
+		"seeker_name": d.SeekerName,
+	}
+}
+
 // CreateSession creates a new session
-func CreateSession(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	userRole, _ := c.Get("user_role")
+func (h *Handler) CreateSession(c *gin.Context) {
+	userID := currentUserID(c)
 
 	var req CreateSessionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -105,16 +72,25 @@ func CreateSession(c *gin.Context) {
 		return
 	}
 
+	if !h.requireVerifiedEmail(c) {
+		return
+	}
+
+	asSolver, ok := actingAsSolver(c)
+	if !ok {
+		return
+	}
+
 	var solverID, seekerID int
-	if userRole == "solver" {
-		solverID = userID.(int)
+	if asSolver {
+		solverID = userID
 		if req.SeekerID == 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Seeker ID is required"})
 			return
 		}
 		seekerID = req.SeekerID
 	} else {
-		seekerID = userID.(int)
+		seekerID = userID
 		if req.SeekerID == 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Solver ID is required"})
 			return
@@ -128,33 +104,42 @@ func CreateSession(c *gin.Context) {
 		return
 	}
 
-	// Insert session
-	result, err := database.DB.Exec(`
-		INSERT INTO sessions (solver_id, seeker_id, title, description, category,
-		                     sub_category, duration, price, scheduled_at, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		solverID, seekerID, req.Title, req.Description, req.Category,
-		req.SubCategory, req.Duration, req.Price, req.ScheduledAt,
-		time.Now(), time.Now())
+	session := models.Session{
+		SolverID:    solverID,
+		SeekerID:    seekerID,
+		Title:       req.Title,
+		Description: req.Description,
+		Category:    req.Category,
+		SubCategory: req.SubCategory,
+		Duration:    req.Duration,
+		Price:       req.Price,
+		ScheduledAt: req.ScheduledAt,
+	}
+	if req.Recurrence != nil {
+		h.createSeries(c, session, req.Recurrence)
+		return
+	}
 
+	// A seeker booking a paid session pays into escrow straight away; sessions
+	// booked by the solver wait for the seeker to pay
+	sessionID, err := h.sessions.Create(&session, userID)
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	}
+	if bookingConflict(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
-	sessionID, _ := result.LastInsertId()
-
 	// Create notifications for both users
-	notifications := []string{
-		`INSERT INTO notifications (user_id, title, message, type, created_at)
-		 VALUES (?, 'New Session Scheduled', 'A new session has been scheduled: ` + req.Title + `', 'in_app', ?)`,
-	}
-
-	for _, notifQuery := range notifications {
-		database.DB.Exec(notifQuery, solverID, time.Now())
-		if solverID != seekerID {
-			database.DB.Exec(notifQuery, seekerID, time.Now())
-		}
+	message := "A new session has been scheduled: " + req.Title
+	h.notifications.Create(solverID, "New Session Scheduled", message, "in_app")
+	if solverID != seekerID {
+		h.notifications.Create(seekerID, "New Session Scheduled", message, "in_app")
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -164,52 +149,41 @@ func CreateSession(c *gin.Context) {
 }
 
 // GetSession returns a specific session
-func GetSession(c *gin.Context) {
-	sessionID := c.Param("id")
-	userID, _ := c.Get("user_id")
-
-	var session models.Session
-	var solverName, seekerName string
-	err := database.DB.QueryRow(`
-		SELECT s.id, s.solver_id, s.seeker_id, s.title, s.description, s.category,
-		       s.sub_category, s.duration, s.price, s.status, s.scheduled_at,
-		       s.started_at, s.ended_at, s.recording_url, s.rating, s.review,
-		       s.created_at, s.updated_at,
-		       solver.first_name || ' ' || solver.last_name as solver_name,
-		       seeker.first_name || ' ' || seeker.last_name as seeker_name
-		FROM sessions s
-		JOIN users solver ON s.solver_id = solver.id
-		JOIN users seeker ON s.seeker_id = seeker.id
-		WHERE s.id = ? AND (s.solver_id = ? OR s.seeker_id = ?)`,
-		sessionID, userID, userID).Scan(
-		&session.ID, &session.SolverID, &session.SeekerID,
-		&session.Title, &session.Description, &session.Category,
-		&session.SubCategory, &session.Duration, &session.Price,
-		&session.Status, &session.ScheduledAt, &session.StartedAt,
-		&session.EndedAt, &session.RecordingURL, &session.Rating,
-		&session.Review, &session.CreatedAt, &session.UpdatedAt,
-		&solverName, &seekerName)
-
-	if err == sql.ErrNoRows {
+func (h *Handler) GetSession(c *gin.Context) {
+	sessionID, ok := paramID(c, "id")
+	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
 	}
+
+	readAny, err := h.can(c, models.PermSessionsReadAny)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"session":     session,
-		"solver_name": solverName,
-		"seeker_name": seekerName,
-	})
+	var d *repository.SessionDetail
+	if readAny {
+		d, err = h.sessions.GetDetail(sessionID)
+	} else {
+		d, err = h.sessions.GetForParticipant(sessionID, currentUserID(c))
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(*d))
 }
 
-// UpdateSession updates a session
-func UpdateSession(c *gin.Context) {
-	sessionID := c.Param("id")
-	userID, _ := c.Get("user_id")
+// UpdateSession edits the details of a session that has not taken place yet;
+// status changes go through the lifecycle endpoints
+func (h *Handler) UpdateSession(c *gin.Context) {
+	userID := currentUserID(c)
 
 	var req map[string]interface{}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -218,85 +192,185 @@ func UpdateSession(c *gin.Context) {
 	}
 
 	// Verify user has permission to update this session
-	var solverID, seekerID int
-	err := database.DB.QueryRow("SELECT solver_id, seeker_id FROM sessions WHERE id = ?", sessionID).Scan(&solverID, &seekerID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	session, ok := h.loadSession(c)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+
+	if userID != session.SolverID && userID != session.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this session"})
 		return
 	}
 
-	if userID != solverID && userID != seekerID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this session"})
+	if _, ok := req["status"]; ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use the session lifecycle endpoints to change status"})
 		return
 	}
 
-	// Build update query dynamically based on provided fields
-	updateFields := []string{}
-	args := []interface{}{}
+	if session.Status != models.SessionRequested && session.Status != models.SessionConfirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only upcoming sessions can be edited"})
+		return
+	}
 
+	// Keep only the fields participants may change
 	allowedFields := map[string]bool{
-		"status":      true,
-		"started_at":  true,
-		"ended_at":    true,
-		"rating":      true,
-		"review":      true,
+		"title":        true,
+		"description":  true,
 		"scheduled_at": true,
 	}
 
+	updates := map[string]interface{}{}
 	for field, value := range req {
 		if allowedFields[field] {
-			updateFields = append(updateFields, field+" = ?")
-			args = append(args, value)
+			updates[field] = value
+		}
+	}
+	for _, field := range []string{"title", "description"} {
+		value, ok := updates[field]
+		if !ok {
+			continue
+		}
+		text, isString := value.(string)
+		if !isString {
+			c.JSON(http.StatusBadRequest, gin.H{"error": field + " must be a string"})
+			return
+		}
+		if field == "title" && strings.TrimSpace(text) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+			return
 		}
 	}
 
-	if len(updateFields) == 0 {
+	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
 		return
 	}
 
-	updateFields = append(updateFields, "updated_at = ?")
-	args = append(args, time.Now())
-	args = append(args, sessionID)
+	if value, ok := updates["scheduled_at"]; ok {
+		raw, _ := value.(string)
+		scheduledAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled_at must be an RFC 3339 time"})
+			return
+		}
+		if scheduledAt.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled time must be in the future"})
+			return
+		}
+		updates["scheduled_at"] = scheduledAt.UTC()
+	}
 
-	query := "UPDATE sessions SET " + joinStrings(updateFields, ", ") + " WHERE id = ?"
-	_, err = database.DB.Exec(query, args...)
+	err := h.sessions.Update(session.ID, userID, updates)
+	if bookingConflict(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
 		return
 	}
 
+	// A confirmed session moved to a new time waits for the other
+	// participant to confirm it again
+	scheduledAt, rescheduled := updates["scheduled_at"].(time.Time)
+	if rescheduled && session.Status == models.SessionConfirmed && !scheduledAt.Equal(session.ScheduledAt) {
+		other := session.SeekerID
+		if userID == session.SeekerID {
+			other = session.SolverID
+		}
+		h.notifications.Create(other, "Session Rescheduled",
+			"Session rescheduled, please confirm the new time: "+session.Title, "in_app")
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Session rescheduled, waiting for the other participant to confirm",
+			"status":  models.SessionRequested,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Session updated successfully"})
 }
 
-// DeleteSession deletes a session
-func DeleteSession(c *gin.Context) {
-	sessionID := c.Param("id")
-	userID, _ := c.Get("user_id")
+// bookingConflict writes the response for a booking the solver's calendar
+// cannot take and reports whether it did; for a series it names the
+// occurrence that clashed
+func bookingConflict(c *gin.Context, err error) bool {
+	var response gin.H
+	switch {
+	case errors.Is(err, repository.ErrSlotTaken):
+		response = gin.H{"error": "The solver is already booked at that time"}
+	case errors.Is(err, repository.ErrUnavailable):
+		response = gin.H{"error": "The solver is not available at that time"}
+	default:
+		return false
+	}
+	if at := occurrenceTime(err); at != nil {
+		response["occurrence"] = at
+	}
+	c.JSON(http.StatusConflict, response)
+	return true
+}
 
-	// Verify user has permission to delete this session
-	var solverID, seekerID int
-	err := database.DB.QueryRow("SELECT solver_id, seeker_id FROM sessions WHERE id = ?", sessionID).Scan(&solverID, &seekerID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+// PaySession moves the seeker's payment for a session into escrow
+func (h *Handler) PaySession(c *gin.Context) {
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	if currentUserID(c) != session.SeekerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the seeker can pay for this session"})
+		return
+	}
+
+	err := h.sessions.Pay(session.ID)
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is not awaiting payment"})
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay for session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment held in escrow"})
+}
+
+// DeleteSession deletes a session that is still only requested
+func (h *Handler) DeleteSession(c *gin.Context) {
+	userID := currentUserID(c)
+
+	// Verify user has permission to delete this session
+	session, ok := h.loadSession(c)
+	if !ok {
 		return
 	}
 
-	if userID != solverID && userID != seekerID {
+	if userID != session.SolverID && userID != session.SeekerID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to delete this session"})
 		return
 	}
 
+	// Once a session has been confirmed it belongs to both participants'
+	// history, so it is cancelled rather than deleted
+	if session.Status != models.SessionRequested {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only requested sessions can be deleted; cancel this session instead"})
+		return
+	}
+	// Sessions that have moved money keep their record for the ledger trail
+	if session.PaymentStatus != models.PaymentNone && session.PaymentStatus != models.PaymentAwaitingPayment {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sessions with payments cannot be deleted; cancel them instead"})
+		return
+	}
+
 	// Delete session
-	_, err = database.DB.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+	err := h.sessions.Delete(session.ID)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only requested sessions can be deleted; cancel this session instead"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
 		return
@@ -305,18 +379,24 @@ func DeleteSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Session deleted successfully"})
 }
 
-// Helper function to join strings
-func joinStrings(strs []string, sep string) string {
-	if len(strs) == 0 {
-		return ""
+// loadSession fetches the session named by the :id parameter, writing the
+// error response itself when it cannot
+func (h *Handler) loadSession(c *gin.Context) (*models.Session, bool) {
+	sessionID, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return nil, false
 	}
-	if len(strs) == 1 {
-		return strs[0]
+
+	session, err := h.sessions.Get(sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return nil, false
 	}
-	
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += sep + strs[i]
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
 	}
-	return result
+
+	return session, true
 }
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testSolver = 1
+	testSeeker = 2
+	testOther  = 3
+)
+
+// sessionFixture serves the session routes to userID over one session
+type sessionFixture struct {
+	users         *fakeUsers
+	sessions      *fakeSessions
+	notifications *fakeNotifications
+	router        *gin.Engine
+}
+
+func newSessionFixture(userID int, session *models.Session) *sessionFixture {
+	f := &sessionFixture{
+		users: newFakeUsers(
+			&models.User{ID: testSolver, Role: "solver", VerificationLevel: models.VerificationLight},
+			&models.User{ID: testSeeker, Role: "seeker", VerificationLevel: models.VerificationLight},
+		),
+		sessions:      newFakeSessions(session),
+		notifications: &fakeNotifications{},
+	}
+	h := &Handler{
+		users:         f.users,
+		sessions:      f.sessions,
+		notifications: f.notifications,
+		verification:  policy.Default(),
+	}
+	f.router = gin.New()
+	f.router.Use(signedIn(userID, "seeker"))
+	f.router.PUT("/sessions/:id", h.UpdateSession)
+	f.router.DELETE("/sessions/:id", h.DeleteSession)
+	f.router.POST("/sessions/:id/confirm", h.ConfirmSession)
+	f.router.POST("/sessions/:id/start", h.StartSession)
+	return f
+}
+
+func testSession(status string) *models.Session {
+	return &models.Session{
+		ID:            7,
+		SolverID:      testSolver,
+		SeekerID:      testSeeker,
+		Title:         "Algebra",
+		Status:        status,
+		PaymentStatus: models.PaymentNone,
+		ScheduledAt:   time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second),
+	}
+}
+
+func TestUpdateSession(t *testing.T) {
+	later := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+	earlier := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name        string
+		userID      int
+		status      string
+		path        string
+		body        string
+		fail        error
+		wantStatus  int
+		wantError   string
+		wantUpdates map[string]interface{}
+	}{
+		{"retitles", testSeeker, models.SessionRequested, "/sessions/7", `{"title":"Geometry","description":"Triangles"}`, nil, http.StatusOK, "",
+			map[string]interface{}{"title": "Geometry", "description": "Triangles"}},
+		{"reschedules", testSolver, models.SessionConfirmed, "/sessions/7", `{"scheduled_at":"` + later.Format(time.RFC3339) + `"}`, nil, http.StatusOK, "",
+			map[string]interface{}{"scheduled_at": later}},
+		{"drops unknown fields", testSeeker, models.SessionRequested, "/sessions/7", `{"title":"Geometry","price":0}`, nil, http.StatusOK, "",
+			map[string]interface{}{"title": "Geometry"}},
+		{"nothing updatable", testSeeker, models.SessionRequested, "/sessions/7", `{"rating":5}`, nil, http.StatusBadRequest, "No valid fields to update", nil},
+		{"unknown session", testSeeker, models.SessionRequested, "/sessions/8", `{"title":"Geometry"}`, nil, http.StatusNotFound, "Session not found", nil},
+		{"not a participant", testOther, models.SessionRequested, "/sessions/7", `{"title":"Geometry"}`, nil, http.StatusForbidden, "Not authorized to update this session", nil},
+		{"status", testSeeker, models.SessionRequested, "/sessions/7", `{"status":"completed"}`, nil, http.StatusBadRequest, "Use the session lifecycle endpoints to change status", nil},
+		{"already started", testSeeker, models.SessionActive, "/sessions/7", `{"title":"Geometry"}`, nil, http.StatusConflict, "Only upcoming sessions can be edited", nil},
+		{"finished", testSeeker, models.SessionCompleted, "/sessions/7", `{"title":"Geometry"}`, nil, http.StatusConflict, "Only upcoming sessions can be edited", nil},
+		{"numeric title", testSeeker, models.SessionRequested, "/sessions/7", `{"title":42}`, nil, http.StatusBadRequest, "title must be a string", nil},
+		{"object description", testSeeker, models.SessionRequested, "/sessions/7", `{"description":{"a":1}}`, nil, http.StatusBadRequest, "description must be a string", nil},
+		{"blank title", testSeeker, models.SessionRequested, "/sessions/7", `{"title":"  "}`, nil, http.StatusBadRequest, "title cannot be empty", nil},
+		{"not a time", testSeeker, models.SessionRequested, "/sessions/7", `{"scheduled_at":"tomorrow"}`, nil, http.StatusBadRequest, "scheduled_at must be an RFC 3339 time", nil},
+		{"in the past", testSeeker, models.SessionRequested, "/sessions/7", `{"scheduled_at":"` + earlier + `"}`, nil, http.StatusBadRequest, "Scheduled time must be in the future", nil},
+		{"slot taken", testSeeker, models.SessionRequested, "/sessions/7", `{"scheduled_at":"` + later.Format(time.RFC3339) + `"}`, repository.ErrSlotTaken, http.StatusConflict, "The solver is already booked at that time", nil},
+		{"unavailable", testSeeker, models.SessionRequested, "/sessions/7", `{"scheduled_at":"` + later.Format(time.RFC3339) + `"}`, repository.ErrUnavailable, http.StatusConflict, "The solver is not available at that time", nil},
+		{"repository fails", testSeeker, models.SessionRequested, "/sessions/7", `{"title":"Geometry"}`, errors.New("disk full"), http.StatusInternalServerError, "Failed to update session", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(tt.userID, testSession(tt.status))
+			f.sessions.fail = tt.fail
+
+			w := serve(f.router, http.MethodPut, tt.path, tt.body)
+			expectStatus(t, w, tt.wantStatus)
+			if body := decode(t, w); tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+
+			updates := f.sessions.updates[7]
+			if len(updates) != len(tt.wantUpdates) {
+				t.Fatalf("updates = %v, want %v", updates, tt.wantUpdates)
+			}
+			for field, want := range tt.wantUpdates {
+				if updates[field] != want {
+					t.Errorf("%s = %v, want %v", field, updates[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRescheduleConfirmedSession(t *testing.T) {
+	for _, by := range []int{testSolver, testSeeker} {
+		t.Run("by user "+strconv.Itoa(by), func(t *testing.T) {
+			f := newSessionFixture(by, testSession(models.SessionConfirmed))
+			later := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+
+			w := serve(f.router, http.MethodPut, "/sessions/7", `{"scheduled_at":"`+later.Format(time.RFC3339)+`"}`)
+			expectStatus(t, w, http.StatusOK)
+			if body := decode(t, w); body["status"] != models.SessionRequested {
+				t.Errorf("response %v does not report the session back to requested", body)
+			}
+			if got, _ := f.sessions.updates[7]["scheduled_at"].(time.Time); !got.Equal(later) {
+				t.Errorf("scheduled_at updated to %v, want %v", got, later)
+			}
+
+			other := testSeeker
+			if by == testSeeker {
+				other = testSolver
+			}
+			if len(f.notifications.sent) != 1 || f.notifications.sent[0].UserID != other {
+				t.Errorf("notifications = %+v, want one to user %d", f.notifications.sent, other)
+			}
+		})
+	}
+}
+
+func TestRetitleConfirmedSessionStaysConfirmed(t *testing.T) {
+	session := testSession(models.SessionConfirmed)
+	f := newSessionFixture(testSeeker, session)
+
+	body := `{"title":"Geometry","scheduled_at":"` + session.ScheduledAt.Format(time.RFC3339) + `"}`
+	w := serve(f.router, http.MethodPut, "/sessions/7", body)
+	expectStatus(t, w, http.StatusOK)
+	if got := decode(t, w); got["status"] != nil {
+		t.Errorf("response %v reports a status change", got)
+	}
+	if len(f.notifications.sent) != 0 {
+		t.Errorf("notified %+v though the time did not change", f.notifications.sent)
+	}
+}
+
+func TestSessionTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int
+		status     string
+		action     string
+		fail       error
+		wantStatus int
+		wantError  string
+	}{
+		{"solver confirms", testSolver, models.SessionRequested, "confirm", nil, http.StatusOK, ""},
+		{"confirming twice", testSolver, models.SessionConfirmed, "confirm", nil, http.StatusConflict, "Session cannot be confirmed while confirmed"},
+		{"wrong confirmer", testSeeker, models.SessionRequested, "confirm", repository.ErrNotConfirmer, http.StatusForbidden, "The other participant has to confirm this session"},
+		{"outsider", testOther, models.SessionRequested, "confirm", nil, http.StatusForbidden, "Not authorized to update this session"},
+		{"starts", testSeeker, models.SessionConfirmed, "start", nil, http.StatusOK, ""},
+		{"unpaid", testSolver, models.SessionConfirmed, "start", repository.ErrPaymentRequired, http.StatusPaymentRequired, "The seeker has not paid for this session yet"},
+		{"not confirmed", testSolver, models.SessionRequested, "start", nil, http.StatusConflict, "Session cannot be started while requested"},
+		{"too early", testSolver, models.SessionConfirmed, "start", repository.ErrTooEarly, http.StatusConflict, "Session has not reached its scheduled time"},
+		{"repository fails", testSolver, models.SessionConfirmed, "start", errors.New("disk full"), http.StatusInternalServerError, "Failed to update session"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(tt.userID, testSession(tt.status))
+			f.sessions.fail = tt.fail
+
+			w := serve(f.router, http.MethodPost, "/sessions/7/"+tt.action, "")
+			expectStatus(t, w, tt.wantStatus)
+			body := decode(t, w)
+			if tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+			if notified := len(f.notifications.sent) > 0; notified != (w.Code == http.StatusOK) {
+				t.Errorf("notified = %v with status %d", notified, w.Code)
+			}
+			if w.Code == http.StatusOK {
+				other := testSolver
+				if tt.userID == testSolver {
+					other = testSeeker
+				}
+				if f.notifications.sent[0].UserID != other {
+					t.Errorf("notified user %d, want %d", f.notifications.sent[0].UserID, other)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmPaidSessionNeedsVerification(t *testing.T) {
+	session := testSession(models.SessionRequested)
+	session.Price = 40
+	f := newSessionFixture(testSolver, session)
+
+	w := serve(f.router, http.MethodPost, "/sessions/7/confirm", "")
+	expectStatus(t, w, http.StatusForbidden)
+	if body := decode(t, w); body["required_level"] != models.VerificationStandard {
+		t.Errorf("response %v does not ask for standard verification", body)
+	}
+	if f.sessions.byID[7].Status != models.SessionRequested {
+		t.Error("session was confirmed anyway")
+	}
+
+	f.users.byID[testSolver].VerificationLevel = models.VerificationStandard
+	expectStatus(t, serve(f.router, http.MethodPost, "/sessions/7/confirm", ""), http.StatusOK)
+	if f.sessions.byID[7].Status != models.SessionConfirmed {
+		t.Errorf("status = %q after a verified solver confirmed", f.sessions.byID[7].Status)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	tests := []struct {
+		name          string
+		userID        int
+		status        string
+		paymentStatus string
+		wantStatus    int
+		wantError     string
+	}{
+		{"seeker", testSeeker, models.SessionRequested, models.PaymentNone, http.StatusOK, ""},
+		{"solver", testSolver, models.SessionRequested, models.PaymentNone, http.StatusOK, ""},
+		{"unpaid", testSeeker, models.SessionRequested, models.PaymentAwaitingPayment, http.StatusOK, ""},
+		{"paid", testSeeker, models.SessionRequested, models.PaymentHeld, http.StatusConflict, "Sessions with payments cannot be deleted; cancel them instead"},
+		{"refunded", testSeeker, models.SessionRequested, models.PaymentRefunded, http.StatusConflict, "Sessions with payments cannot be deleted; cancel them instead"},
+		{"confirmed", testSeeker, models.SessionConfirmed, models.PaymentNone, http.StatusConflict, "Only requested sessions can be deleted; cancel this session instead"},
+		{"cancelled", testSolver, models.SessionCancelled, models.PaymentNone, http.StatusConflict, "Only requested sessions can be deleted; cancel this session instead"},
+		{"completed", testSeeker, models.SessionCompleted, models.PaymentNone, http.StatusConflict, "Only requested sessions can be deleted; cancel this session instead"},
+		{"not a participant", testOther, models.SessionRequested, models.PaymentNone, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := testSession(tt.status)
+			session.PaymentStatus = tt.paymentStatus
+			f := newSessionFixture(tt.userID, session)
+
+			w := serve(f.router, http.MethodDelete, "/sessions/7", "")
+			expectStatus(t, w, tt.wantStatus)
+			if body := decode(t, w); tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+			if deleted := len(f.sessions.deleted) == 1; deleted != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("deleted = %v", f.sessions.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// twoFactorMaxFailures wrong codes in a row lock a user's second factor for
+// twoFactorLockout after the last of them
+const (
+	twoFactorMaxFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// reauthWindow is how recently a user without a password must have signed
+// in with their identity provider to change their two-factor settings
+const reauthWindow = 10 * time.Minute
+
+// TwoFactorSetupRequest starts TOTP enrollment; the password is asked again
+// so a stolen access token cannot lock the owner out. Accounts without a
+// password sign in with their provider again instead.
+type TwoFactorSetupRequest struct {
+	Password string `json:"password"`
+}
+
+// TwoFactorCodeRequest carries an authenticator or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorDisableRequest turns two-factor authentication off
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest finishes a login that asked for a second factor
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// TwoFactorChallenge is returned by Login instead of tokens when the account
+// has two-factor authentication; the challenge token is exchanged at
+// /login/2fa together with a code
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"` // seconds until the challenge lapses
+}
+
+// confirmIdentity checks that the current user is who they claim to be before
+// a change to their second factor: by their password or, for an account that
+// only signs in with identity providers, by a sign-in within reauthWindow. It
+// writes the error response itself when the check fails.
+func (h *Handler) confirmIdentity(c *gin.Context, user *models.User, password string) bool {
+	if user.Password != "" {
+		if password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+			return false
+		}
+		if !auth.CheckPasswordHash(password, user.Password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return false
+		}
+		return true
+	}
+
+	// API keys have no login session, so they never pass
+	sessions, err := h.logins.List(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login sessions"})
+		return false
+	}
+	for _, s := range sessions {
+		if s.ID == currentLoginSessionID(c) && time.Since(s.CreatedAt) < reauthWindow {
+			return true
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":           "Sign in again with your linked account to confirm it's you",
+		"reauth_required": true,
+	})
+	return false
+}
+
+// GetTwoFactorStatus reports whether the current user has two-factor
+// authentication enabled
+func (h *Handler) GetTwoFactorStatus(c *gin.Context) {
+	status, err := h.twoFactor.Status(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+	if h.require2FA.Admin {
+		// The admin API, and so the requirement, covers every staff role
+		if status.Required, err = h.roles.IsStaff(currentUserID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor creates a new TOTP secret for the current user; it takes
+// effect once EnableTwoFactor confirms a code from it
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	var req TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if !h.confirmIdentity(c, user, req.Password) {
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	err = h.twoFactor.StartEnrollment(user.ID, secret)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, user.Email),
+	})
+}
+
+// EnableTwoFactor confirms the pending secret with a code from the
+// authenticator app and returns the user's recovery codes, which are shown
+// this once only
+func (h *Handler) EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	secret, err := h.twoFactor.Secret(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if secret.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(secret.Secret, normalizeCode(req.Code), time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	err = h.twoFactor.Enable(userID, step, hashes)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after confirming the
+// user's identity and checking a current code
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if !h.confirmIdentity(c, user, req.Password) {
+		return
+	}
+	if err := h.verifySecondFactor(user.ID, req.Code, true); err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	if err := h.twoFactor.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's unused recovery codes;
+// it takes an authenticator code, since a lost device is what the codes are for
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	if err := h.verifySecondFactor(userID, req.Code, false); err != nil {
+		secondFactorFailed(c, err)
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := h.twoFactor.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTwoFactor finishes a login with the challenge token from Login and an
+// authenticator or recovery code
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := auth.ValidateChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in attempt has expired; please sign in again"})
+		return
+	}
+
+	user, err := h.users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	if err := h.verifySecondFactor(user.ID, req.Code, true); err != nil {
+		h.recordLogin(c, user.Email, user, models.LoginInvalidCode)
+		secondFactorFailed(c, err)
+		return
+	}
+
+	response, err := h.issueTokens(c, user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.recordLogin(c, user.Email, user, models.LoginSucceeded)
+	c.JSON(http.StatusOK, response)
+}
+
+// requireWithdrawalCode enforces the withdrawal policy: the current user must
+// have two-factor authentication and give a fresh authenticator code
+func (h *Handler) requireWithdrawalCode(c *gin.Context, code string) bool {
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return false
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Enable two-factor authentication to withdraw funds"})
+		return false
+	}
+	if code == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "An authentication code is required to withdraw funds"})
+		return false
+	}
+	if err := h.verifySecondFactor(user.ID, code, false); err != nil {
+		secondFactorFailed(c, err)
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor checks an authenticator code of userID, or also one of
+// their recovery codes when allowRecovery is set. Wrong codes count towards
+// a lockout, reported as ErrRateLimited; ErrNotFound means 2FA is not enabled.
+func (h *Handler) verifySecondFactor(userID int, code string, allowRecovery bool) error {
+	secret, err := h.twoFactor.Secret(userID)
+	if err != nil {
+		return err
+	}
+	if !secret.Enabled {
+		return repository.ErrNotFound
+	}
+	if secret.FailedAttempts >= twoFactorMaxFailures && secret.LastFailedAt != nil &&
+		time.Since(*secret.LastFailedAt) < twoFactorLockout {
+		return repository.ErrRateLimited
+	}
+
+	if step, ok := auth.ValidateTOTP(secret.Secret, normalizeCode(code), time.Now()); ok {
+		return h.twoFactor.UseStep(userID, step)
+	}
+	if allowRecovery {
+		err := h.twoFactor.UseRecoveryCode(userID, auth.HashRecoveryCode(code))
+		if !errors.Is(err, repository.ErrTokenInvalid) {
+			return err
+		}
+	}
+
+	if err := h.twoFactor.RecordFailure(userID); err != nil {
+		return err
+	}
+	return repository.ErrTokenInvalid
+}
+
+// secondFactorFailed writes the response for an error from verifySecondFactor
+func secondFactorFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, repository.ErrRateLimited):
+		c.Header("Retry-After", strconv.Itoa(int(twoFactorLockout.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong codes; please try again later"})
+	case errors.Is(err, repository.ErrTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This code has already been used; wait for the next one"})
+	case errors.Is(err, repository.ErrTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+	}
+}
+
+// normalizeCode strips the spaces authenticator apps show inside codes
+func normalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetupTwoFactorConfirmsIdentity(t *testing.T) {
+	hash, err := auth.HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		password   string // the account's; empty for provider-only accounts
+		signedIn   time.Duration
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"right password", hash, 0, `{"password":"password1"}`, http.StatusOK, ""},
+		{"wrong password", hash, 0, `{"password":"password2"}`, http.StatusUnauthorized, "Password is incorrect"},
+		{"no password", hash, 0, `{}`, http.StatusBadRequest, "Password is required"},
+		{"fresh provider sign-in", "", time.Minute, `{}`, http.StatusOK, ""},
+		{"stale provider sign-in", "", time.Hour, `{}`, http.StatusUnauthorized, "Sign in again with your linked account to confirm it's you"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			twoFactor := newFakeTwoFactor(testSeeker)
+			logins := &fakeLogins{}
+			logins.Create(&models.LoginSession{UserID: testSeeker, CreatedAt: time.Now().Add(-tt.signedIn)}, "family")
+			h := &Handler{
+				users:     newFakeUsers(&models.User{ID: testSeeker, Email: "seeker@example.com", Password: tt.password, IsActive: true}),
+				twoFactor: twoFactor,
+				logins:    logins,
+			}
+			router := gin.New()
+			router.Use(signedIn(testSeeker, models.RoleSeeker))
+			router.POST("/2fa/setup", h.SetupTwoFactor)
+
+			w := serve(router, http.MethodPost, "/2fa/setup", tt.body)
+			expectStatus(t, w, tt.wantStatus)
+			body := decode(t, w)
+			if tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+			if enrolled := twoFactor.pending != ""; enrolled != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("enrollment started = %v with status %d", enrolled, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verificationResendInterval is the least time between two verification emails
+const verificationResendInterval = 2 * time.Minute
+
+// VerifyEmailRequest carries the token from a verification link
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail confirms a user's email address from the token mailed to it
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, email, err := auth.ValidateEmailToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	// The address must not have changed since the link was sent
+	err = h.users.MarkEmailVerified(userID, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail mails the current user a new verification link
+func (h *Handler) ResendVerificationEmail(c *gin.Context) {
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user.IsEmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	err = h.sendVerificationEmail(user)
+	if errors.Is(err, repository.ErrRateLimited) {
+		c.Header("Retry-After", strconv.Itoa(int(verificationResendInterval.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A verification email was sent recently; please wait before requesting another"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// sendVerificationEmail mails user a link to verify their address, unless
+// one went out too recently
+func (h *Handler) sendVerificationEmail(user *models.User) error {
+	if err := h.users.ClaimVerificationEmail(user.ID, verificationResendInterval); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateEmailToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/verify-email?token=" + url.QueryEscape(token))
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your SynapMentor email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create a SynapMentor account, you can ignore this email.\n",
+			user.FirstName, link, int(auth.EmailTokenTTL.Hours())),
+	})
+}
+
+// requireVerifiedEmail rejects users who have not verified their email address
+func (h *Handler) requireVerifiedEmail(c *gin.Context) bool {
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return false
+	}
+	if !user.IsEmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before booking sessions"})
+		return false
+	}
+	return true
+}
+
+// appURL builds a link into the web app, which is served from APP_BASE_URL
+func appURL(path string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
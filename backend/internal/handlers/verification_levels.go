@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIDDocumentSize caps an uploaded ID document
+const maxIDDocumentSize = 10 << 20
+
+// idDocumentTypes are the kinds of ID accepted for full verification
+var idDocumentTypes = map[string]bool{
+	"passport":        true,
+	"national_id":     true,
+	"drivers_license": true,
+}
+
+// idDocumentContentTypes are the file formats accepted, keyed by sniffed type
+var idDocumentContentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// ReviewDocumentRequest approves or rejects an ID document
+type ReviewDocumentRequest struct {
+	Approve *bool  `json:"approve" binding:"required"`
+	Reason  string `json:"reason"`
+}
+
+// idDocumentDir is where uploaded ID documents are kept, outside any
+// publicly served directory
+func idDocumentDir() string {
+	if dir := os.Getenv("ID_DOCUMENT_DIR"); dir != "" {
+		return dir
+	}
+	return "./data/id-documents"
+}
+
+// verificationRequiredError is returned from inside a transition when the
+// user's verification level is too low for it
+type verificationRequiredError struct {
+	level, required string
+}
+
+func (e *verificationRequiredError) Error() string {
+	return "verification level " + e.required + " required"
+}
+
+// checkLevel returns a verificationRequiredError if userID may not take
+// action for amount
+func (h *Handler) checkLevel(userID int, action policy.Action, amount float64) error {
+	user, err := h.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if ok, required := h.verification.Allows(user.VerificationLevel, action, amount); !ok {
+		return &verificationRequiredError{level: user.VerificationLevel, required: required}
+	}
+	return nil
+}
+
+// verificationRequired writes the response for a verificationRequiredError
+func verificationRequired(c *gin.Context, e *verificationRequiredError) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":              "Your account needs " + e.required + " verification to do this",
+		"verification_level": e.level,
+		"required_level":     e.required,
+	})
+}
+
+// requireLevel checks the current user may take action for amount, writing
+// the error response and returning false if not
+func (h *Handler) requireLevel(c *gin.Context, action policy.Action, amount float64) bool {
+	err := h.checkLevel(currentUserID(c), action, amount)
+	var required *verificationRequiredError
+	if errors.As(err, &required) {
+		verificationRequired(c, required)
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification"})
+		return false
+	}
+	return true
+}
+
+// GetVerification returns the current user's verification level, what it
+// rests on and what each level unlocks
+func (h *Handler) GetVerification(c *gin.Context) {
+	user, err := h.users.GetByID(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	docs, err := h.idDocuments.Documents(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get documents"})
+		return
+	}
+	if docs == nil {
+		docs = []models.IdentityDocument{}
+	}
+
+	identity := "none"
+	if len(docs) > 0 {
+		identity = docs[0].Status
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"verification_level": user.VerificationLevel,
+		"email_verified":     user.IsEmailVerified,
+		"phone_verified":     user.IsPhoneVerified,
+		"identity_status":    identity,
+		"documents":          docs,
+		"requirements": gin.H{
+			string(policy.AcceptPaidSession): h.verification.RequiredLevel(policy.AcceptPaidSession, 0),
+			string(policy.Withdraw):          h.verification.RequiredLevel(policy.Withdraw, 0),
+			"large_withdrawal":               h.verification.RequiredLevel(policy.Withdraw, h.verification.LargeWithdrawal+0.01),
+			"large_withdrawal_above":         h.verification.LargeWithdrawal,
+		},
+	})
+}
+
+// SubmitIDDocument uploads an ID document for staff to review
+func (h *Handler) SubmitIDDocument(c *gin.Context) {
+	userID := currentUserID(c)
+
+	docType := c.PostForm("document_type")
+	if !idDocumentTypes[docType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "document_type must be passport, national_id or drivers_license"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIDDocumentSize+1<<20)
+	header, err := c.FormFile("document")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attach the document as a file named document"})
+		return
+	}
+	if header.Size > maxIDDocumentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Document must be 10MB or smaller"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read document"})
+		return
+	}
+	defer file.Close()
+
+	// Trust the bytes, not the name or header the client sent
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := idDocumentContentTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Document must be a JPEG, PNG or PDF"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read document"})
+		return
+	}
+
+	key, err := storeIDDocument(file, ext)
+	if err != nil {
+		log.Printf("Failed to store ID document for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+		return
+	}
+
+	doc := models.IdentityDocument{
+		UserID:       userID,
+		DocumentType: docType,
+		FileKey:      key,
+		FileName:     filepath.Base(header.Filename),
+		ContentType:  contentType,
+		Size:         header.Size,
+	}
+	_, err = h.idDocuments.SubmitDocument(&doc)
+	if err != nil {
+		os.Remove(filepath.Join(idDocumentDir(), key))
+	}
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a document pending review or approved"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit document"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Document submitted for review",
+		"document": doc,
+	})
+}
+
+// storeIDDocument writes an uploaded document under a random name readable
+// only by the server and returns that name
+func storeIDDocument(src io.Reader, ext string) (string, error) {
+	dir := idDocumentDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b) + ext
+
+	path := filepath.Join(dir, key)
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return key, nil
+}
+
+// GetIDDocuments lists ID documents for review, pending ones by default
+func (h *Handler) GetIDDocuments(c *gin.Context) {
+	status := c.DefaultQuery("status", models.DocumentPending)
+	docs, err := h.idDocuments.ListDocuments(status, queryInt(c, "limit", 50), queryInt(c, "offset", 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get documents"})
+		return
+	}
+	if docs == nil {
+		docs = []models.IdentityDocument{}
+	}
+
+	c.JSON(http.StatusOK, docs)
+}
+
+// GetIDDocumentFile serves the uploaded file of an ID document to a reviewer
+func (h *Handler) GetIDDocumentFile(c *gin.Context) {
+	doc, ok := h.loadIDDocument(c)
+	if !ok {
+		return
+	}
+
+	log.Printf("User %d viewed ID document %d of user %d", currentUserID(c), doc.ID, doc.UserID)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", "inline")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", doc.ContentType)
+	c.File(filepath.Join(idDocumentDir(), filepath.Base(doc.FileKey)))
+}
+
+// ReviewIDDocument approves or rejects a pending ID document, updating the
+// owner's verification level
+func (h *Handler) ReviewIDDocument(c *gin.Context) {
+	var req ReviewDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !*req.Approve && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give a reason when rejecting a document"})
+		return
+	}
+
+	doc, ok := h.loadIDDocument(c)
+	if !ok {
+		return
+	}
+	if doc.UserID == currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot review your own document"})
+		return
+	}
+
+	err := h.idDocuments.ReviewDocument(doc.ID, currentUserID(c), *req.Approve, req.Reason)
+	if errors.Is(err, repository.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Document has already been reviewed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review document"})
+		return
+	}
+
+	if *req.Approve {
+		h.notifications.Create(doc.UserID, "Identity Verified",
+			"Your ID document was approved and your account is now fully verified", "in_app")
+	} else {
+		h.notifications.Create(doc.UserID, "Identity Document Rejected",
+			"Your ID document was rejected: "+req.Reason, "in_app")
+	}
+	log.Printf("User %d reviewed ID document %d of user %d (approved: %t)", currentUserID(c), doc.ID, doc.UserID, *req.Approve)
+
+	user, err := h.users.GetByID(doc.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Document reviewed",
+		"verification_level": user.VerificationLevel,
+	})
+}
+
+// loadIDDocument fetches the ID document named by :id, writing the error
+// response and returning false if it cannot
+func (h *Handler) loadIDDocument(c *gin.Context) (*models.IdentityDocument, bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return nil, false
+	}
+	doc, err := h.idDocuments.GetDocument(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get document"})
+		return nil, false
+	}
+	return doc, true
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verificationFixture serves the verification routes to userID
+type verificationFixture struct {
+	users  *fakeUsers
+	mailer *fakeMailer
+	router *gin.Engine
+}
+
+func newVerificationFixture(userID int, verified bool) *verificationFixture {
+	f := &verificationFixture{
+		users: newFakeUsers(&models.User{
+			ID: 1, Email: "seeker@example.com", FirstName: "Sam", Role: "seeker", IsEmailVerified: verified,
+		}),
+		mailer: &fakeMailer{},
+	}
+	h := &Handler{users: f.users, mailer: f.mailer}
+	f.router = gin.New()
+	f.router.POST("/verify-email", h.VerifyEmail)
+	f.router.POST("/verify-email/resend", signedIn(userID, "seeker"), h.ResendVerificationEmail)
+	f.router.POST("/sessions", signedIn(userID, "seeker"), h.CreateSession)
+	return f
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	f := newVerificationFixture(1, false)
+
+	w := serve(f.router, http.MethodPost, "/verify-email/resend", "")
+	expectStatus(t, w, http.StatusOK)
+	if len(f.mailer.sent) != 1 || f.mailer.sent[0].To != "seeker@example.com" {
+		t.Fatalf("sent = %+v, want one email to the seeker", f.mailer.sent)
+	}
+	if !strings.Contains(f.mailer.sent[0].Body, "/verify-email?token=") {
+		t.Errorf("email body has no verification link:\n%s", f.mailer.sent[0].Body)
+	}
+
+	w = serve(f.router, http.MethodPost, "/verify-email/resend", "")
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("throttled resend has no Retry-After header")
+	}
+	if len(f.mailer.sent) != 1 {
+		t.Errorf("a throttled resend sent %d emails in all", len(f.mailer.sent))
+	}
+
+	verified := newVerificationFixture(1, true)
+	expectStatus(t, serve(verified.router, http.MethodPost, "/verify-email/resend", ""), http.StatusConflict)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	valid, err := auth.GenerateEmailToken(1, "seeker@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := auth.GenerateEmailToken(1, "old@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := auth.GenerateToken(1, 1, "seeker@example.com", "seeker", []string{"seeker"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid link", valid, http.StatusOK},
+		{"address changed since", stale, http.StatusBadRequest},
+		{"access token", access, http.StatusBadRequest},
+		{"garbage", "not-a-token", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newVerificationFixture(0, false)
+			w := serve(f.router, http.MethodPost, "/verify-email", `{"token":"`+url.QueryEscape(tt.token)+`"}`)
+			expectStatus(t, w, tt.want)
+			if got := f.users.byID[1].IsEmailVerified; got != (tt.want == http.StatusOK) {
+				t.Errorf("IsEmailVerified = %v", got)
+			}
+		})
+	}
+}
+
+func TestBookingNeedsVerifiedEmail(t *testing.T) {
+	f := newVerificationFixture(1, false)
+	body := `{"seeker_id":2,"title":"Algebra","category":"math","scheduled_at":"2030-01-07T10:00:00Z","duration":60,"price":50}`
+	w := serve(f.router, http.MethodPost, "/sessions", body)
+	expectStatus(t, w, http.StatusForbidden)
+}
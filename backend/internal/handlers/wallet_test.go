@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// walletFixture serves the wallet routes to userID; the seeker's wallet
+// holds 100 and the seeker is verified to level
+type walletFixture struct {
+	h       *Handler
+	users   *fakeUsers
+	wallets *fakeWallets
+	router  *gin.Engine
+}
+
+func newWalletFixture(userID int, level string) *walletFixture {
+	f := &walletFixture{
+		users:   newFakeUsers(&models.User{ID: testSeeker, Email: "seeker@example.com", Role: "seeker", IsActive: true, VerificationLevel: level}),
+		wallets: newFakeWallets(&models.Wallet{ID: 10, UserID: testSeeker, Balance: 100, Currency: "USD"}),
+	}
+	f.h = &Handler{users: f.users, wallets: f.wallets, verification: policy.Default()}
+	f.router = gin.New()
+	f.router.Use(signedIn(userID, "seeker"))
+	f.router.GET("/wallet", f.h.GetWallet)
+	f.router.GET("/wallet/transactions", f.h.GetTransactions)
+	f.router.POST("/wallet/transfer", f.h.TransferFunds)
+	return f
+}
+
+func TestGetWallet(t *testing.T) {
+	f := newWalletFixture(testSeeker, models.VerificationLight)
+	w := serve(f.router, http.MethodGet, "/wallet", "")
+	expectStatus(t, w, http.StatusOK)
+	if body := decode(t, w); body["balance"] != 100.0 || body["user_id"] != float64(testSeeker) {
+		t.Errorf("wallet = %v", body)
+	}
+
+	f = newWalletFixture(testOther, models.VerificationLight)
+	expectStatus(t, serve(f.router, http.MethodGet, "/wallet", ""), http.StatusInternalServerError)
+}
+
+func TestGetTransactionsPages(t *testing.T) {
+	f := newWalletFixture(testSeeker, models.VerificationLight)
+	for i := 0; i < 5; i++ {
+		f.wallets.Transfer(testSeeker, "deposit", 1, "Top up")
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 5},
+		{"?limit=2", 2},
+		{"?limit=2&offset=4", 1},
+		{"?offset=9", 0},
+		{"?limit=-1", 5},
+	}
+	for _, tt := range tests {
+		w := serve(f.router, http.MethodGet, "/wallet/transactions"+tt.query, "")
+		expectStatus(t, w, http.StatusOK)
+		var transactions []models.Transaction
+		if err := json.Unmarshal(w.Body.Bytes(), &transactions); err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != tt.want {
+			t.Errorf("GET /wallet/transactions%s returned %d transactions, want %d", tt.query, len(transactions), tt.want)
+		}
+	}
+}
+
+func TestTransferFunds(t *testing.T) {
+	tests := []struct {
+		name        string
+		level       string
+		body        string
+		wantStatus  int
+		wantBalance float64
+	}{
+		{"deposit", models.VerificationLight, `{"type":"deposit","amount":25}`, http.StatusOK, 125},
+		{"withdraw", models.VerificationLight, `{"type":"withdraw","amount":40}`, http.StatusOK, 60},
+		{"withdraw everything", models.VerificationLight, `{"type":"withdraw","amount":100}`, http.StatusOK, 0},
+		{"overdraw", models.VerificationLight, `{"type":"withdraw","amount":100.01}`, http.StatusBadRequest, 100},
+		{"zero", models.VerificationLight, `{"type":"deposit","amount":0}`, http.StatusBadRequest, 100},
+		{"unknown type", models.VerificationLight, `{"type":"steal","amount":5}`, http.StatusBadRequest, 100},
+		{"large withdrawal", models.VerificationStandard, `{"type":"withdraw","amount":600}`, http.StatusForbidden, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWalletFixture(testSeeker, tt.level)
+
+			w := serve(f.router, http.MethodPost, "/wallet/transfer", tt.body)
+			expectStatus(t, w, tt.wantStatus)
+			if tt.wantStatus == http.StatusOK && decode(t, w)["new_balance"] != tt.wantBalance {
+				t.Errorf("new_balance = %v, want %v", decode(t, w)["new_balance"], tt.wantBalance)
+			}
+			if got := f.wallets.byUser[testSeeker].Balance; got != tt.wantBalance {
+				t.Errorf("balance = %v, want %v", got, tt.wantBalance)
+			}
+			if recorded := len(f.wallets.transactions[10]); (recorded != 0) != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("recorded %d transactions", recorded)
+			}
+		})
+	}
+}
+
+func TestWithdrawalNeedsSecondFactorWhenRequired(t *testing.T) {
+	tests := []struct {
+		name       string
+		twoFactor  bool
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"without two-factor", false, `{"type":"withdraw","amount":10}`, http.StatusForbidden, "Enable two-factor authentication to withdraw funds"},
+		{"without a code", true, `{"type":"withdraw","amount":10}`, http.StatusUnauthorized, "An authentication code is required to withdraw funds"},
+		{"wrong code", true, `{"type":"withdraw","amount":10,"two_factor_code":"000000"}`, http.StatusUnauthorized, "Invalid authentication code"},
+		{"recovery codes don't count", true, `{"type":"withdraw","amount":10,"two_factor_code":"recovery-code"}`, http.StatusUnauthorized, "Invalid authentication code"},
+		{"deposits never ask", false, `{"type":"deposit","amount":10}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWalletFixture(testSeeker, models.VerificationLight)
+			f.h.require2FA = auth.TwoFactorPolicy{Withdrawals: true}
+			f.h.twoFactor = newFakeTwoFactor(testSeeker, "recovery-code")
+			f.users.byID[testSeeker].TwoFactorEnabled = tt.twoFactor
+
+			w := serve(f.router, http.MethodPost, "/wallet/transfer", tt.body)
+			expectStatus(t, w, tt.wantStatus)
+			if body := decode(t, w); tt.wantError != "" && body["error"] != tt.wantError {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantError)
+			}
+			if tt.wantStatus != http.StatusOK && f.wallets.byUser[testSeeker].Balance != 100 {
+				t.Error("refused withdrawal moved money")
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package ical writes iCalendar (RFC 5545) documents for calendar feeds and
+// per-session invitations
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar methods (RFC 5546)
+const (
+	MethodPublish = "PUBLISH" // a read-only feed
+	MethodRequest = "REQUEST" // an invitation or update
+	MethodCancel  = "CANCEL"  // withdraws a previously sent invitation
+)
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+const productID = "-//SynapMentor//SynapMentor Calendar//EN"
+
+// timeFormat is the UTC date-time form, e.g. 20240131T170000Z
+const timeFormat = "20060102T150405Z"
+
+// Calendar is a VCALENDAR object
+type Calendar struct {
+	Name   string
+	Method string
+	Events []Event
+}
+
+// Attendee is a participant of an event
+type Attendee struct {
+	Name  string
+	Email string
+}
+
+// Event is a VEVENT component. UID must stay stable for the lifetime of the
+// underlying record and Sequence must grow with every significant change so
+// that calendar clients replace their copy.
+type Event struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Status      string
+	Organizer   *Attendee
+	Attendees   []Attendee
+	Updated     time.Time
+}
+
+// Write serialises the calendar with CRLF line endings and folded lines
+func (c *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + productID)
+	lw.line("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		lw.line("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	stamp := time.Now().UTC().Format(timeFormat)
+	for _, e := range c.Events {
+		lw.line("BEGIN:VEVENT")
+		lw.line("UID:" + e.UID)
+		lw.line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+		lw.line("DTSTAMP:" + stamp)
+		lw.line("DTSTART:" + e.Start.UTC().Format(timeFormat))
+		lw.line("DTEND:" + e.End.UTC().Format(timeFormat))
+		lw.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Status != "" {
+			lw.line("STATUS:" + e.Status)
+		}
+		if !e.Updated.IsZero() {
+			lw.line("LAST-MODIFIED:" + e.Updated.UTC().Format(timeFormat))
+		}
+		if e.Organizer != nil {
+			lw.line("ORGANIZER" + person(*e.Organizer))
+		}
+		for _, a := range e.Attendees {
+			lw.line("ATTENDEE;ROLE=REQ-PARTICIPANT" + person(a))
+		}
+		lw.line("END:VEVENT")
+	}
+
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+// person renders the parameters and value of an ORGANIZER or ATTENDEE line
+func person(a Attendee) string {
+	s := ""
+	if a.Name != "" {
+		s += `;CN="` + strings.NewReplacer(`"`, "'", "\n", " ").Replace(a.Name) + `"`
+	}
+	return s + ":mailto:" + a.Email
+}
+
+// escape escapes a TEXT value
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// lineWriter writes content lines folded at 75 octets without splitting
+// UTF-8 sequences
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	const limit = 75
+	for first := true; ; first = false {
+		max := limit
+		if !first {
+			max-- // continuation lines start with a space
+		}
+		if len(s) <= max {
+			lw.write(s, first)
+			return
+		}
+		cut := max
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		lw.write(s[:cut], first)
+		s = s[cut:]
+	}
+}
+
+func (lw *lineWriter) write(s string, first bool) {
+	if !first {
+		s = " " + s
+	}
+	_, lw.err = io.WriteString(lw.w, s+"\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,84 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWrite(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	cal := &Calendar{
+		Name:   "Sessions",
+		Method: MethodRequest,
+		Events: []Event{{
+			UID:         "session-7@synapmentor",
+			Sequence:    2,
+			Start:       time.Date(2026, 3, 10, 18, 0, 0, 0, berlin),
+			End:         time.Date(2026, 3, 10, 19, 0, 0, 0, berlin),
+			Summary:     "Algebra; fractions, decimals",
+			Description: "Bring\nnotes",
+			Status:      StatusConfirmed,
+			Organizer:   &Attendee{Name: `Ada "the solver"`, Email: "ada@example.com"},
+			Attendees:   []Attendee{{Email: "bob@example.com"}},
+		}},
+	}
+
+	var b strings.Builder
+	if err := cal.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") || strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Errorf("lines are not CRLF-terminated:\n%q", out)
+	}
+	for _, want := range []string{
+		"METHOD:REQUEST\r\n",
+		"UID:session-7@synapmentor\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20260310T170000Z\r\n",
+		"DTEND:20260310T180000Z\r\n",
+		`SUMMARY:Algebra\; fractions\, decimals` + "\r\n",
+		`DESCRIPTION:Bring\nnotes` + "\r\n",
+		"STATUS:CONFIRMED\r\n",
+		`ORGANIZER;CN="Ada 'the solver'":mailto:ada@example.com` + "\r\n",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT:mailto:bob@example.com\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "LAST-MODIFIED") {
+		t.Error("LAST-MODIFIED written without an update time")
+	}
+}
+
+func TestLinesAreFolded(t *testing.T) {
+	summary := strings.Repeat("Übung ", 40)
+	cal := &Calendar{Events: []Event{{UID: "1", Summary: summary}}}
+
+	var b strings.Builder
+	if err := cal.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var unfolded strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+		} else {
+			unfolded.WriteString("\n" + line)
+		}
+	}
+	if !strings.Contains(unfolded.String(), "\nSUMMARY:"+summary+"\n") {
+		t.Errorf("unfolding does not give back the summary:\n%s", unfolded.String())
+	}
+}
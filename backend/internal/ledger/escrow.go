@@ -0,0 +1,163 @@
+package ledger
+
+import (
+	"os"
+	"strconv"
+	"synapmentor/internal/database"
+	"time"
+)
+
+// Platform accounts used for session and event payments
+const (
+	AccountEscrow       = "system:escrow"        // funds held until a session or event settles
+	AccountPlatformFees = "system:platform_fees" // fees retained from solver payouts
+)
+
+// Policy configures how escrowed session payments are settled
+type Policy struct {
+	// PlatformFeePercent is retained from every amount paid out to a solver
+	PlatformFeePercent float64
+	// FullRefundWindow is how long before the start a seeker may cancel for a full refund
+	FullRefundWindow time.Duration
+	// LateRefundPercent is refunded to a seeker who cancels inside the window;
+	// the rest is paid out to the solver
+	LateRefundPercent float64
+}
+
+// PolicyFromEnv reads the settlement policy from PLATFORM_FEE_PERCENT,
+// CANCELLATION_FULL_REFUND_HOURS and LATE_CANCELLATION_REFUND_PERCENT
+func PolicyFromEnv() Policy {
+	return Policy{
+		PlatformFeePercent: envFloat("PLATFORM_FEE_PERCENT", 10),
+		FullRefundWindow:   time.Duration(envFloat("CANCELLATION_FULL_REFUND_HOURS", 24) * float64(time.Hour)),
+		LateRefundPercent:  envFloat("LATE_CANCELLATION_REFUND_PERCENT", 50),
+	}
+}
+
+func envFloat(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
+
+// Fee returns the platform fee on a payout
+func (p Policy) Fee(cents int64) int64 {
+	return percentOf(cents, p.PlatformFeePercent)
+}
+
+// SeekerRefund returns how much of a held amount goes back to the seeker when
+// the session is cancelled at cancelledAt. Cancellations by the solver are
+// always refunded in full.
+func (p Policy) SeekerRefund(cents int64, scheduledAt, cancelledAt time.Time, bySolver bool) int64 {
+	if bySolver || scheduledAt.Sub(cancelledAt) >= p.FullRefundWindow {
+		return cents
+	}
+	return p.LateRefund(cents)
+}
+
+// LateRefund returns how much of a held amount goes back to a seeker who
+// cancelled too late or did not show up
+func (p Policy) LateRefund(cents int64) int64 {
+	return percentOf(cents, p.LateRefundPercent)
+}
+
+func percentOf(cents int64, percent float64) int64 {
+	if percent >= 100 {
+		return cents
+	}
+	return int64(float64(cents)*percent/100 + 0.5)
+}
+
+// HoldSessionFunds moves a seeker's payment into escrow
+func HoldSessionFunds(tx *database.Tx, sessionID, seekerWalletID int, cents int64, description string) (int64, error) {
+	return holdFunds(tx, Entry{Kind: "escrow_hold", Description: description, SessionID: &sessionID},
+		seekerWalletID, cents)
+}
+
+// HoldEventFunds moves an attendee's payment for an event ticket into escrow
+func HoldEventFunds(tx *database.Tx, eventID, attendeeWalletID int, cents int64, description string) (int64, error) {
+	return holdFunds(tx, Entry{Kind: "escrow_hold", Description: description, EventID: &eventID},
+		attendeeWalletID, cents)
+}
+
+// holdFunds posts entry moving cents from a wallet into escrow
+func holdFunds(tx *database.Tx, entry Entry, walletID int, cents int64) (int64, error) {
+	payer, err := WalletAccount(tx, walletID)
+	if err != nil {
+		return 0, err
+	}
+	escrow, err := SystemAccount(tx, AccountEscrow)
+	if err != nil {
+		return 0, err
+	}
+
+	entry.Postings = []Posting{
+		{AccountID: payer, Amount: -cents},
+		{AccountID: escrow, Amount: cents},
+	}
+	return Post(tx, entry)
+}
+
+// Settlement splits an escrowed amount between seeker, solver and platform
+type Settlement struct {
+	Refund int64 // back to the seeker
+	Payout int64 // to the solver, after fees
+	Fee    int64 // retained by the platform
+}
+
+// Settle computes how a held amount is split once refundCents has been
+// decided; the solver's share is subject to the platform fee
+func (p Policy) Settle(heldCents, refundCents int64) Settlement {
+	solverShare := heldCents - refundCents
+	fee := p.Fee(solverShare)
+	return Settlement{Refund: refundCents, Payout: solverShare - fee, Fee: fee}
+}
+
+// SettleSessionFunds releases escrow according to a settlement
+func SettleSessionFunds(tx *database.Tx, sessionID, seekerWalletID, solverWalletID int, s Settlement, kind, description string) (int64, error) {
+	return settleFunds(tx, Entry{Kind: kind, Description: description, SessionID: &sessionID},
+		seekerWalletID, solverWalletID, s)
+}
+
+// SettleEventFunds releases escrowed ticket payments according to a
+// settlement, refunding the attendee and paying out the organizer.
+// attendeeWalletID is ignored when nothing is refunded.
+func SettleEventFunds(tx *database.Tx, eventID, attendeeWalletID, organizerWalletID int, s Settlement, kind, description string) (int64, error) {
+	return settleFunds(tx, Entry{Kind: kind, Description: description, EventID: &eventID},
+		attendeeWalletID, organizerWalletID, s)
+}
+
+// settleFunds posts entry releasing escrow: the refund to payerWalletID, the
+// payout to payeeWalletID and the fee to the platform
+func settleFunds(tx *database.Tx, entry Entry, payerWalletID, payeeWalletID int, s Settlement) (int64, error) {
+	escrow, err := SystemAccount(tx, AccountEscrow)
+	if err != nil {
+		return 0, err
+	}
+
+	entry.Postings = []Posting{{AccountID: escrow, Amount: -(s.Refund + s.Payout + s.Fee)}}
+	if s.Refund > 0 {
+		payer, err := WalletAccount(tx, payerWalletID)
+		if err != nil {
+			return 0, err
+		}
+		entry.Postings = append(entry.Postings, Posting{AccountID: payer, Amount: s.Refund})
+	}
+	if s.Payout > 0 {
+		payee, err := WalletAccount(tx, payeeWalletID)
+		if err != nil {
+			return 0, err
+		}
+		entry.Postings = append(entry.Postings, Posting{AccountID: payee, Amount: s.Payout})
+	}
+	if s.Fee > 0 {
+		fees, err := SystemAccount(tx, AccountPlatformFees)
+		if err != nil {
+			return 0, err
+		}
+		entry.Postings = append(entry.Postings, Posting{AccountID: fees, Amount: s.Fee})
+	}
+
+	return Post(tx, entry)
+}
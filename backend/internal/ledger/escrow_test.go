@@ -0,0 +1,124 @@
+package ledger_test
+
+import (
+	"synapmentor/internal/ledger"
+	"testing"
+	"time"
+)
+
+// policy keeps 10% of payouts and refunds half of a cancellation made less
+// than a day ahead
+var policy = ledger.Policy{
+	PlatformFeePercent: 10,
+	FullRefundWindow:   24 * time.Hour,
+	LateRefundPercent:  50,
+}
+
+func TestPolicyFee(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  int64
+	}{
+		{4000, 400},
+		{0, 0},
+		{1, 0},      // 0.1 of a cent rounds down
+		{4, 0},      // 0.4
+		{5, 1},      // half a cent rounds up
+		{1999, 200}, // 199.9
+		{1234, 123}, // 123.4
+		{1235, 124}, // 123.5
+		{99999, 10000},
+	}
+	for _, tt := range tests {
+		if got := policy.Fee(tt.cents); got != tt.want {
+			t.Errorf("Fee(%d) = %d, want %d", tt.cents, got, tt.want)
+		}
+	}
+
+	all := ledger.Policy{PlatformFeePercent: 100}
+	if got := all.Fee(4001); got != 4001 {
+		t.Errorf("a 100%% fee on 4001 = %d", got)
+	}
+}
+
+func TestPolicySeekerRefund(t *testing.T) {
+	scheduled := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		cents     int64
+		cancelled time.Time
+		bySolver  bool
+		want      int64
+	}{
+		{"a week ahead", 4000, scheduled.Add(-7 * 24 * time.Hour), false, 4000},
+		{"exactly at the cutoff", 4000, scheduled.Add(-24 * time.Hour), false, 4000},
+		{"just past the cutoff", 4000, scheduled.Add(-24*time.Hour + time.Nanosecond), false, 2000},
+		{"an hour ahead", 4000, scheduled.Add(-time.Hour), false, 2000},
+		{"after the start", 4000, scheduled.Add(time.Hour), false, 2000},
+		{"late, odd cents", 4001, scheduled.Add(-time.Hour), false, 2001},
+		{"late, one cent", 1, scheduled.Add(-time.Hour), false, 1},
+		{"by the solver, late", 4001, scheduled.Add(-time.Hour), true, 4001},
+		{"by the solver, after the start", 4000, scheduled.Add(time.Hour), true, 4000},
+	}
+	for _, tt := range tests {
+		if got := policy.SeekerRefund(tt.cents, scheduled, tt.cancelled, tt.bySolver); got != tt.want {
+			t.Errorf("%s: SeekerRefund(%d) = %d, want %d", tt.name, tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyLateRefund(t *testing.T) {
+	scheduled := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	late := scheduled.Add(-time.Hour)
+
+	tests := []struct {
+		percent float64
+		cents   int64
+		want    int64
+	}{
+		{0, 4000, 0},
+		{25, 4000, 1000},
+		{25, 1002, 251}, // 250.5
+		{33, 1000, 330},
+		{100, 4001, 4001},
+		{150, 4001, 4001}, // never more than was held
+	}
+	for _, tt := range tests {
+		p := policy
+		p.LateRefundPercent = tt.percent
+		if got := p.LateRefund(tt.cents); got != tt.want {
+			t.Errorf("%v%% LateRefund(%d) = %d, want %d", tt.percent, tt.cents, got, tt.want)
+		}
+		if got := p.SeekerRefund(tt.cents, scheduled, late, false); got != tt.want {
+			t.Errorf("%v%% late SeekerRefund(%d) = %d, want %d", tt.percent, tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestPolicySettle(t *testing.T) {
+	tests := []struct {
+		name   string
+		held   int64
+		refund int64
+		want   ledger.Settlement
+	}{
+		{"completed", 4000, 0, ledger.Settlement{Refund: 0, Payout: 3600, Fee: 400}},
+		{"refunded in full", 4000, 4000, ledger.Settlement{Refund: 4000, Payout: 0, Fee: 0}},
+		{"half refunded", 4000, 2000, ledger.Settlement{Refund: 2000, Payout: 1800, Fee: 200}},
+		{"half of odd cents", 4001, 2001, ledger.Settlement{Refund: 2001, Payout: 1800, Fee: 200}},
+		{"fee rounds up", 3333, 1667, ledger.Settlement{Refund: 1667, Payout: 1499, Fee: 167}},
+		{"fee rounds down", 3330, 1666, ledger.Settlement{Refund: 1666, Payout: 1498, Fee: 166}},
+		{"one cent", 1, 0, ledger.Settlement{Refund: 0, Payout: 1, Fee: 0}},
+		{"nothing held", 0, 0, ledger.Settlement{}},
+	}
+	for _, tt := range tests {
+		got := policy.Settle(tt.held, tt.refund)
+		if got != tt.want {
+			t.Errorf("%s: Settle(%d, %d) = %+v, want %+v", tt.name, tt.held, tt.refund, got, tt.want)
+		}
+		if sum := got.Refund + got.Payout + got.Fee; sum != tt.held {
+			t.Errorf("%s: settlement %+v pays out %d of %d held", tt.name, got, sum, tt.held)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package ledger implements the append-only double-entry ledger behind wallet
+// balances. Every movement of money is a journal entry whose postings sum to
+// zero; a wallet's balance is the sum of the postings on its account.
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"synapmentor/internal/database"
+	"time"
+)
+
+// System account codes. Money entering or leaving the platform is balanced
+// against these so that the ledger as a whole always sums to zero.
+const (
+	AccountExternal       = "system:external"        // deposits and withdrawals
+	AccountOpeningBalance = "system:opening_balance" // balances that predate the ledger
+)
+
+var (
+	// ErrUnbalanced is returned when an entry's postings do not sum to zero
+	ErrUnbalanced = errors.New("ledger entry postings do not sum to zero")
+	// ErrInsufficientFunds is returned when an entry would overdraw a wallet
+	ErrInsufficientFunds = errors.New("insufficient balance")
+)
+
+// Posting moves Amount minor units into (positive) or out of (negative) an account
+type Posting struct {
+	AccountID int64
+	Amount    int64
+}
+
+// Entry is a balanced set of postings recorded atomically
+type Entry struct {
+	Kind        string
+	Description string
+	Reference   string
+	SessionID   *int
+	EventID     *int
+	Postings    []Posting
+}
+
+// ToCents converts a currency amount into integer minor units
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromCents converts integer minor units into a currency amount
+func FromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// Post records an entry inside tx and refreshes the cached balance of every
+// wallet it touches. Wallet accounts may not go negative; the caller must
+// have locked the wallets involved (see LockWallet) before posting.
+func Post(tx *database.Tx, entry Entry) (int64, error) {
+	var sum int64
+	for _, p := range entry.Postings {
+		sum += p.Amount
+	}
+	if len(entry.Postings) < 2 || sum != 0 {
+		return 0, ErrUnbalanced
+	}
+
+	entryID, err := tx.InsertID(`
+		INSERT INTO journal_entries (kind, description, reference, session_id, event_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Kind, entry.Description, entry.Reference, entry.SessionID, entry.EventID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	touched := make(map[int64]bool, len(entry.Postings))
+	for _, p := range entry.Postings {
+		if _, err := tx.Exec(`
+			INSERT INTO postings (entry_id, account_id, amount) VALUES (?, ?, ?)`,
+			entryID, p.AccountID, p.Amount); err != nil {
+			return 0, err
+		}
+		touched[p.AccountID] = true
+	}
+
+	for accountID := range touched {
+		if err := refreshWalletBalance(tx, accountID); err != nil {
+			return 0, err
+		}
+	}
+
+	return entryID, nil
+}
+
+// refreshWalletBalance recomputes the cached wallets.balance from the ledger
+// for wallet accounts and rejects overdrafts
+func refreshWalletBalance(tx *database.Tx, accountID int64) error {
+	var walletID sql.NullInt64
+	if err := tx.QueryRow("SELECT wallet_id FROM ledger_accounts WHERE id = ?", accountID).Scan(&walletID); err != nil {
+		return err
+	}
+	if !walletID.Valid {
+		return nil
+	}
+
+	balance, err := AccountBalance(tx, accountID)
+	if err != nil {
+		return err
+	}
+	if balance < 0 {
+		return ErrInsufficientFunds
+	}
+
+	_, err = tx.Exec("UPDATE wallets SET balance = ?, updated_at = ? WHERE id = ?",
+		FromCents(balance), time.Now().UTC(), walletID.Int64)
+	return err
+}
+
+// AccountBalance sums the postings of an account
+func AccountBalance(tx *database.Tx, accountID int64) (int64, error) {
+	var balance int64
+	err := tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM postings WHERE account_id = ?", accountID).Scan(&balance)
+	return balance, err
+}
+
+// LockWallet serialises concurrent movements on a wallet for the rest of tx
+func LockWallet(tx *database.Tx, walletID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM wallets WHERE id = ?"+tx.Dialect.ForUpdate(), walletID).Scan(&id)
+	return err
+}
+
+// WalletAccount returns the ledger account of a wallet, opening it on first use
+func WalletAccount(tx *database.Tx, walletID int) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM ledger_accounts WHERE wallet_id = ?", walletID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return tx.InsertID(`
+		INSERT INTO ledger_accounts (code, kind, wallet_id, created_at) VALUES (?, 'wallet', ?, ?)`,
+		fmt.Sprintf("wallet:%d", walletID), walletID, time.Now().UTC())
+}
+
+// SystemAccount returns the platform account with the given code, opening it
+// on first use
+func SystemAccount(tx *database.Tx, code string) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM ledger_accounts WHERE code = ?", code).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return tx.InsertID(`
+		INSERT INTO ledger_accounts (code, kind, created_at) VALUES (?, 'system', ?)`,
+		code, time.Now().UTC())
+}
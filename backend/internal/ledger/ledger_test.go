@@ -0,0 +1,249 @@
+package ledger_test
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/database/dbtest"
+	"synapmentor/internal/ledger"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newWallet registers a user with an empty wallet and returns the wallet id
+func newWallet(t *testing.T, db *database.Conn, email string) int {
+	t.Helper()
+	now := time.Now()
+	userID, err := db.InsertID(`
+		INSERT INTO users (email, password, first_name, last_name, role, created_at, updated_at)
+		VALUES (?, 'hash', 'Test', 'User', 'seeker', ?, ?)`, email, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletID, err := db.InsertID(`
+		INSERT INTO wallets (user_id, created_at, updated_at) VALUES (?, ?, ?)`, userID, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(walletID)
+}
+
+// move posts cents into (or, when negative, out of) a wallet against the
+// external account, locking the wallet first as the repositories do
+func move(db *database.Conn, walletID int, cents int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ledger.LockWallet(tx, walletID); err != nil {
+		return err
+	}
+	wallet, err := ledger.WalletAccount(tx, walletID)
+	if err != nil {
+		return err
+	}
+	external, err := ledger.SystemAccount(tx, ledger.AccountExternal)
+	if err != nil {
+		return err
+	}
+	if _, err := ledger.Post(tx, ledger.Entry{
+		Kind: "test",
+		Postings: []ledger.Posting{
+			{AccountID: wallet, Amount: cents},
+			{AccountID: external, Amount: -cents},
+		},
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storedBalance returns the balance cached on a wallet row
+func storedBalance(t *testing.T, db *database.Conn, walletID int) float64 {
+	t.Helper()
+	var balance float64
+	if err := db.QueryRow("SELECT balance FROM wallets WHERE id = ?", walletID).Scan(&balance); err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func TestPostRejectsUnbalancedEntries(t *testing.T) {
+	db := dbtest.Open(t)
+	walletID := newWallet(t, db, "saver@example.com")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	wallet, err := ledger.WalletAccount(tx, walletID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := ledger.SystemAccount(tx, ledger.AccountExternal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		postings []ledger.Posting
+	}{
+		{"no postings", nil},
+		{"one posting", []ledger.Posting{{AccountID: wallet, Amount: 0}}},
+		{"money from nowhere", []ledger.Posting{{AccountID: wallet, Amount: 500}, {AccountID: external, Amount: -499}}},
+		{"money lost", []ledger.Posting{{AccountID: wallet, Amount: 500}, {AccountID: external, Amount: -501}}},
+	}
+	for _, tt := range tests {
+		if _, err := ledger.Post(tx, ledger.Entry{Kind: "test", Postings: tt.postings}); !errors.Is(err, ledger.ErrUnbalanced) {
+			t.Errorf("%s: Post() = %v, want ErrUnbalanced", tt.name, err)
+		}
+	}
+
+	var entries int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM journal_entries").Scan(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries != 0 {
+		t.Errorf("%d journal entries recorded for rejected postings", entries)
+	}
+}
+
+func TestPostRefusesOverdraft(t *testing.T) {
+	db := dbtest.Open(t)
+	walletID := newWallet(t, db, "saver@example.com")
+
+	if err := move(db, walletID, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := move(db, walletID, -1001); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Fatalf("overdrawing by a cent = %v, want ErrInsufficientFunds", err)
+	}
+	if got := storedBalance(t, db, walletID); got != 10 {
+		t.Errorf("balance = %v after a refused withdrawal, want 10", got)
+	}
+	if err := move(db, walletID, -1000); err != nil {
+		t.Fatalf("emptying the wallet: %v", err)
+	}
+	if got := storedBalance(t, db, walletID); got != 0 {
+		t.Errorf("balance = %v, want 0", got)
+	}
+
+	// System accounts balance the wallets and may go negative
+	report, err := ledger.Reconcile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK {
+		t.Errorf("ledger does not reconcile: %+v", report)
+	}
+}
+
+func TestReconcileFlagsDrift(t *testing.T) {
+	db := dbtest.Open(t)
+	drifted := newWallet(t, db, "drifted@example.com")
+	intact := newWallet(t, db, "intact@example.com")
+	for _, walletID := range []int{drifted, intact} {
+		if err := move(db, walletID, 2550); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ledger.Reconcile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.WalletsChecked != 2 {
+		t.Fatalf("clean ledger reported %+v", report)
+	}
+
+	// A balance written around the ledger no longer matches the postings
+	if _, err := db.Exec("UPDATE wallets SET balance = ? WHERE id = ?", 30.5, drifted); err != nil {
+		t.Fatal(err)
+	}
+	report, err = ledger.Reconcile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ledger.WalletMismatch{WalletID: drifted, StoredBalance: 30.5, LedgerBalance: 25.5}
+	if report.OK || len(report.Mismatches) != 1 || report.Mismatches[0] != want {
+		t.Errorf("mismatches = %+v, want [%+v]", report.Mismatches, want)
+	}
+	if len(report.UnbalancedEntries) != 0 || report.LedgerTotal != 0 {
+		t.Errorf("postings reported out of balance: %+v", report)
+	}
+
+	// So does a posting written without its counterpart
+	var entryID, account int64
+	if err := db.QueryRow("SELECT MAX(entry_id) FROM postings").Scan(&entryID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT id FROM ledger_accounts WHERE wallet_id = ?", intact).Scan(&account); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO postings (entry_id, account_id, amount) VALUES (?, ?, ?)", entryID, account, 100); err != nil {
+		t.Fatal(err)
+	}
+	report, err = ledger.Reconcile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.UnbalancedEntries) != 1 || report.UnbalancedEntries[0] != entryID || report.LedgerTotal != 100 {
+		t.Errorf("unbalanced entries = %v, total = %d, want [%d] and 100", report.UnbalancedEntries, report.LedgerTotal, entryID)
+	}
+	if len(report.Mismatches) != 2 {
+		t.Errorf("mismatches = %+v, want both wallets", report.Mismatches)
+	}
+}
+
+// Withdrawals racing for the same money must not overdraw the wallet: with
+// the wallet locked, exactly as many succeed as the balance covers
+func TestConcurrentWithdrawals(t *testing.T) {
+	db := dbtest.Open(t)
+	walletID := newWallet(t, db, "saver@example.com")
+	if err := move(db, walletID, 10000); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- move(db, walletID, -2500)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var succeeded, refused int
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ledger.ErrInsufficientFunds):
+			refused++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if succeeded != 4 || refused != workers-4 {
+		t.Errorf("%d withdrawals succeeded and %d were refused, want 4 and %d", succeeded, refused, workers-4)
+	}
+	if got := storedBalance(t, db, walletID); got != 0 {
+		t.Errorf("balance = %v, want 0", got)
+	}
+
+	report, err := ledger.Reconcile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK {
+		t.Errorf("ledger does not reconcile: %+v", report)
+	}
+}
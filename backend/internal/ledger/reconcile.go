@@ -0,0 +1,93 @@
+package ledger
+
+import (
+	"synapmentor/internal/database"
+	"time"
+)
+
+// WalletMismatch is a wallet whose cached balance disagrees with the ledger
+type WalletMismatch struct {
+	WalletID      int     `json:"wallet_id"`
+	StoredBalance float64 `json:"stored_balance"`
+	LedgerBalance float64 `json:"ledger_balance"`
+}
+
+// Report is the outcome of a reconciliation run
+type Report struct {
+	CheckedAt         time.Time        `json:"checked_at"`
+	WalletsChecked    int              `json:"wallets_checked"`
+	Mismatches        []WalletMismatch `json:"mismatches"`
+	UnbalancedEntries []int64          `json:"unbalanced_entries"`
+	LedgerTotal       int64            `json:"ledger_total"` // must be zero
+	OK                bool             `json:"ok"`
+}
+
+// Reconcile recomputes every wallet balance from the postings and verifies
+// that every journal entry, and the ledger as a whole, sums to zero
+func Reconcile(db *database.Conn) (*Report, error) {
+	report := &Report{
+		CheckedAt:         time.Now().UTC(),
+		Mismatches:        []WalletMismatch{},
+		UnbalancedEntries: []int64{},
+	}
+
+	rows, err := db.Query(`
+		SELECT w.id, w.balance, COALESCE(SUM(p.amount), 0)
+		FROM wallets w
+		LEFT JOIN ledger_accounts la ON la.wallet_id = w.id
+		LEFT JOIN postings p ON p.account_id = la.id
+		GROUP BY w.id, w.balance
+		ORDER BY w.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var walletID int
+		var stored float64
+		var ledgerCents int64
+		if err := rows.Scan(&walletID, &stored, &ledgerCents); err != nil {
+			return nil, err
+		}
+		report.WalletsChecked++
+		if ToCents(stored) != ledgerCents {
+			report.Mismatches = append(report.Mismatches, WalletMismatch{
+				WalletID:      walletID,
+				StoredBalance: stored,
+				LedgerBalance: FromCents(ledgerCents),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := db.Query(`
+		SELECT entry_id FROM postings
+		GROUP BY entry_id
+		HAVING SUM(amount) <> 0
+		ORDER BY entry_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+
+	for entries.Next() {
+		var entryID int64
+		if err := entries.Scan(&entryID); err != nil {
+			return nil, err
+		}
+		report.UnbalancedEntries = append(report.UnbalancedEntries, entryID)
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM postings").Scan(&report.LedgerTotal); err != nil {
+		return nil, err
+	}
+
+	report.OK = len(report.Mismatches) == 0 && len(report.UnbalancedEntries) == 0 && report.LedgerTotal == 0
+	return report, nil
+}
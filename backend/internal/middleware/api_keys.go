@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiRoot is where the API's routes are mounted
+const apiRoot = "/api/v1/"
+
+// apiKeyAreas maps the first path segment of a route to the scope area that
+// covers it. Everything else, which includes signing in, account security,
+// API key management and the admin API, is closed to API keys.
+var apiKeyAreas = map[string]string{
+	"profile":       "profile",
+	"settings":      "profile",
+	"dashboard":     "sessions",
+	"sessions":      "sessions",
+	"series":        "sessions",
+	"calendar":      "calendar",
+	"availability":  "calendar",
+	"solvers":       "calendar",
+	"content":       "content",
+	"wallet":        "wallet",
+	"notifications": "notifications",
+	"community":     "community",
+}
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header or with
+// the ApiKey authorization scheme, if any
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, key, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// apiKeyScope returns the scope a request needs from an API key: read or
+// write access to the area of the matched route, or "" if keys may not use it
+func apiKeyScope(c *gin.Context) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(c.FullPath(), apiRoot), "/")
+	area, ok := apiKeyAreas[segment]
+	if !ok {
+		return ""
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return area + ":read"
+	default:
+		return area + ":write"
+	}
+}
+
+// authenticateAPIKey authenticates a request made with an API key, checking
+// that the key's scopes cover the route
+func authenticateAPIKey(c *gin.Context, apiKeys repository.APIKeyRepo, presented string) {
+	key, user, err := apiKeys.Authenticate(auth.HashToken(presented), c.ClientIP())
+	if errors.Is(err, repository.ErrTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
+		c.Abort()
+		return
+	}
+
+	scope := apiKeyScope(c)
+	if scope == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used for this endpoint"})
+		c.Abort()
+		return
+	}
+	allowed := false
+	for _, s := range key.Scopes {
+		if s == scope {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+		c.Abort()
+		return
+	}
+
+	// An API key stands in for a login session, without a second factor
+	setClaims(c, &auth.Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+		Roles:  user.Roles,
+	})
+	c.Set("api_key_id", key.ID)
+
+	c.Next()
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"synapmentor/internal/auth"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// fakeAPIKeys knows one key, "smk_test", that reads sessions and writes the
+// wallet for user 2
+type fakeAPIKeys struct {
+	repository.APIKeyRepo
+}
+
+func (fakeAPIKeys) Authenticate(keyHash, ip string) (*models.APIKey, *models.User, error) {
+	if keyHash != auth.HashToken("smk_test") {
+		return nil, nil, repository.ErrTokenInvalid
+	}
+	key := &models.APIKey{ID: 5, UserID: 2, Scopes: []string{"sessions:read", "wallet:write"}}
+	user := &models.User{ID: 2, Email: "seeker@example.com", Role: models.RoleSeeker, Roles: []string{models.RoleSeeker}}
+	return key, user, nil
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	router := gin.New()
+	api := router.Group("/api/v1", AuthMiddleware(nil, fakeAPIKeys{}))
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("user_id"), "api_key_id": c.GetInt("api_key_id")})
+	}
+	api.GET("/sessions", ok)
+	api.POST("/sessions", ok)
+	api.POST("/wallet/transfer", ok)
+	api.GET("/api-keys", ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"reads sessions", http.MethodGet, "/api/v1/sessions", "X-API-Key", "smk_test", http.StatusOK},
+		{"ApiKey scheme", http.MethodGet, "/api/v1/sessions", "Authorization", "ApiKey smk_test", http.StatusOK},
+		{"writes the wallet", http.MethodPost, "/api/v1/wallet/transfer", "X-API-Key", "smk_test", http.StatusOK},
+		{"no sessions:write", http.MethodPost, "/api/v1/sessions", "X-API-Key", "smk_test", http.StatusForbidden},
+		{"closed area", http.MethodGet, "/api/v1/api-keys", "X-API-Key", "smk_test", http.StatusForbidden},
+		{"unknown key", http.MethodGet, "/api/v1/sessions", "X-API-Key", "smk_other", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != `{"api_key_id":5,"user_id":2}` {
+				t.Errorf("body = %s, want the key's user", w.Body)
+			}
+		})
+	}
+}
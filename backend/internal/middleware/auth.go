@@ -1,16 +1,25 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"synapmentor/internal/auth"
+	"synapmentor/internal/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens and rejects those whose login session
+// has been revoked or whose user has been deactivated. Requests may instead
+// carry an API key, which is limited to the areas its scopes cover.
+func AuthMiddleware(logins repository.LoginSessionRepo, apiKeys repository.APIKeyRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, apiKeys, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -33,51 +42,111 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+
+		err = logins.Validate(claims.SessionID, claims.UserID, c.ClientIP())
+		if errors.Is(err, repository.ErrTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been signed out"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			c.Abort()
+			return
+		}
 		
 		// Store user information in context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		setClaims(c, claims)
 		
 		c.Next()
 	}
 }
 
-// RequireRole middleware checks if user has required role
-func RequireRole(role string) gin.HandlerFunc {
+// RequirePermission middleware checks that one of the user's roles grants
+// permission. Roles are read from the database rather than the token, so
+// revoking one takes effect at once.
+func RequirePermission(roles repository.RoleRepo, permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("user_role")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
+		allowed, err := HasPermission(c, roles, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 			c.Abort()
 			return
 		}
-		
-		if userRole != role && userRole != "admin" {
+		if !allowed {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
 		}
-		
+
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user holds permission,
+// loading their permissions once per request
+func HasPermission(c *gin.Context, roles repository.RoleRepo, permission string) (bool, error) {
+	granted, ok := c.Get("user_permissions")
+	if !ok {
+		permissions, err := roles.Permissions(c.GetInt("user_id"))
+		if err != nil {
+			return false, err
+		}
+		granted = permissions
+		c.Set("user_permissions", permissions)
+	}
+
+	for _, p := range granted.([]string) {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RequireTwoFactor middleware rejects access tokens from logins that did not
+// pass a second factor
+func RequireTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("two_factor") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required; enable it and sign in again"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
 // OptionalAuth middleware that doesn't require authentication but extracts user info if present
-func OptionalAuth() gin.HandlerFunc {
+func OptionalAuth(logins repository.LoginSessionRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
 			tokenParts := strings.Split(authHeader, " ")
 			if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
 				token := tokenParts[1]
-				if claims, err := auth.ValidateToken(token); err == nil {
-					c.Set("user_id", claims.UserID)
-					c.Set("user_email", claims.Email)
-					c.Set("user_role", claims.Role)
+				claims, err := auth.ValidateToken(token)
+				if err == nil && logins.Validate(claims.SessionID, claims.UserID, c.ClientIP()) == nil {
+					setClaims(c, claims)
 				}
 			}
 		}
 		c.Next()
 	}
 }
+
+// setClaims stores the authenticated user's details in the request context
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("login_session_id", claims.SessionID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_role", claims.Role)
+	roles := claims.Roles
+	if len(roles) == 0 {
+		// Tokens issued before users could hold several roles
+		roles = []string{claims.Role}
+	}
+	c.Set("user_roles", roles)
+	c.Set("two_factor", claims.TwoFactor)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// APIKeyScopes are the scopes an API key can be given: read or write access
+// to one area of the API
+var APIKeyScopes = []string{
+	"profile:read", "profile:write",
+	"sessions:read", "sessions:write",
+	"calendar:read", "calendar:write",
+	"content:read", "content:write",
+	"wallet:read", "wallet:write",
+	"notifications:read", "notifications:write",
+	"community:read", "community:write",
+}
+
+// APIKey is a long-lived credential a user creates for scripted access
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"` // first part of the key, to tell keys apart
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Roles within a community
+const (
+	CommunityRoleOwner     = "owner"
+	CommunityRoleModerator = "moderator"
+	CommunityRoleMember    = "member"
+)
+
+// Community is a group of users with its own discussions
+type Community struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Category    string    `json:"category" db:"category"`
+	MemberCount int       `json:"member_count" db:"member_count"`
+	IsActive    bool      `json:"is_active" db:"is_active"`
+	CreatedBy   *int      `json:"created_by,omitempty" db:"created_by"`
+	Role        string    `json:"role,omitempty" db:"-"` // the viewer's role, empty if not a member
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CommunityMember is a user's membership of a community
+type CommunityMember struct {
+	UserID   int       `json:"user_id" db:"user_id"`
+	Name     string    `json:"name" db:"-"`
+	Role     string    `json:"role" db:"role"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+}
+
+// Discussion is a thread started in a community. UserID and AuthorName are
+// hidden from other members when IsAnonymous is set.
+type Discussion struct {
+	ID          int       `json:"id" db:"id"`
+	CommunityID int       `json:"community_id" db:"community_id"`
+	UserID      int       `json:"user_id,omitempty" db:"user_id"`
+	AuthorName  string    `json:"author_name" db:"-"`
+	Title       string    `json:"title" db:"title"`
+	Content     string    `json:"content" db:"content"`
+	Likes       int       `json:"likes" db:"likes"`
+	Replies     int       `json:"replies" db:"replies"`
+	IsAnonymous bool      `json:"is_anonymous" db:"is_anonymous"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DiscussionReply answers a discussion, or another reply when ParentID is set
+type DiscussionReply struct {
+	ID           int       `json:"id" db:"id"`
+	DiscussionID int       `json:"discussion_id" db:"discussion_id"`
+	ParentID     *int      `json:"parent_id" db:"parent_id"`
+	UserID       int       `json:"user_id,omitempty" db:"user_id"`
+	AuthorName   string    `json:"author_name" db:"-"`
+	Content      string    `json:"content" db:"content"`
+	IsAnonymous  bool      `json:"is_anonymous" db:"is_anonymous"`
+	Depth        int       `json:"depth" db:"depth"` // 0 for replies to the discussion itself
+	IsDeleted    bool      `json:"is_deleted" db:"-"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// RecentSession represents a recent session
+type RecentSession struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	SeekerName  string    `json:"seeker_name"`
+	Status      string    `json:"status"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Duration    int       `json:"duration"`
+	Price       float64   `json:"price"`
+}
+
+// LeaderboardEntry represents a leaderboard entry
+type LeaderboardEntry struct {
+	UserID        int     `json:"user_id"`
+	Name          string  `json:"name"`
+	ProfilePic    string  `json:"profile_pic"`
+	TotalSessions int     `json:"total_sessions"`
+	Rating        float64 `json:"rating"`
+	Earnings      float64 `json:"earnings"`
+}
+
+// MonthlyData represents per-month session activity for analytics
+type MonthlyData struct {
+	Month    string  `json:"month"`
+	Sessions int     `json:"sessions"`
+	Earnings float64 `json:"earnings"`
+}
+
+// SessionStats summarises a solver's sessions
+type SessionStats struct {
+	TotalSessions     int
+	CompletedSessions int
+	TotalEarnings     float64
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// RSVP statuses
+const (
+	RSVPGoing      = "going"
+	RSVPWaitlisted = "waitlisted"
+)
+
+// Event is a scheduled gathering organised by a solver. MaxAttendees is nil
+// for events without a cap; Price is 0 for free events.
+type Event struct {
+	ID               int       `json:"id" db:"id"`
+	Title            string    `json:"title" db:"title"`
+	Description      string    `json:"description" db:"description"`
+	EventDate        time.Time `json:"event_date" db:"event_date"`
+	Duration         int       `json:"duration" db:"duration"` // minutes
+	MaxAttendees     *int      `json:"max_attendees" db:"max_attendees"`
+	CurrentAttendees int       `json:"current_attendees" db:"current_attendees"`
+	Waitlisted       int       `json:"waitlisted" db:"-"`
+	Category         string    `json:"category" db:"category"`
+	Price            float64   `json:"price" db:"price"` // per ticket
+	IsActive         bool      `json:"is_active" db:"is_active"`
+	CreatedBy        int       `json:"created_by" db:"created_by"`
+	OrganizerName    string    `json:"organizer_name" db:"-"`
+	RSVPStatus       string    `json:"rsvp_status,omitempty" db:"-"` // the viewer's, empty without an RSVP
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// EventAttendee is a user's RSVP to an event
+type EventAttendee struct {
+	UserID    int       `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"-"`
+	Email     string    `json:"email" db:"-"`
+	Status    string    `json:"status" db:"status"`
+	Position  int       `json:"position,omitempty" db:"-"` // place on the waitlist, from 1
+	Paid      float64   `json:"paid,omitempty" db:"-"`     // for their ticket, unless refunded
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
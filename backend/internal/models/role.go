@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Built-in roles
+const (
+	RoleSeeker    = "seeker"
+	RoleSolver    = "solver"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleSupport   = "support"
+)
+
+// Permissions granted through roles, named resource:action[:scope]
+const (
+	PermUsersRead         = "users:read"
+	PermUsersSuspend      = "users:suspend"
+	PermUsersUnlock       = "users:unlock"
+	PermLoginAttemptsRead = "login_attempts:read"
+	PermSessionsReadAny   = "sessions:read:any"
+	PermContentModerate   = "content:moderate"
+	PermAnalyticsRead     = "analytics:read"
+	PermLedgerReconcile   = "ledger:reconcile"
+	PermRolesManage       = "roles:manage"
+	PermIdentityReview    = "identity:review"
+)
+
+// Role is a named set of permissions
+type Role struct {
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Staff       bool      `json:"staff" db:"staff"` // holders can reach the admin API
+	Permissions []string  `json:"permissions" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
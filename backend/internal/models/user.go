@@ -20,13 +20,36 @@ type User struct {
 	Phone             string    `json:"phone" db:"phone"`
 	IsEmailVerified   bool      `json:"is_email_verified" db:"is_email_verified"`
 	IsPhoneVerified   bool      `json:"is_phone_verified" db:"is_phone_verified"`
-	VerificationLevel string    `json:"verification_level" db:"verification_level"` // light, standard, full
+	VerificationLevel string    `json:"verification_level" db:"verification_level"` // VerificationLight, Standard or Full
 	IsActive          bool      `json:"is_active" db:"is_active"`
-	Role              string    `json:"role" db:"role"` // solver, seeker, admin
+	TwoFactorEnabled  bool      `json:"two_factor_enabled" db:"-"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty" db:"locked_until"` // set after repeated failed sign-ins
+	HasPassword       bool      `json:"has_password" db:"-"` // false for accounts created through social sign-in
+	Role              string    `json:"role" db:"role"` // primary role: solver, seeker, admin
+	Roles             []string  `json:"roles,omitempty" db:"-"` // every role held, including Role
+	Timezone          string    `json:"timezone" db:"timezone"` // IANA name, e.g. Europe/Berlin
+	Locale            string    `json:"locale" db:"locale"`     // BCP 47 tag, e.g. en-US
 	CreatedAt         time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Verification levels, from least to most trusted
+const (
+	VerificationLight    = "light"    // new accounts
+	VerificationStandard = "standard" // verified email and phone number
+	VerificationFull     = "full"     // plus an approved ID document
+)
+
+// HasRole reports whether the user holds role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // UserProfile represents extended user profile information
 type UserProfile struct {
 	UserID           int       `json:"user_id" db:"user_id"`
@@ -55,17 +78,128 @@ type Session struct {
 	SubCategory string    `json:"sub_category" db:"sub_category"`
 	Duration    int       `json:"duration" db:"duration"` // minutes
 	Price       float64   `json:"price" db:"price"`
-	Status      string    `json:"status" db:"status"` // scheduled, active, completed, cancelled
+	Status      string    `json:"status" db:"status"` // requested, confirmed, active, completed, cancelled, no_show
 	ScheduledAt time.Time `json:"scheduled_at" db:"scheduled_at"`
 	StartedAt   *time.Time `json:"started_at" db:"started_at"`
 	EndedAt     *time.Time `json:"ended_at" db:"ended_at"`
 	RecordingURL string   `json:"recording_url" db:"recording_url"`
 	Rating      int       `json:"rating" db:"rating"`
 	Review      string    `json:"review" db:"review"`
+	PaymentStatus string  `json:"payment_status" db:"payment_status"` // none, awaiting_payment, held, released, refunded
+	SeriesID    *int      `json:"series_id" db:"series_id"` // set for occurrences of a recurring series
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Session lifecycle states
+const (
+	SessionRequested = "requested" // booked, waiting for the solver to confirm
+	SessionConfirmed = "confirmed"
+	SessionActive    = "active"
+	SessionCompleted = "completed"
+	SessionCancelled = "cancelled"
+	SessionNoShow    = "no_show"
+)
+
+// LoginSession is one device a user is signed in on
+type LoginSession struct {
+	ID         int       `json:"id" db:"id"`
+	UserID     int       `json:"-" db:"user_id"`
+	Device     string    `json:"device" db:"device"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	TwoFactor  bool      `json:"two_factor" db:"two_factor"` // signed in with a second factor
+	Current    bool      `json:"current" db:"-"` // whether the request came from this session
+}
+
+// UserIdentity links a user to their account at an external identity provider
+type UserIdentity struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"-" db:"user_id"`
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"-" db:"subject"` // the provider's id for the user
+	Email       string     `json:"email" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at" db:"last_login_at"`
+}
+
+// OAuthState is a sign-in with an identity provider that has been started
+// but not yet completed
+type OAuthState struct {
+	Provider  string
+	Verifier  string // PKCE code verifier
+	Nonce     string
+	UserID    *int   // set when an existing user is linking the provider
+	Role      string // role of the account to create, if it comes to that
+	ExpiresAt time.Time
+}
+
+// LoginAttempt is one audited sign-in attempt
+type LoginAttempt struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    *int      `json:"user_id" db:"user_id"` // nil when no account has the email
+	Email     string    `json:"email" db:"email"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	Result    string    `json:"result" db:"result"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Login attempt results
+const (
+	LoginSucceeded          = "success"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginInvalidCode        = "invalid_code"       // wrong second factor
+	LoginTwoFactorPending   = "two_factor_pending" // right password, code still to come
+	LoginAccountLocked      = "account_locked"
+	LoginIPBlocked          = "ip_blocked"
+	LoginDeactivated        = "deactivated"
+)
+
+// TwoFactorStatus describes a user's two-factor setup
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	Required          bool       `json:"required"` // the user's role cannot do without it
+}
+
+// SessionSeries is a recurring booking; each occurrence is a Session with
+// SeriesID pointing back at it and is paid, rated and cancelled on its own
+type SessionSeries struct {
+	ID          int        `json:"id" db:"id"`
+	SolverID    int        `json:"solver_id" db:"solver_id"`
+	SeekerID    int        `json:"seeker_id" db:"seeker_id"`
+	Frequency   string     `json:"frequency" db:"frequency"` // weekly, biweekly
+	Occurrences *int       `json:"occurrences,omitempty" db:"occurrences"`
+	Until       *time.Time `json:"until,omitempty" db:"until_date"`
+	Timezone    string     `json:"timezone" db:"timezone"` // zone the occurrences keep their wall clock time in
+	CreatedBy   int        `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// SessionTransition records one change of a session's status
+type SessionTransition struct {
+	ID         int       `json:"id" db:"id"`
+	SessionID  int       `json:"session_id" db:"session_id"`
+	FromStatus string    `json:"from_status" db:"from_status"` // empty for the booking itself
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	UserID     int       `json:"user_id" db:"user_id"`
+	Reason     string    `json:"reason" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Session payment states
+const (
+	PaymentNone            = "none"             // free session, or booked before escrow existed
+	PaymentAwaitingPayment = "awaiting_payment" // booked by the solver, seeker has not paid yet
+	PaymentHeld            = "held"             // seeker funds are in escrow
+	PaymentReleased        = "released"         // paid out to the solver
+	PaymentRefunded        = "refunded"         // cancelled; returned to the seeker per policy
+)
+
 // Content represents user-generated content
 type Content struct {
 	ID          int       `json:"id" db:"id"`
@@ -99,10 +233,12 @@ type Transaction struct {
 	ID          int       `json:"id" db:"id"`
 	WalletID    int       `json:"wallet_id" db:"wallet_id"`
 	SessionID   *int      `json:"session_id" db:"session_id"`
+	EventID     *int      `json:"event_id" db:"event_id"`
 	Type        string    `json:"type" db:"type"` // credit, debit
 	Amount      float64   `json:"amount" db:"amount"`
 	Description string    `json:"description" db:"description"`
 	Status      string    `json:"status" db:"status"` // pending, completed, failed
+	JournalEntryID *int   `json:"journal_entry_id" db:"journal_entry_id"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -116,3 +252,27 @@ type Notification struct {
 	IsRead    bool      `json:"is_read" db:"is_read"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
+
+// Identity document review states
+const (
+	DocumentPending  = "pending"
+	DocumentApproved = "approved"
+	DocumentRejected = "rejected"
+)
+
+// IdentityDocument is an ID a user has uploaded to reach full verification
+type IdentityDocument struct {
+	ID              int        `json:"id" db:"id"`
+	UserID          int        `json:"user_id" db:"user_id"`
+	UserEmail       string     `json:"user_email,omitempty" db:"-"`      // filled in for reviewers
+	DocumentType    string     `json:"document_type" db:"document_type"` // passport, national_id, drivers_license
+	FileKey         string     `json:"-" db:"file_key"`                 // name of the stored file
+	FileName        string     `json:"file_name" db:"file_name"`
+	ContentType     string     `json:"content_type" db:"content_type"`
+	Size            int64      `json:"size" db:"size"`
+	Status          string     `json:"status" db:"status"`
+	RejectionReason string     `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	ReviewedBy      *int       `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
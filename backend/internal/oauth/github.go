@@ -0,0 +1,61 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gitHubUser is the part of GET /user we use
+type gitHubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// gitHubEmail is one entry of GET /user/emails
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// gitHubIdentity reads the user and their primary address from the GitHub API
+func (p *Provider) gitHubIdentity(ctx context.Context, accessToken string) (*Identity, error) {
+	var user gitHubUser
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &user); err != nil {
+		return nil, fmt.Errorf("GitHub user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("GitHub user: no id in response")
+	}
+
+	identity := &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Picture: user.AvatarURL,
+	}
+	// GitHub has a single display name; split it as best we can
+	name := strings.TrimSpace(user.Name)
+	if name == "" {
+		name = user.Login
+	}
+	if i := strings.LastIndex(name, " "); i > 0 {
+		identity.FirstName, identity.LastName = name[:i], name[i+1:]
+	} else {
+		identity.FirstName = name
+	}
+
+	var emails []gitHubEmail
+	if err := p.getJSON(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+		return nil, fmt.Errorf("GitHub emails: %w", err)
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email, identity.EmailVerified = e.Email, e.Verified
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,292 @@
+// Package oauth signs users in through external identity providers with the
+// OAuth 2.0 authorization code flow and PKCE. OpenID Connect providers are
+// configured from their issuer's discovery document and identify the user
+// with a verified ID token; GitHub, which does not speak OIDC, is read from
+// its REST API instead.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider kinds
+const (
+	KindOIDC   = "oidc"
+	KindGitHub = "github"
+)
+
+// ErrUnknownProvider is returned for a provider name that is not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Identity is who a provider says the user is
+type Identity struct {
+	Subject       string // the provider's stable id for the user
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Picture       string
+}
+
+// Provider is one configured identity provider
+type Provider struct {
+	Name         string
+	Kind         string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+
+	// Issuer locates the discovery document of an OIDC provider; the
+	// endpoints below are filled in from it on first use
+	Issuer string
+
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+	EmailsURL   string // GitHub only: the user's addresses and whether they are verified
+
+	HTTPClient *http.Client
+
+	mu   sync.Mutex
+	keys *keyCache
+}
+
+// ProvidersFromEnv configures the providers listed in OAUTH_PROVIDERS (comma
+// separated names). Each reads OAUTH_<NAME>_CLIENT_ID and
+// OAUTH_<NAME>_CLIENT_SECRET; "google" and "github" know their endpoints and
+// any other name is an OIDC provider at OAUTH_<NAME>_ISSUER. redirectURL
+// gives the callback registered with each provider.
+func ProvidersFromEnv(redirectURL func(name string) string) (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := func(key string) string {
+			return os.Getenv("OAUTH_" + strings.ToUpper(name) + "_" + key)
+		}
+
+		p := &Provider{
+			Name:         name,
+			Kind:         KindOIDC,
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			Scopes:       []string{"openid", "email", "profile"},
+			RedirectURL:  redirectURL(name),
+			Issuer:       env("ISSUER"),
+			HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		}
+		switch name {
+		case "google":
+			if p.Issuer == "" {
+				p.Issuer = "https://accounts.google.com"
+			}
+		case "github":
+			p.Kind = KindGitHub
+			p.Scopes = []string{"read:user", "user:email"}
+			p.AuthURL = "https://github.com/login/oauth/authorize"
+			p.TokenURL = "https://github.com/login/oauth/access_token"
+			p.UserInfoURL = "https://api.github.com/user"
+			p.EmailsURL = "https://api.github.com/user/emails"
+		}
+
+		if p.ClientID == "" {
+			return nil, fmt.Errorf("OAuth provider %s: OAUTH_%s_CLIENT_ID is not set", name, strings.ToUpper(name))
+		}
+		if p.Kind == KindOIDC && p.Issuer == "" {
+			return nil, fmt.Errorf("OAuth provider %s: OAUTH_%s_ISSUER is not set", name, strings.ToUpper(name))
+		}
+		providers[name] = p
+	}
+	return providers, nil
+}
+
+// NewVerifier returns a random PKCE code verifier (RFC 7636)
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState returns a random value for the state or nonce parameter
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// Challenge derives the S256 code challenge sent for verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the provider page the user is sent to for consent
+func (p *Provider) AuthCodeURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	if p.Kind == KindOIDC {
+		q.Set("nonce", nonce)
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode(), nil
+}
+
+// tokenResponse is the token endpoint's answer
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code and returns the user's identity.
+// nonce must be the one sent with AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.ClientID)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token exchange: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token exchange: no access token in response")
+	}
+
+	if p.Kind == KindGitHub {
+		return p.gitHubIdentity(ctx, token.AccessToken)
+	}
+	return p.oidcIdentity(ctx, token, nonce)
+}
+
+// discovery is the part of an OpenID Provider Configuration we use
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discover fills in an OIDC provider's endpoints from its issuer, once
+func (p *Provider) discover(ctx context.Context) error {
+	if p.Kind != KindOIDC {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.AuthURL != "" && p.TokenURL != "" && p.JWKSURL != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var doc discovery
+	if err := p.do(req, &doc); err != nil {
+		return fmt.Errorf("OIDC discovery for %s: %w", p.Name, err)
+	}
+	if doc.Issuer != p.Issuer {
+		return fmt.Errorf("OIDC discovery for %s: issuer %q does not match %q", p.Name, doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return fmt.Errorf("OIDC discovery for %s: incomplete provider configuration", p.Name)
+	}
+
+	p.AuthURL = doc.AuthorizationEndpoint
+	p.TokenURL = doc.TokenEndpoint
+	p.UserInfoURL = doc.UserinfoEndpoint
+	p.JWKSURL = doc.JWKSURI
+	return nil
+}
+
+// do sends req and decodes a JSON response into out
+func (p *Provider) do(req *http.Request, out interface{}) error {
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	// Token endpoints report errors with a 400 and a JSON body worth decoding
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// getJSON fetches url with the user's access token
+func (p *Provider) getJSON(ctx context.Context, url, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, out)
+}
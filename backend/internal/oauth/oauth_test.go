@@ -0,0 +1,181 @@
+package oauth_test
+
+import (
+	"context"
+	"strings"
+	"synapmentor/internal/oauth"
+	"synapmentor/internal/oauth/oauthtest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var alice = oauthtest.User{
+	Subject:       "alice-1",
+	Email:         "alice@example.com",
+	EmailVerified: true,
+	FirstName:     "Alice",
+	LastName:      "Liddell",
+}
+
+// authorize starts a sign-in with p and has user consent to it, returning
+// the code, the verifier and the nonce to exchange it with
+func authorize(t *testing.T, issuer *oauthtest.Issuer, p *oauth.Provider, user oauthtest.User) (code, verifier, nonce string) {
+	t.Helper()
+	state, err := oauth.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = oauth.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err = oauth.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, verifier, nonce)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() = %v", err)
+	}
+	code, returned := issuer.Authorize(t, authURL, user)
+	if returned != state {
+		t.Fatalf("issuer returned state %q, want %q", returned, state)
+	}
+	return code, verifier, nonce
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B
+	got := oauth.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("Challenge() = %q, want %q", got, want)
+	}
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	p := issuer.Provider("test", "http://app.example/oauth/test/callback")
+
+	code, verifier, nonce := authorize(t, issuer, p, alice)
+	if p.TokenURL != issuer.URL+"/token" || p.JWKSURL != issuer.URL+"/jwks" {
+		t.Errorf("discovery found token %q and keys %q", p.TokenURL, p.JWKSURL)
+	}
+
+	identity, err := p.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange() = %v", err)
+	}
+	want := oauth.Identity{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, FirstName: "Alice", LastName: "Liddell"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// Codes are single use
+	if _, err := p.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("a redeemed code was accepted again")
+	}
+}
+
+func TestOIDCSignInAsksUserinfoForMissingEmail(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	issuer.Claims = func(claims jwt.MapClaims) {
+		delete(claims, "email")
+		delete(claims, "email_verified")
+	}
+	p := issuer.Provider("test", "http://app.example/oauth/test/callback")
+
+	code, verifier, nonce := authorize(t, issuer, p, alice)
+	identity, err := p.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange() = %v", err)
+	}
+	if identity.Email != alice.Email || !identity.EmailVerified {
+		t.Errorf("identity = %+v, want the email from userinfo", *identity)
+	}
+}
+
+func TestOIDCSignInRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  func(jwt.MapClaims)
+		tamper  func(code, verifier, nonce string) (string, string, string)
+		wantErr string
+	}{
+		{
+			name:    "wrong verifier",
+			tamper:  func(code, _, nonce string) (string, string, string) { return code, "not-the-verifier", nonce },
+			wantErr: "PKCE verification failed",
+		},
+		{
+			name:    "unknown code",
+			tamper:  func(_, verifier, nonce string) (string, string, string) { return "forged", verifier, nonce },
+			wantErr: "invalid_grant",
+		},
+		{
+			name:    "replayed nonce",
+			tamper:  func(code, verifier, _ string) (string, string, string) { return code, verifier, "another-nonce" },
+			wantErr: "nonce does not match",
+		},
+		{
+			name:    "other audience",
+			claims:  func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+			wantErr: "audience",
+		},
+		{
+			name:    "other issuer",
+			claims:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+			wantErr: "issuer",
+		},
+		{
+			name:    "expired",
+			claims:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: "expired",
+		},
+		{
+			name:    "no expiry",
+			claims:  func(c jwt.MapClaims) { delete(c, "exp") },
+			wantErr: "exp",
+		},
+		{
+			name:    "no subject",
+			claims:  func(c jwt.MapClaims) { delete(c, "sub") },
+			wantErr: "no subject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := oauthtest.NewIssuer(t)
+			issuer.Claims = tt.claims
+			p := issuer.Provider("test", "http://app.example/oauth/test/callback")
+
+			code, verifier, nonce := authorize(t, issuer, p, alice)
+			if tt.tamper != nil {
+				code, verifier, nonce = tt.tamper(code, verifier, nonce)
+			}
+			identity, err := p.Exchange(context.Background(), code, verifier, nonce)
+			if err == nil {
+				t.Fatalf("Exchange() accepted it as %+v", *identity)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Exchange() = %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCDiscoveryChecksIssuer(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	issuer.DiscoveredIssuer = "https://evil.example"
+	p := issuer.Provider("test", "http://app.example/oauth/test/callback")
+
+	_, err := p.AuthCodeURL(context.Background(), "state", "verifier", "nonce")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("AuthCodeURL() = %v, want an issuer mismatch", err)
+	}
+	if p.TokenURL != "" {
+		t.Errorf("took token endpoint %q from a mismatched discovery document", p.TokenURL)
+	}
+}
@@ -0,0 +1,267 @@
+// Package oauthtest runs a stand-in OpenID Connect provider for tests
+package oauthtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"synapmentor/internal/oauth"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyID names the issuer's only signing key
+const keyID = "test-key"
+
+// User is an account at the issuer
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// Issuer is an OIDC provider serving discovery, JWKS, token and userinfo
+// endpoints. Its token endpoint checks the PKCE verifier against the
+// challenge the authorization request carried, as a real provider does.
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	// Claims, when set, edits every ID token's claims before it is signed
+	Claims func(claims jwt.MapClaims)
+	// DiscoveredIssuer, when set, is the issuer the discovery document names
+	DiscoveredIssuer string
+
+	key *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant // by authorization code
+	tokens map[string]User  // by access token
+}
+
+// grant is a consent given at the authorization endpoint, waiting for its
+// code to be redeemed
+type grant struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewIssuer starts an issuer that is shut down when the test ends
+func NewIssuer(t testing.TB) *Issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Issuer{
+		ClientID:     "synapmentor",
+		ClientSecret: "secret",
+		key:          key,
+		grants:       map[string]grant{},
+		tokens:       map[string]User{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/token", i.token)
+	mux.HandleFunc("/userinfo", i.userinfo)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	i.URL = server.URL
+	return i
+}
+
+// Provider returns a provider configured for the issuer, as
+// oauth.ProvidersFromEnv would; its endpoints come from discovery
+func (i *Issuer) Provider(name, redirectURL string) *oauth.Provider {
+	return &oauth.Provider{
+		Name:         name,
+		Kind:         oauth.KindOIDC,
+		ClientID:     i.ClientID,
+		ClientSecret: i.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  redirectURL,
+		Issuer:       i.URL,
+		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Authorize stands in for user consenting at the authorization URL a
+// provider built, and returns the code and state the issuer redirects back
+// with
+func (i *Issuer) Authorize(t testing.TB, authURL string, user User) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != i.URL+"/authorize" {
+		t.Fatalf("authorization URL %s is not the issuer's", authURL)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             i.ClientID,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(key) != want {
+			t.Fatalf("authorization URL has %s %q, want %q", key, q.Get(key), want)
+		}
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL %s lacks a state, nonce or code challenge", authURL)
+	}
+
+	code = randomString(t)
+	i.mu.Lock()
+	i.grants[code] = grant{
+		user:        user,
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+	}
+	i.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := i.URL
+	if i.DiscoveredIssuer != "" {
+		issuer = i.DiscoveredIssuer
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"userinfo_endpoint":      i.URL + "/userinfo",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	coordinate := func(n interface{ FillBytes([]byte) []byte }) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": keyID,
+			"use": "sig",
+			"crv": "P-256",
+			"x":   coordinate(i.key.PublicKey.X),
+			"y":   coordinate(i.key.PublicKey.Y),
+		}},
+	})
+}
+
+// token redeems an authorization code, once, for an access and ID token
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != i.ClientID || r.PostForm.Get("client_secret") != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	g, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok, r.PostForm.Get("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            i.URL,
+		"aud":            i.ClientID,
+		"sub":            g.user.Subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"given_name":     g.user.FirstName,
+		"family_name":    g.user.LastName,
+	}
+	if i.Claims != nil {
+		i.Claims(claims)
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(i.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken := "access-" + code
+	i.mu.Lock()
+	i.tokens[accessToken] = g.user
+	i.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (i *Issuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	user, ok := i.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	i.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString(t testing.TB) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyRefreshInterval limits how often an unknown kid makes us refetch the
+// provider's keys
+const keyRefreshInterval = time.Minute
+
+// idTokenClaims are the ID token claims we read
+type idTokenClaims struct {
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // some providers send "true"
+	GivenName     string      `json:"given_name"`
+	FamilyName    string      `json:"family_name"`
+	Picture       string      `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// oidcIdentity verifies the ID token from the token response and reads the
+// user from it, asking the userinfo endpoint for an email it leaves out
+func (p *Provider) oidcIdentity(ctx context.Context, token tokenResponse, nonce string) (*Identity, error) {
+	if token.IDToken == "" {
+		return nil, errors.New("token exchange: no ID token in response")
+	}
+
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(token.IDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(p.Issuer), jwt.WithAudience(p.ClientID), jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("ID token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token: nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID token: no subject")
+	}
+
+	identity := &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Picture:       claims.Picture,
+	}
+	if identity.Email == "" && p.UserInfoURL != "" {
+		var info idTokenClaims
+		if err := p.getJSON(ctx, p.UserInfoURL, token.AccessToken, &info); err != nil {
+			return nil, fmt.Errorf("userinfo: %w", err)
+		}
+		// Userinfo must describe the same user as the ID token
+		if info.Subject == identity.Subject {
+			identity.Email = info.Email
+			identity.EmailVerified = isTrue(info.EmailVerified)
+		}
+	}
+	return identity, nil
+}
+
+func isTrue(v interface{}) bool {
+	return v == true || v == "true"
+}
+
+// keyCache holds a provider's signing keys by kid
+type keyCache struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// publicKey returns the provider's key with kid, refetching the key set
+// when the kid is new, since providers rotate keys without notice
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		if key, ok := p.keys.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(p.keys.fetchedAt) < keyRefreshInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = &keyCache{keys: keys, fetchedAt: time.Now()}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// A provider with a single key may leave kid out of its tokens
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jwk is one key of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys downloads the provider's JWKS; keys of unsupported types are skipped
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,53 @@
+// Package payouts pays organizers for the tickets to their events once the
+// events are over
+package payouts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"synapmentor/internal/repository"
+	"time"
+)
+
+// Worker periodically pays out the events that have ended
+type Worker struct {
+	Events        repository.EventRepo
+	Notifications repository.NotificationRepo
+	Interval      time.Duration // how often ended events are looked for
+}
+
+// Run pays out ended events every Interval until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.PayOut(time.Now()); err != nil {
+			log.Printf("Failed to pay out events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PayOut pays organizers for every event that ended by now, tells them what
+// they were paid and returns how many events were paid out
+func (w *Worker) PayOut(now time.Time) (int, error) {
+	payouts, err := w.Events.PayOutEnded(now)
+	for _, p := range payouts {
+		if p.Amount == 0 {
+			continue
+		}
+		tickets := "tickets"
+		if p.Tickets == 1 {
+			tickets = "ticket"
+		}
+		w.Notifications.Create(p.OrganizerID, "Event Payout",
+			fmt.Sprintf("You were paid %.2f for %d %s to %s", p.Amount, p.Tickets, tickets, p.Title), "in_app")
+	}
+	return len(payouts), err
+}
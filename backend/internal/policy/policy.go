@@ -0,0 +1,103 @@
+// Package policy decides a user's identity verification level and which
+// actions each level unlocks
+package policy
+
+import (
+	"os"
+	"strconv"
+	"synapmentor/internal/models"
+)
+
+// Facts are what a verification level is computed from
+type Facts struct {
+	EmailVerified    bool
+	PhoneVerified    bool
+	IdentityVerified bool // an ID document has been approved by staff
+}
+
+// Level computes the verification level the facts earn: light to start
+// with, standard once email and phone are verified and full once an ID
+// document has been approved on top
+func Level(f Facts) string {
+	switch {
+	case f.EmailVerified && f.PhoneVerified && f.IdentityVerified:
+		return models.VerificationFull
+	case f.EmailVerified && f.PhoneVerified:
+		return models.VerificationStandard
+	default:
+		return models.VerificationLight
+	}
+}
+
+// rank orders the levels; unknown levels rank with light
+var rank = map[string]int{
+	models.VerificationLight:    0,
+	models.VerificationStandard: 1,
+	models.VerificationFull:     2,
+}
+
+// Meets reports whether level is at least required
+func Meets(level, required string) bool {
+	return rank[level] >= rank[required]
+}
+
+// Action is something only sufficiently verified users may do
+type Action string
+
+const (
+	// AcceptPaidSession is a solver confirming a session that costs money
+	AcceptPaidSession Action = "accept_paid_session"
+	// SellTickets is a solver organising an event that charges for tickets
+	SellTickets Action = "sell_tickets"
+	// Withdraw is moving money out of a wallet
+	Withdraw Action = "withdraw"
+)
+
+// Policy maps actions to the level they need
+type Policy struct {
+	Required map[Action]string
+	// LargeWithdrawal is the amount above which a withdrawal needs full verification
+	LargeWithdrawal float64
+}
+
+// Default requires standard verification to accept paid sessions or sell
+// event tickets and full verification to withdraw more than 500 at once
+func Default() Policy {
+	return Policy{
+		Required: map[Action]string{
+			AcceptPaidSession: models.VerificationStandard,
+			SellTickets:       models.VerificationStandard,
+			Withdraw:          models.VerificationLight,
+		},
+		LargeWithdrawal: 500,
+	}
+}
+
+// FromEnv returns the default policy with the large withdrawal threshold
+// taken from VERIFICATION_LARGE_WITHDRAWAL when set
+func FromEnv() Policy {
+	p := Default()
+	if v, err := strconv.ParseFloat(os.Getenv("VERIFICATION_LARGE_WITHDRAWAL"), 64); err == nil && v >= 0 {
+		p.LargeWithdrawal = v
+	}
+	return p
+}
+
+// RequiredLevel returns the level action needs; amount matters for withdrawals
+func (p Policy) RequiredLevel(action Action, amount float64) string {
+	required, ok := p.Required[action]
+	if !ok {
+		required = models.VerificationLight
+	}
+	if action == Withdraw && amount > p.LargeWithdrawal && !Meets(required, models.VerificationFull) {
+		required = models.VerificationFull
+	}
+	return required
+}
+
+// Allows reports whether a user at level may take action, and the level the
+// action needs
+func (p Policy) Allows(level string, action Action, amount float64) (bool, string) {
+	required := p.RequiredLevel(action, amount)
+	return Meets(level, required), required
+}
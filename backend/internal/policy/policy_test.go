@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"synapmentor/internal/models"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		facts Facts
+		want  string
+	}{
+		{Facts{}, models.VerificationLight},
+		{Facts{EmailVerified: true}, models.VerificationLight},
+		{Facts{PhoneVerified: true}, models.VerificationLight},
+		{Facts{EmailVerified: true, PhoneVerified: true}, models.VerificationStandard},
+		{Facts{EmailVerified: true, IdentityVerified: true}, models.VerificationLight},
+		{Facts{EmailVerified: true, PhoneVerified: true, IdentityVerified: true}, models.VerificationFull},
+	}
+	for _, tt := range tests {
+		if got := Level(tt.facts); got != tt.want {
+			t.Errorf("Level(%+v) = %q, want %q", tt.facts, got, tt.want)
+		}
+	}
+}
+
+func TestMeets(t *testing.T) {
+	tests := []struct {
+		level, required string
+		want            bool
+	}{
+		{models.VerificationLight, models.VerificationLight, true},
+		{models.VerificationLight, models.VerificationStandard, false},
+		{models.VerificationStandard, models.VerificationLight, true},
+		{models.VerificationFull, models.VerificationStandard, true},
+		{models.VerificationStandard, models.VerificationFull, false},
+		{"", models.VerificationLight, true},
+		{"", models.VerificationStandard, false},
+	}
+	for _, tt := range tests {
+		if got := Meets(tt.level, tt.required); got != tt.want {
+			t.Errorf("Meets(%q, %q) = %v, want %v", tt.level, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRequiredLevel(t *testing.T) {
+	p := Default()
+	tests := []struct {
+		action Action
+		amount float64
+		want   string
+	}{
+		{AcceptPaidSession, 40, models.VerificationStandard},
+		{Withdraw, 40, models.VerificationLight},
+		{Withdraw, 500, models.VerificationLight},
+		{Withdraw, 500.01, models.VerificationFull},
+		{"unknown", 1000, models.VerificationLight},
+	}
+	for _, tt := range tests {
+		if got := p.RequiredLevel(tt.action, tt.amount); got != tt.want {
+			t.Errorf("RequiredLevel(%s, %v) = %q, want %q", tt.action, tt.amount, got, tt.want)
+		}
+	}
+
+	if ok, required := p.Allows(models.VerificationStandard, Withdraw, 600); ok || required != models.VerificationFull {
+		t.Errorf("Allows(standard, withdraw 600) = %v, %q", ok, required)
+	}
+	if ok, _ := p.Allows(models.VerificationFull, Withdraw, 600); !ok {
+		t.Error("full verification may not withdraw 600")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("VERIFICATION_LARGE_WITHDRAWAL", "100")
+	if got := FromEnv().LargeWithdrawal; got != 100 {
+		t.Errorf("LargeWithdrawal = %v, want 100", got)
+	}
+	t.Setenv("VERIFICATION_LARGE_WITHDRAWAL", "lots")
+	if got := FromEnv().LargeWithdrawal; got != 500 {
+		t.Errorf("LargeWithdrawal with a bad value = %v, want the default 500", got)
+	}
+}
@@ -0,0 +1,84 @@
+// Package recurrence expands a simple RRULE-style recurrence (weekly or
+// biweekly, bounded by a count or an end date) into occurrence times
+package recurrence
+
+import (
+	"errors"
+	"time"
+)
+
+// Frequencies
+const (
+	Weekly   = "weekly"
+	Biweekly = "biweekly"
+)
+
+// MaxOccurrences bounds the size of a single series
+const MaxOccurrences = 52
+
+var (
+	ErrFrequency = errors.New("frequency must be weekly or biweekly")
+	ErrBound     = errors.New("exactly one of count or until is required")
+	ErrTooMany   = errors.New("a series may have at most 52 occurrences")
+	ErrEmpty     = errors.New("the series has no occurrences")
+)
+
+// Rule describes how a session repeats. Exactly one of Count and Until is set;
+// Until is inclusive.
+type Rule struct {
+	Frequency string     `json:"frequency"`
+	Count     int        `json:"count,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+}
+
+// Validate checks the rule's shape without expanding it
+func (r Rule) Validate() error {
+	if r.Frequency != Weekly && r.Frequency != Biweekly {
+		return ErrFrequency
+	}
+	if (r.Count > 0) == (r.Until != nil) || r.Count < 0 {
+		return ErrBound
+	}
+	if r.Count > MaxOccurrences {
+		return ErrTooMany
+	}
+	return nil
+}
+
+// interval returns the number of days between occurrences
+func (r Rule) interval() int {
+	if r.Frequency == Biweekly {
+		return 14
+	}
+	return 7
+}
+
+// Occurrences returns the start times of the series beginning at start. The
+// steps are taken on the calendar of loc so that occurrences keep their wall
+// clock time across daylight saving changes. Times are returned in UTC.
+func (r Rule) Occurrences(start time.Time, loc *time.Location) ([]time.Time, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	local := start.In(loc)
+	var times []time.Time
+	for i := 0; ; i++ {
+		at := local.AddDate(0, 0, i*r.interval())
+		if r.Count > 0 && i == r.Count {
+			break
+		}
+		if r.Until != nil && at.After(*r.Until) {
+			break
+		}
+		if len(times) == MaxOccurrences {
+			return nil, ErrTooMany
+		}
+		times = append(times, at.UTC())
+	}
+
+	if len(times) == 0 {
+		return nil, ErrEmpty
+	}
+	return times, nil
+}
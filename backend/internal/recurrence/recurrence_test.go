@@ -0,0 +1,89 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	until := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rule Rule
+		want error
+	}{
+		{"weekly count", Rule{Frequency: Weekly, Count: 4}, nil},
+		{"biweekly until", Rule{Frequency: Biweekly, Until: &until}, nil},
+		{"daily", Rule{Frequency: "daily", Count: 4}, ErrFrequency},
+		{"unbounded", Rule{Frequency: Weekly}, ErrBound},
+		{"both bounds", Rule{Frequency: Weekly, Count: 4, Until: &until}, ErrBound},
+		{"negative count", Rule{Frequency: Weekly, Count: -1}, ErrBound},
+		{"a year and a week", Rule{Frequency: Weekly, Count: MaxOccurrences + 1}, ErrTooMany},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Validate() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+	until := start.AddDate(0, 0, 28) // inclusive
+	before := start.Add(-time.Hour)
+	longUntil := start.AddDate(2, 0, 0)
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		want    int
+		last    time.Time
+		wantErr error
+	}{
+		{"weekly count", Rule{Frequency: Weekly, Count: 3}, 3, start.AddDate(0, 0, 14), nil},
+		{"biweekly count", Rule{Frequency: Biweekly, Count: 3}, 3, start.AddDate(0, 0, 28), nil},
+		{"weekly until", Rule{Frequency: Weekly, Until: &until}, 5, until, nil},
+		{"biweekly until", Rule{Frequency: Biweekly, Until: &until}, 3, until, nil},
+		{"until before the start", Rule{Frequency: Weekly, Until: &before}, 0, time.Time{}, ErrEmpty},
+		{"until two years out", Rule{Frequency: Weekly, Until: &longUntil}, 0, time.Time{}, ErrTooMany},
+	}
+	for _, tt := range tests {
+		got, err := tt.rule.Occurrences(start, time.UTC)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Occurrences() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(got) != tt.want {
+			t.Errorf("%s: %d occurrences, want %d", tt.name, len(got), tt.want)
+			continue
+		}
+		if tt.want > 0 && (!got[0].Equal(start) || !got[len(got)-1].Equal(tt.last)) {
+			t.Errorf("%s: occurrences run from %v to %v, want %v to %v", tt.name, got[0], got[len(got)-1], start, tt.last)
+		}
+	}
+}
+
+// A weekly series keeps its wall clock time when daylight saving time starts
+func TestOccurrencesAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Clocks go forward on 29 March 2026 in Berlin
+	start := time.Date(2026, 3, 24, 18, 0, 0, 0, loc)
+
+	got, err := Rule{Frequency: Weekly, Count: 2}.Occurrences(start, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		time.Date(2026, 3, 24, 17, 0, 0, 0, time.UTC), // CET
+		time.Date(2026, 3, 31, 16, 0, 0, 0, time.UTC), // CEST
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) || got[i].Location() != time.UTC {
+			t.Errorf("occurrence %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
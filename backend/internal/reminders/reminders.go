@@ -0,0 +1,85 @@
+// Package reminders tells attendees about the events they are going to
+// shortly before the events start
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"synapmentor/internal/mail"
+	"synapmentor/internal/repository"
+	"time"
+)
+
+// Worker periodically sends the event reminders that have fallen due
+type Worker struct {
+	Events        repository.EventRepo
+	Users         repository.UserRepo
+	Notifications repository.NotificationRepo
+	Mailer        mail.Sender
+	Lead          time.Duration // how long before an event attendees are reminded
+	Interval      time.Duration // how often due reminders are looked for
+}
+
+// LeadFromEnv returns how long before an event to remind attendees, from
+// EVENT_REMINDER_LEAD (a Go duration such as 2h), 24 hours by default
+func LeadFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EVENT_REMINDER_LEAD")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// Run sends due reminders every Interval until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.SendDue(time.Now()); err != nil {
+			log.Printf("Failed to send event reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue reminds everyone going to an event that starts within Lead of now
+// and has not been reminded yet, and returns how many were reminded. Each
+// reminder is recorded before it is sent, so nobody is reminded twice.
+func (w *Worker) SendDue(now time.Time) (int, error) {
+	due, err := w.Events.DueReminders(now, now.Add(w.Lead))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, rm := range due {
+		if err := w.Events.MarkReminded(rm.EventID, rm.UserID); err != nil {
+			return sent, err
+		}
+
+		loc, err := w.Users.Location(rm.UserID)
+		if err != nil {
+			loc = time.UTC
+		}
+		when := rm.EventDate.In(loc).Format("Monday, January 2 at 15:04 MST")
+
+		w.Notifications.Create(rm.UserID, "Event Reminder", rm.Title+" starts "+when, "in_app")
+		if err := w.Mailer.Send(mail.Message{
+			To:      rm.Email,
+			Subject: "Reminder: " + rm.Title,
+			Body: fmt.Sprintf("Hi %s,\n\nThis is a reminder that %s starts %s.\n\n"+
+				"If you can no longer attend, please cancel your RSVP so someone on the waitlist can take your place.\n",
+				rm.FirstName, rm.Title, when),
+		}); err != nil {
+			log.Printf("Failed to email reminder for event %d to user %d: %v", rm.EventID, rm.UserID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
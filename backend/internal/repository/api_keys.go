@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// APIKeyRepo stores users' API keys by hash
+type APIKeyRepo interface {
+	// Create stores a new key, failing with ErrInvalidState once the user
+	// has max keys that are neither revoked nor expired
+	Create(key *models.APIKey, keyHash string, max int) (int, error)
+	// List returns a user's keys, newest first, including revoked and expired ones
+	List(userID int) ([]models.APIKey, error)
+	// Revoke revokes one of a user's keys
+	Revoke(userID, id int) error
+	// Authenticate returns the key with keyHash and its user, recording the
+	// use from ip. It fails with ErrTokenInvalid for an unknown, revoked or
+	// expired key, or one whose user has been deactivated.
+	Authenticate(keyHash, ip string) (*models.APIKey, *models.User, error)
+}
+
+type sqlAPIKeyRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlAPIKeyRepo) Create(key *models.APIKey, keyHash string, max int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var active int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM api_keys
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`, key.UserID, now).Scan(&active); err != nil {
+		return 0, err
+	}
+	if active >= max {
+		return 0, ErrInvalidState
+	}
+
+	id, err := tx.InsertID(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, " "), key.ExpiresAt.UTC(), now)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	key.ID, key.CreatedAt = int(id), now
+	return key.ID, nil
+}
+
+const selectAPIKey = `
+	SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at,
+	       COALESCE(last_used_ip, ''), revoked_at, created_at
+	FROM api_keys`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key    models.APIKey
+		scopes string
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt,
+		&key.LastUsedAt, &key.LastUsedIP, &key.RevokedAt, &key.CreatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
+
+func (r *sqlAPIKeyRepo) List(userID int) ([]models.APIKey, error) {
+	rows, err := r.db.Query(selectAPIKey+" WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *sqlAPIKeyRepo) Revoke(userID, id int) error {
+	return expectRow(r.db.Exec(`
+		UPDATE api_keys SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, time.Now().UTC(), id, userID))
+}
+
+func (r *sqlAPIKeyRepo) Authenticate(keyHash, ip string) (*models.APIKey, *models.User, error) {
+	key, err := scanAPIKey(r.db.QueryRow(selectAPIKey+" WHERE key_hash = ?", keyHash))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if key.RevokedAt != nil || !now.Before(key.ExpiresAt) {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	user, err := scanUser(r.db.QueryRow(selectUser+" WHERE id = ?", key.UserID))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrTokenInvalid
+	}
+	if user.Roles, err = userRoles(r.db, user.ID); err != nil {
+		return nil, nil, err
+	}
+
+	// Like login sessions, recording every request would mean a write per call
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastSeenInterval || key.LastUsedIP != ip {
+		if _, err := r.db.Exec("UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?",
+			now, ip, key.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, user, nil
+}
@@ -0,0 +1,103 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// createAPIKey stores a key with the given hash for userID
+func createAPIKey(t *testing.T, repos *repository.Repositories, userID int, hash string, expires time.Time) int {
+	t.Helper()
+	id, err := repos.APIKeys.Create(&models.APIKey{
+		UserID:    userID,
+		Name:      hash,
+		Prefix:    "smk_" + hash,
+		Scopes:    []string{"sessions:read", "wallet:read"},
+		ExpiresAt: expires,
+	}, hash, 3)
+	if err != nil {
+		t.Fatalf("create key %s: %v", hash, err)
+	}
+	return id
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+	other := createUser(t, repos, "other@example.com", models.RoleSeeker)
+	live := createAPIKey(t, repos, user, "live", time.Now().Add(time.Hour))
+	createAPIKey(t, repos, user, "expired", time.Now().Add(-time.Minute))
+	revoked := createAPIKey(t, repos, user, "revoked", time.Now().Add(time.Hour))
+
+	key, owner, err := repos.APIKeys.Authenticate("live", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != live || owner.ID != user || !owner.HasRole(models.RoleSeeker) {
+		t.Errorf("Authenticate() = key %d of user %d %v", key.ID, owner.ID, owner.Roles)
+	}
+	if len(key.Scopes) != 2 || key.Scopes[0] != "sessions:read" {
+		t.Errorf("Scopes = %v", key.Scopes)
+	}
+
+	if err := repos.APIKeys.Revoke(other, revoked); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("revoking someone else's key = %v, want ErrNotFound", err)
+	}
+	if err := repos.APIKeys.Revoke(user, revoked); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"expired", "revoked", "unknown"} {
+		if _, _, err := repos.APIKeys.Authenticate(hash, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+			t.Errorf("Authenticate(%s) = %v, want ErrTokenInvalid", hash, err)
+		}
+	}
+
+	keys, err := repos.APIKeys.List(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("List() = %d keys, want all 3", len(keys))
+	}
+	for _, k := range keys {
+		if k.ID == live && (k.LastUsedAt == nil || k.LastUsedIP != "10.0.0.1") {
+			t.Errorf("live key use not recorded: %+v", k)
+		}
+	}
+
+	// Deactivating the user disables their keys
+	if err := repos.Users.SetActive(user, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repos.APIKeys.Authenticate("live", ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("a deactivated user's key = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestAPIKeyLimit(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+	for _, hash := range []string{"a", "b", "c"} {
+		createAPIKey(t, repos, user, hash, time.Now().Add(time.Hour))
+	}
+
+	fourth := &models.APIKey{UserID: user, Name: "d", Prefix: "smk_d", ExpiresAt: time.Now().Add(time.Hour)}
+	if _, err := repos.APIKeys.Create(fourth, "d", 3); !errors.Is(err, repository.ErrInvalidState) {
+		t.Fatalf("creating a key over the limit = %v, want ErrInvalidState", err)
+	}
+
+	// Revoked keys don't count
+	keys, err := repos.APIKeys.List(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.APIKeys.Revoke(user, keys[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.APIKeys.Create(fourth, "d", 3); err != nil {
+		t.Errorf("creating a key after revoking one: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"synapmentor/internal/availability"
+	"synapmentor/internal/database"
+	"time"
+)
+
+// maxSessionLength bounds how far back a booking can start and still overlap
+// a given time; it must cover the longest Duration CreateSession accepts
+const maxSessionLength = 24 * time.Hour
+
+// AvailabilityRepo stores solvers' weekly availability and its exceptions
+type AvailabilityRepo interface {
+	// Rules returns a solver's weekly availability rules
+	Rules(solverID int) ([]availability.Rule, error)
+	// ReplaceRules swaps a solver's weekly rules for a new set
+	ReplaceRules(solverID int, rules []availability.Rule) error
+	// Exceptions returns a solver's exceptions overlapping a period
+	Exceptions(solverID int, from, to time.Time) ([]availability.Exception, error)
+	// AddException records an exception and returns its id
+	AddException(solverID int, e availability.Exception) (int, error)
+	// DeleteException removes one of a solver's exceptions
+	DeleteException(solverID, id int) error
+	// Slots returns a solver's open slots of the given duration in a period
+	Slots(solverID int, from, to time.Time, duration time.Duration) ([]availability.Interval, error)
+}
+
+type sqlAvailabilityRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlAvailabilityRepo) Rules(solverID int) ([]availability.Rule, error) {
+	return loadRules(r.db, solverID)
+}
+
+func (r *sqlAvailabilityRepo) ReplaceRules(solverID int, rules []availability.Rule) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM availability_rules WHERE solver_id = ?", solverID); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if _, err := tx.Exec(`
+			INSERT INTO availability_rules (solver_id, weekday, start_minute, end_minute, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			solverID, int(rule.Weekday), rule.StartMinute, rule.EndMinute, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlAvailabilityRepo) Exceptions(solverID int, from, to time.Time) ([]availability.Exception, error) {
+	return loadExceptions(r.db, solverID, from, to)
+}
+
+func (r *sqlAvailabilityRepo) AddException(solverID int, e availability.Exception) (int, error) {
+	id, err := r.db.InsertID(`
+		INSERT INTO availability_exceptions (solver_id, starts_at, ends_at, available, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		solverID, e.StartsAt.UTC(), e.EndsAt.UTC(), e.Available, e.Reason, time.Now().UTC())
+	return int(id), err
+}
+
+func (r *sqlAvailabilityRepo) DeleteException(solverID, id int) error {
+	return expectRow(r.db.Exec("DELETE FROM availability_exceptions WHERE id = ? AND solver_id = ?", id, solverID))
+}
+
+func (r *sqlAvailabilityRepo) Slots(solverID int, from, to time.Time, duration time.Duration) ([]availability.Interval, error) {
+	windows, err := openWindows(r.db, solverID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := bookedIntervals(r.db, solverID, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	return availability.Slots(windows, busy, duration), nil
+}
+
+func loadRules(q querier, solverID int) ([]availability.Rule, error) {
+	rows, err := q.Query(`
+		SELECT id, weekday, start_minute, end_minute
+		FROM availability_rules WHERE solver_id = ?
+		ORDER BY weekday, start_minute`, solverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []availability.Rule{}
+	for rows.Next() {
+		var rule availability.Rule
+		if err := rows.Scan(&rule.ID, &rule.Weekday, &rule.StartMinute, &rule.EndMinute); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func loadExceptions(q querier, solverID int, from, to time.Time) ([]availability.Exception, error) {
+	rows, err := q.Query(`
+		SELECT id, starts_at, ends_at, available, COALESCE(reason, '')
+		FROM availability_exceptions
+		WHERE solver_id = ? AND starts_at < ? AND ends_at > ?
+		ORDER BY starts_at`, solverID, to.UTC(), from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []availability.Exception{}
+	for rows.Next() {
+		var e availability.Exception
+		if err := rows.Scan(&e.ID, &e.StartsAt, &e.EndsAt, &e.Available, &e.Reason); err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+	return exceptions, rows.Err()
+}
+
+// openWindows computes a solver's open windows in a period. A solver without
+// any weekly rules has not opted into the calendar and is open at all times.
+func openWindows(q querier, solverID int, from, to time.Time) ([]availability.Interval, error) {
+	rules, err := loadRules(q, solverID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return []availability.Interval{{Start: from.UTC(), End: to.UTC()}}, nil
+	}
+
+	exceptions, err := loadExceptions(q, solverID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(q, solverID)
+	if err != nil {
+		return nil, err
+	}
+	return availability.Windows(rules, exceptions, from, to, loc), nil
+}
+
+// bookedIntervals returns the times a solver is already booked in a period,
+// ignoring the session excludeID (zero to ignore none)
+func bookedIntervals(q querier, solverID int, from, to time.Time, excludeID int) ([]availability.Interval, error) {
+	rows, err := q.Query(`
+		SELECT scheduled_at, duration FROM sessions
+		WHERE solver_id = ? AND id <> ?
+		AND status IN ('requested', 'confirmed', 'active')
+		AND scheduled_at < ? AND scheduled_at > ?`,
+		solverID, excludeID, to.UTC(), from.UTC().Add(-maxSessionLength))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var busy []availability.Interval
+	for rows.Next() {
+		var start time.Time
+		var minutes int
+		if err := rows.Scan(&start, &minutes); err != nil {
+			return nil, err
+		}
+		slot := availability.Interval{Start: start, End: start.Add(time.Duration(minutes) * time.Minute)}
+		if slot.End.After(from) {
+			busy = append(busy, slot)
+		}
+	}
+	return busy, rows.Err()
+}
+
+// checkBookable verifies inside tx that a solver is free and available for a
+// session; the solver's user row is locked first so that concurrent bookings
+// of the same solver are checked one after another
+func checkBookable(tx *database.Tx, solverID int, slot availability.Interval, excludeID int) error {
+	var id int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ?"+tx.Dialect.ForUpdate(), solverID).Scan(&id); err != nil {
+		return notFound(err)
+	}
+
+	busy, err := bookedIntervals(tx, solverID, slot.Start, slot.End, excludeID)
+	if err != nil {
+		return err
+	}
+	if len(busy) > 0 {
+		return ErrSlotTaken
+	}
+
+	windows, err := openWindows(tx, solverID, slot.Start, slot.End)
+	if err != nil {
+		return err
+	}
+	if !availability.Covers(windows, slot) {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"time"
+)
+
+// CalendarSession is a session with what a calendar entry needs to show
+type CalendarSession struct {
+	ID          int
+	Title       string
+	Description string
+	Status      string
+	ScheduledAt time.Time
+	Duration    int
+	Sequence    int
+	UpdatedAt   time.Time
+	SolverName  string
+	SolverEmail string
+	SeekerName  string
+	SeekerEmail string
+}
+
+// CalendarEvent is a community event with what a calendar entry needs to show
+type CalendarEvent struct {
+	ID             int
+	Title          string
+	Description    string
+	EventDate      time.Time
+	Duration       int
+	IsActive       bool
+	Sequence       int
+	UpdatedAt      time.Time
+	OrganizerName  string
+	OrganizerEmail string
+}
+
+// CalendarRepo stores iCal feed tokens and reads the entries of a user's calendar
+type CalendarRepo interface {
+	// SetFeedToken stores the hash of a user's feed token, replacing any previous one
+	SetFeedToken(userID int, tokenHash string) error
+	// DeleteFeed revokes a user's feed
+	DeleteFeed(userID int) error
+	// FeedOwner returns the user a feed token hash belongs to
+	FeedOwner(tokenHash string) (int, error)
+	// Sessions returns a user's sessions scheduled since a time, cancelled ones
+	// included so that calendar clients learn about the cancellation
+	Sessions(userID int, since time.Time) ([]CalendarSession, error)
+	// Session returns one session as a calendar entry
+	Session(id int) (*CalendarSession, error)
+	// Events returns events a user organises or attends since a time
+	Events(userID int, since time.Time) ([]CalendarEvent, error)
+}
+
+type sqlCalendarRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlCalendarRepo) SetFeedToken(userID int, tokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM calendar_feeds WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO calendar_feeds (user_id, token_hash, created_at) VALUES (?, ?, ?)`,
+		userID, tokenHash, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCalendarRepo) DeleteFeed(userID int) error {
+	return expectRow(r.db.Exec("DELETE FROM calendar_feeds WHERE user_id = ?", userID))
+}
+
+func (r *sqlCalendarRepo) FeedOwner(tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(`
+		SELECT f.user_id FROM calendar_feeds f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.token_hash = ? AND COALESCE(u.is_active, TRUE)`, tokenHash).Scan(&userID)
+	return userID, notFound(err)
+}
+
+const selectCalendarSession = `
+	SELECT s.id, s.title, COALESCE(s.description, ''), s.status, s.scheduled_at, s.duration,
+	       COALESCE(s.ical_sequence, 0), s.updated_at,
+	       solver.first_name || ' ' || solver.last_name, solver.email,
+	       seeker.first_name || ' ' || seeker.last_name, seeker.email
+	FROM sessions s
+	JOIN users solver ON s.solver_id = solver.id
+	JOIN users seeker ON s.seeker_id = seeker.id`
+
+func scanCalendarSession(row rowScanner) (*CalendarSession, error) {
+	var s CalendarSession
+	err := row.Scan(&s.ID, &s.Title, &s.Description, &s.Status, &s.ScheduledAt, &s.Duration,
+		&s.Sequence, &s.UpdatedAt, &s.SolverName, &s.SolverEmail, &s.SeekerName, &s.SeekerEmail)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+func (r *sqlCalendarRepo) Sessions(userID int, since time.Time) ([]CalendarSession, error) {
+	rows, err := r.db.Query(selectCalendarSession+`
+		WHERE (s.solver_id = ? OR s.seeker_id = ?) AND s.scheduled_at >= ?
+		ORDER BY s.scheduled_at`, userID, userID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []CalendarSession
+	for rows.Next() {
+		s, err := scanCalendarSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlCalendarRepo) Session(id int) (*CalendarSession, error) {
+	return scanCalendarSession(r.db.QueryRow(selectCalendarSession+" WHERE s.id = ?", id))
+}
+
+func (r *sqlCalendarRepo) Events(userID int, since time.Time) ([]CalendarEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT e.id, e.title, COALESCE(e.description, ''), e.event_date, COALESCE(e.duration, 60),
+		       COALESCE(e.is_active, TRUE), COALESCE(e.ical_sequence, 0), e.updated_at,
+		       u.first_name || ' ' || u.last_name, u.email
+		FROM events e
+		JOIN users u ON e.created_by = u.id
+		WHERE e.event_date >= ?
+		AND (e.created_by = ? OR EXISTS (
+			SELECT 1 FROM event_attendees a
+			WHERE a.event_id = e.id AND a.user_id = ? AND a.status = 'going'))
+		ORDER BY e.event_date`, since.UTC(), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []CalendarEvent
+	for rows.Next() {
+		var e CalendarEvent
+		if err := rows.Scan(&e.ID, &e.Title, &e.Description, &e.EventDate, &e.Duration,
+			&e.IsActive, &e.Sequence, &e.UpdatedAt, &e.OrganizerName, &e.OrganizerEmail); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,70 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestFeedTokens(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "solver@example.com", "solver")
+
+	if err := repos.Calendar.SetFeedToken(user, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := repos.Calendar.FeedOwner("first"); err != nil || owner != user {
+		t.Errorf("FeedOwner() = %d, %v, want %d", owner, err, user)
+	}
+
+	// Rotating the token revokes the old one
+	if err := repos.Calendar.SetFeedToken(user, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Calendar.FeedOwner("first"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("FeedOwner() of a rotated token = %v, want ErrNotFound", err)
+	}
+
+	if err := repos.Calendar.DeleteFeed(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Calendar.FeedOwner("second"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("FeedOwner() of a deleted feed = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCalendarSessionSequence(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+
+	id := book(t, repos, solver, seeker, 48*time.Hour, 0)
+	before, err := repos.Calendar.Session(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.SolverEmail != "solver@example.com" || before.SeekerEmail != "seeker@example.com" {
+		t.Errorf("calendar session = %+v", before)
+	}
+
+	// Clients only replace their copy of an entry whose sequence grew
+	if _, err := repos.Sessions.Cancel(id, seeker, ""); err != nil {
+		t.Fatal(err)
+	}
+	after, err := repos.Calendar.Session(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Sequence <= before.Sequence {
+		t.Errorf("sequence %d after cancelling, was %d", after.Sequence, before.Sequence)
+	}
+
+	sessions, err := repos.Calendar.Sessions(seeker, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Status != "cancelled" {
+		t.Errorf("feed sessions = %+v, want the cancelled session", sessions)
+	}
+}
@@ -0,0 +1,517 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// CommunityFilter narrows a community listing
+type CommunityFilter struct {
+	ViewerID int // fills in the viewer's role in each community
+	Category string
+	Query    string // matched against name and description
+	MemberID int    // only communities this user belongs to
+	After    int    // cursor: list communities with a greater id
+	Limit    int
+}
+
+// DiscussionFilter narrows a discussion listing
+type DiscussionFilter struct {
+	CommunityID int // zero lists discussions from every community
+	Before      int // cursor: list discussions with a smaller id
+	Limit       int
+}
+
+// CommunityRepo stores communities and who belongs to them. member_count is
+// kept in step with the memberships in the same transaction.
+type CommunityRepo interface {
+	// List returns active communities, oldest first
+	List(filter CommunityFilter) ([]models.Community, error)
+	// Get returns an active community with the viewer's role in it
+	Get(id, viewerID int) (*models.Community, error)
+	// Create inserts a community owned by userID and returns its id
+	Create(userID int, community *models.Community) (int, error)
+	// Update replaces the name, description and category of a community
+	Update(id int, community *models.Community) error
+	// Delete deactivates a community, hiding it and its discussions
+	Delete(id int) error
+	// Join adds userID as a member, failing with ErrInvalidState if they
+	// already are one
+	Join(id, userID int) error
+	// Leave removes userID's membership, failing with ErrNotFound if they are
+	// not a member and ErrInvalidState if they own the community
+	Leave(id, userID int) error
+	// MemberRole returns userID's role in the community, or "" if they are
+	// not a member
+	MemberRole(id, userID int) (string, error)
+	// Members returns the members of a community by user id, after the
+	// member with id after
+	Members(id, after, limit int) ([]models.CommunityMember, error)
+	// SetMemberRole makes a member a moderator or a plain member, failing with
+	// ErrNotFound if they are not a member and ErrInvalidState for the owner
+	SetMemberRole(id, userID int, role string) error
+}
+
+// DiscussionRepo stores discussions and their threaded replies. The replies
+// count on a discussion is kept in step with its live replies.
+type DiscussionRepo interface {
+	// List returns discussions in active communities, newest first
+	List(filter DiscussionFilter) ([]models.Discussion, error)
+	// Get returns a discussion in an active community
+	Get(id int) (*models.Discussion, error)
+	// Create inserts a discussion and returns its id
+	Create(discussion *models.Discussion) (int, error)
+	// Update replaces the title and content of a discussion
+	Update(id int, title, content string) error
+	// Delete removes a discussion together with its replies
+	Delete(id int) error
+	// Replies returns the replies to a discussion, deleted ones included so
+	// threads stay whole, oldest first after the reply with id after
+	Replies(discussionID, after, limit int) ([]models.DiscussionReply, error)
+	// GetReply returns a reply to a discussion in an active community
+	GetReply(id int) (*models.DiscussionReply, error)
+	// CreateReply inserts a reply one level below its parent, if it has one,
+	// and returns its id
+	CreateReply(reply *models.DiscussionReply) (int, error)
+	// UpdateReply replaces the content of a live reply
+	UpdateReply(id int, content string) error
+	// DeleteReply blanks a reply while keeping its place in the thread,
+	// failing with ErrNotFound if it is already deleted
+	DeleteReply(id int) error
+}
+
+type sqlCommunityRepo struct {
+	db *database.Conn
+}
+
+const selectCommunity = `
+	SELECT c.id, c.name, COALESCE(c.description, ''), COALESCE(c.category, ''),
+	       COALESCE(c.member_count, 0), COALESCE(c.is_active, TRUE), c.created_by,
+	       COALESCE(m.role, ''), c.created_at, c.updated_at
+	FROM communities c
+	LEFT JOIN community_members m ON m.community_id = c.id AND m.user_id = ?`
+
+func scanCommunity(row rowScanner) (*models.Community, error) {
+	var cm models.Community
+	if err := row.Scan(&cm.ID, &cm.Name, &cm.Description, &cm.Category, &cm.MemberCount,
+		&cm.IsActive, &cm.CreatedBy, &cm.Role, &cm.CreatedAt, &cm.UpdatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &cm, nil
+}
+
+func (r *sqlCommunityRepo) List(filter CommunityFilter) ([]models.Community, error) {
+	query := selectCommunity + " WHERE c.is_active AND c.id > ?"
+	args := []interface{}{filter.ViewerID, filter.After}
+
+	if filter.Category != "" {
+		query += " AND c.category = ?"
+		args = append(args, filter.Category)
+	}
+	if filter.Query != "" {
+		query += " AND (LOWER(c.name) LIKE ? OR LOWER(COALESCE(c.description, '')) LIKE ?)"
+		like := "%" + filter.Query + "%"
+		args = append(args, like, like)
+	}
+	if filter.MemberID != 0 {
+		query += " AND EXISTS (SELECT 1 FROM community_members x WHERE x.community_id = c.id AND x.user_id = ?)"
+		args = append(args, filter.MemberID)
+	}
+
+	query += " ORDER BY c.id LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var communities []models.Community
+	for rows.Next() {
+		cm, err := scanCommunity(rows)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, *cm)
+	}
+	return communities, rows.Err()
+}
+
+func (r *sqlCommunityRepo) Get(id, viewerID int) (*models.Community, error) {
+	return scanCommunity(r.db.QueryRow(selectCommunity+" WHERE c.id = ? AND c.is_active", viewerID, id))
+}
+
+func (r *sqlCommunityRepo) Create(userID int, community *models.Community) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	id, err := tx.InsertID(`
+		INSERT INTO communities (name, description, category, member_count, is_active, created_by,
+		                         created_at, updated_at)
+		VALUES (?, ?, ?, 1, TRUE, ?, ?, ?)`,
+		community.Name, community.Description, community.Category, userID, now, now)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO community_members (community_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)`, id, userID, models.CommunityRoleOwner, now); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *sqlCommunityRepo) Update(id int, community *models.Community) error {
+	return expectRow(r.db.Exec(`
+		UPDATE communities SET name = ?, description = ?, category = ?, updated_at = ?
+		WHERE id = ? AND is_active`,
+		community.Name, community.Description, community.Category, time.Now().UTC(), id))
+}
+
+func (r *sqlCommunityRepo) Delete(id int) error {
+	return expectRow(r.db.Exec(`
+		UPDATE communities SET is_active = FALSE, updated_at = ?
+		WHERE id = ? AND is_active`, time.Now().UTC(), id))
+}
+
+func (r *sqlCommunityRepo) Join(id, userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the community serializes joins and leaves so the count stays exact
+	var active bool
+	if err := tx.QueryRow("SELECT COALESCE(is_active, TRUE) FROM communities WHERE id = ?"+tx.Dialect.ForUpdate(),
+		id).Scan(&active); err != nil {
+		return notFound(err)
+	}
+	if !active {
+		return ErrNotFound
+	}
+
+	role, err := memberRole(tx, id, userID)
+	if err != nil {
+		return err
+	}
+	if role != "" {
+		return ErrInvalidState
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO community_members (community_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)`, id, userID, models.CommunityRoleMember, time.Now().UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE communities SET member_count = member_count + 1 WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCommunityRepo) Leave(id, userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var active bool
+	if err := tx.QueryRow("SELECT COALESCE(is_active, TRUE) FROM communities WHERE id = ?"+tx.Dialect.ForUpdate(),
+		id).Scan(&active); err != nil {
+		return notFound(err)
+	}
+
+	role, err := memberRole(tx, id, userID)
+	if err != nil {
+		return err
+	}
+	switch role {
+	case "":
+		return ErrNotFound
+	case models.CommunityRoleOwner:
+		return ErrInvalidState
+	}
+
+	if _, err := tx.Exec("DELETE FROM community_members WHERE community_id = ? AND user_id = ?",
+		id, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE communities SET member_count = member_count - 1 WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCommunityRepo) MemberRole(id, userID int) (string, error) {
+	return memberRole(r.db, id, userID)
+}
+
+// memberRole returns userID's role in a community, or "" if they are not a member
+func memberRole(q querier, id, userID int) (string, error) {
+	var role string
+	err := q.QueryRow("SELECT role FROM community_members WHERE community_id = ? AND user_id = ?",
+		id, userID).Scan(&role)
+	if err := notFound(err); errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return role, err
+}
+
+func (r *sqlCommunityRepo) Members(id, after, limit int) ([]models.CommunityMember, error) {
+	rows, err := r.db.Query(`
+		SELECT m.user_id, u.first_name || ' ' || u.last_name, m.role, m.joined_at
+		FROM community_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.community_id = ? AND m.user_id > ?
+		ORDER BY m.user_id LIMIT ?`, id, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.CommunityMember
+	for rows.Next() {
+		var m models.CommunityMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (r *sqlCommunityRepo) SetMemberRole(id, userID int, role string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := memberRole(tx, id, userID)
+	if err != nil {
+		return err
+	}
+	switch current {
+	case "":
+		return ErrNotFound
+	case models.CommunityRoleOwner:
+		return ErrInvalidState
+	}
+
+	if _, err := tx.Exec("UPDATE community_members SET role = ? WHERE community_id = ? AND user_id = ?",
+		role, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlDiscussionRepo struct {
+	db *database.Conn
+}
+
+const selectDiscussion = `
+	SELECT d.id, d.community_id, d.user_id, u.first_name || ' ' || u.last_name, d.title, d.content,
+	       COALESCE(d.likes, 0), COALESCE(d.replies, 0), COALESCE(d.is_anonymous, FALSE),
+	       d.created_at, d.updated_at
+	FROM discussions d
+	JOIN communities c ON c.id = d.community_id AND c.is_active
+	JOIN users u ON u.id = d.user_id`
+
+func scanDiscussion(row rowScanner) (*models.Discussion, error) {
+	var d models.Discussion
+	if err := row.Scan(&d.ID, &d.CommunityID, &d.UserID, &d.AuthorName, &d.Title, &d.Content,
+		&d.Likes, &d.Replies, &d.IsAnonymous, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &d, nil
+}
+
+func (r *sqlDiscussionRepo) List(filter DiscussionFilter) ([]models.Discussion, error) {
+	query := selectDiscussion + " WHERE 1 = 1"
+	var args []interface{}
+
+	if filter.CommunityID != 0 {
+		query += " AND d.community_id = ?"
+		args = append(args, filter.CommunityID)
+	}
+	if filter.Before != 0 {
+		query += " AND d.id < ?"
+		args = append(args, filter.Before)
+	}
+
+	query += " ORDER BY d.id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discussions []models.Discussion
+	for rows.Next() {
+		d, err := scanDiscussion(rows)
+		if err != nil {
+			return nil, err
+		}
+		discussions = append(discussions, *d)
+	}
+	return discussions, rows.Err()
+}
+
+func (r *sqlDiscussionRepo) Get(id int) (*models.Discussion, error) {
+	return scanDiscussion(r.db.QueryRow(selectDiscussion+" WHERE d.id = ?", id))
+}
+
+func (r *sqlDiscussionRepo) Create(d *models.Discussion) (int, error) {
+	now := time.Now().UTC()
+	id, err := r.db.InsertID(`
+		INSERT INTO discussions (community_id, user_id, title, content, is_anonymous, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.CommunityID, d.UserID, d.Title, d.Content, d.IsAnonymous, now, now)
+	return int(id), err
+}
+
+func (r *sqlDiscussionRepo) Update(id int, title, content string) error {
+	return expectRow(r.db.Exec(`
+		UPDATE discussions SET title = ?, content = ?, updated_at = ?
+		WHERE id = ?`, title, content, time.Now().UTC(), id))
+}
+
+func (r *sqlDiscussionRepo) Delete(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM discussion_replies WHERE discussion_id = ?", id); err != nil {
+		return err
+	}
+	if err := expectRow(tx.Exec("DELETE FROM discussions WHERE id = ?", id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const selectReply = `
+	SELECT r.id, r.discussion_id, r.parent_id, r.user_id, u.first_name || ' ' || u.last_name,
+	       r.content, COALESCE(r.is_anonymous, FALSE), r.depth, r.deleted_at IS NOT NULL,
+	       r.created_at, r.updated_at
+	FROM discussion_replies r
+	JOIN discussions d ON d.id = r.discussion_id
+	JOIN communities c ON c.id = d.community_id AND c.is_active
+	JOIN users u ON u.id = r.user_id`
+
+func scanReply(row rowScanner) (*models.DiscussionReply, error) {
+	var reply models.DiscussionReply
+	if err := row.Scan(&reply.ID, &reply.DiscussionID, &reply.ParentID, &reply.UserID, &reply.AuthorName,
+		&reply.Content, &reply.IsAnonymous, &reply.Depth, &reply.IsDeleted,
+		&reply.CreatedAt, &reply.UpdatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &reply, nil
+}
+
+func (r *sqlDiscussionRepo) Replies(discussionID, after, limit int) ([]models.DiscussionReply, error) {
+	rows, err := r.db.Query(selectReply+`
+		WHERE r.discussion_id = ? AND r.id > ?
+		ORDER BY r.id LIMIT ?`, discussionID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replies []models.DiscussionReply
+	for rows.Next() {
+		reply, err := scanReply(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, *reply)
+	}
+	return replies, rows.Err()
+}
+
+func (r *sqlDiscussionRepo) GetReply(id int) (*models.DiscussionReply, error) {
+	return scanReply(r.db.QueryRow(selectReply+" WHERE r.id = ?", id))
+}
+
+func (r *sqlDiscussionRepo) CreateReply(reply *models.DiscussionReply) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	depth := 0
+	if reply.ParentID != nil {
+		if err := tx.QueryRow("SELECT depth + 1 FROM discussion_replies WHERE id = ? AND discussion_id = ?",
+			*reply.ParentID, reply.DiscussionID).Scan(&depth); err != nil {
+			return 0, notFound(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	id, err := tx.InsertID(`
+		INSERT INTO discussion_replies (discussion_id, parent_id, user_id, content, is_anonymous,
+		                                depth, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		reply.DiscussionID, reply.ParentID, reply.UserID, reply.Content, reply.IsAnonymous,
+		depth, now, now)
+	if err != nil {
+		return 0, err
+	}
+	if err := expectRow(tx.Exec("UPDATE discussions SET replies = replies + 1 WHERE id = ?",
+		reply.DiscussionID)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reply.ID, reply.Depth, reply.CreatedAt, reply.UpdatedAt = int(id), depth, now, now
+	return reply.ID, nil
+}
+
+func (r *sqlDiscussionRepo) UpdateReply(id int, content string) error {
+	return expectRow(r.db.Exec(`
+		UPDATE discussion_replies SET content = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, content, time.Now().UTC(), id))
+}
+
+func (r *sqlDiscussionRepo) DeleteReply(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var discussionID int
+	if err := tx.QueryRow("SELECT discussion_id FROM discussion_replies WHERE id = ? AND deleted_at IS NULL",
+		id).Scan(&discussionID); err != nil {
+		return notFound(err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`
+		UPDATE discussion_replies SET content = '', deleted_at = ?, updated_at = ?
+		WHERE id = ?`, now, now, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE discussions SET replies = replies - 1 WHERE id = ?", discussionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
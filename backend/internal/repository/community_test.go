@@ -0,0 +1,132 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+)
+
+func TestCommunityMembership(t *testing.T) {
+	repos := newRepos(t)
+	owner := createUser(t, repos, "owner@example.com", models.RoleSolver)
+	member := createUser(t, repos, "member@example.com", models.RoleSeeker)
+
+	id, err := repos.Communities.Create(owner, &models.Community{Name: "Algebra", Category: "math"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Communities.Join(id, member); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Communities.Join(id, member); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("joining twice = %v, want ErrInvalidState", err)
+	}
+	community, err := repos.Communities.Get(id, member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if community.MemberCount != 2 || community.Role != models.CommunityRoleMember {
+		t.Errorf("community = %d members, role %q; want 2 and member", community.MemberCount, community.Role)
+	}
+
+	if err := repos.Communities.Leave(id, owner); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("the owner leaving = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Communities.SetMemberRole(id, owner, models.CommunityRoleMember); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("demoting the owner = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Communities.SetMemberRole(id, member, models.CommunityRoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := repos.Communities.MemberRole(id, member); err != nil || role != models.CommunityRoleModerator {
+		t.Errorf("MemberRole() = %q, %v", role, err)
+	}
+
+	if err := repos.Communities.Leave(id, member); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Communities.Leave(id, member); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("leaving twice = %v, want ErrNotFound", err)
+	}
+	if community, err = repos.Communities.Get(id, member); err != nil || community.MemberCount != 1 || community.Role != "" {
+		t.Errorf("after leaving: %+v, %v", community, err)
+	}
+
+	if err := repos.Communities.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Communities.Get(id, owner); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get() of a deleted community = %v, want ErrNotFound", err)
+	}
+	if err := repos.Communities.Join(id, member); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("joining a deleted community = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiscussionThreads(t *testing.T) {
+	repos := newRepos(t)
+	owner := createUser(t, repos, "owner@example.com", models.RoleSolver)
+	community, err := repos.Communities.Create(owner, &models.Community{Name: "Algebra"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	discussion, err := repos.Discussions.Create(&models.Discussion{CommunityID: community, UserID: owner,
+		Title: "Factoring", Content: "How?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := &models.DiscussionReply{DiscussionID: discussion, UserID: owner, Content: "Like this"}
+	if _, err := repos.Discussions.CreateReply(top); err != nil {
+		t.Fatal(err)
+	}
+	nested := &models.DiscussionReply{DiscussionID: discussion, ParentID: &top.ID, UserID: owner, Content: "Thanks"}
+	if _, err := repos.Discussions.CreateReply(nested); err != nil {
+		t.Fatal(err)
+	}
+	if top.Depth != 0 || nested.Depth != 1 {
+		t.Errorf("depths = %d, %d; want 0, 1", top.Depth, nested.Depth)
+	}
+	missing := 999
+	if _, err := repos.Discussions.CreateReply(&models.DiscussionReply{DiscussionID: discussion,
+		ParentID: &missing, UserID: owner, Content: "?"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("replying to a missing reply = %v, want ErrNotFound", err)
+	}
+
+	if err := repos.Discussions.DeleteReply(top.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Discussions.DeleteReply(top.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting twice = %v, want ErrNotFound", err)
+	}
+	if err := repos.Discussions.UpdateReply(top.ID, "back"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("editing a deleted reply = %v, want ErrNotFound", err)
+	}
+
+	// The deleted reply keeps its place so the thread stays whole
+	replies, err := repos.Discussions.Replies(discussion, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2 || !replies[0].IsDeleted || replies[0].Content != "" || replies[1].ID != nested.ID {
+		t.Errorf("Replies() = %+v", replies)
+	}
+	if page, err := repos.Discussions.Replies(discussion, replies[0].ID, 10); err != nil || len(page) != 1 {
+		t.Errorf("Replies() after the first = %d, %v", len(page), err)
+	}
+	d, err := repos.Discussions.Get(discussion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Replies != 1 {
+		t.Errorf("replies = %d, want the 1 live reply", d.Replies)
+	}
+
+	if err := repos.Discussions.Delete(discussion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Discussions.GetReply(nested.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("a reply outliving its discussion = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// ContentDetail is a content item joined with its author's name
+type ContentDetail struct {
+	Content    models.Content
+	AuthorName string
+}
+
+// ContentFilter narrows a content listing
+type ContentFilter struct {
+	ViewerID int // drafts are only listed for their owner
+	Category string
+	Status   string // empty or "all" disables the status filter
+	Limit    int
+	Offset   int
+}
+
+// ContentRepo stores user-generated content
+type ContentRepo interface {
+	// List returns published content plus the viewer's own items
+	List(filter ContentFilter) ([]ContentDetail, error)
+	// Get returns a content item by id
+	Get(id int) (*ContentDetail, error)
+	// Create inserts a content item owned by userID and returns its id
+	Create(userID int, content *models.Content) (int, error)
+	// Update replaces the editable fields of a content item
+	Update(id int, content *models.Content) error
+	// Delete removes a content item
+	Delete(id int) error
+	// IncrementViews bumps the view counter
+	IncrementViews(id int) error
+	// Stats returns the number of published items and their total views
+	Stats(userID int) (total int, views int, err error)
+}
+
+type sqlContentRepo struct {
+	db *database.Conn
+}
+
+const selectContentDetail = `
+	SELECT c.id, c.user_id, c.title, COALESCE(c.description, ''), c.type, COALESCE(c.url, ''),
+	       COALESCE(c.category, ''), COALESCE(c.sub_category, ''), COALESCE(c.tags, '[]'),
+	       c.views, c.likes, c.status, c.created_at, c.updated_at,
+	       u.first_name || ' ' || u.last_name as author_name
+	FROM content c
+	JOIN users u ON c.user_id = u.id`
+
+func scanContentDetail(row rowScanner) (*ContentDetail, error) {
+	var d ContentDetail
+	item := &d.Content
+	err := row.Scan(&item.ID, &item.UserID, &item.Title, &item.Description,
+		&item.Type, &item.URL, &item.Category, &item.SubCategory,
+		&item.Tags, &item.Views, &item.Likes, &item.Status,
+		&item.CreatedAt, &item.UpdatedAt, &d.AuthorName)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &d, nil
+}
+
+func (r *sqlContentRepo) List(filter ContentFilter) ([]ContentDetail, error) {
+	query := selectContentDetail + `
+		WHERE (c.user_id = ? OR c.status = 'published')`
+	args := []interface{}{filter.ViewerID}
+
+	if filter.Category != "" {
+		query += " AND c.category = ?"
+		args = append(args, filter.Category)
+	}
+
+	if filter.Status != "" && filter.Status != "all" {
+		query += " AND c.status = ?"
+		args = append(args, filter.Status)
+	}
+
+	query += " ORDER BY c.created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var content []ContentDetail
+	for rows.Next() {
+		d, err := scanContentDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, *d)
+	}
+	return content, rows.Err()
+}
+
+func (r *sqlContentRepo) Get(id int) (*ContentDetail, error) {
+	return scanContentDetail(r.db.QueryRow(selectContentDetail+" WHERE c.id = ?", id))
+}
+
+func (r *sqlContentRepo) Create(userID int, content *models.Content) (int, error) {
+	now := time.Now().UTC()
+	id, err := r.db.InsertID(`
+		INSERT INTO content (user_id, title, description, type, url, category,
+		                    sub_category, tags, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, content.Title, content.Description, content.Type, content.URL, content.Category,
+		content.SubCategory, content.Tags, content.Status, now, now)
+	return int(id), err
+}
+
+func (r *sqlContentRepo) Update(id int, content *models.Content) error {
+	return expectRow(r.db.Exec(`
+		UPDATE content SET title = ?, description = ?, type = ?, url = ?,
+		                  category = ?, sub_category = ?, tags = ?, status = ?, updated_at = ?
+		WHERE id = ?`,
+		content.Title, content.Description, content.Type, content.URL, content.Category,
+		content.SubCategory, content.Tags, content.Status, time.Now().UTC(), id))
+}
+
+func (r *sqlContentRepo) Delete(id int) error {
+	return expectRow(r.db.Exec("DELETE FROM content WHERE id = ?", id))
+}
+
+func (r *sqlContentRepo) IncrementViews(id int) error {
+	_, err := r.db.Exec("UPDATE content SET views = views + 1 WHERE id = ?", id)
+	return err
+}
+
+func (r *sqlContentRepo) Stats(userID int) (int, int, error) {
+	var total, views int
+	err := r.db.QueryRow(`
+		SELECT
+			COUNT(*) as total_content,
+			COALESCE(SUM(views), 0) as total_views
+		FROM content WHERE user_id = ? AND status = 'published'`, userID).Scan(&total, &views)
+	return total, views, err
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// Transaction types recorded against an event
+const (
+	txEventTicket = "event_ticket"
+	txEventRefund = "event_refund"
+	txEventPayout = "event_payout"
+)
+
+// EventPayout is what the organizer of an event that has ended was paid
+type EventPayout struct {
+	EventID     int
+	Title       string
+	OrganizerID int
+	Tickets     int
+	Amount      float64 // after the platform fee
+}
+
+// heldTicket is a ticket whose price is still in escrow
+type heldTicket struct {
+	ID     int
+	UserID int
+	Cents  int64
+	Status string // the holder's RSVP status, empty if they have none
+}
+
+// insertEventTransaction records the visible wallet transaction for an event entry
+func insertEventTransaction(tx *database.Tx, walletID, eventID int, txType string, cents, entryID int64, description string) error {
+	_, err := tx.Exec(`
+		INSERT INTO transactions (wallet_id, event_id, type, amount, description, status, journal_entry_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?)`,
+		walletID, eventID, txType, ledger.FromCents(cents), description, entryID, time.Now().UTC())
+	return err
+}
+
+// buyTicket moves the ticket price of an event from userID's wallet into
+// escrow; having no wallet is the same as having nothing in it
+func buyTicket(tx *database.Tx, event *lockedEvent, userID int) error {
+	wallet, err := lockUserWallet(tx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return ledger.ErrInsufficientFunds
+	}
+	if err != nil {
+		return err
+	}
+
+	cents := ledger.ToCents(event.Price)
+	description := "Ticket for event: " + event.Title
+	entryID, err := ledger.HoldEventFunds(tx, event.ID, wallet, cents, description)
+	if err != nil {
+		return err
+	}
+	if err := insertEventTransaction(tx, wallet, event.ID, txEventTicket, cents, entryID, description); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		INSERT INTO event_tickets (event_id, user_id, price, payment_status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		event.ID, userID, event.Price, models.PaymentHeld, now, now)
+	return err
+}
+
+// heldTickets returns the tickets to an event still held in escrow, only
+// userID's unless it is 0
+func heldTickets(tx *database.Tx, eventID, userID int) ([]heldTicket, error) {
+	query := `
+		SELECT t.id, t.user_id, t.price, COALESCE(a.status, '')
+		FROM event_tickets t
+		LEFT JOIN event_attendees a ON a.event_id = t.event_id AND a.user_id = t.user_id
+		WHERE t.event_id = ? AND t.payment_status = ?`
+	args := []interface{}{eventID, models.PaymentHeld}
+	if userID != 0 {
+		query += " AND t.user_id = ?"
+		args = append(args, userID)
+	}
+
+	rows, err := tx.Query(query+" ORDER BY t.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []heldTicket
+	for rows.Next() {
+		var t heldTicket
+		var price float64
+		if err := rows.Scan(&t.ID, &t.UserID, &price, &t.Status); err != nil {
+			return nil, err
+		}
+		t.Cents = ledger.ToCents(price)
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
+
+// setTicketStatus records where a ticket's money stands
+func setTicketStatus(tx *database.Tx, ticketID int, status string) error {
+	_, err := tx.Exec("UPDATE event_tickets SET payment_status = ?, updated_at = ? WHERE id = ?",
+		status, time.Now().UTC(), ticketID)
+	return err
+}
+
+// settleTicket releases a held ticket: refundCents go back to the holder and
+// the rest, less the platform fee, to the organizer
+func (r *sqlEventRepo) settleTicket(tx *database.Tx, event *lockedEvent, t heldTicket, refundCents int64, description string) error {
+	holderWallet, err := lockUserWallet(tx, t.UserID)
+	if err != nil {
+		return err
+	}
+	organizerWallet, err := lockUserWallet(tx, event.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	s := r.policy.Settle(t.Cents, refundCents)
+	kind := "escrow_release"
+	if s.Refund > 0 {
+		kind = "escrow_refund"
+	}
+	entryID, err := ledger.SettleEventFunds(tx, event.ID, holderWallet, organizerWallet, s, kind, description)
+	if err != nil {
+		return err
+	}
+
+	if s.Refund > 0 {
+		if err := insertEventTransaction(tx, holderWallet, event.ID, txEventRefund, s.Refund, entryID, description); err != nil {
+			return err
+		}
+	}
+	if s.Payout > 0 {
+		if err := insertEventTransaction(tx, organizerWallet, event.ID, txEventPayout, s.Payout, entryID, description); err != nil {
+			return err
+		}
+	}
+
+	status := models.PaymentReleased
+	if s.Refund > 0 {
+		status = models.PaymentRefunded
+	}
+	return setTicketStatus(tx, t.ID, status)
+}
+
+// refundRSVP settles userID's tickets to an event they are cancelling their
+// RSVP to and returns how much was refunded. A waitlisted ticket is always
+// refunded in full; one for a spot follows the same policy as a seeker
+// cancelling a session.
+func (r *sqlEventRepo) refundRSVP(tx *database.Tx, event *lockedEvent, userID int) (int64, error) {
+	tickets, err := heldTickets(tx, event.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var refunded int64
+	for _, t := range tickets {
+		refund := t.Cents
+		if t.Status == models.RSVPGoing {
+			refund = r.policy.SeekerRefund(t.Cents, event.EventDate, time.Now(), false)
+		}
+		if err := r.settleTicket(tx, event, t, refund, "Ticket cancelled for event: "+event.Title); err != nil {
+			return 0, err
+		}
+		refunded += refund
+	}
+	return refunded, nil
+}
+
+// refundTickets refunds every ticket to an event in full
+func (r *sqlEventRepo) refundTickets(tx *database.Tx, event *lockedEvent) error {
+	tickets, err := heldTickets(tx, event.ID, 0)
+	if err != nil {
+		return err
+	}
+	for _, t := range tickets {
+		if err := r.settleTicket(tx, event, t, t.Cents, "Refund for cancelled event: "+event.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlEventRepo) PayOutEnded(now time.Time) ([]EventPayout, error) {
+	rows, err := r.db.Query(`
+		SELECT e.id, e.event_date, COALESCE(e.duration, 60)
+		FROM events e
+		WHERE e.is_active AND e.paid_out_at IS NULL AND e.event_date <= ?
+		  AND EXISTS (SELECT 1 FROM event_tickets t WHERE t.event_id = e.id AND t.payment_status = ?)
+		ORDER BY e.event_date, e.id`, now.UTC(), models.PaymentHeld)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ended []int
+	for rows.Next() {
+		var id, duration int
+		var date time.Time
+		if err := rows.Scan(&id, &date, &duration); err != nil {
+			return nil, err
+		}
+		if !date.Add(time.Duration(duration) * time.Minute).After(now) {
+			ended = append(ended, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var payouts []EventPayout
+	for _, id := range ended {
+		payout, err := r.payOut(id)
+		if err != nil {
+			return payouts, err
+		}
+		if payout != nil {
+			payouts = append(payouts, *payout)
+		}
+	}
+	return payouts, nil
+}
+
+// payOut pays the organizer of an event that has ended for every ticket of
+// someone who was going, in one entry, and refunds anyone left on the
+// waitlist. It returns nil if the event was paid out already.
+func (r *sqlEventRepo) payOut(id int) (*EventPayout, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	event, err := lockEvent(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.PaidOut {
+		return nil, nil
+	}
+
+	tickets, err := heldTickets(tx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := &EventPayout{EventID: id, Title: event.Title, OrganizerID: event.CreatedBy}
+	var held int64
+	for _, t := range tickets {
+		if t.Status != models.RSVPGoing {
+			if err := r.settleTicket(tx, event, t, t.Cents, "Refund for event: "+event.Title); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		held += t.Cents
+		payout.Tickets++
+	}
+
+	if held > 0 {
+		organizerWallet, err := lockUserWallet(tx, event.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		s := r.policy.Settle(held, 0)
+		description := "Payout for event: " + event.Title
+		entryID, err := ledger.SettleEventFunds(tx, id, 0, organizerWallet, s, "escrow_release", description)
+		if err != nil {
+			return nil, err
+		}
+		if s.Payout > 0 {
+			if err := insertEventTransaction(tx, organizerWallet, id, txEventPayout, s.Payout, entryID, description); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`
+			UPDATE event_tickets SET payment_status = ?, updated_at = ?
+			WHERE event_id = ? AND payment_status = ?`,
+			models.PaymentReleased, time.Now().UTC(), id, models.PaymentHeld); err != nil {
+			return nil, err
+		}
+		payout.Amount = ledger.FromCents(s.Payout)
+	}
+
+	if _, err := tx.Exec("UPDATE events SET paid_out_at = ? WHERE id = ?", time.Now().UTC(), id); err != nil {
+		return nil, err
+	}
+	return payout, tx.Commit()
+}
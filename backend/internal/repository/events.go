@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// EventFilter narrows an event listing
+type EventFilter struct {
+	ViewerID    int // fills in the viewer's RSVP to each event
+	OrganizerID int // only events this user organises
+	Category    string
+	From        time.Time // only events starting at or after From
+	Limit       int
+	Offset      int
+}
+
+// EventReminder is a reminder due to one attendee of an event
+type EventReminder struct {
+	EventID   int
+	Title     string
+	EventDate time.Time
+	UserID    int
+	FirstName string
+	Email     string
+}
+
+// EventRepo stores events and RSVPs to them. Capacity is enforced, and the
+// waitlist promoted, under a lock on the event row, so current_attendees
+// never exceeds max_attendees. RSVPs to paid events, waitlisted ones
+// included, buy a ticket whose price is held in escrow until it is refunded
+// or paid out to the organizer.
+type EventRepo interface {
+	// List returns active events, soonest first
+	List(filter EventFilter) ([]models.Event, error)
+	// Get returns an event, cancelled ones included, with the viewer's RSVP
+	Get(id, viewerID int) (*models.Event, error)
+	// Create inserts an event and returns its id
+	Create(event *models.Event) (int, error)
+	// Update replaces the editable fields of an active event and returns the
+	// users promoted from the waitlist if the capacity grew. It fails with
+	// ErrInvalidState if the new capacity is below the attendees already going.
+	Update(id int, event *models.Event) ([]int, error)
+	// Cancel deactivates an event, refunds every ticket in full and returns
+	// everyone who had responded
+	Cancel(id int) ([]int, error)
+	// RSVP signs userID up for an active event, on the waitlist if it is full,
+	// and returns the status they got. It fails with ErrInvalidState if they
+	// have already responded and with ledger.ErrInsufficientFunds if they
+	// cannot pay for a ticket.
+	RSVP(id, userID int) (string, error)
+	// CancelRSVP withdraws userID's RSVP, refunding their ticket under the
+	// cancellation policy, and returns the amount refunded and who was
+	// promoted from the waitlist into the spot freed, if anyone. It fails with
+	// ErrNotFound if they had not responded.
+	CancelRSVP(id, userID int) (float64, []int, error)
+	// Attendees returns everyone going, then the waitlist in order
+	Attendees(id int) ([]models.EventAttendee, error)
+	// DueReminders returns reminders not yet sent to attendees going to
+	// active events that start between now and before
+	DueReminders(now, before time.Time) ([]EventReminder, error)
+	// MarkReminded records that userID was reminded of an event
+	MarkReminded(id, userID int) error
+	// PayOutEnded pays organizers for the tickets to their events that ended
+	// by now, refunds anyone still waitlisted and returns the payouts made
+	PayOutEnded(now time.Time) ([]EventPayout, error)
+}
+
+type sqlEventRepo struct {
+	db     *database.Conn
+	policy ledger.Policy
+}
+
+const selectEvent = `
+	SELECT e.id, e.title, COALESCE(e.description, ''), e.event_date, COALESCE(e.duration, 60),
+	       e.max_attendees, COALESCE(e.current_attendees, 0),
+	       (SELECT COUNT(*) FROM event_attendees w WHERE w.event_id = e.id AND w.status = 'waitlisted'),
+	       COALESCE(e.category, ''), COALESCE(e.price, 0), COALESCE(e.is_active, TRUE), e.created_by,
+	       u.first_name || ' ' || u.last_name, COALESCE(a.status, ''), e.created_at, e.updated_at
+	FROM events e
+	JOIN users u ON u.id = e.created_by
+	LEFT JOIN event_attendees a ON a.event_id = e.id AND a.user_id = ?`
+
+func scanEvent(row rowScanner) (*models.Event, error) {
+	var e models.Event
+	if err := row.Scan(&e.ID, &e.Title, &e.Description, &e.EventDate, &e.Duration,
+		&e.MaxAttendees, &e.CurrentAttendees, &e.Waitlisted, &e.Category, &e.Price, &e.IsActive, &e.CreatedBy,
+		&e.OrganizerName, &e.RSVPStatus, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &e, nil
+}
+
+func (r *sqlEventRepo) List(filter EventFilter) ([]models.Event, error) {
+	query := selectEvent + " WHERE e.is_active AND e.event_date >= ?"
+	args := []interface{}{filter.ViewerID, filter.From.UTC()}
+
+	if filter.OrganizerID != 0 {
+		query += " AND e.created_by = ?"
+		args = append(args, filter.OrganizerID)
+	}
+	if filter.Category != "" {
+		query += " AND e.category = ?"
+		args = append(args, filter.Category)
+	}
+
+	query += " ORDER BY e.event_date, e.id LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	return events, rows.Err()
+}
+
+func (r *sqlEventRepo) Get(id, viewerID int) (*models.Event, error) {
+	return scanEvent(r.db.QueryRow(selectEvent+" WHERE e.id = ?", viewerID, id))
+}
+
+func (r *sqlEventRepo) Create(event *models.Event) (int, error) {
+	now := time.Now().UTC()
+	id, err := r.db.InsertID(`
+		INSERT INTO events (title, description, event_date, duration, max_attendees, current_attendees,
+		                    category, price, is_active, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, TRUE, ?, ?, ?)`,
+		event.Title, event.Description, event.EventDate.UTC(), event.Duration, event.MaxAttendees,
+		event.Category, event.Price, event.CreatedBy, now, now)
+	return int(id), err
+}
+
+// lockedEvent is an event as read under the lock on its row
+type lockedEvent struct {
+	ID        int
+	Title     string
+	EventDate time.Time
+	Price     float64
+	Going     int
+	Capacity  *int // nil for no cap
+	CreatedBy int
+	PaidOut   bool
+}
+
+// lockEvent locks an active event's row inside tx
+func lockEvent(tx *database.Tx, id int) (*lockedEvent, error) {
+	e := lockedEvent{ID: id}
+	var active bool
+	err := tx.QueryRow(`
+		SELECT title, event_date, COALESCE(price, 0), COALESCE(current_attendees, 0), max_attendees,
+		       created_by, paid_out_at IS NOT NULL, COALESCE(is_active, TRUE)
+		FROM events WHERE id = ?`+tx.Dialect.ForUpdate(), id).Scan(
+		&e.Title, &e.EventDate, &e.Price, &e.Going, &e.Capacity, &e.CreatedBy, &e.PaidOut, &active)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if !active {
+		return nil, ErrNotFound
+	}
+	return &e, nil
+}
+
+// promoteWaitlisted moves people from the front of an event's waitlist into
+// the free spots, inside tx, and returns who was promoted
+func promoteWaitlisted(tx *database.Tx, id, going int, capacity *int) ([]int, error) {
+	query := "SELECT user_id FROM event_attendees WHERE event_id = ? AND status = ? ORDER BY id"
+	args := []interface{}{id, models.RSVPWaitlisted}
+	if capacity != nil {
+		free := *capacity - going
+		if free <= 0 {
+			return nil, nil
+		}
+		query += " LIMIT ?"
+		args = append(args, free)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range promoted {
+		if _, err := tx.Exec("UPDATE event_attendees SET status = ? WHERE event_id = ? AND user_id = ?",
+			models.RSVPGoing, id, userID); err != nil {
+			return nil, err
+		}
+	}
+	if len(promoted) > 0 {
+		if _, err := tx.Exec("UPDATE events SET current_attendees = current_attendees + ? WHERE id = ?",
+			len(promoted), id); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+func (r *sqlEventRepo) Update(id int, event *models.Event) ([]int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockEvent(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.MaxAttendees != nil && *event.MaxAttendees < locked.Going {
+		return nil, ErrInvalidState
+	}
+
+	// Moving the event also means reminding everyone again
+	if !locked.EventDate.Equal(event.EventDate) {
+		if _, err := tx.Exec("UPDATE event_attendees SET reminded_at = NULL WHERE event_id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE events SET title = ?, description = ?, event_date = ?, duration = ?, max_attendees = ?,
+		                  category = ?, price = ?, ical_sequence = COALESCE(ical_sequence, 0) + 1, updated_at = ?
+		WHERE id = ?`,
+		event.Title, event.Description, event.EventDate.UTC(), event.Duration, event.MaxAttendees,
+		event.Category, event.Price, time.Now().UTC(), id); err != nil {
+		return nil, err
+	}
+
+	promoted, err := promoteWaitlisted(tx, id, locked.Going, event.MaxAttendees)
+	if err != nil {
+		return nil, err
+	}
+	return promoted, tx.Commit()
+}
+
+func (r *sqlEventRepo) Cancel(id int) ([]int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	event, err := lockEvent(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.refundTickets(tx, event); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE events SET is_active = FALSE, ical_sequence = COALESCE(ical_sequence, 0) + 1, updated_at = ?
+		WHERE id = ?`, time.Now().UTC(), id); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT user_id FROM event_attendees WHERE event_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attendees []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attendees, tx.Commit()
+}
+
+func (r *sqlEventRepo) RSVP(id, userID int) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	event, err := lockEvent(tx, id)
+	if err != nil {
+		return "", err
+	}
+
+	var responded int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM event_attendees WHERE event_id = ? AND user_id = ?",
+		id, userID).Scan(&responded); err != nil {
+		return "", err
+	}
+	if responded > 0 {
+		return "", ErrInvalidState
+	}
+
+	status := models.RSVPGoing
+	if event.Capacity != nil && event.Going >= *event.Capacity {
+		status = models.RSVPWaitlisted
+	}
+	if event.Price > 0 {
+		if err := buyTicket(tx, event, userID); err != nil {
+			return "", err
+		}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO event_attendees (event_id, user_id, status, created_at)
+		VALUES (?, ?, ?, ?)`, id, userID, status, time.Now().UTC()); err != nil {
+		return "", err
+	}
+	if status == models.RSVPGoing {
+		if _, err := tx.Exec("UPDATE events SET current_attendees = current_attendees + 1 WHERE id = ?",
+			id); err != nil {
+			return "", err
+		}
+	}
+	return status, tx.Commit()
+}
+
+func (r *sqlEventRepo) CancelRSVP(id, userID int) (float64, []int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	event, err := lockEvent(tx, id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM event_attendees WHERE event_id = ? AND user_id = ?",
+		id, userID).Scan(&status); err != nil {
+		return 0, nil, notFound(err)
+	}
+	refunded, err := r.refundRSVP(tx, event, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM event_attendees WHERE event_id = ? AND user_id = ?",
+		id, userID); err != nil {
+		return 0, nil, err
+	}
+
+	var promoted []int
+	if status == models.RSVPGoing {
+		if _, err := tx.Exec("UPDATE events SET current_attendees = current_attendees - 1 WHERE id = ?",
+			id); err != nil {
+			return 0, nil, err
+		}
+		if promoted, err = promoteWaitlisted(tx, id, event.Going-1, event.Capacity); err != nil {
+			return 0, nil, err
+		}
+	}
+	return ledger.FromCents(refunded), promoted, tx.Commit()
+}
+
+func (r *sqlEventRepo) Attendees(id int) ([]models.EventAttendee, error) {
+	rows, err := r.db.Query(`
+		SELECT a.user_id, u.first_name || ' ' || u.last_name, u.email, a.status,
+		       COALESCE((SELECT SUM(t.price) FROM event_tickets t
+		                 WHERE t.event_id = a.event_id AND t.user_id = a.user_id AND t.payment_status <> ?), 0),
+		       a.created_at
+		FROM event_attendees a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.event_id = ?
+		ORDER BY CASE WHEN a.status = ? THEN 0 ELSE 1 END, a.id`, models.PaymentRefunded, id, models.RSVPGoing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attendees []models.EventAttendee
+	position := 0
+	for rows.Next() {
+		var a models.EventAttendee
+		if err := rows.Scan(&a.UserID, &a.Name, &a.Email, &a.Status, &a.Paid, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if a.Status == models.RSVPWaitlisted {
+			position++
+			a.Position = position
+		}
+		attendees = append(attendees, a)
+	}
+	return attendees, rows.Err()
+}
+
+func (r *sqlEventRepo) DueReminders(now, before time.Time) ([]EventReminder, error) {
+	rows, err := r.db.Query(`
+		SELECT e.id, e.title, e.event_date, u.id, COALESCE(u.first_name, ''), u.email
+		FROM event_attendees a
+		JOIN events e ON e.id = a.event_id
+		JOIN users u ON u.id = a.user_id
+		WHERE a.status = ? AND a.reminded_at IS NULL AND e.is_active
+		  AND e.event_date > ? AND e.event_date <= ?
+		ORDER BY e.event_date, a.id`, models.RSVPGoing, now.UTC(), before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []EventReminder
+	for rows.Next() {
+		var rm EventReminder
+		if err := rows.Scan(&rm.EventID, &rm.Title, &rm.EventDate, &rm.UserID, &rm.FirstName,
+			&rm.Email); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rm)
+	}
+	return reminders, rows.Err()
+}
+
+func (r *sqlEventRepo) MarkReminded(id, userID int) error {
+	return expectRow(r.db.Exec("UPDATE event_attendees SET reminded_at = ? WHERE event_id = ? AND user_id = ?",
+		time.Now().UTC(), id, userID))
+}
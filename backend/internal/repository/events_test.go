@@ -0,0 +1,248 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestEventRSVPWaitlist(t *testing.T) {
+	repos := newRepos(t)
+	organizer := createUser(t, repos, "organizer@example.com", models.RoleSolver)
+	first := createUser(t, repos, "first@example.com", models.RoleSeeker)
+	second := createUser(t, repos, "second@example.com", models.RoleSeeker)
+	third := createUser(t, repos, "third@example.com", models.RoleSeeker)
+
+	capacity := 1
+	eventID, err := repos.Events.Create(&models.Event{
+		Title:        "Study group",
+		EventDate:    time.Now().Add(72 * time.Hour),
+		Duration:     60,
+		MaxAttendees: &capacity,
+		CreatedBy:    organizer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsvps := []struct {
+		userID int
+		want   string
+		err    error
+	}{
+		{first, models.RSVPGoing, nil},
+		{second, models.RSVPWaitlisted, nil},
+		{third, models.RSVPWaitlisted, nil},
+		{first, "", repository.ErrInvalidState},
+	}
+	for _, r := range rsvps {
+		status, err := repos.Events.RSVP(eventID, r.userID)
+		if status != r.want || !errors.Is(err, r.err) {
+			t.Errorf("RSVP() by user %d = %q, %v, want %q, %v", r.userID, status, err, r.want, r.err)
+		}
+	}
+	event, err := repos.Events.Get(eventID, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.CurrentAttendees != 1 || event.Waitlisted != 2 || event.RSVPStatus != models.RSVPWaitlisted {
+		t.Errorf("event = %d going, %d waitlisted, viewer %q", event.CurrentAttendees, event.Waitlisted, event.RSVPStatus)
+	}
+
+	// Leaving hands the spot to the head of the waitlist
+	_, promoted, err := repos.Events.CancelRSVP(eventID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 1 || promoted[0] != second {
+		t.Errorf("promoted = %v, want [%d]", promoted, second)
+	}
+	if _, _, err := repos.Events.CancelRSVP(eventID, first); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("cancelling twice = %v, want ErrNotFound", err)
+	}
+
+	// Capacity can't drop below who is going, and growing it promotes
+	event.MaxAttendees = new(int)
+	if _, err := repos.Events.Update(eventID, event); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("shrinking below attendance = %v, want ErrInvalidState", err)
+	}
+	*event.MaxAttendees = 2
+	if promoted, err = repos.Events.Update(eventID, event); err != nil || len(promoted) != 1 || promoted[0] != third {
+		t.Errorf("Update() promoted %v, %v, want [%d]", promoted, err, third)
+	}
+
+	attendees, err := repos.Events.Attendees(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attendees) != 2 || attendees[0].UserID != second || attendees[1].UserID != third {
+		t.Errorf("Attendees() = %+v", attendees)
+	}
+
+	// Cancelling the event returns everyone who responded
+	notify, err := repos.Events.Cancel(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notify) != 2 {
+		t.Errorf("Cancel() = %v, want both attendees", notify)
+	}
+	if _, err := repos.Events.RSVP(eventID, first); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("RSVP() to a cancelled event = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEventReminders(t *testing.T) {
+	repos := newRepos(t)
+	organizer := createUser(t, repos, "organizer@example.com", models.RoleSolver)
+	attendee := createUser(t, repos, "attendee@example.com", models.RoleSeeker)
+
+	now := time.Now().UTC()
+	soon, err := repos.Events.Create(&models.Event{Title: "Soon", EventDate: now.Add(time.Hour), Duration: 60, CreatedBy: organizer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := repos.Events.Create(&models.Event{Title: "Later", EventDate: now.Add(48 * time.Hour), Duration: 60, CreatedBy: organizer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{soon, later} {
+		if _, err := repos.Events.RSVP(id, attendee); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := repos.Events.DueReminders(now, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].EventID != soon || due[0].UserID != attendee || due[0].Email != "attendee@example.com" {
+		t.Fatalf("DueReminders() = %+v, want the soon event only", due)
+	}
+	if err := repos.Events.MarkReminded(soon, attendee); err != nil {
+		t.Fatal(err)
+	}
+	if due, err = repos.Events.DueReminders(now, now.Add(24*time.Hour)); err != nil || len(due) != 0 {
+		t.Errorf("DueReminders() after reminding = %+v, %v", due, err)
+	}
+}
+
+func TestEventTicketsWaitlistAndPayout(t *testing.T) {
+	repos := newRepos(t)
+	organizer := createUser(t, repos, "organizer@example.com", models.RoleSolver)
+	first := createUser(t, repos, "first@example.com", models.RoleSeeker)
+	second := createUser(t, repos, "second@example.com", models.RoleSeeker)
+	third := createUser(t, repos, "third@example.com", models.RoleSeeker)
+	broke := createUser(t, repos, "broke@example.com", models.RoleSeeker)
+	for _, id := range []int{first, second, third} {
+		deposit(t, repos, id, 50)
+	}
+
+	capacity := 1
+	start := time.Now().Add(72 * time.Hour)
+	eventID, err := repos.Events.Create(&models.Event{
+		Title:        "Workshop",
+		EventDate:    start,
+		Duration:     60,
+		MaxAttendees: &capacity,
+		Price:        20,
+		CreatedBy:    organizer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsvps := []struct {
+		userID int
+		want   string
+		err    error
+	}{
+		{first, models.RSVPGoing, nil},
+		{second, models.RSVPWaitlisted, nil},
+		{third, models.RSVPWaitlisted, nil},
+		{first, "", repository.ErrInvalidState},
+		{broke, "", ledger.ErrInsufficientFunds},
+	}
+	for _, r := range rsvps {
+		status, err := repos.Events.RSVP(eventID, r.userID)
+		if status != r.want || !errors.Is(err, r.err) {
+			t.Errorf("RSVP() by user %d = %q, %v, want %q, %v", r.userID, status, err, r.want, r.err)
+		}
+	}
+	if got := balance(t, repos, second); got != 30 {
+		t.Errorf("waitlisted balance = %v, want the ticket held", got)
+	}
+
+	// Cancelling well ahead refunds in full and hands the spot on
+	refunded, promoted, err := repos.Events.CancelRSVP(eventID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunded != 20 || len(promoted) != 1 || promoted[0] != second {
+		t.Errorf("CancelRSVP() = %v, %v, want 20 refunded and user %d promoted", refunded, promoted, second)
+	}
+	if _, _, err := repos.Events.CancelRSVP(eventID, first); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("cancelling twice = %v, want ErrNotFound", err)
+	}
+
+	if payouts, err := repos.Events.PayOutEnded(time.Now()); err != nil || len(payouts) != 0 {
+		t.Errorf("PayOutEnded() before the event = %+v, %v", payouts, err)
+	}
+	payouts, err := repos.Events.PayOutEnded(start.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts) != 1 || payouts[0].Tickets != 1 || payouts[0].Amount != 18 {
+		t.Errorf("PayOutEnded() = %+v, want one ticket paid out at 18", payouts)
+	}
+	if again, err := repos.Events.PayOutEnded(start.Add(3 * time.Hour)); err != nil || len(again) != 0 {
+		t.Errorf("paying out twice = %+v, %v", again, err)
+	}
+
+	want := map[int]float64{organizer: 18, first: 50, second: 30, third: 50}
+	for userID, w := range want {
+		if got := balance(t, repos, userID); got != w {
+			t.Errorf("user %d balance = %v, want %v", userID, got, w)
+		}
+	}
+	reconcile(t, repos)
+}
+
+func TestCancelledEventRefundsEveryone(t *testing.T) {
+	repos := newRepos(t)
+	organizer := createUser(t, repos, "organizer@example.com", models.RoleSolver)
+	attendee := createUser(t, repos, "attendee@example.com", models.RoleSeeker)
+	deposit(t, repos, attendee, 20)
+
+	eventID, err := repos.Events.Create(&models.Event{
+		Title:     "Meetup",
+		EventDate: time.Now().Add(2 * time.Hour),
+		Duration:  60,
+		Price:     20,
+		CreatedBy: organizer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Events.RSVP(eventID, attendee); err != nil {
+		t.Fatal(err)
+	}
+
+	notified, err := repos.Events.Cancel(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notified) != 1 || notified[0] != attendee {
+		t.Errorf("Cancel() = %v, want user %d told", notified, attendee)
+	}
+	if got := balance(t, repos, attendee); got != 20 {
+		t.Errorf("attendee balance = %v, want a full refund", got)
+	}
+	if _, err := repos.Events.RSVP(eventID, organizer); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("RSVP() to a cancelled event = %v, want ErrNotFound", err)
+	}
+	reconcile(t, repos)
+}
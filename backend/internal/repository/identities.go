@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// ErrAlreadyLinked is returned when a provider account is already linked to
+// a different user
+var ErrAlreadyLinked = errors.New("identity is linked to another user")
+
+// IdentityRepo stores the external identities users sign in with and the
+// sign-ins in flight with their providers
+type IdentityRepo interface {
+	// SaveState stores a started sign-in under a hash of its state parameter
+	SaveState(stateHash string, state *models.OAuthState) error
+	// ConsumeState returns and deletes a started sign-in with provider,
+	// failing with ErrTokenInvalid if there is none or it has expired
+	ConsumeState(stateHash, provider string) (*models.OAuthState, error)
+	// FindUser returns the user a provider subject is linked to and records
+	// the sign-in
+	FindUser(provider, subject string) (int, error)
+	// Link links an identity to its user. Linking one already linked to the
+	// same user succeeds; it fails with ErrAlreadyLinked if another user has
+	// it, or with ErrInvalidState if the user has a different account at the
+	// same provider.
+	Link(identity *models.UserIdentity) error
+	// CreateUser creates a user, with profile and wallet, already linked to identity
+	CreateUser(user *models.User, identity *models.UserIdentity) (int, error)
+	// List returns a user's linked identities
+	List(userID int) ([]models.UserIdentity, error)
+	// Unlink removes one of a user's identities, or fails with
+	// ErrInvalidState if it is the only way left to sign in
+	Unlink(userID, id int) error
+}
+
+type sqlIdentityRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlIdentityRepo) SaveState(stateHash string, state *models.OAuthState) error {
+	now := time.Now().UTC()
+	// Abandoned sign-ins are cleared out as new ones start
+	if _, err := r.db.Exec("DELETE FROM oauth_states WHERE expires_at < ?", now); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_states (state_hash, provider, code_verifier, nonce, user_id, role,
+		                          expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		stateHash, state.Provider, state.Verifier, state.Nonce, state.UserID, state.Role,
+		state.ExpiresAt.UTC(), now)
+	return err
+}
+
+func (r *sqlIdentityRepo) ConsumeState(stateHash, provider string) (*models.OAuthState, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		state models.OAuthState
+		role  *string
+	)
+	err = tx.QueryRow(`
+		SELECT provider, code_verifier, nonce, user_id, role, expires_at
+		FROM oauth_states WHERE state_hash = ?`+tx.Dialect.ForUpdate(), stateHash).Scan(
+		&state.Provider, &state.Verifier, &state.Nonce, &state.UserID, &role, &state.ExpiresAt)
+	if err := notFound(err); errors.Is(err, ErrNotFound) {
+		return nil, ErrTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if role != nil {
+		state.Role = *role
+	}
+
+	if _, err := tx.Exec("DELETE FROM oauth_states WHERE state_hash = ?", stateHash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if state.Provider != provider || time.Now().After(state.ExpiresAt) {
+		return nil, ErrTokenInvalid
+	}
+	return &state, nil
+}
+
+func (r *sqlIdentityRepo) FindUser(provider, subject string) (int, error) {
+	var id, userID int
+	err := r.db.QueryRow(`
+		SELECT id, user_id FROM user_identities
+		WHERE provider = ? AND subject = ?`, provider, subject).Scan(&id, &userID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+	_, err = r.db.Exec("UPDATE user_identities SET last_login_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return userID, err
+}
+
+func (r *sqlIdentityRepo) Link(identity *models.UserIdentity) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := linkIdentity(tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlIdentityRepo) CreateUser(user *models.User, identity *models.UserIdentity) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := createUser(tx, user)
+	if err != nil {
+		return 0, err
+	}
+	identity.UserID = userID
+	if err := linkIdentity(tx, identity); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// linkIdentity inserts identity inside tx unless it is already there
+func linkIdentity(tx *database.Tx, identity *models.UserIdentity) error {
+	var owner int
+	err := tx.QueryRow(`
+		SELECT user_id FROM user_identities
+		WHERE provider = ? AND subject = ?`, identity.Provider, identity.Subject).Scan(&owner)
+	switch err := notFound(err); {
+	case err == nil && owner == identity.UserID:
+		return nil
+	case err == nil:
+		return ErrAlreadyLinked
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	var others int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM user_identities
+		WHERE user_id = ? AND provider = ?`, identity.UserID, identity.Provider).Scan(&others); err != nil {
+		return err
+	}
+	if others > 0 {
+		return ErrInvalidState
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, now, now)
+	return err
+}
+
+func (r *sqlIdentityRepo) List(userID int) ([]models.UserIdentity, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE user_id = ?
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var i models.UserIdentity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email,
+			&i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (r *sqlIdentityRepo) Unlink(userID, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasPassword bool
+	if err := tx.QueryRow("SELECT password <> '' FROM users WHERE id = ?"+tx.Dialect.ForUpdate(),
+		userID).Scan(&hasPassword); err != nil {
+		return notFound(err)
+	}
+	var others int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM user_identities
+		WHERE user_id = ? AND id <> ?`, userID, id).Scan(&others); err != nil {
+		return err
+	}
+
+	if err := expectRow(tx.Exec(
+		"DELETE FROM user_identities WHERE id = ? AND user_id = ?", id, userID)); err != nil {
+		return err
+	}
+	// Without a password the account needs some identity to sign in with
+	if !hasPassword && others == 0 {
+		return ErrInvalidState
+	}
+	return tx.Commit()
+}
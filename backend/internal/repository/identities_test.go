@@ -0,0 +1,142 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestOAuthStateIsSingleUse(t *testing.T) {
+	repos := newRepos(t)
+	userID := createUser(t, repos, "linker@example.com", models.RoleSeeker)
+
+	err := repos.Identities.SaveState("live", &models.OAuthState{
+		Provider:  "google",
+		Verifier:  "verifier",
+		Nonce:     "nonce",
+		UserID:    &userID,
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repos.Identities.SaveState("stale", &models.OAuthState{
+		Provider:  "google",
+		Verifier:  "verifier",
+		Nonce:     "nonce",
+		Role:      models.RoleSolver,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := repos.Identities.ConsumeState("live", "google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Verifier != "verifier" || state.Nonce != "nonce" || state.UserID == nil || *state.UserID != userID {
+		t.Errorf("ConsumeState() = %+v", state)
+	}
+	if _, err := repos.Identities.ConsumeState("live", "google"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("ConsumeState() twice = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := repos.Identities.ConsumeState("stale", "google"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("ConsumeState() of an expired state = %v, want ErrTokenInvalid", err)
+	}
+
+	// A state presented with the wrong provider is spent all the same
+	err = repos.Identities.SaveState("misdirected", &models.OAuthState{
+		Provider:  "google",
+		Verifier:  "verifier",
+		Nonce:     "nonce",
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Identities.ConsumeState("misdirected", "github"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("ConsumeState() for another provider = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := repos.Identities.ConsumeState("misdirected", "google"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("ConsumeState() after a misdirected one = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	repos := newRepos(t)
+	alice := createUser(t, repos, "alice@example.com", models.RoleSeeker)
+	bob := createUser(t, repos, "bob@example.com", models.RoleSeeker)
+
+	identity := &models.UserIdentity{UserID: alice, Provider: "google", Subject: "g-1", Email: "alice@example.com"}
+	if err := repos.Identities.Link(identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Identities.Link(identity); err != nil {
+		t.Errorf("linking again = %v, want success", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity models.UserIdentity
+		want     error
+	}{
+		{"to another user", models.UserIdentity{UserID: bob, Provider: "google", Subject: "g-1"}, repository.ErrAlreadyLinked},
+		{"second account at a provider", models.UserIdentity{UserID: alice, Provider: "google", Subject: "g-2"}, repository.ErrInvalidState},
+		{"another provider", models.UserIdentity{UserID: alice, Provider: "github", Subject: "1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repos.Identities.Link(&tt.identity); !errors.Is(err, tt.want) {
+				t.Errorf("Link() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	found, err := repos.Identities.FindUser("google", "g-1")
+	if err != nil || found != alice {
+		t.Errorf("FindUser() = %d, %v, want %d", found, err, alice)
+	}
+	if _, err := repos.Identities.FindUser("google", "g-2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("FindUser() of an unlinked subject = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUnlinkKeepsAWayToSignIn(t *testing.T) {
+	repos := newRepos(t)
+	userID, err := repos.Identities.CreateUser(&models.User{
+		Email:     "oauth@example.com",
+		FirstName: "OAuth",
+		Role:      models.RoleSeeker,
+	}, &models.UserIdentity{Provider: "google", Subject: "g-1", Email: "oauth@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Wallets.GetByUserID(userID); err != nil {
+		t.Errorf("account created through a provider has no wallet: %v", err)
+	}
+
+	if err := repos.Identities.Link(&models.UserIdentity{UserID: userID, Provider: "github", Subject: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := repos.Identities.List(userID)
+	if err != nil || len(identities) != 2 {
+		t.Fatalf("List() = %v, %v", identities, err)
+	}
+
+	other := createUser(t, repos, "other@example.com", models.RoleSeeker)
+	if err := repos.Identities.Unlink(other, identities[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Unlink() of someone else's identity = %v, want ErrNotFound", err)
+	}
+	if err := repos.Identities.Unlink(userID, identities[0].ID); err != nil {
+		t.Fatalf("Unlink() with another identity left = %v", err)
+	}
+	if err := repos.Identities.Unlink(userID, identities[1].ID); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("Unlink() of the last way to sign in = %v, want ErrInvalidState", err)
+	}
+	if left, _ := repos.Identities.List(userID); len(left) != 1 {
+		t.Errorf("%d identities left, want the last one kept", len(left))
+	}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+)
+
+// LedgerRepo exposes integrity checks over the double-entry ledger
+type LedgerRepo interface {
+	// Reconcile recomputes every wallet balance from the ledger
+	Reconcile() (*ledger.Report, error)
+}
+
+type sqlLedgerRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlLedgerRepo) Reconcile() (*ledger.Report, error) {
+	return ledger.Reconcile(r.db)
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// LoginAttemptFilter narrows the login attempt audit; empty fields match all
+type LoginAttemptFilter struct {
+	UserID     int
+	Email      string
+	IPAddress  string
+	FailedOnly bool
+}
+
+// LoginAttemptRepo audits sign-in attempts
+type LoginAttemptRepo interface {
+	// Record stores one attempt
+	Record(attempt *models.LoginAttempt) error
+	// FailuresFromIP counts the wrong passwords given from ip since since and
+	// returns when the latest of them was
+	FailuresFromIP(ip string, since time.Time) (int, *time.Time, error)
+	// List returns the attempts matching filter, newest first
+	List(filter LoginAttemptFilter, limit, offset int) ([]models.LoginAttempt, error)
+}
+
+type sqlLoginAttemptRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlLoginAttemptRepo) Record(attempt *models.LoginAttempt) error {
+	_, err := r.db.Exec(`
+		INSERT INTO login_attempts (user_id, email, ip_address, user_agent, result, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		attempt.UserID, attempt.Email, attempt.IPAddress, attempt.UserAgent, attempt.Result,
+		time.Now().UTC())
+	return err
+}
+
+func (r *sqlLoginAttemptRepo) FailuresFromIP(ip string, since time.Time) (int, *time.Time, error) {
+	const failures = `
+		FROM login_attempts
+		WHERE ip_address = ? AND result = ? AND created_at > ?`
+	args := []interface{}{ip, models.LoginInvalidCredentials, since.UTC()}
+
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+failures, args...).Scan(&count); err != nil {
+		return 0, nil, err
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+
+	// MAX() would lose the column type under SQLite, so read the newest row
+	var latest time.Time
+	err := r.db.QueryRow("SELECT created_at"+failures+" ORDER BY created_at DESC LIMIT 1",
+		args...).Scan(&latest)
+	return count, &latest, err
+}
+
+func (r *sqlLoginAttemptRepo) List(filter LoginAttemptFilter, limit, offset int) ([]models.LoginAttempt, error) {
+	query := `
+		SELECT id, user_id, email, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+		       result, created_at
+		FROM login_attempts
+		WHERE 1 = 1`
+	var args []interface{}
+	if filter.UserID != 0 {
+		query += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Email != "" {
+		query += " AND email = ?"
+		args = append(args, filter.Email)
+	}
+	if filter.IPAddress != "" {
+		query += " AND ip_address = ?"
+		args = append(args, filter.IPAddress)
+	}
+	if filter.FailedOnly {
+		query += " AND result NOT IN (?, ?)"
+		args = append(args, models.LoginSucceeded, models.LoginTwoFactorPending)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.LoginAttempt
+	for rows.Next() {
+		var a models.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Email, &a.IPAddress, &a.UserAgent,
+			&a.Result, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
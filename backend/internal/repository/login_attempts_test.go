@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestLoginAttemptAudit(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	record := func(userID *int, email, ip, result string) {
+		t.Helper()
+		if err := repos.LoginAttempts.Record(&models.LoginAttempt{
+			UserID: userID, Email: email, IPAddress: ip, Result: result,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := time.Now().Add(-time.Minute)
+
+	record(&user, "seeker@example.com", "10.0.0.1", models.LoginInvalidCredentials)
+	record(nil, "nobody@example.com", "10.0.0.1", models.LoginInvalidCredentials)
+	record(&user, "seeker@example.com", "10.0.0.1", models.LoginSucceeded)
+	record(&user, "seeker@example.com", "10.0.0.2", models.LoginInvalidCredentials)
+
+	failures, latest, err := repos.LoginAttempts.FailuresFromIP("10.0.0.1", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 2 || latest == nil {
+		t.Errorf("FailuresFromIP() = %d, %v, want 2 wrong passwords", failures, latest)
+	}
+	if failures, latest, err := repos.LoginAttempts.FailuresFromIP("10.0.0.9", since); err != nil || failures != 0 || latest != nil {
+		t.Errorf("FailuresFromIP() for a quiet address = %d, %v, %v", failures, latest, err)
+	}
+	if failures, _, err := repos.LoginAttempts.FailuresFromIP("10.0.0.1", time.Now().Add(time.Minute)); err != nil || failures != 0 {
+		t.Errorf("FailuresFromIP() after the window = %d, %v", failures, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter repository.LoginAttemptFilter
+		want   int
+	}{
+		{"all", repository.LoginAttemptFilter{}, 4},
+		{"by user", repository.LoginAttemptFilter{UserID: user}, 3},
+		{"by email", repository.LoginAttemptFilter{Email: "nobody@example.com"}, 1},
+		{"by address", repository.LoginAttemptFilter{IPAddress: "10.0.0.2"}, 1},
+		{"failed only", repository.LoginAttemptFilter{UserID: user, FailedOnly: true}, 2},
+	}
+	for _, tt := range tests {
+		attempts, err := repos.LoginAttempts.List(tt.filter, 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts) != tt.want {
+			t.Errorf("%s: got %d attempts, want %d", tt.name, len(attempts), tt.want)
+		}
+	}
+}
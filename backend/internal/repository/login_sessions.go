@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// lastSeenInterval throttles how often a login session's last_seen_at is written
+const lastSeenInterval = time.Minute
+
+// LoginSessionRepo stores the devices users are signed in on
+type LoginSessionRepo interface {
+	// Create records a new login whose refresh tokens form familyID
+	Create(session *models.LoginSession, familyID string) (int, error)
+	// ForFamily returns the login session a refresh token family belongs to
+	ForFamily(familyID string) (*models.LoginSession, error)
+	// Validate checks that a login session of userID is live and its user
+	// active, returning ErrTokenInvalid otherwise, and records the activity
+	Validate(id, userID int, ip string) error
+	// List returns a user's live login sessions, most recently seen first
+	List(userID int) ([]models.LoginSession, error)
+	// Revoke signs one of a user's login sessions out
+	Revoke(userID, id int) error
+	// RevokeAll signs out every login session of a user except exceptID and
+	// returns how many were revoked
+	RevokeAll(userID, exceptID int) (int, error)
+}
+
+type sqlLoginSessionRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlLoginSessionRepo) Create(session *models.LoginSession, familyID string) (int, error) {
+	now := time.Now().UTC()
+	id, err := r.db.InsertID(`
+		INSERT INTO login_sessions (user_id, family_id, device, user_agent, ip_address,
+		                            two_factor, created_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, familyID, session.Device, session.UserAgent, session.IPAddress,
+		session.TwoFactor, now, now)
+	return int(id), err
+}
+
+func (r *sqlLoginSessionRepo) ForFamily(familyID string) (*models.LoginSession, error) {
+	var s models.LoginSession
+	err := r.db.QueryRow(`
+		SELECT id, user_id, COALESCE(two_factor, FALSE)
+		FROM login_sessions WHERE family_id = ?`, familyID).Scan(&s.ID, &s.UserID, &s.TwoFactor)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+func (r *sqlLoginSessionRepo) Validate(id, userID int, ip string) error {
+	var (
+		lastSeen time.Time
+		revoked  *time.Time
+		active   bool
+	)
+	err := r.db.QueryRow(`
+		SELECT l.last_seen_at, l.revoked_at, COALESCE(u.is_active, TRUE)
+		FROM login_sessions l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.id = ? AND l.user_id = ?`, id, userID).Scan(&lastSeen, &revoked, &active)
+	if err := notFound(err); errors.Is(err, ErrNotFound) {
+		return ErrTokenInvalid
+	} else if err != nil {
+		return err
+	}
+	if revoked != nil || !active {
+		return ErrTokenInvalid
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(lastSeen) < lastSeenInterval {
+		return nil
+	}
+	_, err = r.db.Exec("UPDATE login_sessions SET last_seen_at = ?, ip_address = ? WHERE id = ?",
+		now, ip, id)
+	return err
+}
+
+func (r *sqlLoginSessionRepo) List(userID int) ([]models.LoginSession, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, COALESCE(device, ''), COALESCE(user_agent, ''),
+		       COALESCE(ip_address, ''), COALESCE(two_factor, FALSE), created_at, last_seen_at
+		FROM login_sessions
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.LoginSession
+	for rows.Next() {
+		var s models.LoginSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Device, &s.UserAgent, &s.IPAddress,
+			&s.TwoFactor, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlLoginSessionRepo) Revoke(userID, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	err = tx.QueryRow(`
+		SELECT family_id FROM login_sessions
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, id, userID).Scan(&familyID)
+	if err != nil {
+		return notFound(err)
+	}
+	if err := revokeFamily(tx, familyID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlLoginSessionRepo) RevokeAll(userID, exceptID int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := revokeUserLogins(tx, userID, exceptID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// revokeUserLogins revokes a user's login sessions other than exceptID,
+// together with their refresh tokens
+func revokeUserLogins(tx *database.Tx, userID, exceptID int, at time.Time) (int, error) {
+	if _, err := tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE revoked_at IS NULL AND family_id IN (
+			SELECT family_id FROM login_sessions WHERE user_id = ? AND id <> ?)`,
+		at, userID, exceptID); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		UPDATE login_sessions SET revoked_at = ?
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`, at, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
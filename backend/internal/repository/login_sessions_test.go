@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// signIn opens a login session for userID backed by a refresh token
+// named after familyID
+func signIn(t *testing.T, repos *repository.Repositories, userID int, familyID string) int {
+	t.Helper()
+	if err := repos.Tokens.IssueRefresh(userID, familyID, familyID+"-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	id, err := repos.Logins.Create(&models.LoginSession{UserID: userID, Device: familyID}, familyID)
+	if err != nil {
+		t.Fatalf("sign in on %s: %v", familyID, err)
+	}
+	return id
+}
+
+func TestLoginSessionRevocation(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	other := createUser(t, repos, "other@example.com", "seeker")
+	laptop := signIn(t, repos, user, "laptop")
+	phone := signIn(t, repos, user, "phone")
+	tablet := signIn(t, repos, user, "tablet")
+
+	if got, err := repos.Logins.ForFamily("phone"); err != nil || got.ID != phone {
+		t.Fatalf("ForFamily(phone) = %+v, %v, want %d", got, err, phone)
+	}
+	if err := repos.Logins.Validate(laptop, user, "10.0.0.1"); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if err := repos.Logins.Validate(laptop, other, "10.0.0.1"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("validating someone else's session = %v, want ErrTokenInvalid", err)
+	}
+
+	// Another user can't sign a session out
+	if err := repos.Logins.Revoke(other, phone); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("revoking someone else's session = %v, want ErrNotFound", err)
+	}
+	if err := repos.Logins.Revoke(user, phone); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Logins.Validate(phone, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("validating a revoked session = %v, want ErrTokenInvalid", err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("phone-token", "next", time.Now().Add(time.Hour)); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("refreshing a revoked session = %v, want ErrTokenInvalid", err)
+	}
+
+	if n, err := repos.Logins.RevokeAll(user, laptop); err != nil || n != 1 {
+		t.Fatalf("RevokeAll() = %d, %v, want tablet only", n, err)
+	}
+	sessions, err := repos.Logins.List(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != laptop {
+		t.Errorf("List() = %+v, want only the laptop", sessions)
+	}
+	if err := repos.Logins.Validate(tablet, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("validating a signed-out session = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestRefreshReuseRevokesLoginSession(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	login := signIn(t, repos, user, "laptop")
+	expires := time.Now().Add(time.Hour)
+
+	if _, _, err := repos.Tokens.RotateRefresh("laptop-token", "second", expires); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("laptop-token", "stolen", expires); !errors.Is(err, repository.ErrTokenReused) {
+		t.Fatalf("replaying a used token = %v, want ErrTokenReused", err)
+	}
+	if err := repos.Logins.Validate(login, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("the login after a replay = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestDeactivationEndsLoginSessions(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	login := signIn(t, repos, user, "laptop")
+
+	if err := repos.Users.SetActive(user, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Logins.Validate(login, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("validating a deactivated user's session = %v, want ErrTokenInvalid", err)
+	}
+}
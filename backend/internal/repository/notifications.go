@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// NotificationRepo stores in-app notifications
+type NotificationRepo interface {
+	// ListForUser returns a user's notifications, newest first
+	ListForUser(userID, limit int) ([]models.Notification, error)
+	// Create adds a notification for a user
+	Create(userID int, title, message, notificationType string) error
+	// MarkRead flags a user's notification as read
+	MarkRead(id, userID int) error
+	// Delete removes a user's notification
+	Delete(id, userID int) error
+}
+
+type sqlNotificationRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlNotificationRepo) ListForUser(userID, limit int) ([]models.Notification, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, title, message, type, is_read, created_at
+		FROM notifications WHERE user_id = ?
+		ORDER BY created_at DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var notification models.Notification
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Title,
+			&notification.Message, &notification.Type, &notification.IsRead, &notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *sqlNotificationRepo) Create(userID int, title, message, notificationType string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notifications (user_id, title, message, type, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, title, message, notificationType, time.Now().UTC())
+	return err
+}
+
+func (r *sqlNotificationRepo) MarkRead(id, userID int) error {
+	_, err := r.db.Exec("UPDATE notifications SET is_read = true WHERE id = ? AND user_id = ?",
+		id, userID)
+	return err
+}
+
+func (r *sqlNotificationRepo) Delete(id, userID int) error {
+	_, err := r.db.Exec("DELETE FROM notifications WHERE id = ? AND user_id = ?",
+		id, userID)
+	return err
+}
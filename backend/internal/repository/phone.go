@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"crypto/subtle"
+	"errors"
+	"synapmentor/internal/database"
+	"time"
+)
+
+// PhoneLimits bounds how one-time codes are sent and tried
+type PhoneLimits struct {
+	Interval    time.Duration // least time between two codes
+	MaxPerHour  int           // codes sent to a user in an hour
+	MaxAttempts int           // wrong guesses before a code is void
+}
+
+// PhoneRepo stores the one-time codes that verify users' phone numbers
+type PhoneRepo interface {
+	// Start stores the hash of a code sent to phone, replacing any earlier
+	// code. It fails with ErrRateLimited when the limits do not allow another
+	// code yet, or with ErrInvalidState if another account has verified phone.
+	Start(userID int, phone, codeHash string, expiresAt time.Time, limits PhoneLimits) error
+	// Verify checks a code. On a match the pending number becomes the user's
+	// verified phone, the verification level is recomputed and the number is
+	// returned. It fails with ErrNotFound when no code is pending or it has
+	// expired, ErrTokenInvalid for a wrong code, ErrRateLimited once the code
+	// has had too many wrong guesses, and ErrInvalidState if another account
+	// verified the number meanwhile.
+	Verify(userID int, codeHash string, limits PhoneLimits) (string, error)
+}
+
+type sqlPhoneRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlPhoneRepo) Start(userID int, phone, codeHash string, expiresAt time.Time, limits PhoneLimits) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := phoneTaken(tx, userID, phone); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var (
+		sentAt, windowStart time.Time
+		sends               int
+	)
+	err = tx.QueryRow(`
+		SELECT sent_at, window_started_at, sends_in_window
+		FROM phone_verifications WHERE user_id = ?`+tx.Dialect.ForUpdate(), userID).Scan(
+		&sentAt, &windowStart, &sends)
+	switch err := notFound(err); {
+	case errors.Is(err, ErrNotFound):
+		_, err = tx.Exec(`
+			INSERT INTO phone_verifications (user_id, phone, code_hash, expires_at, sent_at,
+			                                 window_started_at, sends_in_window)
+			VALUES (?, ?, ?, ?, ?, ?, 1)`,
+			userID, phone, codeHash, expiresAt.UTC(), now, now)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if now.Sub(sentAt) < limits.Interval {
+			return ErrRateLimited
+		}
+		if now.Sub(windowStart) >= time.Hour {
+			windowStart, sends = now, 0
+		}
+		if sends >= limits.MaxPerHour {
+			return ErrRateLimited
+		}
+		if _, err := tx.Exec(`
+			UPDATE phone_verifications
+			SET phone = ?, code_hash = ?, attempts = 0, expires_at = ?, sent_at = ?,
+			    window_started_at = ?, sends_in_window = ?
+			WHERE user_id = ?`,
+			phone, codeHash, expiresAt.UTC(), now, windowStart, sends+1, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlPhoneRepo) Verify(userID int, codeHash string, limits PhoneLimits) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		phone, stored string
+		attempts      int
+		expiresAt     time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT phone, code_hash, attempts, expires_at
+		FROM phone_verifications WHERE user_id = ?`+tx.Dialect.ForUpdate(), userID).Scan(
+		&phone, &stored, &attempts, &expiresAt)
+	if err != nil {
+		return "", notFound(err)
+	}
+	if !time.Now().Before(expiresAt) {
+		return "", ErrNotFound
+	}
+	if attempts >= limits.MaxAttempts {
+		return "", ErrRateLimited
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(codeHash)) != 1 {
+		if _, err := tx.Exec("UPDATE phone_verifications SET attempts = attempts + 1 WHERE user_id = ?",
+			userID); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		return "", ErrTokenInvalid
+	}
+
+	if err := phoneTaken(tx, userID, phone); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		UPDATE users SET phone = ?, is_phone_verified = TRUE, updated_at = ?
+		WHERE id = ?`, phone, time.Now().UTC(), userID); err != nil {
+		return "", err
+	}
+	if err := refreshVerificationLevel(tx, userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("DELETE FROM phone_verifications WHERE user_id = ?", userID); err != nil {
+		return "", err
+	}
+	return phone, tx.Commit()
+}
+
+// phoneTaken fails with ErrInvalidState if an account other than userID has
+// verified phone
+func phoneTaken(tx *database.Tx, userID int, phone string) error {
+	var taken int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM users
+		WHERE phone = ? AND is_phone_verified AND id <> ?`, phone, userID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrInvalidState
+	}
+	return nil
+}
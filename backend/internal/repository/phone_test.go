@@ -0,0 +1,129 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// testPhoneLimits allow a code at any time but only three wrong guesses
+var testPhoneLimits = repository.PhoneLimits{MaxPerHour: 5, MaxAttempts: 3}
+
+// verifyPhone gives userID a verified phone number
+func verifyPhone(t *testing.T, repos *repository.Repositories, userID int, phone string) {
+	t.Helper()
+	if err := repos.Phones.Start(userID, phone, "code", time.Now().Add(time.Hour), testPhoneLimits); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Phones.Verify(userID, "code", testPhoneLimits); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPhoneVerification(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+
+	if _, err := repos.Phones.Verify(user, "code", testPhoneLimits); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("verifying with no code pending = %v, want ErrNotFound", err)
+	}
+	if err := repos.Phones.Start(user, "+14155550123", "code", time.Now().Add(time.Hour), testPhoneLimits); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Phones.Verify(user, "wrong", testPhoneLimits); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("a wrong code = %v, want ErrTokenInvalid", err)
+	}
+	// A verified email on top of the phone is what earns standard
+	if err := repos.Users.MarkEmailVerified(user, "seeker@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	phone, err := repos.Phones.Verify(user, "code", testPhoneLimits)
+	if err != nil || phone != "+14155550123" {
+		t.Fatalf("Verify() = %q, %v", phone, err)
+	}
+
+	got, err := repos.Users.GetByID(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Phone != phone || !got.IsPhoneVerified || got.VerificationLevel != models.VerificationStandard {
+		t.Errorf("user = phone %v verified %v level %s, want a verified number at standard",
+			got.Phone, got.IsPhoneVerified, got.VerificationLevel)
+	}
+	if _, err := repos.Phones.Verify(user, "code", testPhoneLimits); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("reusing the code = %v, want ErrNotFound", err)
+	}
+
+	// Changing the number undoes the verification and the level it earned
+	got.Phone = "+14155550199"
+	if err := repos.Users.UpdateProfile(user, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = repos.Users.GetByID(user); err != nil {
+		t.Fatal(err)
+	}
+	if got.IsPhoneVerified || got.VerificationLevel != models.VerificationLight {
+		t.Errorf("after a new number: verified %v level %s, want unverified at light",
+			got.IsPhoneVerified, got.VerificationLevel)
+	}
+}
+
+func TestPhoneCodeLimits(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+	expires := time.Now().Add(time.Hour)
+
+	throttled := repository.PhoneLimits{Interval: time.Hour, MaxPerHour: 5, MaxAttempts: 3}
+	if err := repos.Phones.Start(user, "+14155550123", "first", expires, throttled); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Phones.Start(user, "+14155550123", "second", expires, throttled); !errors.Is(err, repository.ErrRateLimited) {
+		t.Errorf("a second code within the interval = %v, want ErrRateLimited", err)
+	}
+
+	for i := 0; i < testPhoneLimits.MaxAttempts; i++ {
+		if _, err := repos.Phones.Verify(user, "wrong", testPhoneLimits); !errors.Is(err, repository.ErrTokenInvalid) {
+			t.Fatalf("guess %d = %v, want ErrTokenInvalid", i+1, err)
+		}
+	}
+	if _, err := repos.Phones.Verify(user, "first", testPhoneLimits); !errors.Is(err, repository.ErrRateLimited) {
+		t.Errorf("the right code after too many guesses = %v, want ErrRateLimited", err)
+	}
+
+	hourly := repository.PhoneLimits{MaxPerHour: 1, MaxAttempts: 3}
+	if err := repos.Phones.Start(user, "+14155550123", "third", expires, hourly); !errors.Is(err, repository.ErrRateLimited) {
+		t.Errorf("a code over the hourly limit = %v, want ErrRateLimited", err)
+	}
+
+	expiredUser := createUser(t, repos, "other@example.com", models.RoleSeeker)
+	if err := repos.Phones.Start(expiredUser, "+14155550124", "code", time.Now().Add(-time.Minute), testPhoneLimits); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Phones.Verify(expiredUser, "code", testPhoneLimits); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("an expired code = %v, want ErrNotFound", err)
+	}
+}
+
+func TestVerifiedPhoneBelongsToOneAccount(t *testing.T) {
+	repos := newRepos(t)
+	first := createUser(t, repos, "first@example.com", models.RoleSeeker)
+	second := createUser(t, repos, "second@example.com", models.RoleSeeker)
+
+	// Both start before either verifies; the second to finish loses
+	for _, user := range []int{first, second} {
+		if err := repos.Phones.Start(user, "+14155550123", "code", time.Now().Add(time.Hour), testPhoneLimits); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repos.Phones.Verify(first, "code", testPhoneLimits); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Phones.Verify(second, "code", testPhoneLimits); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("verifying a number already verified = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Phones.Start(second, "+14155550123", "code", time.Now().Add(time.Hour), testPhoneLimits); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("starting on a verified number = %v, want ErrInvalidState", err)
+	}
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+)
+
+var (
+	// ErrNotFound is returned when a lookup matches no row
+	ErrNotFound = errors.New("record not found")
+	// ErrInvalidState is returned when a record cannot make the requested change
+	// from its current state
+	ErrInvalidState = errors.New("invalid state for this operation")
+	// ErrRateLimited is returned when an action is repeated sooner than allowed
+	ErrRateLimited = errors.New("too many requests")
+)
+
+// Repositories groups every repository the HTTP layer depends on
+type Repositories struct {
+	Users         UserRepo
+	Sessions      SessionRepo
+	Content       ContentRepo
+	Wallets       WalletRepo
+	Notifications NotificationRepo
+	Ledger        LedgerRepo
+	Availability  AvailabilityRepo
+	Calendar      CalendarRepo
+	Tokens        TokenRepo
+	Logins        LoginSessionRepo
+	TwoFactor     TwoFactorRepo
+	LoginAttempts LoginAttemptRepo
+	Identities    IdentityRepo
+	Roles         RoleRepo
+	APIKeys       APIKeyRepo
+	Phones        PhoneRepo
+	IDDocuments   IDDocumentRepo
+	Communities   CommunityRepo
+	Discussions   DiscussionRepo
+	Events        EventRepo
+}
+
+// New builds the SQL-backed repositories on top of a database connection;
+// policy governs how escrowed session and ticket payments are settled
+func New(db *database.Conn, policy ledger.Policy) *Repositories {
+	return &Repositories{
+		Users:         &sqlUserRepo{db: db},
+		Sessions:      &sqlSessionRepo{db: db, policy: policy},
+		Content:       &sqlContentRepo{db: db},
+		Wallets:       &sqlWalletRepo{db: db},
+		Notifications: &sqlNotificationRepo{db: db},
+		Ledger:        &sqlLedgerRepo{db: db},
+		Availability:  &sqlAvailabilityRepo{db: db},
+		Calendar:      &sqlCalendarRepo{db: db},
+		Tokens:        &sqlTokenRepo{db: db},
+		Logins:        &sqlLoginSessionRepo{db: db},
+		TwoFactor:     &sqlTwoFactorRepo{db: db},
+		LoginAttempts: &sqlLoginAttemptRepo{db: db},
+		Identities:    &sqlIdentityRepo{db: db},
+		Roles:         &sqlRoleRepo{db: db},
+		APIKeys:       &sqlAPIKeyRepo{db: db},
+		Phones:        &sqlPhoneRepo{db: db},
+		IDDocuments:   &sqlIDDocumentRepo{db: db},
+		Communities:   &sqlCommunityRepo{db: db},
+		Discussions:   &sqlDiscussionRepo{db: db},
+		Events:        &sqlEventRepo{db: db, policy: policy},
+	}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// querier is satisfied by both *database.Conn and *database.Tx, for reads
+// that run either on their own or inside a larger transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// notFound maps sql.ErrNoRows onto ErrNotFound and passes other errors through
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// expectRow returns ErrNotFound when a write statement touched no rows
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
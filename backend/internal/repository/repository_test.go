@@ -0,0 +1,69 @@
+package repository_test
+
+import (
+	"synapmentor/internal/database/dbtest"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// testPolicy keeps 10% of payouts and refunds half of a late cancellation
+var testPolicy = ledger.Policy{
+	PlatformFeePercent: 10,
+	FullRefundWindow:   24 * time.Hour,
+	LateRefundPercent:  50,
+}
+
+// newRepos returns repositories over a freshly migrated database
+func newRepos(t *testing.T) *repository.Repositories {
+	t.Helper()
+	return repository.New(dbtest.Open(t), testPolicy)
+}
+
+// createUser registers a user holding role, with an empty wallet
+func createUser(t *testing.T, repos *repository.Repositories, email, role string) int {
+	t.Helper()
+	id, err := repos.Users.Create(&models.User{
+		Email:     email,
+		Password:  "hash",
+		FirstName: "Test",
+		LastName:  role,
+		Role:      role,
+	})
+	if err != nil {
+		t.Fatalf("create %s: %v", email, err)
+	}
+	return id
+}
+
+// deposit pays amount into a user's wallet
+func deposit(t *testing.T, repos *repository.Repositories, userID int, amount float64) {
+	t.Helper()
+	if _, err := repos.Wallets.Transfer(userID, "deposit", amount, "Test deposit"); err != nil {
+		t.Fatalf("deposit for user %d: %v", userID, err)
+	}
+}
+
+// balance returns what is in a user's wallet
+func balance(t *testing.T, repos *repository.Repositories, userID int) float64 {
+	t.Helper()
+	wallet, err := repos.Wallets.GetByUserID(userID)
+	if err != nil {
+		t.Fatalf("wallet of user %d: %v", userID, err)
+	}
+	return wallet.Balance
+}
+
+// reconcile fails the test unless every wallet agrees with the ledger
+func reconcile(t *testing.T, repos *repository.Repositories) {
+	t.Helper()
+	report, err := repos.Ledger.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK {
+		t.Errorf("ledger does not reconcile: %+v", report)
+	}
+}
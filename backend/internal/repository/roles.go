@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// RoleRepo stores roles, the permissions they grant and the roles users hold
+type RoleRepo interface {
+	// List returns every role with its permissions
+	List() ([]models.Role, error)
+	// Permissions returns everything a user's roles allow
+	Permissions(userID int) ([]string, error)
+	// IsStaff reports whether a user holds a staff role
+	IsStaff(userID int) (bool, error)
+	// Grant gives a user a role; granting one already held succeeds.
+	// grantedBy is nil when users add a role themselves.
+	Grant(userID int, role string, grantedBy *int) error
+	// Revoke takes a role from a user. It fails with ErrInvalidState for the
+	// user's primary role, or when it would leave no one able to manage roles.
+	Revoke(userID int, role string) error
+}
+
+type sqlRoleRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlRoleRepo) List() ([]models.Role, error) {
+	rows, err := r.db.Query(`
+		SELECT name, COALESCE(description, ''), staff, created_at
+		FROM roles ORDER BY staff, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	index := map[string]int{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.Staff, &role.CreatedAt); err != nil {
+			return nil, err
+		}
+		role.Permissions = []string{}
+		index[role.Name] = len(roles)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.Query("SELECT role, permission FROM role_permissions ORDER BY permission")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		if i, ok := index[role]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, permission)
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (r *sqlRoleRepo) Permissions(userID int) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role = ur.role
+		WHERE ur.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (r *sqlRoleRepo) IsStaff(userID int) (bool, error) {
+	var staff bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM user_roles ur
+		               JOIN roles ro ON ro.name = ur.role
+		               WHERE ur.user_id = ? AND ro.staff)`, userID).Scan(&staff)
+	return staff, err
+}
+
+func (r *sqlRoleRepo) Grant(userID int, role string, grantedBy *int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM roles WHERE name = ?)
+		   AND EXISTS (SELECT 1 FROM users WHERE id = ?)`, role, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	var held int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM user_roles WHERE user_id = ? AND role = ?",
+		userID, role).Scan(&held); err != nil {
+		return err
+	}
+	if held > 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_roles (user_id, role, granted_by, created_at)
+		VALUES (?, ?, ?, ?)`, userID, role, grantedBy, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRoleRepo) Revoke(userID int, role string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var primary string
+	if err := tx.QueryRow("SELECT role FROM users WHERE id = ?"+tx.Dialect.ForUpdate(),
+		userID).Scan(&primary); err != nil {
+		return notFound(err)
+	}
+	if role == primary {
+		return ErrInvalidState
+	}
+
+	if err := expectRow(tx.Exec(
+		"DELETE FROM user_roles WHERE user_id = ? AND role = ?", userID, role)); err != nil {
+		return err
+	}
+
+	// Someone must be left who can hand roles out again
+	var managers int
+	if err := tx.QueryRow(`
+		SELECT COUNT(DISTINCT ur.user_id)
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role = ur.role
+		WHERE rp.permission = ?`, models.PermRolesManage).Scan(&managers); err != nil {
+		return err
+	}
+	if managers == 0 {
+		return ErrInvalidState
+	}
+	return tx.Commit()
+}
+
+// userRoles loads the names of the roles a user holds
+func userRoles(q querier, userID int) ([]string, error) {
+	rows, err := q.Query("SELECT role FROM user_roles WHERE user_id = ? ORDER BY role", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"errors"
+	"sort"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	repos := newRepos(t)
+	seeker := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+	admin := createUser(t, repos, "admin@example.com", models.RoleAdmin)
+
+	user, err := repos.Users.GetByID(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Roles) != 1 || !user.HasRole(models.RoleSeeker) {
+		t.Errorf("Roles = %v, want the primary role only", user.Roles)
+	}
+	if permissions, err := repos.Roles.Permissions(seeker); err != nil || len(permissions) != 0 {
+		t.Errorf("seeker permissions = %v, %v, want none", permissions, err)
+	}
+	if staff, err := repos.Roles.IsStaff(seeker); err != nil || staff {
+		t.Errorf("IsStaff(seeker) = %v, %v", staff, err)
+	}
+
+	// A second marketplace role and a staff role add up
+	for _, role := range []string{models.RoleSolver, models.RoleSupport, models.RoleSupport} {
+		if err := repos.Roles.Grant(seeker, role, &admin); err != nil {
+			t.Fatalf("Grant(%s): %v", role, err)
+		}
+	}
+	user, err = repos.Users.GetByID(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"seeker", "solver", "support"}; !equalSorted(user.Roles, want) {
+		t.Errorf("Roles = %v, want %v", user.Roles, want)
+	}
+	permissions, err := repos.Roles.Permissions(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{models.PermIdentityReview, models.PermLoginAttemptsRead, models.PermSessionsReadAny, models.PermUsersRead, models.PermUsersUnlock}; !equalSorted(permissions, want) {
+		t.Errorf("Permissions() = %v, want %v", permissions, want)
+	}
+	if staff, err := repos.Roles.IsStaff(seeker); err != nil || !staff {
+		t.Errorf("IsStaff(support) = %v, %v", staff, err)
+	}
+
+	if err := repos.Roles.Grant(seeker, "wizard", nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("granting an unknown role = %v, want ErrNotFound", err)
+	}
+	if err := repos.Roles.Grant(seeker+100, models.RoleSolver, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("granting to an unknown user = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	repos := newRepos(t)
+	first := createUser(t, repos, "first@example.com", models.RoleSeeker)
+	second := createUser(t, repos, "second@example.com", models.RoleSolver)
+	if err := repos.Roles.Grant(first, models.RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repos.Roles.Revoke(first, models.RoleSeeker); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("revoking the primary role = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Roles.Revoke(first, models.RoleAdmin); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("revoking the last administrator = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Roles.Revoke(second, models.RoleAdmin); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("revoking a role not held = %v, want ErrNotFound", err)
+	}
+
+	if err := repos.Roles.Grant(second, models.RoleAdmin, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Roles.Revoke(first, models.RoleAdmin); err != nil {
+		t.Errorf("revoking one of two administrators: %v", err)
+	}
+	if permissions, err := repos.Roles.Permissions(first); err != nil || len(permissions) != 0 {
+		t.Errorf("permissions after revoking = %v, %v, want none", permissions, err)
+	}
+}
+
+func TestListRoles(t *testing.T) {
+	repos := newRepos(t)
+	roles, err := repos.Roles.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]models.Role{}
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	if len(byName) != 5 {
+		t.Fatalf("List() = %d roles, want the 5 built-in ones", len(roles))
+	}
+	if admin := byName[models.RoleAdmin]; !admin.Staff || len(admin.Permissions) != 10 {
+		t.Errorf("admin = %+v, want staff with every permission", admin)
+	}
+	if seeker := byName[models.RoleSeeker]; seeker.Staff || len(seeker.Permissions) != 0 {
+		t.Errorf("seeker = %+v, want no permissions", seeker)
+	}
+}
+
+// equalSorted reports whether got holds the same strings as want in any order
+func equalSorted(got, want []string) bool {
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
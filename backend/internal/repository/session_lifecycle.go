@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// startGrace is how long before its scheduled time a session may be started
+const startGrace = 15 * time.Minute
+
+// sessionTransitions lists, for every status, the statuses it may be reached from
+var sessionTransitions = map[string][]string{
+	models.SessionRequested: {models.SessionConfirmed}, // rescheduled, to be confirmed again
+	models.SessionConfirmed: {models.SessionRequested},
+	models.SessionActive:    {models.SessionConfirmed},
+	models.SessionCompleted: {models.SessionActive},
+	models.SessionCancelled: {models.SessionRequested, models.SessionConfirmed},
+	models.SessionNoShow:    {models.SessionConfirmed},
+}
+
+// canTransition reports whether a session may move from one status to another
+func canTransition(from, to string) bool {
+	for _, allowed := range sessionTransitions[to] {
+		if allowed == from {
+			return true
+		}
+	}
+	return false
+}
+
+// isPending reports whether a session has yet to take place
+func isPending(status string) bool {
+	return status == models.SessionRequested || status == models.SessionConfirmed
+}
+
+// transitionFunc performs whatever a new status entails (timestamps, escrow
+// settlement) for a session locked inside tx
+type transitionFunc func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error)
+
+// transition moves a session to a new status inside one database transaction
+func (r *sqlSessionRepo) transition(id, userID int, to, reason string, apply transitionFunc) (*ledger.Settlement, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	settlement, err := transitionTx(tx, id, userID, to, reason, apply)
+	if err != nil {
+		return nil, err
+	}
+	return settlement, tx.Commit()
+}
+
+// transitionTx moves a session to a new status inside tx; apply runs with the
+// session locked, after the move has been validated
+func transitionTx(tx *database.Tx, id, userID int, to, reason string, apply transitionFunc) (*ledger.Settlement, error) {
+	session, err := lockSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(session.Status, to) {
+		return nil, ErrInvalidState
+	}
+
+	var settlement *ledger.Settlement
+	if apply != nil {
+		if settlement, err = apply(tx, session); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE sessions SET status = ?, ical_sequence = ical_sequence + 1, updated_at = ?
+		WHERE id = ?`, to, time.Now().UTC(), id); err != nil {
+		return nil, err
+	}
+	if err := recordTransition(tx, id, session.Status, to, userID, reason); err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// recordTransition appends to a session's status history
+func recordTransition(tx *database.Tx, sessionID int, from, to string, userID int, reason string) error {
+	var fromStatus interface{}
+	if from != "" {
+		fromStatus = from
+	}
+	_, err := tx.Exec(`
+		INSERT INTO session_transitions (session_id, from_status, to_status, user_id, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sessionID, fromStatus, to, userID, reason, time.Now().UTC())
+	return err
+}
+
+// confirmerOf returns who has to confirm a requested session: its solver, or
+// after a confirmed session was rescheduled, whoever did not move it
+func confirmerOf(tx *database.Tx, s *models.Session) (int, error) {
+	var from string
+	var movedBy int
+	err := tx.QueryRow(`
+		SELECT COALESCE(from_status, ''), user_id FROM session_transitions
+		WHERE session_id = ? AND to_status = ?
+		ORDER BY id DESC LIMIT 1`, s.ID, models.SessionRequested).Scan(&from, &movedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.SolverID, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if from == models.SessionConfirmed && movedBy == s.SolverID {
+		return s.SeekerID, nil
+	}
+	return s.SolverID, nil
+}
+
+func (r *sqlSessionRepo) Confirm(id, userID int) error {
+	_, err := r.transition(id, userID, models.SessionConfirmed, "",
+		func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error) {
+			confirmer, err := confirmerOf(tx, s)
+			if err != nil {
+				return nil, err
+			}
+			if userID != confirmer {
+				return nil, ErrNotConfirmer
+			}
+			return nil, nil
+		})
+	return err
+}
+
+func (r *sqlSessionRepo) Start(id, userID int) error {
+	_, err := r.transition(id, userID, models.SessionActive, "",
+		func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error) {
+			if time.Now().Before(s.ScheduledAt.Add(-startGrace)) {
+				return nil, ErrTooEarly
+			}
+			if s.PaymentStatus == models.PaymentAwaitingPayment {
+				return nil, ErrPaymentRequired
+			}
+			_, err := tx.Exec("UPDATE sessions SET started_at = ? WHERE id = ?", time.Now().UTC(), s.ID)
+			return nil, err
+		})
+	return err
+}
+
+func (r *sqlSessionRepo) Complete(id, userID int) (*ledger.Settlement, error) {
+	return r.transition(id, userID, models.SessionCompleted, "",
+		func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error) {
+			if _, err := tx.Exec("UPDATE sessions SET ended_at = ? WHERE id = ?", time.Now().UTC(), s.ID); err != nil {
+				return nil, err
+			}
+			return r.releaseEscrow(tx, s, func(int64) int64 { return 0 },
+				"Payout for session: "+s.Title)
+		})
+}
+
+func (r *sqlSessionRepo) Cancel(id, userID int, reason string) (*ledger.Settlement, error) {
+	return r.transition(id, userID, models.SessionCancelled, reason, r.refundOnCancel(userID))
+}
+
+// refundOnCancel settles escrow for a cancellation made by userID
+func (r *sqlSessionRepo) refundOnCancel(userID int) transitionFunc {
+	return func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error) {
+		return r.releaseEscrow(tx, s, func(held int64) int64 {
+			return r.policy.SeekerRefund(held, s.ScheduledAt, time.Now(), userID == s.SolverID)
+		}, "Cancelled session: "+s.Title)
+	}
+}
+
+func (r *sqlSessionRepo) NoShow(id, userID int, reason string) (*ledger.Settlement, error) {
+	return r.transition(id, userID, models.SessionNoShow, reason,
+		func(tx *database.Tx, s *models.Session) (*ledger.Settlement, error) {
+			if time.Now().Before(s.ScheduledAt) {
+				return nil, ErrTooEarly
+			}
+			// The reporter is the participant who showed up
+			seekerAbsent := userID == s.SolverID
+			return r.releaseEscrow(tx, s, func(held int64) int64 {
+				if seekerAbsent {
+					return r.policy.LateRefund(held)
+				}
+				return held
+			}, "No-show for session: "+s.Title)
+		})
+}
+
+func (r *sqlSessionRepo) Rate(id, rating int, review string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var current int
+	err = tx.QueryRow("SELECT status, COALESCE(rating, 0) FROM sessions WHERE id = ?"+tx.Dialect.ForUpdate(), id).
+		Scan(&status, &current)
+	if err != nil {
+		return notFound(err)
+	}
+	if status != models.SessionCompleted || current != 0 {
+		return ErrInvalidState
+	}
+
+	if _, err := tx.Exec("UPDATE sessions SET rating = ?, review = ?, updated_at = ? WHERE id = ?",
+		rating, review, time.Now().UTC(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlSessionRepo) History(id int) ([]models.SessionTransition, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, COALESCE(from_status, ''), to_status, user_id,
+		       COALESCE(reason, ''), created_at
+		FROM session_transitions WHERE session_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.SessionTransition{}
+	for rows.Next() {
+		var t models.SessionTransition
+		if err := rows.Scan(&t.ID, &t.SessionID, &t.FromStatus, &t.ToStatus,
+			&t.UserID, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, t)
+	}
+	return history, rows.Err()
+}
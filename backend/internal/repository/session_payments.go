@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// Transaction types recorded against a session
+const (
+	txSessionPayment = "session_payment"
+	txSessionPayout  = "session_payout"
+	txSessionRefund  = "session_refund"
+)
+
+func (r *sqlSessionRepo) Pay(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	session, err := lockSession(tx, id)
+	if err != nil {
+		return err
+	}
+	if session.PaymentStatus != models.PaymentAwaitingPayment || !isPending(session.Status) {
+		return ErrInvalidState
+	}
+
+	if err := holdSessionFunds(tx, session); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockSession reads a session for update inside tx
+func lockSession(tx *database.Tx, id int) (*models.Session, error) {
+	var s models.Session
+	err := tx.QueryRow(`
+		SELECT id, solver_id, seeker_id, title, price, status, scheduled_at,
+		       COALESCE(payment_status, 'none')
+		FROM sessions WHERE id = ?`+tx.Dialect.ForUpdate(), id).Scan(
+		&s.ID, &s.SolverID, &s.SeekerID, &s.Title, &s.Price, &s.Status, &s.ScheduledAt,
+		&s.PaymentStatus)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+// lockUserWallet returns and locks the wallet of a user inside tx
+func lockUserWallet(tx *database.Tx, userID int) (int, error) {
+	var walletID int
+	if err := tx.QueryRow("SELECT id FROM wallets WHERE user_id = ?", userID).Scan(&walletID); err != nil {
+		return 0, notFound(err)
+	}
+	return walletID, ledger.LockWallet(tx, walletID)
+}
+
+// insertSessionTransaction records the visible wallet transaction for a session entry
+func insertSessionTransaction(tx *database.Tx, walletID, sessionID int, txType string, cents, entryID int64, description string) error {
+	_, err := tx.Exec(`
+		INSERT INTO transactions (wallet_id, session_id, type, amount, description, status, journal_entry_id, created_at)
+		VALUES (?, ?, ?, ?, ?, 'completed', ?, ?)`,
+		walletID, sessionID, txType, ledger.FromCents(cents), description, entryID, time.Now().UTC())
+	return err
+}
+
+// holdSessionFunds moves the session price from the seeker's wallet into escrow
+func holdSessionFunds(tx *database.Tx, session *models.Session) error {
+	seekerWallet, err := lockUserWallet(tx, session.SeekerID)
+	if err != nil {
+		return err
+	}
+
+	cents := ledger.ToCents(session.Price)
+	description := "Payment for session: " + session.Title
+	entryID, err := ledger.HoldSessionFunds(tx, session.ID, seekerWallet, cents, description)
+	if err != nil {
+		return err
+	}
+	if err := insertSessionTransaction(tx, seekerWallet, session.ID, txSessionPayment, cents, entryID, description); err != nil {
+		return err
+	}
+
+	return setPaymentStatus(tx, session.ID, models.PaymentHeld)
+}
+
+// setPaymentStatus records where a session's money stands
+func setPaymentStatus(tx *database.Tx, sessionID int, status string) error {
+	_, err := tx.Exec("UPDATE sessions SET payment_status = ?, updated_at = ? WHERE id = ?",
+		status, time.Now().UTC(), sessionID)
+	return err
+}
+
+// releaseEscrow settles a held payment: refundCents go back to the seeker and
+// the rest, less the platform fee, to the solver. It does nothing for
+// sessions without a held payment and drops any outstanding payment request.
+func (r *sqlSessionRepo) releaseEscrow(tx *database.Tx, session *models.Session, refundCents func(held int64) int64, description string) (*ledger.Settlement, error) {
+	switch session.PaymentStatus {
+	case models.PaymentHeld:
+	case models.PaymentAwaitingPayment:
+		return nil, setPaymentStatus(tx, session.ID, models.PaymentNone)
+	default:
+		return nil, nil
+	}
+
+	held := ledger.ToCents(session.Price)
+	s := r.policy.Settle(held, refundCents(held))
+	if err := settleSessionFunds(tx, session, s, description); err != nil {
+		return nil, err
+	}
+
+	status := models.PaymentReleased
+	if s.Refund > 0 {
+		status = models.PaymentRefunded
+	}
+	return &s, setPaymentStatus(tx, session.ID, status)
+}
+
+// settleSessionFunds releases escrow to the seeker and solver per a settlement
+func settleSessionFunds(tx *database.Tx, session *models.Session, s ledger.Settlement, description string) error {
+	seekerWallet, err := lockUserWallet(tx, session.SeekerID)
+	if err != nil {
+		return err
+	}
+	solverWallet, err := lockUserWallet(tx, session.SolverID)
+	if err != nil {
+		return err
+	}
+
+	kind := "escrow_release"
+	if s.Refund > 0 {
+		kind = "escrow_refund"
+	}
+	entryID, err := ledger.SettleSessionFunds(tx, session.ID, seekerWallet, solverWallet, s, kind, description)
+	if err != nil {
+		return err
+	}
+
+	if s.Refund > 0 {
+		if err := insertSessionTransaction(tx, seekerWallet, session.ID, txSessionRefund, s.Refund, entryID, description); err != nil {
+			return err
+		}
+	}
+	if s.Payout > 0 {
+		if err := insertSessionTransaction(tx, solverWallet, session.ID, txSessionPayout, s.Payout, entryID, description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"fmt"
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// OccurrenceError reports which occurrence of a series could not be booked
+type OccurrenceError struct {
+	At  time.Time
+	Err error
+}
+
+func (e *OccurrenceError) Error() string {
+	return fmt.Sprintf("occurrence at %s: %v", e.At.Format(time.RFC3339), e.Err)
+}
+
+func (e *OccurrenceError) Unwrap() error {
+	return e.Err
+}
+
+// SeriesEdit changes the upcoming occurrences of a series
+type SeriesEdit struct {
+	// Fields are updatable session columns other than scheduled_at
+	Fields map[string]interface{}
+	// Reschedule, when set, returns the new start of an occurrence
+	Reschedule func(time.Time) time.Time
+}
+
+// CancelledOccurrence is one session called off with its series
+type CancelledOccurrence struct {
+	SessionID  int
+	Settlement *ledger.Settlement
+}
+
+func (r *sqlSessionRepo) CreateSeries(series *models.SessionSeries, template models.Session, starts []time.Time, bookedBy int) ([]int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.InsertID(`
+		INSERT INTO session_series (solver_id, seeker_id, frequency, occurrences, until_date,
+		                            timezone, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		template.SolverID, template.SeekerID, series.Frequency, series.Occurrences, series.Until,
+		series.Timezone, bookedBy, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	series.ID = int(id)
+	series.SolverID, series.SeekerID, series.CreatedBy = template.SolverID, template.SeekerID, bookedBy
+
+	// Every occurrence is booked, and paid for, as a session of its own
+	ids := make([]int, 0, len(starts))
+	for _, at := range starts {
+		session := template
+		session.SeriesID = &series.ID
+		session.ScheduledAt = at
+		if err := bookSession(tx, &session, bookedBy); err != nil {
+			return nil, &OccurrenceError{At: at, Err: err}
+		}
+		ids = append(ids, session.ID)
+	}
+
+	return ids, tx.Commit()
+}
+
+func (r *sqlSessionRepo) GetSeries(id int) (*models.SessionSeries, error) {
+	var s models.SessionSeries
+	err := r.db.QueryRow(`
+		SELECT id, solver_id, seeker_id, frequency, occurrences, until_date, timezone,
+		       created_by, created_at
+		FROM session_series WHERE id = ?`, id).Scan(
+		&s.ID, &s.SolverID, &s.SeekerID, &s.Frequency, &s.Occurrences, &s.Until, &s.Timezone,
+		&s.CreatedBy, &s.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+func (r *sqlSessionRepo) SeriesSessions(id int) ([]SessionDetail, error) {
+	rows, err := r.db.Query(selectSessionDetail+" WHERE s.series_id = ? ORDER BY s.scheduled_at", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []SessionDetail
+	for rows.Next() {
+		d, err := scanSessionDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *d)
+	}
+	return sessions, rows.Err()
+}
+
+// upcomingOccurrences returns the ids and start times of the pending sessions
+// of a series that have not reached their scheduled time, locking them
+func upcomingOccurrences(tx *database.Tx, seriesID int) ([]models.Session, error) {
+	rows, err := tx.Query(`
+		SELECT id, scheduled_at FROM sessions
+		WHERE series_id = ? AND status IN (?, ?) AND scheduled_at > ?
+		ORDER BY scheduled_at`+tx.Dialect.ForUpdate(),
+		seriesID, models.SessionRequested, models.SessionConfirmed, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.ScheduledAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessionRepo) UpdateSeries(id, userID int, edit SeriesEdit) ([]int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	occurrences, err := upcomingOccurrences(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, o := range occurrences {
+		fields := make(map[string]interface{}, len(edit.Fields)+1)
+		for k, v := range edit.Fields {
+			fields[k] = v
+		}
+		if edit.Reschedule != nil {
+			at := edit.Reschedule(o.ScheduledAt).UTC()
+			if at.Before(time.Now()) {
+				return nil, &OccurrenceError{At: o.ScheduledAt, Err: ErrInPast}
+			}
+			fields["scheduled_at"] = at
+		}
+		if err := updateSessionTx(tx, o.ID, userID, fields); err != nil {
+			return nil, &OccurrenceError{At: o.ScheduledAt, Err: err}
+		}
+		ids = append(ids, o.ID)
+	}
+
+	return ids, tx.Commit()
+}
+
+func (r *sqlSessionRepo) CancelSeries(id, userID int, reason string) ([]CancelledOccurrence, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	occurrences, err := upcomingOccurrences(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each occurrence is refunded under the cancellation policy on its own
+	var cancelled []CancelledOccurrence
+	for _, o := range occurrences {
+		settlement, err := transitionTx(tx, o.ID, userID, models.SessionCancelled, reason, r.refundOnCancel(userID))
+		if err != nil {
+			return nil, err
+		}
+		cancelled = append(cancelled, CancelledOccurrence{SessionID: o.ID, Settlement: settlement})
+	}
+
+	return cancelled, tx.Commit()
+}
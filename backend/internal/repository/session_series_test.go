@@ -0,0 +1,137 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// bookSeries has the seeker book weekly sessions with the solver starting a
+// week from now
+func bookSeries(t *testing.T, repos *repository.Repositories, solverID, seekerID, count int, price float64) ([]int, error) {
+	t.Helper()
+	start := time.Now().Add(7 * 24 * time.Hour).UTC().Truncate(time.Hour)
+	starts := make([]time.Time, count)
+	for i := range starts {
+		starts[i] = start.AddDate(0, 0, 7*i)
+	}
+	series := &models.SessionSeries{Frequency: "weekly", Occurrences: &count, Timezone: "UTC"}
+	template := models.Session{SolverID: solverID, SeekerID: seekerID, Title: "Algebra", Duration: 60, Price: price}
+	return repos.Sessions.CreateSeries(series, template, starts, seekerID)
+}
+
+func TestSeriesBooksAndCancelsEveryOccurrence(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+	deposit(t, repos, seeker, 100)
+
+	ids, err := bookSeries(t, repos, solver, seeker, 3, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || balance(t, repos, seeker) != 40 {
+		t.Fatalf("booked %v leaving %v, want 3 sessions leaving 40", ids, balance(t, repos, seeker))
+	}
+	first, err := repos.Sessions.Get(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SeriesID == nil {
+		t.Fatal("occurrence does not belong to a series")
+	}
+	seriesID := *first.SeriesID
+
+	sessions, err := repos.Sessions.SeriesSessions(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(sessions); i++ {
+		if gap := sessions[i].Session.ScheduledAt.Sub(sessions[i-1].Session.ScheduledAt); gap != 7*24*time.Hour {
+			t.Errorf("occurrences %d and %d are %v apart", i-1, i, gap)
+		}
+	}
+
+	// Each occurrence is refunded in full, well ahead of its start
+	cancelled, err := repos.Sessions.CancelSeries(seriesID, seeker, "moving away")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 3 || balance(t, repos, seeker) != 100 {
+		t.Errorf("cancelled %d occurrences leaving %v, want 3 and 100", len(cancelled), balance(t, repos, seeker))
+	}
+	for _, id := range ids {
+		if got := sessionStatus(t, repos, id); got != models.SessionCancelled {
+			t.Errorf("session %d is %s, want cancelled", id, got)
+		}
+	}
+	reconcile(t, repos)
+}
+
+func TestSeriesIsBookedWhollyOrNotAtAll(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+	deposit(t, repos, seeker, 50)
+
+	// The third occurrence cannot be paid for
+	_, err := bookSeries(t, repos, solver, seeker, 3, 20)
+	var occurrence *repository.OccurrenceError
+	if !errors.As(err, &occurrence) {
+		t.Fatalf("CreateSeries() = %v, want an OccurrenceError", err)
+	}
+	if got := balance(t, repos, seeker); got != 50 {
+		t.Errorf("balance = %v after a failed series, want 50", got)
+	}
+
+	sessions, err := repos.Sessions.List(repository.SessionFilter{UserID: seeker, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions left behind by a failed series", len(sessions))
+	}
+	reconcile(t, repos)
+}
+
+func TestUpdateSeriesShiftsUpcomingOccurrences(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+
+	ids, err := bookSeries(t, repos, solver, seeker, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := repos.Sessions.Get(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := repos.Sessions.UpdateSeries(*first.SeriesID, solver, repository.SeriesEdit{
+		Fields:     map[string]interface{}{"title": "Geometry"},
+		Reschedule: func(at time.Time) time.Time { return at.Add(2 * time.Hour) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 2 {
+		t.Fatalf("updated %v, want both occurrences", updated)
+	}
+	moved, err := repos.Sessions.Get(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Title != "Geometry" || !moved.ScheduledAt.Equal(first.ScheduledAt.Add(2*time.Hour)) {
+		t.Errorf("occurrence = %q at %v, want Geometry two hours later", moved.Title, moved.ScheduledAt)
+	}
+
+	_, err = repos.Sessions.UpdateSeries(*first.SeriesID, solver, repository.SeriesEdit{
+		Reschedule: func(at time.Time) time.Time { return at.AddDate(-1, 0, 0) },
+	})
+	if !errors.Is(err, repository.ErrInPast) {
+		t.Errorf("moving a series into the past = %v, want ErrInPast", err)
+	}
+}
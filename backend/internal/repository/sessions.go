@@ -0,0 +1,478 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"synapmentor/internal/availability"
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// SessionDetail is a session joined with the names of both participants
+type SessionDetail struct {
+	Session    models.Session
+	SolverName string
+	SeekerName string
+}
+
+// SessionFilter narrows a session listing to one participant
+type SessionFilter struct {
+	UserID   int
+	AsSolver bool // match solver_id instead of seeker_id
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+var (
+	// ErrNoFields is returned when an update carries nothing to change
+	ErrNoFields = errors.New("no fields to update")
+	// ErrPaymentRequired is returned when a paid session has not been paid for
+	ErrPaymentRequired = errors.New("session has not been paid for")
+	// ErrTooEarly is returned when a session is started or reported before its
+	// scheduled time
+	ErrTooEarly = errors.New("session has not reached its scheduled time")
+	// ErrNotConfirmer is returned when a session is confirmed by the
+	// participant who is not the one to confirm it
+	ErrNotConfirmer = errors.New("session must be confirmed by the other participant")
+	// ErrSlotTaken is returned when a booking overlaps another of the solver's sessions
+	ErrSlotTaken = errors.New("solver is already booked at that time")
+	// ErrUnavailable is returned when a booking falls outside the solver's availability
+	ErrUnavailable = errors.New("solver is not available at that time")
+	// ErrInPast is returned when a session would be moved to a time already passed
+	ErrInPast = errors.New("scheduled time has already passed")
+)
+
+// SessionRepo stores tutoring sessions and their dashboard aggregates
+type SessionRepo interface {
+	// List returns the sessions of one participant, newest first
+	List(filter SessionFilter) ([]SessionDetail, error)
+	// Get returns a session by id
+	Get(id int) (*models.Session, error)
+	// GetForParticipant returns a session only if userID takes part in it
+	GetForParticipant(id, userID int) (*SessionDetail, error)
+	// GetDetail returns any session with its participants' names
+	GetDetail(id int) (*SessionDetail, error)
+	// Create books a session on behalf of bookedBy and returns its id. A paid
+	// session booked by its seeker moves the funds into escrow right away;
+	// one booked by the solver waits for the seeker to Pay.
+	Create(session *models.Session, bookedBy int) (int, error)
+	// Pay moves the seeker's funds for a session into escrow
+	Pay(id int) error
+	// Confirm accepts a requested session. That is the solver's to do, unless
+	// the solver rescheduled a confirmed session, when it is the seeker's.
+	Confirm(id, userID int) error
+	// Start marks a confirmed session active, no earlier than shortly before
+	// its scheduled time; paid sessions must be paid for
+	Start(id, userID int) error
+	// Complete ends an active session and pays the solver from escrow
+	Complete(id, userID int) (*ledger.Settlement, error)
+	// Cancel calls off a session that has not started, refunding escrow per the policy
+	Cancel(id, userID int, reason string) (*ledger.Settlement, error)
+	// NoShow records that the other participant did not attend; userID is the
+	// participant who reports it
+	NoShow(id, userID int, reason string) (*ledger.Settlement, error)
+	// Rate stores the seeker's rating of a completed session, once
+	Rate(id, rating int, review string) error
+	// History returns every status change of a session, oldest first
+	History(id int) ([]models.SessionTransition, error)
+	// Update sets the given columns, which must be updatable session fields;
+	// a new scheduled_at must be free in the solver's calendar. Rescheduling a
+	// confirmed session sends it back to requested, for the participant other
+	// than userID to confirm the new time.
+	Update(id, userID int, fields map[string]interface{}) error
+	// Delete removes a requested session, failing with ErrInvalidState once
+	// it has moved on; later sessions are cancelled instead
+	Delete(id int) error
+
+	// CreateSeries books one session per start time from template, all in one
+	// transaction, and returns their ids; a conflict is an *OccurrenceError
+	CreateSeries(series *models.SessionSeries, template models.Session, starts []time.Time, bookedBy int) ([]int, error)
+	// GetSeries returns a series by id
+	GetSeries(id int) (*models.SessionSeries, error)
+	// SeriesSessions returns every occurrence of a series, earliest first
+	SeriesSessions(id int) ([]SessionDetail, error)
+	// UpdateSeries applies an edit to the pending occurrences of a series that
+	// have not started yet and returns their ids
+	UpdateSeries(id, userID int, edit SeriesEdit) ([]int, error)
+	// CancelSeries cancels the pending occurrences of a series that have not
+	// started yet, refunding each under the cancellation policy
+	CancelSeries(id, userID int, reason string) ([]CancelledOccurrence, error)
+
+	// Stats summarises sessions given by a solver
+	Stats(solverID int) (*models.SessionStats, error)
+	// Recent returns the latest sessions of a participant
+	Recent(userID int, asSolver bool, limit int) ([]models.RecentSession, error)
+	// Upcoming returns pending sessions of a participant scheduled after a time
+	Upcoming(userID int, asSolver bool, after time.Time) ([]models.RecentSession, error)
+	// Monthly buckets a solver's sessions by calendar month in loc since a time
+	Monthly(solverID int, since time.Time, loc *time.Location) ([]models.MonthlyData, error)
+	// Leaderboard ranks active solvers by earnings and rating
+	Leaderboard(limit int) ([]models.LeaderboardEntry, error)
+}
+
+type sqlSessionRepo struct {
+	db     *database.Conn
+	policy ledger.Policy
+}
+
+const selectSessionDetail = `
+	SELECT s.id, s.solver_id, s.seeker_id, s.title, COALESCE(s.description, ''),
+	       COALESCE(s.category, ''), COALESCE(s.sub_category, ''), s.duration, s.price,
+	       s.status, s.scheduled_at, s.started_at, s.ended_at,
+	       COALESCE(s.recording_url, ''), COALESCE(s.rating, 0), COALESCE(s.review, ''),
+	       COALESCE(s.payment_status, 'none'), s.series_id, s.created_at, s.updated_at,
+	       solver.first_name || ' ' || solver.last_name as solver_name,
+	       seeker.first_name || ' ' || seeker.last_name as seeker_name
+	FROM sessions s
+	JOIN users solver ON s.solver_id = solver.id
+	JOIN users seeker ON s.seeker_id = seeker.id`
+
+func scanSessionDetail(row rowScanner) (*SessionDetail, error) {
+	var d SessionDetail
+	s := &d.Session
+	err := row.Scan(&s.ID, &s.SolverID, &s.SeekerID,
+		&s.Title, &s.Description, &s.Category,
+		&s.SubCategory, &s.Duration, &s.Price,
+		&s.Status, &s.ScheduledAt, &s.StartedAt,
+		&s.EndedAt, &s.RecordingURL, &s.Rating,
+		&s.Review, &s.PaymentStatus, &s.SeriesID, &s.CreatedAt, &s.UpdatedAt,
+		&d.SolverName, &d.SeekerName)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &d, nil
+}
+
+func (r *sqlSessionRepo) List(filter SessionFilter) ([]SessionDetail, error) {
+	query := selectSessionDetail
+	if filter.AsSolver {
+		query += " WHERE s.solver_id = ?"
+	} else {
+		query += " WHERE s.seeker_id = ?"
+	}
+	args := []interface{}{filter.UserID}
+
+	if filter.Status != "" {
+		query += " AND s.status = ?"
+		args = append(args, filter.Status)
+	}
+
+	query += " ORDER BY s.scheduled_at DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []SessionDetail
+	for rows.Next() {
+		d, err := scanSessionDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *d)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessionRepo) Get(id int) (*models.Session, error) {
+	d, err := scanSessionDetail(r.db.QueryRow(selectSessionDetail+" WHERE s.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	return &d.Session, nil
+}
+
+func (r *sqlSessionRepo) GetForParticipant(id, userID int) (*SessionDetail, error) {
+	return scanSessionDetail(r.db.QueryRow(
+		selectSessionDetail+" WHERE s.id = ? AND (s.solver_id = ? OR s.seeker_id = ?)",
+		id, userID, userID))
+}
+
+func (r *sqlSessionRepo) GetDetail(id int) (*SessionDetail, error) {
+	return scanSessionDetail(r.db.QueryRow(selectSessionDetail+" WHERE s.id = ?", id))
+}
+
+func (r *sqlSessionRepo) Create(session *models.Session, bookedBy int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := bookSession(tx, session, bookedBy); err != nil {
+		return 0, err
+	}
+	return session.ID, tx.Commit()
+}
+
+// bookSession inserts a session inside tx once the solver's calendar has room
+// for it, holding the seeker's payment when the seeker is the one booking
+func bookSession(tx *database.Tx, session *models.Session, bookedBy int) error {
+	session.ScheduledAt = session.ScheduledAt.UTC()
+	if err := checkBookable(tx, session.SolverID, sessionInterval(session), 0); err != nil {
+		return err
+	}
+
+	paymentStatus := models.PaymentNone
+	if session.Price > 0 {
+		paymentStatus = models.PaymentAwaitingPayment
+	}
+
+	now := time.Now().UTC()
+	id, err := tx.InsertID(`
+		INSERT INTO sessions (solver_id, seeker_id, series_id, title, description, category,
+		                     sub_category, duration, price, status, scheduled_at, payment_status,
+		                     created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.SolverID, session.SeekerID, session.SeriesID, session.Title, session.Description,
+		session.Category, session.SubCategory, session.Duration, session.Price, models.SessionRequested,
+		session.ScheduledAt, paymentStatus, now, now)
+	if err != nil {
+		return err
+	}
+	session.ID = int(id)
+
+	if err := recordTransition(tx, session.ID, "", models.SessionRequested, bookedBy, ""); err != nil {
+		return err
+	}
+
+	if bookedBy == session.SeekerID && paymentStatus == models.PaymentAwaitingPayment {
+		return holdSessionFunds(tx, session)
+	}
+	return nil
+}
+
+// updatableSessionColumns guards the dynamic UPDATE against arbitrary column names
+// and keeps status changes on the lifecycle methods
+var updatableSessionColumns = map[string]bool{
+	"title":        true,
+	"description":  true,
+	"scheduled_at": true,
+}
+
+func (r *sqlSessionRepo) Update(id, userID int, fields map[string]interface{}) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateSessionTx(tx, id, userID, fields); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateSessionTx applies an Update made by userID inside tx
+func updateSessionTx(tx *database.Tx, id, userID int, fields map[string]interface{}) error {
+	updateFields := []string{}
+	args := []interface{}{}
+
+	for field, value := range fields {
+		if !updatableSessionColumns[field] {
+			return errors.New("session field is not updatable: " + field)
+		}
+		updateFields = append(updateFields, field+" = ?")
+		args = append(args, value)
+	}
+
+	if len(updateFields) == 0 {
+		return ErrNoFields
+	}
+
+	reconfirm := false
+	if scheduledAt, ok := fields["scheduled_at"].(time.Time); ok {
+		var session models.Session
+		err := tx.QueryRow("SELECT id, solver_id, duration, status, scheduled_at FROM sessions WHERE id = ?"+
+			tx.Dialect.ForUpdate(), id).
+			Scan(&session.ID, &session.SolverID, &session.Duration, &session.Status, &session.ScheduledAt)
+		if err != nil {
+			return notFound(err)
+		}
+		// The other participant agreed to the old time, not the new one
+		reconfirm = session.Status == models.SessionConfirmed && !scheduledAt.Equal(session.ScheduledAt)
+		session.ScheduledAt = scheduledAt
+		if err := checkBookable(tx, session.SolverID, sessionInterval(&session), id); err != nil {
+			return err
+		}
+	}
+	if reconfirm {
+		updateFields = append(updateFields, "status = ?")
+		args = append(args, models.SessionRequested)
+	}
+
+	// Every editable field shows in calendar invites, so each edit is a new revision
+	updateFields = append(updateFields, "ical_sequence = ical_sequence + 1", "updated_at = ?")
+	args = append(args, time.Now().UTC(), id)
+
+	query := "UPDATE sessions SET " + strings.Join(updateFields, ", ") + " WHERE id = ?"
+	if err := expectRow(tx.Exec(query, args...)); err != nil {
+		return err
+	}
+	if reconfirm {
+		return recordTransition(tx, id, models.SessionConfirmed, models.SessionRequested, userID, "Rescheduled")
+	}
+	return nil
+}
+
+// sessionInterval returns the time a session occupies
+func sessionInterval(s *models.Session) availability.Interval {
+	start := s.ScheduledAt.UTC()
+	return availability.Interval{Start: start, End: start.Add(time.Duration(s.Duration) * time.Minute)}
+}
+
+func (r *sqlSessionRepo) Delete(id int) error {
+	err := expectRow(r.db.Exec("DELETE FROM sessions WHERE id = ? AND status = ?", id, models.SessionRequested))
+	if errors.Is(err, ErrNotFound) {
+		if _, err := r.Get(id); err != nil {
+			return err
+		}
+		return ErrInvalidState
+	}
+	return err
+}
+
+func (r *sqlSessionRepo) Stats(solverID int) (*models.SessionStats, error) {
+	var stats models.SessionStats
+	err := r.db.QueryRow(`
+		SELECT
+			COUNT(*) as total_sessions,
+			COUNT(CASE WHEN status = 'completed' THEN 1 END) as completed_sessions,
+			COALESCE(SUM(CASE WHEN status = 'completed' THEN price ELSE 0 END), 0) as total_earnings
+		FROM sessions WHERE solver_id = ?`, solverID).Scan(
+		&stats.TotalSessions, &stats.CompletedSessions, &stats.TotalEarnings)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// summaryQuery selects sessions of one participant together with the name of
+// the other participant
+func summaryQuery(asSolver bool, where string) string {
+	if asSolver {
+		return `
+			SELECT s.id, s.title, u.first_name || ' ' || u.last_name as seeker_name,
+			       s.status, s.scheduled_at, s.duration, s.price
+			FROM sessions s
+			JOIN users u ON s.seeker_id = u.id
+			WHERE s.solver_id = ?` + where
+	}
+	return `
+		SELECT s.id, s.title, u.first_name || ' ' || u.last_name as solver_name,
+		       s.status, s.scheduled_at, s.duration, s.price
+		FROM sessions s
+		JOIN users u ON s.solver_id = u.id
+		WHERE s.seeker_id = ?` + where
+}
+
+func (r *sqlSessionRepo) querySummaries(query string, args ...interface{}) ([]models.RecentSession, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.RecentSession
+	for rows.Next() {
+		var session models.RecentSession
+		err := rows.Scan(&session.ID, &session.Title, &session.SeekerName,
+			&session.Status, &session.ScheduledAt, &session.Duration, &session.Price)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessionRepo) Recent(userID int, asSolver bool, limit int) ([]models.RecentSession, error) {
+	query := summaryQuery(asSolver, `
+			ORDER BY s.scheduled_at DESC
+			LIMIT ?`)
+	return r.querySummaries(query, userID, limit)
+}
+
+func (r *sqlSessionRepo) Upcoming(userID int, asSolver bool, after time.Time) ([]models.RecentSession, error) {
+	query := summaryQuery(asSolver, ` AND s.status IN ('requested', 'confirmed')
+			AND s.scheduled_at > ?
+			ORDER BY s.scheduled_at ASC`)
+	return r.querySummaries(query, userID, after)
+}
+
+func (r *sqlSessionRepo) Monthly(solverID int, since time.Time, loc *time.Location) ([]models.MonthlyData, error) {
+	rows, err := r.db.Query(`
+		SELECT scheduled_at, status, price
+		FROM sessions
+		WHERE solver_id = ?
+		AND scheduled_at >= ?
+		ORDER BY scheduled_at`, solverID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Months are bucketed here rather than in SQL so that a session late on
+	// the last day of a month counts towards the month the caller saw it in
+	var monthlyData []models.MonthlyData
+	for rows.Next() {
+		var scheduledAt time.Time
+		var status string
+		var price float64
+		if err := rows.Scan(&scheduledAt, &status, &price); err != nil {
+			return nil, err
+		}
+
+		month := scheduledAt.In(loc).Format("2006-01")
+		if n := len(monthlyData); n == 0 || monthlyData[n-1].Month != month {
+			monthlyData = append(monthlyData, models.MonthlyData{Month: month})
+		}
+		data := &monthlyData[len(monthlyData)-1]
+		data.Sessions++
+		if status == models.SessionCompleted {
+			data.Earnings += price
+		}
+	}
+	return monthlyData, rows.Err()
+}
+
+func (r *sqlSessionRepo) Leaderboard(limit int) ([]models.LeaderboardEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT
+			u.id, u.first_name || ' ' || u.last_name as name, COALESCE(u.profile_pic, ''),
+			COUNT(s.id) as total_sessions,
+			COALESCE(AVG(s.rating), 0) as rating,
+			COALESCE(SUM(CASE WHEN s.status = 'completed' THEN s.price ELSE 0 END), 0) as earnings
+		FROM users u
+		LEFT JOIN sessions s ON u.id = s.solver_id
+		WHERE u.is_active = true
+		  AND EXISTS (SELECT 1 FROM user_roles ur
+		              JOIN roles ro ON ro.name = ur.role
+		              WHERE ur.user_id = u.id AND ro.name = ?)
+		GROUP BY u.id, u.first_name, u.last_name, u.profile_pic
+		HAVING COUNT(s.id) > 0
+		ORDER BY earnings DESC, rating DESC
+		LIMIT ?`, models.RoleSolver, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaderboard []models.LeaderboardEntry
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		err := rows.Scan(&entry.UserID, &entry.Name, &entry.ProfilePic,
+			&entry.TotalSessions, &entry.Rating, &entry.Earnings)
+		if err != nil {
+			return nil, err
+		}
+		leaderboard = append(leaderboard, entry)
+	}
+	return leaderboard, rows.Err()
+}
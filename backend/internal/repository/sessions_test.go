@@ -0,0 +1,499 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/availability"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+// book has the seeker book a session with the solver starting in, paying
+// for it up front when it has a price
+func book(t *testing.T, repos *repository.Repositories, solverID, seekerID int, in time.Duration, price float64) int {
+	t.Helper()
+	id, err := repos.Sessions.Create(&models.Session{
+		SolverID:    solverID,
+		SeekerID:    seekerID,
+		Title:       "Algebra",
+		Category:    "math",
+		Duration:    60,
+		Price:       price,
+		ScheduledAt: time.Now().Add(in),
+	}, seekerID)
+	if err != nil {
+		t.Fatalf("book session: %v", err)
+	}
+	return id
+}
+
+func sessionStatus(t *testing.T, repos *repository.Repositories, id int) string {
+	t.Helper()
+	s, err := repos.Sessions.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Status
+}
+
+func TestSessionEscrowLifecycle(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+	deposit(t, repos, seeker, 100)
+
+	id := book(t, repos, solver, seeker, 5*time.Minute, 40)
+	if got := balance(t, repos, seeker); got != 60 {
+		t.Errorf("seeker balance after booking = %v, want 60", got)
+	}
+	if err := repos.Sessions.Pay(id); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("paying twice = %v, want ErrInvalidState", err)
+	}
+
+	if err := repos.Sessions.Start(id, solver); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("Start() before confirming = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Sessions.Confirm(id, seeker); !errors.Is(err, repository.ErrNotConfirmer) {
+		t.Errorf("Confirm() by the seeker = %v, want ErrNotConfirmer", err)
+	}
+	if err := repos.Sessions.Confirm(id, solver); err != nil {
+		t.Fatalf("Confirm() = %v", err)
+	}
+	if _, err := repos.Sessions.Complete(id, solver); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("Complete() before starting = %v, want ErrInvalidState", err)
+	}
+	if err := repos.Sessions.Start(id, seeker); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if _, err := repos.Sessions.Cancel(id, seeker, "changed my mind"); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("Cancel() once started = %v, want ErrInvalidState", err)
+	}
+	settlement, err := repos.Sessions.Complete(id, solver)
+	if err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+
+	if settlement.Payout != 3600 || settlement.Fee != 400 || settlement.Refund != 0 {
+		t.Errorf("settlement = %+v, want 36.00 paid out and 4.00 kept", settlement)
+	}
+	if got := balance(t, repos, solver); got != 36 {
+		t.Errorf("solver balance = %v, want 36", got)
+	}
+	if got := sessionStatus(t, repos, id); got != models.SessionCompleted {
+		t.Errorf("status = %s, want completed", got)
+	}
+	if _, err := repos.Sessions.Complete(id, solver); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("completing twice = %v, want ErrInvalidState", err)
+	}
+
+	history, err := repos.Sessions.History(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path []string
+	for _, h := range history {
+		path = append(path, h.ToStatus)
+	}
+	want := []string{models.SessionRequested, models.SessionConfirmed, models.SessionActive, models.SessionCompleted}
+	if len(path) != len(want) {
+		t.Fatalf("history = %v, want %v", path, want)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Fatalf("history = %v, want %v", path, want)
+		}
+	}
+
+	if err := repos.Sessions.Rate(id, 5, "Clear"); err != nil {
+		t.Fatalf("Rate() = %v", err)
+	}
+	if err := repos.Sessions.Rate(id, 1, "Changed my mind"); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("rating twice = %v, want ErrInvalidState", err)
+	}
+	reconcile(t, repos)
+}
+
+func TestStartOnlyCloseToScheduledTime(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Duration
+		want error
+	}{
+		{"an hour early", time.Hour, repository.ErrTooEarly},
+		{"inside the grace window", 10 * time.Minute, nil},
+		{"late", -10 * time.Minute, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := newRepos(t)
+			solver := createUser(t, repos, "solver@example.com", models.RoleSolver)
+			seeker := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+
+			id := book(t, repos, solver, seeker, tt.in, 0)
+			if err := repos.Sessions.Confirm(id, solver); err != nil {
+				t.Fatal(err)
+			}
+			if err := repos.Sessions.Start(id, solver); !errors.Is(err, tt.want) {
+				t.Errorf("Start() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionAwaitingPayment(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+	deposit(t, repos, seeker, 30)
+
+	// A session the solver books waits for the seeker to pay
+	id, err := repos.Sessions.Create(&models.Session{
+		SolverID: solver, SeekerID: seeker, Title: "Algebra", Duration: 60, Price: 40,
+		ScheduledAt: time.Now().Add(5 * time.Minute),
+	}, solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Sessions.Confirm(id, solver); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Sessions.Start(id, solver); !errors.Is(err, repository.ErrPaymentRequired) {
+		t.Errorf("starting an unpaid session = %v, want ErrPaymentRequired", err)
+	}
+	if err := repos.Sessions.Pay(id); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Fatalf("paying 40 out of 30 = %v, want ErrInsufficientFunds", err)
+	}
+
+	deposit(t, repos, seeker, 10)
+	if err := repos.Sessions.Pay(id); err != nil {
+		t.Fatalf("Pay() = %v", err)
+	}
+	s, err := repos.Sessions.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PaymentStatus != models.PaymentHeld || balance(t, repos, seeker) != 0 {
+		t.Errorf("payment status %s with %v left, want held and 0", s.PaymentStatus, balance(t, repos, seeker))
+	}
+	if err := repos.Sessions.Start(id, solver); err != nil {
+		t.Errorf("Start() once paid = %v", err)
+	}
+
+	// Cancelling before paying moves no money
+	unpaid, err := repos.Sessions.Create(&models.Session{
+		SolverID: solver, SeekerID: seeker, Title: "Geometry", Duration: 60, Price: 40,
+		ScheduledAt: time.Now().Add(48 * time.Hour),
+	}, solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settlement, err := repos.Sessions.Cancel(unpaid, seeker, "")
+	if err != nil || settlement != nil {
+		t.Errorf("Cancel() of an unpaid session = %+v, %v", settlement, err)
+	}
+	reconcile(t, repos)
+}
+
+func TestCancelRefundsUnderPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          time.Duration
+		bySolver    bool
+		wantRefund  float64
+		wantPayout  float64
+		wantBalance float64 // the seeker's afterwards, of 100
+	}{
+		{"seeker, well ahead", 48 * time.Hour, false, 40, 0, 100},
+		{"seeker, late", 2 * time.Hour, false, 20, 18, 80},
+		{"solver, late", 2 * time.Hour, true, 40, 0, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := newRepos(t)
+			solver := createUser(t, repos, "solver@example.com", "solver")
+			seeker := createUser(t, repos, "seeker@example.com", "seeker")
+			deposit(t, repos, seeker, 100)
+
+			id := book(t, repos, solver, seeker, tt.in, 40)
+			if err := repos.Sessions.Confirm(id, solver); err != nil {
+				t.Fatal(err)
+			}
+			by := seeker
+			if tt.bySolver {
+				by = solver
+			}
+			settlement, err := repos.Sessions.Cancel(id, by, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := float64(settlement.Refund) / 100; got != tt.wantRefund {
+				t.Errorf("refund = %v, want %v", got, tt.wantRefund)
+			}
+			if got := float64(settlement.Payout) / 100; got != tt.wantPayout {
+				t.Errorf("payout = %v, want %v", got, tt.wantPayout)
+			}
+			if got := balance(t, repos, seeker); got != tt.wantBalance {
+				t.Errorf("seeker balance = %v, want %v", got, tt.wantBalance)
+			}
+			if _, err := repos.Sessions.Cancel(id, by, "again"); !errors.Is(err, repository.ErrInvalidState) {
+				t.Errorf("cancelling twice = %v, want ErrInvalidState", err)
+			}
+			reconcile(t, repos)
+		})
+	}
+}
+
+func TestNoShowSettlesForTheAttendee(t *testing.T) {
+	tests := []struct {
+		name        string
+		reporter    string // who showed up
+		wantRefund  float64
+		wantPayout  float64
+		wantBalance float64 // the seeker's afterwards, of 100
+	}{
+		{"seeker absent", "solver", 20, 18, 80},
+		{"solver absent", "seeker", 40, 0, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := newRepos(t)
+			solver := createUser(t, repos, "solver@example.com", "solver")
+			seeker := createUser(t, repos, "seeker@example.com", "seeker")
+			deposit(t, repos, seeker, 100)
+			reporter := seeker
+			if tt.reporter == "solver" {
+				reporter = solver
+			}
+
+			early := book(t, repos, solver, seeker, time.Hour, 0)
+			if err := repos.Sessions.Confirm(early, solver); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repos.Sessions.NoShow(early, reporter, ""); !errors.Is(err, repository.ErrTooEarly) {
+				t.Errorf("NoShow() before the start = %v, want ErrTooEarly", err)
+			}
+
+			id := book(t, repos, solver, seeker, -10*time.Minute, 40)
+			if err := repos.Sessions.Confirm(id, solver); err != nil {
+				t.Fatal(err)
+			}
+			settlement, err := repos.Sessions.NoShow(id, reporter, "nobody came")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := float64(settlement.Refund) / 100; got != tt.wantRefund {
+				t.Errorf("refund = %v, want %v", got, tt.wantRefund)
+			}
+			if got := float64(settlement.Payout) / 100; got != tt.wantPayout {
+				t.Errorf("payout = %v, want %v", got, tt.wantPayout)
+			}
+			if got := balance(t, repos, seeker); got != tt.wantBalance {
+				t.Errorf("seeker balance = %v, want %v", got, tt.wantBalance)
+			}
+			if got := sessionStatus(t, repos, id); got != models.SessionNoShow {
+				t.Errorf("status = %s, want no_show", got)
+			}
+			reconcile(t, repos)
+		})
+	}
+}
+
+func TestBookingConflicts(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+	create := func(at time.Time, minutes int) error {
+		_, err := repos.Sessions.Create(&models.Session{
+			SolverID: solver, SeekerID: seeker, Title: "Algebra", Duration: minutes, ScheduledAt: at,
+		}, seeker)
+		return err
+	}
+	if err := create(start, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want error
+	}{
+		{"same time", start, repository.ErrSlotTaken},
+		{"overlapping the end", start.Add(30 * time.Minute), repository.ErrSlotTaken},
+		{"overlapping the start", start.Add(-30 * time.Minute), repository.ErrSlotTaken},
+		{"right after", start.Add(time.Hour), nil},
+		{"right before", start.Add(-time.Hour), nil},
+	}
+	for _, tt := range tests {
+		if err := create(tt.at, 60); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Create() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Once the solver publishes availability, bookings must fall inside it
+	next := start.AddDate(0, 0, 7)
+	rule := availability.Rule{Weekday: next.Weekday(), StartMinute: 9 * 60, EndMinute: 17 * 60}
+	if err := repos.Availability.ReplaceRules(solver, []availability.Rule{rule}); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, time.UTC)
+	if err := create(day.Add(8*time.Hour), 60); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("booking before opening hours = %v, want ErrUnavailable", err)
+	}
+	if err := create(day.Add(16*time.Hour+30*time.Minute), 60); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("booking past closing time = %v, want ErrUnavailable", err)
+	}
+	if err := create(day.Add(9*time.Hour), 60); err != nil {
+		t.Errorf("booking inside opening hours = %v", err)
+	}
+}
+
+func TestRescheduleNeedsConfirmingAgain(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", models.RoleSolver)
+	seeker := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+
+	id := book(t, repos, solver, seeker, 48*time.Hour, 0)
+	if err := repos.Sessions.Confirm(id, solver); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits that leave the time alone keep the confirmation
+	if err := repos.Sessions.Update(id, seeker, map[string]interface{}{"title": "Geometry"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionStatus(t, repos, id); got != models.SessionConfirmed {
+		t.Fatalf("status after retitling = %s, want confirmed", got)
+	}
+
+	moves := []struct {
+		by, confirmer, other int
+	}{
+		{by: seeker, confirmer: solver, other: seeker},
+		{by: solver, confirmer: seeker, other: solver},
+	}
+	for i, m := range moves {
+		at := time.Now().Add(time.Duration(72+24*i) * time.Hour).UTC()
+		if err := repos.Sessions.Update(id, m.by, map[string]interface{}{"scheduled_at": at}); err != nil {
+			t.Fatal(err)
+		}
+		if got := sessionStatus(t, repos, id); got != models.SessionRequested {
+			t.Fatalf("status after rescheduling = %s, want requested", got)
+		}
+		if err := repos.Sessions.Confirm(id, m.other); !errors.Is(err, repository.ErrNotConfirmer) {
+			t.Errorf("Confirm() by whoever rescheduled = %v, want ErrNotConfirmer", err)
+		}
+		if err := repos.Sessions.Confirm(id, m.confirmer); err != nil {
+			t.Fatalf("Confirm() by the other participant = %v", err)
+		}
+	}
+
+	history, err := repos.Sessions.History(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rescheduled := 0
+	for _, h := range history {
+		if h.FromStatus == models.SessionConfirmed && h.ToStatus == models.SessionRequested {
+			rescheduled++
+		}
+	}
+	if rescheduled != 2 {
+		t.Errorf("history records %d reschedules, want 2", rescheduled)
+	}
+}
+
+func TestDeleteOnlyRequestedSessions(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", models.RoleSolver)
+	seeker := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+
+	requested := book(t, repos, solver, seeker, 48*time.Hour, 0)
+	confirmed := book(t, repos, solver, seeker, 72*time.Hour, 0)
+	if err := repos.Sessions.Confirm(confirmed, solver); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repos.Sessions.Delete(confirmed); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("Delete() of a confirmed session = %v, want ErrInvalidState", err)
+	}
+	if got := sessionStatus(t, repos, confirmed); got != models.SessionConfirmed {
+		t.Errorf("status = %s, want the confirmed session kept", got)
+	}
+	if err := repos.Sessions.Delete(requested); err != nil {
+		t.Fatalf("Delete() of a requested session = %v", err)
+	}
+	if _, err := repos.Sessions.Get(requested); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get() after deleting = %v, want ErrNotFound", err)
+	}
+	if err := repos.Sessions.Delete(requested); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting twice = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRescheduleIntoBookedSlot(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", "solver")
+	seeker := createUser(t, repos, "seeker@example.com", "seeker")
+
+	first := book(t, repos, solver, seeker, 48*time.Hour, 0)
+	second := book(t, repos, solver, seeker, 72*time.Hour, 0)
+	taken, err := repos.Sessions.Get(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.Sessions.Update(second, seeker, map[string]interface{}{"scheduled_at": taken.ScheduledAt.Add(30 * time.Minute)})
+	if !errors.Is(err, repository.ErrSlotTaken) {
+		t.Errorf("Update() = %v, want ErrSlotTaken", err)
+	}
+
+	// A session may move within its own slot
+	own, err := repos.Sessions.Get(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Sessions.Update(second, seeker, map[string]interface{}{"scheduled_at": own.ScheduledAt.Add(30 * time.Minute)}); err != nil {
+		t.Errorf("moving a session by half an hour = %v", err)
+	}
+
+	// Cancelled sessions free their slot
+	if _, err := repos.Sessions.Cancel(first, seeker, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Sessions.Update(second, seeker, map[string]interface{}{"scheduled_at": taken.ScheduledAt}); err != nil {
+		t.Errorf("moving into a cancelled session's slot = %v", err)
+	}
+}
+
+func TestLeaderboardRanksByGrantedRole(t *testing.T) {
+	repos := newRepos(t)
+	solver := createUser(t, repos, "solver@example.com", models.RoleSolver)
+	convert := createUser(t, repos, "convert@example.com", models.RoleSeeker)
+	seeker := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+
+	// A seeker who has become a solver too, though users.role still says seeker
+	if err := repos.Roles.Grant(convert, models.RoleSolver, nil); err != nil {
+		t.Fatal(err)
+	}
+	book(t, repos, solver, seeker, 24*time.Hour, 0)
+	book(t, repos, convert, seeker, 48*time.Hour, 0)
+	// The seeker solves nothing, but sessions they appear in must not rank them
+	book(t, repos, seeker, convert, 72*time.Hour, 0)
+
+	entries, err := repos.Sessions.Leaderboard(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranked := map[int]bool{}
+	for _, e := range entries {
+		ranked[e.UserID] = true
+	}
+	if !ranked[solver] || !ranked[convert] || ranked[seeker] || len(entries) != 2 {
+		t.Errorf("leaderboard = %+v, want users %d and %d only", entries, solver, convert)
+	}
+}
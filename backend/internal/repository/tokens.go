@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned for a refresh token or login session that is
+	// expired, revoked or belongs to a deactivated user
+	ErrTokenInvalid = errors.New("refresh token is no longer valid")
+	// ErrTokenReused is returned when a refresh token is presented a second
+	// time; its whole family has been revoked by then
+	ErrTokenReused = errors.New("refresh token has already been used")
+)
+
+// TokenRepo stores hashed, single-use refresh and password reset tokens
+type TokenRepo interface {
+	// IssueRefresh stores the hash of a refresh token starting or extending a family
+	IssueRefresh(userID int, familyID, tokenHash string, expiresAt time.Time) error
+	// RotateRefresh consumes a refresh token and stores its successor in the
+	// same family, returning the token's user and family. A token that was
+	// already used revokes its family and fails with ErrTokenReused.
+	RotateRefresh(tokenHash, nextHash string, expiresAt time.Time) (int, string, error)
+	// RevokeRefreshFamily revokes the family a refresh token belongs to
+	RevokeRefreshFamily(tokenHash string) error
+
+	// IssuePasswordReset stores a reset token for userID, superseding earlier
+	// ones, or fails with ErrRateLimited if one was issued less than interval ago
+	IssuePasswordReset(userID int, tokenHash string, expiresAt time.Time, interval time.Duration) error
+	// ResetPassword consumes a reset token, sets the new password hash and
+	// signs the user out everywhere, returning the user's id
+	ResetPassword(tokenHash, passwordHash string) (int, error)
+}
+
+type sqlTokenRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlTokenRepo) IssueRefresh(userID int, familyID, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, familyID, tokenHash, expiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func (r *sqlTokenRepo) RotateRefresh(tokenHash, nextHash string, expiresAt time.Time) (int, string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, userID      int
+		familyID        string
+		expires         time.Time
+		usedAt, revoked *time.Time
+		active          bool
+	)
+	err = tx.QueryRow(`
+		SELECT t.id, t.user_id, t.family_id, t.expires_at, t.used_at, t.revoked_at,
+		       COALESCE(u.is_active, TRUE)
+		FROM refresh_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?`+tx.Dialect.ForUpdate(), tokenHash).Scan(
+		&id, &userID, &familyID, &expires, &usedAt, &revoked, &active)
+	if err != nil {
+		return 0, "", notFound(err)
+	}
+
+	now := time.Now().UTC()
+	if revoked != nil || !active || !now.Before(expires) {
+		return 0, "", ErrTokenInvalid
+	}
+	if usedAt != nil {
+		// Someone is replaying a rotated token, so every token descended from
+		// the same login is presumed stolen
+		if err := revokeFamily(tx, familyID, now); err != nil {
+			return 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrTokenReused
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ?", now, id); err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, familyID, nextHash, expiresAt.UTC(), now); err != nil {
+		return 0, "", err
+	}
+
+	return userID, familyID, tx.Commit()
+}
+
+func (r *sqlTokenRepo) RevokeRefreshFamily(tokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	err = tx.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ?", tokenHash).Scan(&familyID)
+	if err != nil {
+		return notFound(err)
+	}
+	if err := revokeFamily(tx, familyID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeFamily revokes every live token of a refresh token family and the
+// login session it belongs to
+func revokeFamily(tx *database.Tx, familyID string, at time.Time) error {
+	if _, err := tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE family_id = ? AND revoked_at IS NULL`, at, familyID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE login_sessions SET revoked_at = ?
+		WHERE family_id = ? AND revoked_at IS NULL`, at, familyID)
+	return err
+}
+
+func (r *sqlTokenRepo) IssuePasswordReset(userID int, tokenHash string, expiresAt time.Time, interval time.Duration) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var recent int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE user_id = ? AND created_at > ?`, userID, now.Add(-interval)).Scan(&recent); err != nil {
+		return err
+	}
+	if recent > 0 {
+		return ErrRateLimited
+	}
+
+	// Only the latest link works
+	if _, err := tx.Exec(`
+		UPDATE password_reset_tokens SET used_at = ?
+		WHERE user_id = ? AND used_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?)`, userID, tokenHash, expiresAt.UTC(), now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTokenRepo) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, userID int
+		expires    time.Time
+		usedAt     *time.Time
+		active     bool
+	)
+	err = tx.QueryRow(`
+		SELECT t.id, t.user_id, t.expires_at, t.used_at, COALESCE(u.is_active, TRUE)
+		FROM password_reset_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?`+tx.Dialect.ForUpdate(), tokenHash).Scan(
+		&id, &userID, &expires, &usedAt, &active)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	now := time.Now().UTC()
+	if usedAt != nil || !active || !now.Before(expires) {
+		return 0, ErrTokenInvalid
+	}
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE id = ?", now, id); err != nil {
+		return 0, err
+	}
+	if err := setPassword(tx, userID, passwordHash, now); err != nil {
+		return 0, err
+	}
+	// Whoever knew the old password may be signed in somewhere
+	if _, err := revokeUserLogins(tx, userID, 0, now); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
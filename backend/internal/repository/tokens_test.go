@@ -0,0 +1,114 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	expires := time.Now().Add(time.Hour)
+
+	if err := repos.Tokens.IssueRefresh(user, "family", "first", expires); err != nil {
+		t.Fatal(err)
+	}
+	if got, family, err := repos.Tokens.RotateRefresh("first", "second", expires); err != nil || got != user || family != "family" {
+		t.Fatalf("RotateRefresh() = %d, %q, %v, want user %d in family", got, family, err, user)
+	}
+	if got, _, err := repos.Tokens.RotateRefresh("second", "third", expires); err != nil || got != user {
+		t.Fatalf("rotating the successor = %d, %v", got, err)
+	}
+
+	// Replaying a used token revokes the whole family, the live token included
+	if _, _, err := repos.Tokens.RotateRefresh("first", "stolen", expires); !errors.Is(err, repository.ErrTokenReused) {
+		t.Fatalf("replaying a used token = %v, want ErrTokenReused", err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("third", "fourth", expires); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("rotating after a replay = %v, want ErrTokenInvalid", err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("stolen", "fifth", expires); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("the replay's successor = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRefreshTokenExpiryAndLogout(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+
+	if err := repos.Tokens.IssueRefresh(user, "old", "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("expired", "next", time.Now().Add(time.Hour)); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("rotating an expired token = %v, want ErrTokenInvalid", err)
+	}
+
+	if err := repos.Tokens.IssueRefresh(user, "login", "live", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Tokens.RevokeRefreshFamily("live"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("live", "next", time.Now().Add(time.Hour)); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("rotating after logout = %v, want ErrTokenInvalid", err)
+	}
+	if err := repos.Tokens.RevokeRefreshFamily("unknown"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("logging out an unknown token = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	login := signIn(t, repos, user, "laptop")
+	expires := time.Now().Add(time.Hour)
+
+	if err := repos.Tokens.IssuePasswordReset(user, "first", expires, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Tokens.IssuePasswordReset(user, "second", expires, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Tokens.IssuePasswordReset(user, "third", expires, time.Hour); !errors.Is(err, repository.ErrRateLimited) {
+		t.Errorf("issuing within the interval = %v, want ErrRateLimited", err)
+	}
+
+	// Only the latest link works, and only once
+	if _, err := repos.Tokens.ResetPassword("first", "new-hash"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("superseded token = %v, want ErrTokenInvalid", err)
+	}
+	if got, err := repos.Tokens.ResetPassword("second", "new-hash"); err != nil || got != user {
+		t.Fatalf("ResetPassword() = %d, %v, want user %d", got, err, user)
+	}
+	if _, err := repos.Tokens.ResetPassword("second", "other-hash"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("reusing a token = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := repos.Tokens.ResetPassword("unknown", "other-hash"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("unknown token = %v, want ErrNotFound", err)
+	}
+
+	stored, err := repos.Users.GetByID(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "new-hash" {
+		t.Errorf("password = %q, want the new hash", stored.Password)
+	}
+	if err := repos.Logins.Validate(login, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("login after a reset = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+
+	if err := repos.Tokens.IssuePasswordReset(user, "expired", time.Now().Add(-time.Minute), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Tokens.ResetPassword("expired", "new-hash"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("expired token = %v, want ErrTokenInvalid", err)
+	}
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// TOTPSecret is a user's authenticator secret together with the failed
+// attempts made against it since the last success
+type TOTPSecret struct {
+	Secret         string
+	Enabled        bool
+	FailedAttempts int
+	LastFailedAt   *time.Time
+}
+
+// TwoFactorRepo stores TOTP secrets and recovery codes
+type TwoFactorRepo interface {
+	// Status reports whether a user has two-factor authentication enabled
+	// and how many unused recovery codes are left
+	Status(userID int) (*models.TwoFactorStatus, error)
+	// StartEnrollment stores a new secret awaiting confirmation, replacing any
+	// earlier pending one, or fails with ErrInvalidState if 2FA is enabled
+	StartEnrollment(userID int, secret string) error
+	// Secret returns a user's secret, pending or enabled
+	Secret(userID int) (*TOTPSecret, error)
+	// Enable confirms the pending secret with the code accepted for step and
+	// stores the first set of recovery codes
+	Enable(userID int, step int64, recoveryHashes []string) error
+	// UseStep records a code accepted for step, failing with ErrTokenReused
+	// if a code for that step or a later one was already accepted
+	UseStep(userID int, step int64) error
+	// UseRecoveryCode spends an unused recovery code, failing with
+	// ErrTokenInvalid if none matches
+	UseRecoveryCode(userID int, codeHash string) error
+	// RecordFailure counts a wrong code against the user's secret
+	RecordFailure(userID int) error
+	// ReplaceRecoveryCodes discards a user's unused recovery codes and stores
+	// a new set
+	ReplaceRecoveryCodes(userID int, recoveryHashes []string) error
+	// Disable removes a user's secret and recovery codes
+	Disable(userID int) error
+}
+
+type sqlTwoFactorRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlTwoFactorRepo) Status(userID int) (*models.TwoFactorStatus, error) {
+	status := &models.TwoFactorStatus{}
+	err := r.db.QueryRow(`
+		SELECT enabled_at FROM user_totp
+		WHERE user_id = ? AND enabled_at IS NOT NULL`, userID).Scan(&status.EnabledAt)
+	if err := notFound(err); errors.Is(err, ErrNotFound) {
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
+	status.Enabled = true
+
+	err = r.db.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes
+		WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&status.RecoveryCodesLeft)
+	return status, err
+}
+
+func (r *sqlTwoFactorRepo) StartEnrollment(userID int, secret string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var enabled int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM user_totp
+		WHERE user_id = ? AND enabled_at IS NOT NULL`, userID).Scan(&enabled); err != nil {
+		return err
+	}
+	if enabled > 0 {
+		return ErrInvalidState
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_totp (user_id, secret, created_at)
+		VALUES (?, ?, ?)`, userID, secret, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTwoFactorRepo) Secret(userID int) (*TOTPSecret, error) {
+	var (
+		s         TOTPSecret
+		enabledAt *time.Time
+	)
+	err := r.db.QueryRow(`
+		SELECT secret, enabled_at, failed_attempts, last_failed_at
+		FROM user_totp WHERE user_id = ?`, userID).Scan(
+		&s.Secret, &enabledAt, &s.FailedAttempts, &s.LastFailedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.Enabled = enabledAt != nil
+	return &s, nil
+}
+
+func (r *sqlTwoFactorRepo) Enable(userID int, step int64, recoveryHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		UPDATE user_totp
+		SET enabled_at = ?, last_step = ?, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = ? AND enabled_at IS NULL`, now, step, userID)
+	if err := expectRow(result, err); errors.Is(err, ErrNotFound) {
+		return ErrInvalidState
+	} else if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTwoFactorRepo) UseStep(userID int, step int64) error {
+	// The guard on last_step makes check-and-set one statement, so two
+	// requests racing with the same code cannot both succeed
+	result, err := r.db.Exec(`
+		UPDATE user_totp SET last_step = ?, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = ? AND enabled_at IS NOT NULL AND last_step < ?`, step, userID, step)
+	if err := expectRow(result, err); errors.Is(err, ErrNotFound) {
+		return ErrTokenReused
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *sqlTwoFactorRepo) UseRecoveryCode(userID int, codeHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, now, userID, codeHash)
+	if err := expectRow(result, err); errors.Is(err, ErrNotFound) {
+		return ErrTokenInvalid
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE user_totp SET failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTwoFactorRepo) RecordFailure(userID int) error {
+	_, err := r.db.Exec(`
+		UPDATE user_totp SET failed_attempts = failed_attempts + 1, last_failed_at = ?
+		WHERE user_id = ?`, time.Now().UTC(), userID)
+	return err
+}
+
+func (r *sqlTwoFactorRepo) ReplaceRecoveryCodes(userID int, recoveryHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTwoFactorRepo) Disable(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err := expectRow(result, err); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes a user's unused recovery codes and inserts
+// new ones; spent codes are kept as a record of when they were used
+func replaceRecoveryCodes(tx *database.Tx, userID int, hashes []string, at time.Time) error {
+	if _, err := tx.Exec(`
+		DELETE FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash, created_at)
+			VALUES (?, ?, ?)`, userID, hash, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/repository"
+	"testing"
+)
+
+// enableTwoFactor enrolls userID with the given recovery code hashes,
+// accepting a first code at step 100
+func enableTwoFactor(t *testing.T, repos *repository.Repositories, userID int, recoveryHashes ...string) {
+	t.Helper()
+	if err := repos.TwoFactor.StartEnrollment(userID, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(userID, 100, recoveryHashes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+
+	if err := repos.TwoFactor.StartEnrollment(user, "PENDING"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := repos.TwoFactor.Status(user); err != nil || status.Enabled {
+		t.Fatalf("Status() while pending = %+v, %v, want disabled", status, err)
+	}
+	if secret, err := repos.TwoFactor.Secret(user); err != nil || secret.Enabled || secret.Secret != "PENDING" {
+		t.Fatalf("Secret() while pending = %+v, %v", secret, err)
+	}
+
+	if err := repos.TwoFactor.Enable(user, 100, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(user, 101, nil); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("enabling twice = %v, want ErrInvalidState", err)
+	}
+	if err := repos.TwoFactor.StartEnrollment(user, "OTHER"); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("enrolling while enabled = %v, want ErrInvalidState", err)
+	}
+	if status, err := repos.TwoFactor.Status(user); err != nil || !status.Enabled || status.RecoveryCodesLeft != 2 {
+		t.Errorf("Status() = %+v, %v, want enabled with 2 codes", status, err)
+	}
+
+	if err := repos.TwoFactor.Disable(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.TwoFactor.Secret(user); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Secret() after disabling = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTOTPStepsAreSingleUse(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	enableTwoFactor(t, repos, user)
+
+	// Enabling used step 100, so neither it nor an earlier step works again
+	for _, step := range []int64{99, 100} {
+		if err := repos.TwoFactor.UseStep(user, step); !errors.Is(err, repository.ErrTokenReused) {
+			t.Errorf("UseStep(%d) = %v, want ErrTokenReused", step, err)
+		}
+	}
+	if err := repos.TwoFactor.UseStep(user, 101); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.UseStep(user, 101); !errors.Is(err, repository.ErrTokenReused) {
+		t.Errorf("replaying step 101 = %v, want ErrTokenReused", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	other := createUser(t, repos, "other@example.com", "seeker")
+	enableTwoFactor(t, repos, user, "first", "second")
+	enableTwoFactor(t, repos, other, "theirs")
+
+	if err := repos.TwoFactor.RecordFailure(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(user, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(user, "first"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("reusing a recovery code = %v, want ErrTokenInvalid", err)
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(user, "theirs"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("someone else's recovery code = %v, want ErrTokenInvalid", err)
+	}
+
+	// A good code clears the failures counted against the secret
+	secret, err := repos.TwoFactor.Secret(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.FailedAttempts != 0 {
+		t.Errorf("FailedAttempts = %d after a good code, want 0", secret.FailedAttempts)
+	}
+
+	// New codes replace the unused ones
+	if err := repos.TwoFactor.ReplaceRecoveryCodes(user, []string{"third"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(user, "second"); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("a replaced recovery code = %v, want ErrTokenInvalid", err)
+	}
+	if status, err := repos.TwoFactor.Status(user); err != nil || status.RecoveryCodesLeft != 1 {
+		t.Errorf("Status() = %+v, %v, want 1 code left", status, err)
+	}
+}
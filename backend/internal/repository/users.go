@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"errors"
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// UserRepo stores user accounts and their extended profiles
+type UserRepo interface {
+	// EmailExists reports whether an account already uses email
+	EmailExists(email string) (bool, error)
+	// Create inserts a user together with an empty profile and wallet
+	Create(user *models.User) (int, error)
+	// GetByID returns the full user record
+	GetByID(id int) (*models.User, error)
+	// GetByEmail returns the user including the password hash
+	GetByEmail(email string) (*models.User, error)
+	// UpdateProfile updates the editable personal fields; an empty time zone
+	// or locale keeps the current one, and changing the phone number clears
+	// its verification
+	UpdateProfile(id int, user *models.User) error
+	// GetProfile returns the extended profile of a user
+	GetProfile(userID int) (*models.UserProfile, error)
+	// Location returns the time zone a user has chosen
+	Location(id int) (*time.Location, error)
+	// SetActive activates or deactivates an account; deactivation signs the
+	// user out of every device
+	SetActive(id int, active bool) error
+	// MarkEmailVerified marks the user's email verified, provided it is still
+	// email, and recomputes their verification level
+	MarkEmailVerified(id int, email string) error
+	// ClaimVerificationEmail records that a verification email is being sent,
+	// failing with ErrRateLimited if the last one went out less than interval ago
+	ClaimVerificationEmail(id int, interval time.Duration) error
+	// ChangePassword sets a new password hash and signs the user out of every
+	// login session except keepSession
+	ChangePassword(id int, passwordHash string, keepSession int) error
+	// RecordLoginFailure counts a failed sign-in against the account and
+	// returns how many have failed since the last success
+	RecordLoginFailure(id int) (int, error)
+	// LockLogin refuses sign-ins to the account until until
+	LockLogin(id int, until time.Time) error
+	// ClearLoginFailures resets the failure count and lifts any lock
+	ClearLoginFailures(id int) error
+}
+
+type sqlUserRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlUserRepo) EmailExists(email string) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&count)
+	return count > 0, err
+}
+
+func (r *sqlUserRepo) Create(user *models.User) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := createUser(tx, user)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// createUser inserts a user holding their primary role, together with an
+// empty profile and wallet, inside tx
+func createUser(tx *database.Tx, user *models.User) (int, error) {
+	now := time.Now().UTC()
+	userID, err := tx.InsertID(`
+		INSERT INTO users (email, password, first_name, last_name, role, timezone, locale,
+		                   is_email_verified, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.Email, user.Password, user.FirstName, user.LastName, user.Role,
+		orDefault(user.Timezone, "UTC"), orDefault(user.Locale, "en"), user.IsEmailVerified, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_roles (user_id, role, created_at)
+		VALUES (?, ?, ?)`,
+		userID, user.Role, now); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_profiles (user_id, created_at, updated_at)
+		VALUES (?, ?, ?)`,
+		userID, now, now); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO wallets (user_id, created_at, updated_at)
+		VALUES (?, ?, ?)`,
+		userID, now, now); err != nil {
+		return 0, err
+	}
+	return int(userID), nil
+}
+
+const selectUser = `
+	SELECT id, email, password,
+	       COALESCE(first_name, '') as first_name,
+	       COALESCE(last_name, '') as last_name,
+	       COALESCE(country, '') as country,
+	       COALESCE(city, '') as city,
+	       COALESCE(gender, '') as gender,
+	       date_of_birth,
+	       COALESCE(profile_pic, '') as profile_pic,
+	       COALESCE(bio, '') as bio,
+	       COALESCE(phone, '') as phone,
+	       COALESCE(is_email_verified, FALSE) as is_email_verified,
+	       COALESCE(is_phone_verified, FALSE) as is_phone_verified,
+	       COALESCE(verification_level, 'light') as verification_level,
+	       COALESCE(is_active, TRUE) as is_active, locked_until, password <> '' as has_password,
+	       EXISTS (SELECT 1 FROM user_totp t
+	               WHERE t.user_id = users.id AND t.enabled_at IS NOT NULL) as two_factor_enabled,
+	       role, COALESCE(timezone, 'UTC'), COALESCE(locale, 'en'), created_at, updated_at
+	FROM users`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Password, &user.FirstName, &user.LastName,
+		&user.Country, &user.City, &user.Gender, &user.DateOfBirth, &user.ProfilePic,
+		&user.Bio, &user.Phone, &user.IsEmailVerified, &user.IsPhoneVerified,
+		&user.VerificationLevel, &user.IsActive, &user.LockedUntil, &user.HasPassword, &user.TwoFactorEnabled,
+		&user.Role, &user.Timezone, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *sqlUserRepo) GetByID(id int) (*models.User, error) {
+	return r.getWithRoles(scanUser(r.db.QueryRow(selectUser+" WHERE id = ?", id)))
+}
+
+func (r *sqlUserRepo) GetByEmail(email string) (*models.User, error) {
+	return r.getWithRoles(scanUser(r.db.QueryRow(selectUser+" WHERE email = ?", email)))
+}
+
+// getWithRoles fills in the roles of a user just loaded
+func (r *sqlUserRepo) getWithRoles(user *models.User, err error) (*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	if user.Roles, err = userRoles(r.db, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *sqlUserRepo) UpdateProfile(id int, user *models.User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A new phone number has to be verified again, and a level that rested
+	// on the old one drops back
+	if _, err := tx.Exec(`
+		UPDATE users SET first_name = ?, last_name = ?, country = ?, city = ?,
+		               gender = ?, date_of_birth = ?, bio = ?, phone = ?,
+		               is_phone_verified = CASE WHEN COALESCE(phone, '') = ? THEN is_phone_verified
+		                                        ELSE FALSE END,
+		               timezone = COALESCE(NULLIF(?, ''), timezone),
+		               locale = COALESCE(NULLIF(?, ''), locale), updated_at = ?
+		WHERE id = ?`,
+		user.FirstName, user.LastName, user.Country, user.City, user.Gender,
+		user.DateOfBirth, user.Bio, user.Phone, user.Phone,
+		user.Timezone, user.Locale, time.Now().UTC(), id); err != nil {
+		return err
+	}
+	if err := refreshVerificationLevel(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlUserRepo) GetProfile(userID int) (*models.UserProfile, error) {
+	var profile models.UserProfile
+	err := r.db.QueryRow(`
+		SELECT user_id, COALESCE(languages, '[]'), COALESCE(skills, '[]'),
+		       COALESCE(experience, '[]'), COALESCE(achievements, '[]'),
+		       COALESCE(projects, '[]'), COALESCE(bank_account, ''),
+		       profile_complete, followers, following, COALESCE(interests, '[]'),
+		       created_at, updated_at
+		FROM user_profiles WHERE user_id = ?`, userID).Scan(
+		&profile.UserID, &profile.Languages, &profile.Skills, &profile.Experience,
+		&profile.Achievements, &profile.Projects, &profile.BankAccount,
+		&profile.ProfileComplete, &profile.Followers, &profile.Following,
+		&profile.Interests, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &profile, nil
+}
+
+func (r *sqlUserRepo) Location(id int) (*time.Location, error) {
+	return userLocation(r.db, id)
+}
+
+// userLocation loads a user's time zone, falling back to UTC for names the
+// running binary does not know
+func userLocation(q querier, id int) (*time.Location, error) {
+	var name string
+	if err := q.QueryRow("SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = ?", id).Scan(&name); err != nil {
+		return nil, notFound(err)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func (r *sqlUserRepo) SetActive(id int, active bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if err := expectRow(tx.Exec("UPDATE users SET is_active = ?, updated_at = ? WHERE id = ?",
+		active, now, id)); err != nil {
+		return err
+	}
+	if !active {
+		if _, err := revokeUserLogins(tx, id, 0, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlUserRepo) MarkEmailVerified(id int, email string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := expectRow(tx.Exec(`
+		UPDATE users SET is_email_verified = TRUE, updated_at = ?
+		WHERE id = ? AND email = ?`, time.Now().UTC(), id, email)); err != nil {
+		return err
+	}
+	if err := refreshVerificationLevel(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlUserRepo) ClaimVerificationEmail(id int, interval time.Duration) error {
+	now := time.Now().UTC()
+	err := expectRow(r.db.Exec(`
+		UPDATE users SET email_verification_sent_at = ?
+		WHERE id = ? AND (email_verification_sent_at IS NULL OR email_verification_sent_at < ?)`,
+		now, id, now.Add(-interval)))
+	if errors.Is(err, ErrNotFound) {
+		return ErrRateLimited
+	}
+	return err
+}
+
+func (r *sqlUserRepo) ChangePassword(id int, passwordHash string, keepSession int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if err := setPassword(tx, id, passwordHash, now); err != nil {
+		return err
+	}
+	if _, err := revokeUserLogins(tx, id, keepSession, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setPassword stores a new password hash for a user inside tx
+func setPassword(tx *database.Tx, id int, passwordHash string, at time.Time) error {
+	// A new password also lifts any lockout from failed sign-ins
+	return expectRow(tx.Exec(`
+		UPDATE users SET password = ?, failed_login_count = 0, locked_until = NULL, updated_at = ?
+		WHERE id = ?`, passwordHash, at, id))
+}
+
+func (r *sqlUserRepo) RecordLoginFailure(id int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := expectRow(tx.Exec(
+		"UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = ?", id)); err != nil {
+		return 0, err
+	}
+	var failures int
+	if err := tx.QueryRow("SELECT failed_login_count FROM users WHERE id = ?", id).Scan(&failures); err != nil {
+		return 0, err
+	}
+	return failures, tx.Commit()
+}
+
+func (r *sqlUserRepo) LockLogin(id int, until time.Time) error {
+	return expectRow(r.db.Exec("UPDATE users SET locked_until = ? WHERE id = ?", until.UTC(), id))
+}
+
+func (r *sqlUserRepo) ClearLoginFailures(id int) error {
+	return expectRow(r.db.Exec(
+		"UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = ?", id))
+}
@@ -0,0 +1,92 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+
+	if err := repos.Users.ClaimVerificationEmail(user, time.Hour); err != nil {
+		t.Fatalf("first claim: %v", err)
+	}
+	if err := repos.Users.ClaimVerificationEmail(user, time.Hour); !errors.Is(err, repository.ErrRateLimited) {
+		t.Errorf("second claim within the interval = %v, want ErrRateLimited", err)
+	}
+
+	// A link for an address the account no longer has is refused
+	if err := repos.Users.MarkEmailVerified(user, "old@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("verifying a stale address = %v, want ErrNotFound", err)
+	}
+	if err := repos.Users.MarkEmailVerified(user, "seeker@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repos.Users.GetByID(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsEmailVerified {
+		t.Error("IsEmailVerified = false after verifying")
+	}
+}
+
+func TestChangePasswordKeepsCurrentSession(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+	laptop := signIn(t, repos, user, "laptop")
+	phone := signIn(t, repos, user, "phone")
+
+	if err := repos.Users.ChangePassword(user, "new-hash", laptop); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Logins.Validate(laptop, user, ""); err != nil {
+		t.Errorf("the session that changed the password = %v, want valid", err)
+	}
+	if err := repos.Logins.Validate(phone, user, ""); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("another session = %v, want ErrTokenInvalid", err)
+	}
+	if _, _, err := repos.Tokens.RotateRefresh("phone-token", "next", time.Now().Add(time.Hour)); !errors.Is(err, repository.ErrTokenInvalid) {
+		t.Errorf("refreshing another session = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", "seeker")
+
+	for want := 1; want <= 3; want++ {
+		if got, err := repos.Users.RecordLoginFailure(user); err != nil || got != want {
+			t.Fatalf("RecordLoginFailure() = %d, %v, want %d", got, err, want)
+		}
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := repos.Users.LockLogin(user, until); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repos.Users.GetByID(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LockedUntil == nil || !got.LockedUntil.Equal(until) {
+		t.Errorf("LockedUntil = %v, want %v", got.LockedUntil, until)
+	}
+
+	// A password reset lifts the lock and starts the count again
+	if err := repos.Users.ChangePassword(user, "new-hash", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repos.Users.GetByID(user); err != nil || got.LockedUntil != nil {
+		t.Errorf("LockedUntil after a new password = %v, %v", got.LockedUntil, err)
+	}
+	if got, err := repos.Users.RecordLoginFailure(user); err != nil || got != 1 {
+		t.Errorf("RecordLoginFailure() after a new password = %d, %v, want 1", got, err)
+	}
+
+	if err := repos.Users.ClearLoginFailures(user + 100); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ClearLoginFailures() for an unknown user = %v, want ErrNotFound", err)
+	}
+}
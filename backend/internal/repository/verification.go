@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/models"
+	"synapmentor/internal/policy"
+	"time"
+)
+
+// IDDocumentRepo stores the ID documents users upload to be verified
+type IDDocumentRepo interface {
+	// SubmitDocument stores an uploaded document for review, failing with
+	// ErrInvalidState while the user has one pending or approved
+	SubmitDocument(doc *models.IdentityDocument) (int, error)
+	// Documents returns a user's documents, newest first
+	Documents(userID int) ([]models.IdentityDocument, error)
+	// ListDocuments returns documents in status, oldest first, for review
+	ListDocuments(status string, limit, offset int) ([]models.IdentityDocument, error)
+	// GetDocument returns a document by id
+	GetDocument(id int) (*models.IdentityDocument, error)
+	// ReviewDocument approves or rejects a pending document and recomputes its
+	// user's verification level. It fails with ErrInvalidState if the
+	// document has been reviewed already.
+	ReviewDocument(id, reviewerID int, approve bool, reason string) error
+}
+
+type sqlIDDocumentRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlIDDocumentRepo) SubmitDocument(doc *models.IdentityDocument) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var open int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM identity_documents
+		WHERE user_id = ? AND status IN (?, ?)`,
+		doc.UserID, models.DocumentPending, models.DocumentApproved).Scan(&open); err != nil {
+		return 0, err
+	}
+	if open > 0 {
+		return 0, ErrInvalidState
+	}
+
+	now := time.Now().UTC()
+	id, err := tx.InsertID(`
+		INSERT INTO identity_documents (user_id, document_type, file_key, file_name, content_type,
+		                                size, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.UserID, doc.DocumentType, doc.FileKey, doc.FileName, doc.ContentType, doc.Size,
+		models.DocumentPending, now)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	doc.ID, doc.Status, doc.CreatedAt = int(id), models.DocumentPending, now
+	return doc.ID, nil
+}
+
+const selectIdentityDocument = `
+	SELECT d.id, d.user_id, u.email, d.document_type, d.file_key, COALESCE(d.file_name, ''),
+	       d.content_type, d.size, d.status, COALESCE(d.rejection_reason, ''),
+	       d.reviewed_by, d.reviewed_at, d.created_at
+	FROM identity_documents d
+	JOIN users u ON u.id = d.user_id`
+
+func scanIdentityDocument(row rowScanner) (*models.IdentityDocument, error) {
+	var d models.IdentityDocument
+	if err := row.Scan(&d.ID, &d.UserID, &d.UserEmail, &d.DocumentType, &d.FileKey, &d.FileName,
+		&d.ContentType, &d.Size, &d.Status, &d.RejectionReason, &d.ReviewedBy, &d.ReviewedAt,
+		&d.CreatedAt); err != nil {
+		return nil, notFound(err)
+	}
+	return &d, nil
+}
+
+func (r *sqlIDDocumentRepo) listDocuments(query string, args ...interface{}) ([]models.IdentityDocument, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.IdentityDocument
+	for rows.Next() {
+		d, err := scanIdentityDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *d)
+	}
+	return docs, rows.Err()
+}
+
+func (r *sqlIDDocumentRepo) Documents(userID int) ([]models.IdentityDocument, error) {
+	return r.listDocuments(selectIdentityDocument+`
+		WHERE d.user_id = ? ORDER BY d.created_at DESC, d.id DESC`, userID)
+}
+
+func (r *sqlIDDocumentRepo) ListDocuments(status string, limit, offset int) ([]models.IdentityDocument, error) {
+	return r.listDocuments(selectIdentityDocument+`
+		WHERE d.status = ? ORDER BY d.created_at, d.id LIMIT ? OFFSET ?`, status, limit, offset)
+}
+
+func (r *sqlIDDocumentRepo) GetDocument(id int) (*models.IdentityDocument, error) {
+	return scanIdentityDocument(r.db.QueryRow(selectIdentityDocument+" WHERE d.id = ?", id))
+}
+
+func (r *sqlIDDocumentRepo) ReviewDocument(id, reviewerID int, approve bool, reason string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID int
+		status string
+	)
+	if err := tx.QueryRow("SELECT user_id, status FROM identity_documents WHERE id = ?"+tx.Dialect.ForUpdate(),
+		id).Scan(&userID, &status); err != nil {
+		return notFound(err)
+	}
+	if status != models.DocumentPending {
+		return ErrInvalidState
+	}
+
+	status = models.DocumentRejected
+	if approve {
+		status, reason = models.DocumentApproved, ""
+	}
+	if _, err := tx.Exec(`
+		UPDATE identity_documents
+		SET status = ?, rejection_reason = NULLIF(?, ''), reviewed_by = ?, reviewed_at = ?
+		WHERE id = ?`, status, reason, reviewerID, time.Now().UTC(), id); err != nil {
+		return err
+	}
+	if err := refreshVerificationLevel(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refreshVerificationLevel recomputes a user's stored verification level
+// inside tx after something it depends on has changed
+func refreshVerificationLevel(tx *database.Tx, userID int) error {
+	var f policy.Facts
+	if err := tx.QueryRow(`
+		SELECT COALESCE(is_email_verified, FALSE), COALESCE(is_phone_verified, FALSE),
+		       EXISTS (SELECT 1 FROM identity_documents d
+		               WHERE d.user_id = users.id AND d.status = ?)
+		FROM users WHERE id = ?`, models.DocumentApproved, userID).Scan(
+		&f.EmailVerified, &f.PhoneVerified, &f.IdentityVerified); err != nil {
+		return notFound(err)
+	}
+	_, err := tx.Exec("UPDATE users SET verification_level = ? WHERE id = ?", policy.Level(f), userID)
+	return err
+}
@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/models"
+	"synapmentor/internal/repository"
+	"testing"
+)
+
+func submitDocument(t *testing.T, repos *repository.Repositories, userID int) int {
+	t.Helper()
+	id, err := repos.IDDocuments.SubmitDocument(&models.IdentityDocument{
+		UserID:       userID,
+		DocumentType: "passport",
+		FileKey:      "key",
+		FileName:     "passport.png",
+		ContentType:  "image/png",
+		Size:         1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func verificationLevel(t *testing.T, repos *repository.Repositories, userID int) string {
+	t.Helper()
+	user, err := repos.Users.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.VerificationLevel
+}
+
+func TestIDDocumentReview(t *testing.T) {
+	repos := newRepos(t)
+	user := createUser(t, repos, "seeker@example.com", models.RoleSeeker)
+	reviewer := createUser(t, repos, "admin@example.com", models.RoleAdmin)
+
+	rejected := submitDocument(t, repos, user)
+	if _, err := repos.IDDocuments.SubmitDocument(&models.IdentityDocument{UserID: user, DocumentType: "passport",
+		FileKey: "other", ContentType: "image/png"}); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("a second pending document = %v, want ErrInvalidState", err)
+	}
+	if err := repos.IDDocuments.ReviewDocument(rejected, reviewer, false, "blurry"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.IDDocuments.ReviewDocument(rejected, reviewer, true, ""); !errors.Is(err, repository.ErrInvalidState) {
+		t.Errorf("reviewing twice = %v, want ErrInvalidState", err)
+	}
+	doc, err := repos.IDDocuments.GetDocument(rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Status != models.DocumentRejected || doc.RejectionReason != "blurry" || doc.ReviewedBy == nil || *doc.ReviewedBy != reviewer {
+		t.Errorf("rejected document = %+v", doc)
+	}
+
+	// An approved ID alone is not enough; it tops up email and phone
+	approved := submitDocument(t, repos, user)
+	if err := repos.IDDocuments.ReviewDocument(approved, reviewer, true, "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if level := verificationLevel(t, repos, user); level != models.VerificationLight {
+		t.Errorf("level with only an ID = %q, want light", level)
+	}
+	if err := repos.Users.MarkEmailVerified(user, "seeker@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	verifyPhone(t, repos, user, "+14155550123")
+	if level := verificationLevel(t, repos, user); level != models.VerificationFull {
+		t.Errorf("level with email, phone and ID = %q, want full", level)
+	}
+
+	docs, err := repos.IDDocuments.Documents(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].ID != approved || docs[0].RejectionReason != "" {
+		t.Errorf("Documents() = %+v, want the approved document first", docs)
+	}
+	if pending, err := repos.IDDocuments.ListDocuments(models.DocumentPending, 10, 0); err != nil || len(pending) != 0 {
+		t.Errorf("pending documents = %v, %v", pending, err)
+	}
+}
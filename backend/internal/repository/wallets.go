@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"synapmentor/internal/database"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/models"
+	"time"
+)
+
+// WalletRepo stores wallets and their transaction history
+type WalletRepo interface {
+	// GetByUserID returns the wallet owned by a user
+	GetByUserID(userID int) (*models.Wallet, error)
+	// ListTransactions returns a wallet's transactions, newest first
+	ListTransactions(walletID, limit, offset int) ([]models.Transaction, error)
+	// Transfer deposits into or withdraws from a user's wallet, posting the
+	// ledger entry and the visible transaction in one database transaction
+	Transfer(userID int, transferType string, amount float64, description string) (float64, error)
+}
+
+type sqlWalletRepo struct {
+	db *database.Conn
+}
+
+func (r *sqlWalletRepo) GetByUserID(userID int) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.db.QueryRow(`
+		SELECT id, user_id, balance, currency, created_at, updated_at
+		FROM wallets WHERE user_id = ?`, userID).Scan(
+		&wallet.ID, &wallet.UserID, &wallet.Balance, &wallet.Currency,
+		&wallet.CreatedAt, &wallet.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &wallet, nil
+}
+
+func (r *sqlWalletRepo) ListTransactions(walletID, limit, offset int) ([]models.Transaction, error) {
+	rows, err := r.db.Query(`
+		SELECT id, wallet_id, session_id, event_id, type, amount, COALESCE(description, ''), status,
+		       journal_entry_id, created_at
+		FROM transactions WHERE wallet_id = ?
+		ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		walletID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		var transaction models.Transaction
+		err := rows.Scan(&transaction.ID, &transaction.WalletID, &transaction.SessionID,
+			&transaction.EventID, &transaction.Type, &transaction.Amount, &transaction.Description,
+			&transaction.Status, &transaction.JournalEntryID, &transaction.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, rows.Err()
+}
+
+func (r *sqlWalletRepo) Transfer(userID int, transferType string, amount float64, description string) (float64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var walletID int
+	if err := tx.QueryRow("SELECT id FROM wallets WHERE user_id = ?", userID).Scan(&walletID); err != nil {
+		return 0, notFound(err)
+	}
+	if err := ledger.LockWallet(tx, walletID); err != nil {
+		return 0, err
+	}
+
+	walletAccount, err := ledger.WalletAccount(tx, walletID)
+	if err != nil {
+		return 0, err
+	}
+	externalAccount, err := ledger.SystemAccount(tx, ledger.AccountExternal)
+	if err != nil {
+		return 0, err
+	}
+
+	cents := ledger.ToCents(amount)
+	if transferType == "withdraw" {
+		cents = -cents
+	}
+
+	entryID, err := ledger.Post(tx, ledger.Entry{
+		Kind:        transferType,
+		Description: description,
+		Postings: []ledger.Posting{
+			{AccountID: walletAccount, Amount: cents},
+			{AccountID: externalAccount, Amount: -cents},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO transactions (wallet_id, type, amount, description, status, journal_entry_id, created_at)
+		VALUES (?, ?, ?, ?, 'completed', ?, ?)`,
+		walletID, transferType, amount, description, entryID, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM wallets WHERE id = ?", walletID).Scan(&balance); err != nil {
+		return 0, err
+	}
+
+	return balance, tx.Commit()
+}
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"errors"
+	"synapmentor/internal/ledger"
+	"synapmentor/internal/repository"
+	"testing"
+)
+
+func TestWalletTransfers(t *testing.T) {
+	repos := newRepos(t)
+	userID := createUser(t, repos, "saver@example.com", "seeker")
+
+	tests := []struct {
+		transferType string
+		amount       float64
+		wantBalance  float64
+		wantErr      error
+	}{
+		{"deposit", 100, 100, nil},
+		{"withdraw", 30.25, 69.75, nil},
+		{"withdraw", 70, 69.75, ledger.ErrInsufficientFunds},
+		{"deposit", 0.1, 69.85, nil},
+	}
+	for _, tt := range tests {
+		got, err := repos.Wallets.Transfer(userID, tt.transferType, tt.amount, "test")
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s %v: err = %v, want %v", tt.transferType, tt.amount, err, tt.wantErr)
+		}
+		if err == nil && got != tt.wantBalance {
+			t.Errorf("%s %v: balance = %v, want %v", tt.transferType, tt.amount, got, tt.wantBalance)
+		}
+		if b := balance(t, repos, userID); b != tt.wantBalance {
+			t.Errorf("%s %v: stored balance = %v, want %v", tt.transferType, tt.amount, b, tt.wantBalance)
+		}
+	}
+
+	wallet, err := repos.Wallets.GetByUserID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := repos.Wallets.ListTransactions(wallet.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 3 {
+		t.Errorf("%d transactions listed, want the 3 that went through", len(transactions))
+	}
+	reconcile(t, repos)
+
+	if _, err := repos.Wallets.Transfer(userID+100, "deposit", 1, "test"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Transfer() for a user without a wallet = %v, want ErrNotFound", err)
+	}
+}
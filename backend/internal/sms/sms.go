@@ -0,0 +1,102 @@
+// Package sms sends text messages through Twilio, or into the log when
+// running locally
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a text message to a phone number in E.164 form
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers text messages
+type Sender interface {
+	Send(msg Message) error
+}
+
+// FromEnv builds the sender selected by SMS_TRANSPORT: twilio
+// (TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, TWILIO_FROM) or log, the default
+func FromEnv() (Sender, error) {
+	switch transport := os.Getenv("SMS_TRANSPORT"); transport {
+	case "twilio":
+		s := &TwilioSender{
+			AccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+			AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+			From:       os.Getenv("TWILIO_FROM"),
+			HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		}
+		if s.AccountSID == "" || s.AuthToken == "" || s.From == "" {
+			return nil, fmt.Errorf("SMS_TRANSPORT=twilio requires TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM")
+		}
+		return s, nil
+	case "", "log":
+		return LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS_TRANSPORT %q", transport)
+	}
+}
+
+// TwilioSender delivers through Twilio's Messages API
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string // a Twilio number or messaging service SID
+	HTTPClient *http.Client
+}
+
+func (s *TwilioSender) Send(msg Message) error {
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("Body", msg.Body)
+	if strings.HasPrefix(s.From, "MG") {
+		form.Set("MessagingServiceSid", s.From)
+	} else {
+		form.Set("From", s.From)
+	}
+
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + url.PathEscape(s.AccountSID) + "/Messages.json"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio: %s (code %d)", apiErr.Message, apiErr.Code)
+		}
+		return fmt.Errorf("twilio: %s", resp.Status)
+	}
+	return nil
+}
+
+// LogSender prints messages to the server log instead of sending them
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("sms to %s: %s", msg.To, msg.Body)
+	return nil
+}
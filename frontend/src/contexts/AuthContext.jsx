@@ -112,7 +112,12 @@ export const AuthProvider = ({ children }) => {
   }
 
   const logout = () => {
+    const storedRefreshToken = localStorage.getItem('refreshToken')
+    if (storedRefreshToken) {
+      axios.post('/logout', { refresh_token: storedRefreshToken }).catch(() => {})
+    }
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     setToken(null)
     setUser(null)
     delete axios.defaults.headers.common['Authorization']
@@ -136,9 +141,13 @@ export const AuthProvider = ({ children }) => {
 
   const refreshToken = async () => {
     try {
-      const response = await axios.post('/refresh-token')
+      // Refresh tokens are single-use, so store the rotated one straight away
+      const response = await axios.post('/refresh-token', {
+        refresh_token: localStorage.getItem('refreshToken')
+      })
       const newToken = response.data.token
       localStorage.setItem('token', newToken)
+      localStorage.setItem('refreshToken', response.data.refresh_token)
       setToken(newToken)
       return true
     } catch (error) {